@@ -0,0 +1,205 @@
+package analytics
+
+import (
+	"context"
+	"sort"
+	"time"
+	"weezel/budget/db"
+	"weezel/budget/dbengine"
+)
+
+// monthsOfHistory is the amount of months needed before the inspected month
+// so that year-over-year delta and 12 month rolling average can be computed.
+const monthsOfHistory = 12
+
+// Delta is a change between two values. Relative change is valid only when
+// the value it is compared against is non-zero.
+type Delta struct {
+	Abs      float64 `json:"abs"`
+	Pct      float64 `json:"pct"`
+	PctValid bool    `json:"pct_valid"`
+}
+
+// Trend describes how spending of a single category or a user developed.
+type Trend struct {
+	Name      string  `json:"name"`
+	Value     float64 `json:"value"`
+	MoM       Delta   `json:"mom"`
+	YoY       Delta   `json:"yoy"`
+	Rolling3  float64 `json:"rolling3"`
+	Rolling12 float64 `json:"rolling12"`
+}
+
+// SavingsRate is the share of salaries that was left unspent during the month.
+type SavingsRate struct {
+	Month    time.Time `json:"month"`
+	Salaries float64   `json:"salaries"`
+	Expenses float64   `json:"expenses"`
+	Savings  float64   `json:"savings"`
+	Rate     float64   `json:"rate"`
+}
+
+type Report struct {
+	Month      time.Time     `json:"month"`
+	Categories []Trend       `json:"categories"`
+	Users      []Trend       `json:"users"`
+	Savings    []SavingsRate `json:"savings"`
+}
+
+func firstOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// months returns consecutive months ending to the given month, oldest first.
+func months(month time.Time, count int) []time.Time {
+	out := make([]time.Time, count)
+	for i := 0; i < count; i++ {
+		out[i] = month.AddDate(0, i-count+1, 0)
+	}
+	return out
+}
+
+func delta(current, previous float64) Delta {
+	d := Delta{Abs: current - previous}
+	if previous != 0 {
+		d.Pct = d.Abs / previous
+		d.PctValid = true
+	}
+	return d
+}
+
+func average(values []float64) float64 {
+	if len(values) == 0 {
+		return 0.0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// ComputeTrend computes deltas and rolling averages for the last value in series.
+// Series must be monthly values without gaps, oldest first.
+func ComputeTrend(name string, series []float64) Trend {
+	if len(series) == 0 {
+		return Trend{Name: name}
+	}
+
+	last := len(series) - 1
+	trend := Trend{
+		Name:  name,
+		Value: series[last],
+	}
+	if last >= 1 {
+		trend.MoM = delta(series[last], series[last-1])
+	}
+	if last >= 12 {
+		trend.YoY = delta(series[last], series[last-12])
+	}
+	trend.Rolling3 = average(series[max(0, len(series)-3):])
+	trend.Rolling12 = average(series[max(0, len(series)-12):])
+
+	return trend
+}
+
+// trends converts per month sums to trends, sorted by the latest value
+func trends(sums map[string]map[time.Time]float64, window []time.Time) []Trend {
+	out := make([]Trend, 0, len(sums))
+	for name, byMonth := range sums {
+		series := make([]float64, len(window))
+		for i, m := range window {
+			series[i] = byMonth[m]
+		}
+		out = append(out, ComputeTrend(name, series))
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Value == out[j].Value {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].Value > out[j].Value
+	})
+
+	return out
+}
+
+func addSum(sums map[string]map[time.Time]float64, name string, month time.Time, value float64) {
+	if _, ok := sums[name]; !ok {
+		sums[name] = map[time.Time]float64{}
+	}
+	sums[name][firstOfMonth(month)] += value
+}
+
+// Build computes trends for the given month. Rows are expected to cover at least
+// twelve months before the month for year-over-year deltas to be available.
+func Build(
+	month time.Time,
+	categories []*db.GetCategoryExpensesByTimespanRow,
+	expenses []*db.GetAggrExpensesByTimespanRow,
+	salaries []*db.GetSalariesByTimespanRow,
+) Report {
+	month = firstOfMonth(month)
+	window := months(month, monthsOfHistory+1)
+
+	categorySums := map[string]map[time.Time]float64{}
+	for _, c := range categories {
+		addSum(categorySums, c.Category, c.Months, c.ExpensesSum)
+	}
+
+	userSums := map[string]map[time.Time]float64{}
+	expenseSums := map[time.Time]float64{}
+	for _, e := range expenses {
+		addSum(userSums, e.Username, e.Months, e.ExpensesSum)
+		expenseSums[firstOfMonth(e.Months)] += e.ExpensesSum
+	}
+
+	salarySums := map[time.Time]float64{}
+	for _, s := range salaries {
+		salarySums[firstOfMonth(s.Months)] += s.Salary
+	}
+
+	savings := []SavingsRate{}
+	for _, m := range window[1:] {
+		rate := SavingsRate{
+			Month:    m,
+			Salaries: salarySums[m],
+			Expenses: expenseSums[m],
+			Savings:  salarySums[m] - expenseSums[m],
+		}
+		if rate.Salaries > 0 {
+			rate.Rate = rate.Savings / rate.Salaries
+		}
+		savings = append(savings, rate)
+	}
+
+	return Report{
+		Month:      month,
+		Categories: trends(categorySums, window),
+		Users:      trends(userSums, window),
+		Savings:    savings,
+	}
+}
+
+// Load fetches the needed history from the database and builds the trend report.
+func Load(ctx context.Context, store *dbengine.Store, month time.Time) (Report, error) {
+	month = firstOfMonth(month)
+	from := month.AddDate(0, -monthsOfHistory, 0)
+
+	categories, err := store.GetCategoryExpensesByTimespan(ctx, from, month)
+	if err != nil {
+		return Report{}, err
+	}
+
+	expenses, err := store.GetAggrExpensesByTimespan(ctx, from, month)
+	if err != nil {
+		return Report{}, err
+	}
+
+	salaries, err := store.GetSalariesByTimespan(ctx, from, month)
+	if err != nil {
+		return Report{}, err
+	}
+
+	return Build(month, categories, expenses, salaries), nil
+}
@@ -0,0 +1,125 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+	"weezel/budget/db"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+const floatDelta = float64(1e-4)
+
+func month(year int, m time.Month) time.Time {
+	return time.Date(year, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func TestComputeTrend(t *testing.T) {
+	tests := []struct {
+		name   string
+		series []float64
+		want   Trend
+	}{
+		{
+			name:   "Empty series",
+			series: nil,
+			want:   Trend{Name: "ruoka"},
+		},
+		{
+			name:   "Previous month without spending",
+			series: []float64{0, 30},
+			want: Trend{
+				Name:      "ruoka",
+				Value:     30,
+				MoM:       Delta{Abs: 30},
+				Rolling3:  15,
+				Rolling12: 15,
+			},
+		},
+		{
+			name:   "Full year of history",
+			series: []float64{100, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 40, 80},
+			want: Trend{
+				Name:      "ruoka",
+				Value:     80,
+				MoM:       Delta{Abs: 40, Pct: 1, PctValid: true},
+				YoY:       Delta{Abs: -20, Pct: -0.2, PctValid: true},
+				Rolling3:  43.3333,
+				Rolling12: 18.3333,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ComputeTrend("ruoka", tt.series)
+			if diff := cmp.Diff(tt.want, got, cmpopts.EquateApprox(0, floatDelta)); diff != "" {
+				t.Errorf("%s: ComputeTrend() mismatch:\n%s", tt.name, diff)
+			}
+		})
+	}
+}
+
+func TestBuild(t *testing.T) {
+	categories := []*db.GetCategoryExpensesByTimespanRow{
+		{Category: "ruoka", Months: month(2021, time.March), ExpensesSum: 200},
+		{Category: "ruoka", Months: month(2022, time.February), ExpensesSum: 100},
+		{Category: "ruoka", Months: month(2022, time.March), ExpensesSum: 150},
+		{Category: "", Months: month(2022, time.March), ExpensesSum: 50},
+	}
+	expenses := []*db.GetAggrExpensesByTimespanRow{
+		{Username: "alice", Months: month(2022, time.March), ExpensesSum: 120},
+		{Username: "alice", Months: month(2022, time.March), ExpensesSum: 30},
+		{Username: "tom", Months: month(2022, time.March), ExpensesSum: 50},
+	}
+	salaries := []*db.GetSalariesByTimespanRow{
+		{Username: "alice", Salary: 600, Months: month(2022, time.March)},
+		{Username: "tom", Salary: 200, Months: month(2022, time.March)},
+	}
+
+	got := Build(time.Date(2022, 3, 15, 0, 0, 0, 0, time.UTC), categories, expenses, salaries)
+
+	if !got.Month.Equal(month(2022, time.March)) {
+		t.Errorf("Build() month = %s, want 2022-03", got.Month)
+	}
+
+	wantCategories := []Trend{
+		{
+			Name:      "ruoka",
+			Value:     150,
+			MoM:       Delta{Abs: 50, Pct: 0.5, PctValid: true},
+			YoY:       Delta{Abs: -50, Pct: -0.25, PctValid: true},
+			Rolling3:  83.3333,
+			Rolling12: 20.8333,
+		},
+		{
+			Name:      "",
+			Value:     50,
+			MoM:       Delta{Abs: 50},
+			YoY:       Delta{Abs: 50},
+			Rolling3:  16.6666,
+			Rolling12: 4.1666,
+		},
+	}
+	if diff := cmp.Diff(wantCategories, got.Categories, cmpopts.EquateApprox(0, floatDelta)); diff != "" {
+		t.Errorf("Build() categories mismatch:\n%s", diff)
+	}
+
+	if len(got.Users) != 2 || got.Users[0].Name != "alice" || got.Users[0].Value != 150 {
+		t.Errorf("Build() users = %+v", got.Users)
+	}
+
+	if len(got.Savings) != 12 {
+		t.Fatalf("Build() savings has %d months, want 12", len(got.Savings))
+	}
+	wantSavings := SavingsRate{
+		Month:    month(2022, time.March),
+		Salaries: 800,
+		Expenses: 200,
+		Savings:  600,
+		Rate:     0.75,
+	}
+	if diff := cmp.Diff(wantSavings, got.Savings[11]); diff != "" {
+		t.Errorf("Build() savings mismatch:\n%s", diff)
+	}
+}
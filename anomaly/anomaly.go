@@ -0,0 +1,146 @@
+package anomaly
+
+import (
+	"context"
+	"math"
+	"sort"
+	"weezel/budget/confighandler"
+	"weezel/budget/dbengine"
+)
+
+const (
+	defaultZScoreThreshold = 3.5
+	defaultMinSamples      = 5
+	// historyLimit is the amount of the latest prices compared against
+	historyLimit = 100
+	// madScale makes MAD comparable to standard deviation for normal distribution
+	madScale = 0.6745
+	// meanADScale is used instead when more than half of the prices are equal
+	meanADScale = 0.7979
+)
+
+// Result tells whether the price stands out from its history and why.
+type Result struct {
+	Outlier bool
+	Score   float64
+	Median  float64
+	// Basis is either "shop" or "category" depending on which history was used
+	Basis string
+}
+
+func median(sorted []float64) float64 {
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// RobustZScore returns the modified z-score of the value against history. It is
+// based on the median and the median absolute deviation, hence a few earlier
+// typos in the history don't hide new ones. False is returned when the history
+// doesn't vary at all, since no meaningful score can be calculated then.
+func RobustZScore(value float64, history []float64) (float64, float64, bool) {
+	if len(history) == 0 {
+		return 0.0, 0.0, false
+	}
+
+	sorted := append([]float64{}, history...)
+	sort.Float64s(sorted)
+	med := median(sorted)
+
+	deviations := make([]float64, len(sorted))
+	meanAD := 0.0
+	for i, v := range sorted {
+		deviations[i] = math.Abs(v - med)
+		meanAD += deviations[i]
+	}
+	meanAD /= float64(len(deviations))
+	sort.Float64s(deviations)
+	mad := median(deviations)
+
+	switch {
+	case mad > 0:
+		return madScale * (value - med) / mad, med, true
+	case meanAD > 0:
+		return meanADScale * (value - med) / meanAD, med, true
+	}
+	return 0.0, med, false
+}
+
+func thresholds(conf confighandler.Anomaly) (float64, int) {
+	zScore := conf.ZScoreThreshold
+	if zScore <= 0 {
+		zScore = defaultZScoreThreshold
+	}
+	minSamples := conf.MinSamples
+	if minSamples <= 0 {
+		minSamples = defaultMinSamples
+	}
+	return zScore, minSamples
+}
+
+func check(price float64, history []float64, zThreshold float64) Result {
+	score, med, ok := RobustZScore(price, history)
+	if !ok {
+		// All the earlier prices were equal, anything more than double is suspicious
+		return Result{
+			Outlier: math.Abs(price-med) > math.Abs(med),
+			Median:  med,
+		}
+	}
+	return Result{
+		Outlier: math.Abs(score) > zThreshold,
+		Score:   score,
+		Median:  med,
+	}
+}
+
+// Check compares price against the shop's history and falls back to the category's
+// history if the shop hasn't been visited often enough.
+func Check(price float64, shopPrices, categoryPrices []float64, conf confighandler.Anomaly) Result {
+	if conf.Disabled {
+		return Result{}
+	}
+
+	zThreshold, minSamples := thresholds(conf)
+	if len(shopPrices) >= minSamples {
+		res := check(price, shopPrices, zThreshold)
+		res.Basis = "shop"
+		return res
+	}
+	if len(categoryPrices) >= minSamples {
+		res := check(price, categoryPrices, zThreshold)
+		res.Basis = "category"
+		return res
+	}
+
+	return Result{}
+}
+
+// CheckExpense fetches price history of the shop and the category and
+// checks if the price is an outlier.
+func CheckExpense(
+	ctx context.Context,
+	store *dbengine.Store,
+	shopName string,
+	category string,
+	price float64,
+	conf confighandler.Anomaly,
+) (Result, error) {
+	if conf.Disabled {
+		return Result{}, nil
+	}
+
+	shopPrices, err := store.GetShopPriceHistory(ctx, shopName, historyLimit)
+	if err != nil {
+		return Result{}, err
+	}
+
+	categoryPrices, err := store.GetCategoryPriceHistory(ctx, category, historyLimit)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Check(price, shopPrices, categoryPrices, conf), nil
+}
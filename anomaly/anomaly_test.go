@@ -0,0 +1,90 @@
+package anomaly
+
+import (
+	"testing"
+	"weezel/budget/confighandler"
+)
+
+func TestCheck(t *testing.T) {
+	lidl := []float64{45.10, 38.20, 52.00, 41.75, 60.30, 47.90, 39.99}
+	bus := []float64{2.80, 2.80, 2.80, 2.80, 2.80}
+
+	tests := []struct {
+		name           string
+		price          float64
+		shopPrices     []float64
+		categoryPrices []float64
+		conf           confighandler.Anomaly
+		wantOutlier    bool
+		wantBasis      string
+	}{
+		{
+			name:        "Usual grocery shopping",
+			price:       49.00,
+			shopPrices:  lidl,
+			wantOutlier: false,
+			wantBasis:   "shop",
+		},
+		{
+			name:        "Decimal separator forgotten",
+			price:       4500,
+			shopPrices:  lidl,
+			wantOutlier: true,
+			wantBasis:   "shop",
+		},
+		{
+			name:        "Too small by a magnitude",
+			price:       4.50,
+			shopPrices:  lidl,
+			wantOutlier: true,
+			wantBasis:   "shop",
+		},
+		{
+			name:        "Lenient threshold is not exceeded",
+			price:       120,
+			shopPrices:  lidl,
+			conf:        confighandler.Anomaly{ZScoreThreshold: 20},
+			wantOutlier: false,
+			wantBasis:   "shop",
+		},
+		{
+			name:           "New shop falls back to category",
+			price:          999,
+			shopPrices:     []float64{10},
+			categoryPrices: lidl,
+			wantOutlier:    true,
+			wantBasis:      "category",
+		},
+		{
+			name:        "Not enough history",
+			price:       999,
+			shopPrices:  lidl[:3],
+			wantOutlier: false,
+			wantBasis:   "",
+		},
+		{
+			name:        "Constant prices",
+			price:       28.00,
+			shopPrices:  bus,
+			wantOutlier: true,
+			wantBasis:   "shop",
+		},
+		{
+			name:        "Disabled",
+			price:       4500,
+			shopPrices:  lidl,
+			conf:        confighandler.Anomaly{Disabled: true},
+			wantOutlier: false,
+			wantBasis:   "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Check(tt.price, tt.shopPrices, tt.categoryPrices, tt.conf)
+			if got.Outlier != tt.wantOutlier || got.Basis != tt.wantBasis {
+				t.Errorf("%s: Check() = %+v, want outlier=%t basis=%q",
+					tt.name, got, tt.wantOutlier, tt.wantBasis)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestListExpenses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer s3cr3t" {
+			t.Errorf("got authorization %q", auth)
+		}
+		if r.URL.Path != "/api/v1/expenses" {
+			t.Errorf("got path %q", r.URL.Path)
+		}
+		if q := r.URL.RawQuery; q != "category=ruoka&limit=2" {
+			t.Errorf("got query %q", q)
+		}
+		_, _ = w.Write([]byte(`{"items": [{"id": 1, "shop_name": "kauppa", "price": 1.5}], "limit": 2, "offset": 0}`))
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL+"/api/v1/", "s3cr3t")
+	page, err := client.ListExpenses(context.Background(), ListExpensesParams{
+		Category: "ruoka",
+		Limit:    2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &ExpensePage{
+		Items: []Expense{{ID: 1, ShopName: "kauppa", Price: 1.5}},
+		Limit: 2,
+	}
+	if diff := cmp.Diff(expected, page); diff != "" {
+		t.Errorf("differs:\n%s", diff)
+	}
+}
+
+func TestUpdateExpense(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/expenses/42" {
+			t.Errorf("got %s %s", r.Method, r.URL.Path)
+		}
+		var body ExpenseRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		_ = json.NewEncoder(w).Encode(Expense{ID: 42, ShopName: body.ShopName, Price: body.Price})
+	}))
+	defer srv.Close()
+
+	expense, err := New(srv.URL, "s3cr3t").UpdateExpense(context.Background(), 42, ExpenseRequest{
+		ShopName: "kauppa",
+		Price:    3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&Expense{ID: 42, ShopName: "kauppa", Price: 3}, expense); diff != "" {
+		t.Errorf("differs:\n%s", diff)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error": "not found"}`))
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL, "s3cr3t").GetSalary(context.Background(), 1)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected APIError, got %v", err)
+	}
+	if diff := cmp.Diff(&APIError{StatusCode: http.StatusNotFound, Message: "not found"}, apiErr); diff != "" {
+		t.Errorf("differs:\n%s", diff)
+	}
+}
@@ -0,0 +1,129 @@
+// Package blobstore keeps files by the SHA-256 of their content, so the same
+// file is stored only once and the hash can't point to anything else later.
+package blobstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"weezel/budget/confighandler"
+)
+
+// DefaultDirectory is used by the filesystem store, relative to the working directory
+const DefaultDirectory = "receipts"
+
+// ErrNotFound is returned for unknown hashes
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps the blobs. Put returns the hash of the content, storing the same
+// content again is a no-op.
+type Store interface {
+	Put(ctx context.Context, data []byte) (string, error)
+	Get(ctx context.Context, hash string) ([]byte, error)
+}
+
+// New returns the store selected in the configuration. The database store is
+// given by the caller, nil when the database doesn't support it.
+func New(conf confighandler.Attachments, database Store) (Store, error) {
+	switch conf.Backend {
+	case "", "filesystem":
+		dir := conf.Directory
+		if dir == "" {
+			dir = DefaultDirectory
+		}
+		return NewFS(dir)
+	case "database":
+		if database == nil {
+			return nil, errors.New("attachments can't be stored in this database")
+		}
+		return database, nil
+	}
+	return nil, fmt.Errorf("unknown attachment backend %q", conf.Backend)
+}
+
+var hashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Hash returns the address of the content
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidHash tells whether hash could be returned by Hash. Hashes coming from
+// the users must be checked before using them in paths.
+func ValidHash(hash string) bool {
+	return hashPattern.MatchString(hash)
+}
+
+// FS keeps the blobs in a directory, split into subdirectories by the first
+// two characters of the hash
+type FS struct {
+	dir string
+}
+
+var _ Store = (*FS)(nil)
+
+// NewFS creates the directory if it doesn't exist
+func NewFS(dir string) (*FS, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("blob store: %w", err)
+	}
+	return &FS{dir: dir}, nil
+}
+
+func (f *FS) path(hash string) string {
+	return filepath.Join(f.dir, hash[:2], hash)
+}
+
+// Put writes the blob to a temporary file first, so that a partially written
+// file is never found by its hash
+func (f *FS) Put(_ context.Context, data []byte) (string, error) {
+	hash := Hash(data)
+	path := f.path(hash)
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", fmt.Errorf("blob store: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), hash+".*")
+	if err != nil {
+		return "", fmt.Errorf("blob store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("blob store: %w", err)
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("blob store: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return "", fmt.Errorf("blob store: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("blob store: %w", err)
+	}
+	return hash, nil
+}
+
+func (f *FS) Get(_ context.Context, hash string) ([]byte, error) {
+	if !ValidHash(hash) {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(f.path(hash))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("blob store: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,53 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFS(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewFS(filepath.Join(dir, "receipts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("kuitti")
+	hash, err := store.Put(ctx, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != Hash(data) || !ValidHash(hash) {
+		t.Errorf("got hash %q, expected %q", hash, Hash(data))
+	}
+	// Storing again is a no-op
+	if again, err := store.Put(ctx, data); err != nil || again != hash {
+		t.Errorf("second put returned %q, %v", again, err)
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "receipts", hash[:2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d files, expected 1", len(entries))
+	}
+
+	got, err := store.Get(ctx, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("got %q, expected %q", got, data)
+	}
+
+	for _, unknown := range []string{Hash([]byte("muu")), "../../etc/passwd", ""} {
+		if _, err = store.Get(ctx, unknown); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) returned %v, expected ErrNotFound", unknown, err)
+		}
+	}
+}
@@ -0,0 +1,462 @@
+package main
+
+/*
+Generates the Go client of the web API from its OpenAPI document. Only
+the subset of OpenAPI used by web/openapi.json is supported: JSON bodies,
+path and query parameters and object, array and scalar schemas.
+
+Run it through go generate:
+	go generate ./apiclient
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+type schema struct {
+	Type        string          `json:"type"`
+	Format      string          `json:"format"`
+	Ref         string          `json:"$ref"`
+	Description string          `json:"description"`
+	Items       *schema         `json:"items"`
+	Properties  json.RawMessage `json:"properties"`
+	Required    []string        `json:"required"`
+}
+
+type parameter struct {
+	Ref         string  `json:"$ref"`
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description"`
+	Required    bool    `json:"required"`
+	Schema      *schema `json:"schema"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type requestBody struct {
+	Content map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Ref     string               `json:"$ref"`
+	Content map[string]mediaType `json:"content"`
+}
+
+type operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary"`
+	Parameters  []parameter         `json:"parameters"`
+	RequestBody *requestBody        `json:"requestBody"`
+	Responses   map[string]response `json:"responses"`
+}
+
+type document struct {
+	Paths      json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas    json.RawMessage      `json:"schemas"`
+		Parameters map[string]parameter `json:"parameters"`
+	} `json:"components"`
+}
+
+// initialisms are written in upper case in Go identifiers
+var initialisms = map[string]string{
+	"id":  "ID",
+	"url": "URL",
+}
+
+// orderedKeys returns the keys of a JSON object in the order they appear.
+// Generated code follows the order of the document this way.
+func orderedKeys(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, tok.(string))
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+func goName(name string) string {
+	var sb strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' }) {
+		if initialism, found := initialisms[part]; found {
+			sb.WriteString(initialism)
+			continue
+		}
+		sb.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return sb.String()
+}
+
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+type generator struct {
+	doc     document
+	buf     bytes.Buffer
+	imports map[string]bool
+}
+
+func (g *generator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) goType(s *schema) (string, error) {
+	if s.Ref != "" {
+		return refName(s.Ref), nil
+	}
+
+	switch s.Type {
+	case "string":
+		if s.Format == "date-time" {
+			g.imports["time"] = true
+			return "time.Time", nil
+		}
+		return "string", nil
+	case "integer":
+		if s.Format == "int64" {
+			return "int64", nil
+		}
+		return "int32", nil
+	case "number":
+		return "float64", nil
+	case "boolean":
+		return "bool", nil
+	case "array":
+		itemType, err := g.goType(s.Items)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + itemType, nil
+	}
+	return "", fmt.Errorf("unsupported schema type %q", s.Type)
+}
+
+func (g *generator) genSchemas() error {
+	names, err := orderedKeys(g.doc.Components.Schemas)
+	if err != nil {
+		return err
+	}
+	schemas := map[string]*schema{}
+	if err := json.Unmarshal(g.doc.Components.Schemas, &schemas); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		s := schemas[name]
+		if s.Type != "object" {
+			return fmt.Errorf("schema %s: only objects are supported", name)
+		}
+
+		props, err := orderedKeys(s.Properties)
+		if err != nil {
+			return err
+		}
+		propSchemas := map[string]*schema{}
+		if len(s.Properties) > 0 {
+			if err := json.Unmarshal(s.Properties, &propSchemas); err != nil {
+				return err
+			}
+		}
+
+		g.printf("type %s struct {\n", name)
+		for _, prop := range props {
+			typ, err := g.goType(propSchemas[prop])
+			if err != nil {
+				return fmt.Errorf("schema %s property %s: %w", name, prop, err)
+			}
+			tag := prop
+			required := false
+			for _, r := range s.Required {
+				required = required || r == prop
+			}
+			if !required {
+				tag += ",omitempty"
+				// Zero is a valid number, hence missing one is told apart with nil
+				if typ == "int32" || typ == "int64" || typ == "float64" {
+					typ = "*" + typ
+				}
+			}
+			if desc := propSchemas[prop].Description; desc != "" {
+				g.printf("// %s\n", desc)
+			}
+			g.printf("%s %s `json:%q`\n", goName(prop), typ, tag)
+		}
+		g.printf("}\n\n")
+	}
+
+	return nil
+}
+
+func (g *generator) resolveParameter(p parameter) (parameter, error) {
+	if p.Ref == "" {
+		return p, nil
+	}
+	resolved, found := g.doc.Components.Parameters[refName(p.Ref)]
+	if !found {
+		return parameter{}, fmt.Errorf("no such parameter %s", p.Ref)
+	}
+	return resolved, nil
+}
+
+// pathExpr turns a templated path into a Go string expression
+func (g *generator) pathExpr(path string, pathParams []parameter) string {
+	parts := []string{}
+	rest := path
+	for _, p := range pathParams {
+		before, after, _ := strings.Cut(rest, "{"+p.Name+"}")
+		if before != "" {
+			parts = append(parts, fmt.Sprintf("%q", before))
+		}
+		g.imports["strconv"] = true
+		parts = append(parts, fmt.Sprintf("strconv.FormatInt(int64(%s), 10)", p.Name))
+		rest = after
+	}
+	if rest != "" {
+		parts = append(parts, fmt.Sprintf("%q", rest))
+	}
+	return strings.Join(parts, " + ")
+}
+
+// successResponse returns the schema of the first 2xx response
+func (g *generator) successResponse(op operation) *schema {
+	codes := []string{}
+	for code := range op.Responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		if strings.HasPrefix(code, "2") {
+			return op.Responses[code].Content["application/json"].Schema
+		}
+	}
+	return nil
+}
+
+func (g *generator) genOperation(path, method string, op operation, shared []parameter) error {
+	name := goName(op.OperationID)
+	if name == "" {
+		return fmt.Errorf("%s %s: operationId is missing", method, path)
+	}
+
+	var pathParams, queryParams []parameter
+	for _, p := range append(append([]parameter{}, shared...), op.Parameters...) {
+		p, err := g.resolveParameter(p)
+		if err != nil {
+			return err
+		}
+		switch p.In {
+		case "path":
+			pathParams = append(pathParams, p)
+		case "query":
+			queryParams = append(queryParams, p)
+		default:
+			return fmt.Errorf("%s: parameters in %s are not supported", name, p.In)
+		}
+	}
+
+	if len(queryParams) > 0 {
+		g.printf("// %sParams are the query parameters of %s. Zero values are omitted.\n", name, name)
+		g.printf("type %sParams struct {\n", name)
+		for _, p := range queryParams {
+			typ, err := g.goType(p.Schema)
+			if err != nil {
+				return err
+			}
+			if p.Description != "" {
+				g.printf("// %s\n", p.Description)
+			}
+			g.printf("%s %s\n", goName(p.Name), typ)
+		}
+		g.printf("}\n\n")
+	}
+
+	args := []string{"ctx context.Context"}
+	for _, p := range pathParams {
+		typ, err := g.goType(p.Schema)
+		if err != nil {
+			return err
+		}
+		args = append(args, p.Name+" "+typ)
+	}
+	if len(queryParams) > 0 {
+		args = append(args, fmt.Sprintf("params %sParams", name))
+	}
+	bodyArg := "nil"
+	if op.RequestBody != nil {
+		typ, err := g.goType(op.RequestBody.Content["application/json"].Schema)
+		if err != nil {
+			return err
+		}
+		args = append(args, "body "+typ)
+		bodyArg = "body"
+	}
+
+	respSchema := g.successResponse(op)
+	if respSchema == nil {
+		return fmt.Errorf("%s: no JSON success response", name)
+	}
+	respType, err := g.goType(respSchema)
+	if err != nil {
+		return err
+	}
+	// Slices are returned as such, objects as pointers
+	retType, ret := "*"+respType, "&out"
+	if strings.HasPrefix(respType, "[]") {
+		retType, ret = respType, "out"
+	}
+
+	g.printf("// %s calls %s %s: %s\n", name, strings.ToUpper(method), path, op.Summary)
+	g.printf("func (c *Client) %s(%s) (%s, error) {\n", name, strings.Join(args, ", "), retType)
+	queryArg := "nil"
+	if len(queryParams) > 0 {
+		queryArg = "query"
+		g.imports["net/url"] = true
+		g.printf("query := url.Values{}\n")
+		for _, p := range queryParams {
+			field := "params." + goName(p.Name)
+			typ, _ := g.goType(p.Schema)
+			switch typ {
+			case "string":
+				g.printf("if %s != \"\" {\nquery.Set(%q, %s)\n}\n", field, p.Name, field)
+			case "int32", "int64":
+				g.imports["strconv"] = true
+				g.printf("if %s != 0 {\nquery.Set(%q, strconv.FormatInt(int64(%s), 10))\n}\n", field, p.Name, field)
+			default:
+				return fmt.Errorf("%s: query parameter type %s is not supported", name, typ)
+			}
+		}
+	}
+	g.imports["net/http"] = true
+	g.printf("var out %s\n", respType)
+	g.printf("if err := c.do(ctx, http.Method%s, %s, %s, %s, &out); err != nil {\nreturn nil, err\n}\n",
+		strings.ToUpper(method[:1])+method[1:],
+		g.pathExpr(path, pathParams),
+		queryArg,
+		bodyArg)
+	g.printf("return %s, nil\n}\n\n", ret)
+
+	return nil
+}
+
+func (g *generator) genOperations() error {
+	paths, err := orderedKeys(g.doc.Paths)
+	if err != nil {
+		return err
+	}
+	items := map[string]json.RawMessage{}
+	if err := json.Unmarshal(g.doc.Paths, &items); err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		methods, err := orderedKeys(items[path])
+		if err != nil {
+			return err
+		}
+		ops := map[string]json.RawMessage{}
+		if err := json.Unmarshal(items[path], &ops); err != nil {
+			return err
+		}
+
+		var shared []parameter
+		if raw, found := ops["parameters"]; found {
+			if err := json.Unmarshal(raw, &shared); err != nil {
+				return err
+			}
+		}
+		for _, method := range methods {
+			if method == "parameters" {
+				continue
+			}
+			var op operation
+			if err := json.Unmarshal(ops[method], &op); err != nil {
+				return err
+			}
+			if err := g.genOperation(path, method, op, shared); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Generate returns the formatted Go source of the client
+func Generate(spec []byte, pkg string) ([]byte, error) {
+	g := &generator{imports: map[string]bool{"context": true}}
+	if err := json.Unmarshal(spec, &g.doc); err != nil {
+		return nil, fmt.Errorf("parse spec: %w", err)
+	}
+
+	if err := g.genSchemas(); err != nil {
+		return nil, err
+	}
+	if err := g.genOperations(); err != nil {
+		return nil, err
+	}
+	body := g.buf.Bytes()
+
+	imports := []string{}
+	for imp := range g.imports {
+		imports = append(imports, fmt.Sprintf("%q", imp))
+	}
+	sort.Strings(imports)
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by apiclientgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\n", pkg)
+	fmt.Fprintf(&out, "import (\n%s\n)\n\n", strings.Join(imports, "\n"))
+	out.Write(body)
+
+	return format.Source(out.Bytes())
+}
+
+func main() {
+	specFile := flag.String("spec", "", "OpenAPI document")
+	outFile := flag.String("out", "", "Generated Go file")
+	pkg := flag.String("package", "apiclient", "Package name of the generated file")
+	flag.Parse()
+
+	if *specFile == "" || *outFile == "" {
+		log.Fatal("Both -spec and -out are required")
+	}
+
+	spec, err := os.ReadFile(*specFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	src, err := Generate(spec, *pkg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*outFile, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGeneratedClientIsUpToDate(t *testing.T) {
+	spec, err := os.ReadFile("../../web/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := os.ReadFile("../../apiclient/client_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Generate(spec, "apiclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(expected), string(got)); diff != "" {
+		t.Errorf("client is stale, run go generate ./apiclient:\n%s", diff)
+	}
+}
+
+func TestGoName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"id", "ID"},
+		{"shop_name", "ShopName"},
+		{"next_offset", "NextOffset"},
+		{"listExpenses", "ListExpenses"},
+		{"callback-url", "CallbackURL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := goName(tt.name); got != tt.expected {
+				t.Errorf("got %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -21,9 +21,12 @@ var (
 	wd             string
 )
 
-var schemasDir = "schemas"
+var (
+	schemasDir       = "schemas"
+	sqliteSchemasDir = "sqlite_schemas"
+)
 
-//go:embed schemas/*.sql
+//go:embed schemas/*.sql sqlite_schemas/*.sql
 var sqlMigrations embed.FS
 
 func init() {
@@ -51,6 +54,10 @@ func main() {
 		panic(err)
 	}
 
+	backend, err := dbengine.Backend(conf)
+	if err != nil {
+		panic(err)
+	}
 	dbConn, err := dbengine.DBConnForMigrations(conf)
 	if err != nil {
 		panic(err)
@@ -58,9 +65,16 @@ func main() {
 	defer dbConn.Close()
 
 	goose.SetBaseFS(sqlMigrations)
+	if err = goose.SetDialect(dbengine.MigrationDialect(backend)); err != nil {
+		panic(err)
+	}
+	dir := schemasDir
+	if backend == dbengine.BackendSQLite {
+		dir = sqliteSchemasDir
+	}
 
 	if showStatus {
-		if err = goose.Status(dbConn, schemasDir); err != nil {
+		if err = goose.Status(dbConn, dir); err != nil {
 			fmt.Println(err)
 		}
 		return
@@ -70,7 +84,7 @@ func main() {
 		log.Println("Rollback the database migrations")
 		// Rollback all the migrations until they are gone
 		for {
-			if err = goose.Down(dbConn, schemasDir); err != nil {
+			if err = goose.Down(dbConn, dir); err != nil {
 				log.Printf("error while rolling back: %s\n", err)
 				break
 			}
@@ -78,11 +92,11 @@ func main() {
 		fmt.Println("Rollbacks completed")
 	} else {
 		// Do the DB Migrations
-		if err := goose.Status(dbConn, schemasDir); err != nil {
+		if err := goose.Status(dbConn, dir); err != nil {
 			fmt.Println(err)
 			return
 		}
-		if err := goose.Up(dbConn, schemasDir); err != nil {
+		if err := goose.Up(dbConn, dir); err != nil {
 			fmt.Println(err)
 			return
 		}
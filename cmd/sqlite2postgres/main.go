@@ -14,9 +14,10 @@ passed with `-f` flag.
 Once migration is done, it prints "Migration completed" (we're omtiting
 sqlite.c related warnings here).
 
-NOTE: Currently database doesn't prevent adding the same named event
-twice with the same sum, so be sure to run it only once! This is a
-deliberate decision.
+NOTE: The rows carry their SQLite IDs as idempotency keys, so running
+the tool twice fails on the unique keys instead of adding the same events
+again. The rows are added in a single transaction, so a failed run doesn't
+leave anything behind and can be retried.
 
 I didn't want to scatter related structs and variables to different files
 and wanted to keep them in one place, since when file is going to be deleted,
@@ -25,7 +26,9 @@ deleting one file will be enough. Bear with me.
 
 import (
 	"context"
+	"database/sql"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
@@ -95,6 +98,35 @@ func initSQLiteConnection(dataSource string) (*sqlx.DB, error) {
 	return sqliteDB, sqliteDB.Ping()
 }
 
+func insertRows(ctx context.Context, store *dbengine.Store, salaries []SalaryRow, expenses []BudgetRow) error {
+	// Insert salaries to Postgres
+	for _, s := range salaries {
+		key := fmt.Sprintf("sqlite:salary:%d", s.ID)
+		_, err := store.WithIdempotencyKey(key).AddSalary(ctx, s.Username, s.Salary, ParseTime(s.RecordTime))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Insert expenses to Postgres
+	rows := make([]db.AddExpensesParams, 0, len(expenses))
+	for _, b := range expenses {
+		rows = append(rows, db.AddExpensesParams{
+			Username:    b.Username,
+			ShopName:    b.ShopName,
+			Category:    b.Category,
+			Price:       b.Price,
+			ExpenseDate: ParseTime(b.PurchaseDate),
+			IdempotencyKey: sql.NullString{
+				String: fmt.Sprintf("sqlite:budget:%d", b.ID),
+				Valid:  true,
+			},
+		})
+	}
+	_, err := store.AddExpenses(ctx, rows)
+	return err
+}
+
 func main() {
 	ctx := context.Background()
 
@@ -121,7 +153,7 @@ func main() {
 		panic(err)
 	}
 	defer postgresDB.Close()
-	budgetDB := db.New(postgresDB)
+	store := dbengine.NewPostgresStore(postgresDB, nil).WithSource(dbengine.SourceImport)
 
 	sqliteDB, err := initSQLiteConnection(sqliteDBPath)
 	if err != nil {
@@ -142,29 +174,12 @@ func main() {
 		panic(err)
 	}
 
-	// Insert salaries to Postgres
-	for _, s := range salaries {
-		_, err = budgetDB.AddSalary(ctx, db.AddSalaryParams{
-			Username:  s.Username,
-			Salary:    s.Salary,
-			StoreDate: ParseTime(s.RecordTime),
-		})
-		if err != nil {
-			panic(err)
-		}
-	}
-	// Insert expenses to Postgres
-	for _, b := range expenses {
-		_, err = budgetDB.AddExpense(ctx, db.AddExpenseParams{
-			Username:    b.Username,
-			ShopName:    b.ShopName,
-			Category:    b.Category,
-			Price:       b.Price,
-			ExpenseDate: ParseTime(b.PurchaseDate),
-		})
-		if err != nil {
-			panic(err)
-		}
+	// Either all the rows are migrated or none
+	err = store.WithTx(ctx, func(tx *dbengine.Store) error {
+		return insertRows(ctx, tx, salaries, expenses)
+	})
+	if err != nil {
+		panic(err)
 	}
 
 	log.Println("SQLite to PostgreSQL migration completed")
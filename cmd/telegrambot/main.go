@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"embed"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -13,23 +15,35 @@ import (
 	"strings"
 	"syscall"
 	"time"
+	"weezel/budget/blobstore"
 	"weezel/budget/confighandler"
 	"weezel/budget/dbengine"
 	"weezel/budget/logger"
+	"weezel/budget/metrics"
+	"weezel/budget/ocr"
+	"weezel/budget/outputs"
+	"weezel/budget/reports"
 	"weezel/budget/shortlivedpage"
 	"weezel/budget/telegramhandler"
 	"weezel/budget/web"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/pressly/goose/v3"
 )
 
 var configFileName string
 
-//go:embed schemas/*.sql
+// certCheckInterval is how often the TLS certificate files are checked for changes
+const certCheckInterval = 30 * time.Second
+
+//go:embed schemas/*.sql sqlite_schemas/*.sql
 var sqlMigrations embed.FS
 
-var schemasDir = "schemas"
+var (
+	schemasDir       = "schemas"
+	sqliteSchemasDir = "sqlite_schemas"
+)
 
 // setWorkingDirectory changes working directory to same where
 // the executable is
@@ -46,7 +60,15 @@ func setWorkingDirectory(workdirPath string) string {
 	return trimmed
 }
 
-func dbMigrations(conf confighandler.TomlConfig) error {
+// migrationsDir returns the embedded migrations of the backend
+func migrationsDir(backend string) string {
+	if backend == dbengine.BackendSQLite {
+		return sqliteSchemasDir
+	}
+	return schemasDir
+}
+
+func dbMigrations(conf confighandler.TomlConfig, backend string) error {
 	dbConn, err := dbengine.DBConnForMigrations(conf)
 	if err != nil {
 		return err
@@ -54,19 +76,47 @@ func dbMigrations(conf confighandler.TomlConfig) error {
 	defer dbConn.Close()
 
 	goose.SetBaseFS(sqlMigrations)
+	if err = goose.SetDialect(dbengine.MigrationDialect(backend)); err != nil {
+		return err
+	}
 
 	// Do the DB Migrations
 	// goose.SetLogger(&logrus.Logger{}) // FIXME
-	if err := goose.Status(dbConn, schemasDir); err != nil {
+	dir := migrationsDir(backend)
+	if err := goose.Status(dbConn, dir); err != nil {
 		return fmt.Errorf("goose status: %w", err)
 	}
-	if err := goose.Up(dbConn, schemasDir); err != nil {
+	if err := goose.Up(dbConn, dir); err != nil {
 		return fmt.Errorf("goose up: %w", err)
 	}
 
 	return nil
 }
 
+// checkMigrations fails if the database isn't at the latest embedded migration
+func checkMigrations(dbConn *sql.DB, dir string) web.Check {
+	return func(ctx context.Context) (string, error) {
+		current, err := goose.GetDBVersionContext(ctx, dbConn)
+		if err != nil {
+			return "", err
+		}
+		migrations, err := goose.CollectMigrations(dir, 0, goose.MaxVersion)
+		if err != nil {
+			return "", err
+		}
+		latest, err := migrations.Last()
+		if err != nil {
+			return "", err
+		}
+
+		detail := fmt.Sprintf("version %d, latest %d", current, latest.Version)
+		if current != latest.Version {
+			return detail, errors.New("migrations are not up to date")
+		}
+		return detail, nil
+	}
+}
+
 func main() {
 	ctx := context.Background()
 
@@ -100,20 +150,98 @@ func main() {
 		logger.CloseLogFile()
 	}()
 
+	backend, err := dbengine.Backend(conf)
+	if err != nil {
+		logger.Fatal(err)
+	}
 	// Perform database migrations
-	err = dbMigrations(conf)
+	err = dbMigrations(conf, backend)
 	if err != nil {
 		logger.Fatal(err)
 	}
 
 	// protector.Protect(filepath.Join(cwd, "/"))
 
-	_, err = dbengine.New(ctx, conf.Postgres)
+	var store *dbengine.Store
+	var checkDB web.Check
+	// Only the PostgreSQL server can go away while the bot is running
+	var dbPool *pgxpool.Pool
+	var breaker *dbengine.Breaker
+	var writeQueue *dbengine.WriteQueue
+	switch backend {
+	case dbengine.BackendSQLite:
+		var sqliteDB *sql.DB
+		sqliteDB, err = dbengine.OpenSQLite(conf.SQLite.Path)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer sqliteDB.Close()
+		store = dbengine.NewSQLiteStore(sqliteDB)
+		checkDB = dbengine.CheckSQLite(sqliteDB)
+	default:
+		dbPool, err = dbengine.New(ctx, conf.Postgres)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer dbPool.Close()
+		writeQueue, err = dbengine.OpenWriteQueue(filepath.Join(cwd, "pending_writes.jsonl"))
+		if err != nil {
+			logger.Fatal(err)
+		}
+		breaker = dbengine.NewBreaker()
+		dbengine.RegisterPoolMetrics(dbPool)
+		dbengine.RegisterBreakerMetrics(breaker, writeQueue)
+		store = dbengine.NewPostgresStore(dbPool, breaker)
+		checkDB = dbengine.CheckPool(dbPool)
+	}
+	logger.Infof("Using %s database", backend)
+	loadStats := func(
+		ctx context.Context,
+		startMonth, endMonth time.Time,
+		topShops int32,
+	) (outputs.StatisticsVars, error) {
+		return reports.Statistics(ctx, store, startMonth, endMonth, topShops)
+	}
+
+	pageStore, err := shortlivedpage.NewStore(conf.ShortLivedPages, store)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	// Large objects are only supported by PostgreSQL
+	var largeObjects blobstore.Store
+	if dbPool != nil {
+		largeObjects = dbengine.NewLargeObjectStore(dbPool)
+	}
+	receipts, err := blobstore.New(conf.Attachments, largeObjects)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	ocrEngine, err := ocr.New(conf.OCR)
 	if err != nil {
 		logger.Fatal(err)
 	}
+	// serviceCtx stops the background tasks on exit
+	serviceCtx, stopServices := context.WithCancel(ctx)
+	defer stopServices()
+	shortlivedpage.Init(serviceCtx, pageStore)
 
-	shortlivedpage.InitScheduler()
+	// Purchases and salaries sent to the bot are queued while the database is
+	// down, the web server reports the errors
+	botStore := store.WithQueue(writeQueue)
+	replayQueue := func(ctx context.Context) {
+		replayed, replayErr := botStore.ReplayQueue(ctx)
+		if replayErr != nil {
+			logger.Errorf("Replaying the write queue failed: %v", replayErr)
+		}
+		if replayed > 0 {
+			logger.Infof("Replayed %d queued inserts, %d left", replayed, writeQueue.Len())
+		}
+	}
+	if breaker != nil {
+		// Inserts left from the previous run
+		replayQueue(serviceCtx)
+		go breaker.Monitor(serviceCtx, dbPool.Ping, replayQueue)
+	}
 
 	bot, err := tgbotapi.NewBotAPI(conf.Telegram.APIKey)
 	if err != nil {
@@ -123,21 +251,126 @@ func main() {
 	logger.Infof("Using username: %s", bot.Self.UserName)
 	go telegramhandler.ConnectionHandler(
 		bot,
+		botStore,
+		receipts,
+		ocrEngine,
 		conf.Telegram.ChannelID,
-		conf.Webserver.Hostname)
+		conf.Webserver.Hostname,
+		conf.Budget,
+		conf.Anomaly,
+		conf.Webserver.LinkSecret)
+	telegramhandler.ScheduleForecastAlerts(bot, store, conf.Telegram.ChannelID, conf.Budget)
 
+	// Changes made through the web server are audited as such
+	webStore := store.WithSource(dbengine.SourceWeb)
 	mux := http.NewServeMux()
-	mux.HandleFunc("/", web.APIHandler)
+	mux.Handle("/", web.NewPageHandler(conf.Webserver.TrustForwardedFor))
+	web.NewAPI(webStore, conf.Webserver.APITokens).Register(mux)
+	ui, err := web.NewUI(
+		webStore,
+		loadStats,
+		bot.Self.UserName,
+		conf.Telegram.APIKey,
+		conf.Webserver.UIUsers,
+		receipts)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	ui.Register(mux)
+	web.NewReportLinks(
+		conf.Webserver.LinkSecret,
+		conf.Telegram.ChannelID,
+		loadStats,
+		store.IsLinkRevoked).Register(mux)
+	migrationConn, err := dbengine.DBConnForMigrations(conf)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer migrationConn.Close()
+	health := web.NewHealth()
+	health.AddLiveness("telegram", telegramhandler.CheckUpdateLoop)
+	health.AddLiveness("scheduler", telegramhandler.CheckScheduler)
+	health.AddLiveness("janitor", shortlivedpage.CheckJanitor)
+	health.AddReadiness("database", checkDB)
+	if writeQueue != nil {
+		health.AddReadiness("write_queue", dbengine.CheckQueue(writeQueue))
+	}
+	health.AddReadiness("migrations", checkMigrations(migrationConn, migrationsDir(backend)))
+	// The results of the checks are shown only on the admin listener
+	health.RegisterSummary(mux)
+
+	var adminServ *http.Server
+	if conf.Webserver.AdminPort != "" {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("GET /metrics", metrics.Handler())
+		health.Register(adminMux)
+		adminServ = &http.Server{
+			Handler:           adminMux,
+			Addr:              conf.Webserver.AdminPort,
+			ReadHeaderTimeout: 3 * time.Second,
+			ReadTimeout:       10 * time.Second,
+			WriteTimeout:      30 * time.Second,
+		}
+		go func() {
+			logger.Info(adminServ.ListenAndServe())
+		}()
+		logger.Infof("Admin listener on %s", conf.Webserver.AdminPort)
+	} else {
+		// The metrics aren't exposed on the public listener
+		logger.Info("AdminPort not set, /metrics and the health check details are disabled")
+	}
+
+	maxRequestBytes := conf.Webserver.MaxRequestBytes
+	if maxRequestBytes <= 0 {
+		maxRequestBytes = web.DefaultMaxRequestBytes
+	}
 	httpServ := &http.Server{
-		Handler:           mux,
+		Handler:           web.InstrumentHandler(web.SecureHandler(mux, maxRequestBytes)),
 		Addr:              conf.Webserver.HTTPPort,
 		ReadHeaderTimeout: 3 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		MaxHeaderBytes:    16 << 10,
 	}
 
-	go func() {
-		logger.Info(httpServ.ListenAndServe())
-	}()
-	logger.Infof("Listening on port %s", conf.Webserver.HTTPPort)
+	var redirectServ *http.Server
+	if conf.Webserver.TLSCertFile != "" {
+		certReloader, err := web.NewCertReloader(conf.Webserver.TLSCertFile, conf.Webserver.TLSKeyFile)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		httpServ.TLSConfig = certReloader.TLSConfig()
+
+		reload := make(chan os.Signal, 1)
+		signal.Notify(reload, syscall.SIGHUP)
+		go certReloader.Watch(serviceCtx, certCheckInterval, reload)
+
+		go func() {
+			logger.Info(httpServ.ListenAndServeTLS("", ""))
+		}()
+		logger.Infof("Listening HTTPS on port %s", conf.Webserver.HTTPPort)
+
+		if conf.Webserver.HTTPRedirectPort != "" {
+			redirectServ = &http.Server{
+				Handler:           web.RedirectHandler(conf.Webserver.Hostname),
+				Addr:              conf.Webserver.HTTPRedirectPort,
+				ReadHeaderTimeout: 3 * time.Second,
+				ReadTimeout:       10 * time.Second,
+				WriteTimeout:      10 * time.Second,
+				IdleTimeout:       time.Minute,
+			}
+			go func() {
+				logger.Info(redirectServ.ListenAndServe())
+			}()
+			logger.Infof("Redirecting HTTP on port %s to HTTPS", conf.Webserver.HTTPRedirectPort)
+		}
+	} else {
+		go func() {
+			logger.Info(httpServ.ListenAndServe())
+		}()
+		logger.Infof("Listening on port %s", conf.Webserver.HTTPPort)
+	}
 
 	// Graceful shutdown for HTTP server
 	done := make(chan os.Signal, 1)
@@ -147,5 +380,13 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	logger.Infof("HTTP server stopping")
 	defer cancel()
+	for _, serv := range []*http.Server{redirectServ, adminServ} {
+		if serv == nil {
+			continue
+		}
+		if err := serv.Shutdown(ctx); err != nil {
+			logger.Error(err)
+		}
+	}
 	logger.Fatal(httpServ.Shutdown(ctx))
 }
@@ -5,11 +5,12 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
+	"weezel/budget/analytics"
 	"weezel/budget/confighandler"
 	"weezel/budget/db"
 	"weezel/budget/dbengine"
@@ -20,154 +21,181 @@ import (
 	"weezel/budget/utils"
 
 	"github.com/google/go-cmp/cmp"
-	"github.com/jackc/pgx/v4/pgxpool"
 )
 
-var (
-	wd   string
-	conn *pgxpool.Pool
-)
+// integrationBackends are the database backends the suite is run against.
+// Run only one of them with e.g. -run 'TestIntegration_main/sqlite'.
+var integrationBackends = []string{dbengine.BackendPostgres, dbengine.BackendSQLite}
 
-func init() {
-	wd, _ = os.Getwd()
+// setupStore migrates the database of the backend, empties it and adds the
+// test content. PostgreSQL is configured in integrations.toml, SQLite uses a
+// temporary file.
+func setupStore(t *testing.T, backend string) *dbengine.Store {
+	t.Helper()
 	ctx := context.Background()
 
+	wd, _ := os.Getwd()
 	configFileName := "../../integrations.toml"
 	configFile, err := os.ReadFile(filepath.Join(wd, configFileName))
 	if err != nil {
-		panic(fmt.Errorf(">1> %s", err))
+		t.Fatal(err)
 	}
 	conf, err := confighandler.LoadConfig(configFile)
 	if err != nil {
-		panic(fmt.Errorf(">2> %s", err))
+		t.Fatal(err)
 	}
+	conf.Database.Backend = backend
+	conf.SQLite.Path = filepath.Join(t.TempDir(), "budget_test.db")
 
 	// Perform database migrations
-	err = dbMigrations(conf)
-	if err != nil {
-		panic(fmt.Errorf(">3> %s", err))
-	}
-
-	conn, err = dbengine.New(context.Background(), conf.Postgres)
-	if err != nil {
-		panic(fmt.Errorf(">4> %s", err))
+	if err = dbMigrations(conf, backend); err != nil {
+		t.Fatal(err)
 	}
 
-	_, err = conn.Exec(ctx, "DELETE FROM budget_schema.expense;")
-	if err != nil {
-		panic(fmt.Errorf(">5> %s", err))
-	}
-	_, err = conn.Exec(ctx, "DELETE FROM budget_schema.salary;")
-	if err != nil {
-		panic(fmt.Errorf(">6> %s", err))
+	var store *dbengine.Store
+	switch backend {
+	case dbengine.BackendSQLite:
+		sqliteDB, err := dbengine.OpenSQLite(conf.SQLite.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { sqliteDB.Close() })
+		store = dbengine.NewSQLiteStore(sqliteDB)
+	default:
+		conn, err := dbengine.New(ctx, conf.Postgres)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(conn.Close)
+		for _, table := range []string{
+			"budget_schema.attachment",
+			"budget_schema.expense",
+			"budget_schema.salary",
+			"budget_schema.audit_log",
+		} {
+			if _, err = conn.Exec(ctx, "DELETE FROM "+table); err != nil {
+				t.Fatal(err)
+			}
+		}
+		store = dbengine.NewPostgresStore(conn, nil)
 	}
 
-	addContent()
+	addContent(t, store)
+	return store
 }
 
 func generateStatsHTMLPage(
 	ctx context.Context,
+	store *dbengine.Store,
 	startMonth time.Time,
 	endMonth time.Time,
 ) ([]byte, error) {
-	stats, err := dbengine.StatisticsByTimespan(ctx, startMonth, endMonth)
+	stats, err := store.StatisticsByTimespan(ctx, startMonth, endMonth)
 	if err != nil {
 		return nil, err
 	}
 	debtcontrol.FillDebts(stats)
 
-	detailedExpenses, err := dbengine.GetExpensesByTimespan(ctx, startMonth, endMonth)
+	detailedExpenses, err := store.GetExpensesByTimespan(ctx, startMonth, endMonth)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := store.GetCategoryExpensesByTimespan(ctx, startMonth, endMonth)
+	if err != nil {
+		return nil, err
+	}
+
+	categoryShares, err := store.GetCategorySharesByTimespan(ctx, startMonth, endMonth)
+	if err != nil {
+		return nil, err
+	}
+
+	topShops, err := store.GetTopShopsByTimespan(ctx, startMonth, endMonth, 5)
+	if err != nil {
+		return nil, err
+	}
+
+	trends, err := analytics.Load(ctx, store, endMonth)
 	if err != nil {
 		return nil, err
 	}
 
 	htmlPage, err := outputs.RenderStatsHTML(outputs.StatisticsVars{
-		From:       startMonth,
-		To:         endMonth,
-		Statistics: stats,
-		Detailed:   detailedExpenses,
+		From:           startMonth,
+		To:             endMonth,
+		Statistics:     stats,
+		Detailed:       detailedExpenses,
+		Categories:     categories,
+		CategoryShares: categoryShares,
+		TopShops:       topShops,
+		Trends:         trends,
 	})
 	if err != nil {
 		return nil, err
 	}
-	htmlPageHash := utils.CalcSha256Sum(htmlPage)
+	htmlPageHash := shortlivedpage.NewToken()
 	shortlivedPage := shortlivedpage.ShortLivedPage{
 		TTLSeconds: 600,
 		StartTime:  time.Now(),
 		HTMLPage:   &htmlPage,
 	}
 	// If hash already exits, Add function returns false.
-	if ok := shortlivedpage.Add(htmlPageHash, shortlivedPage); ok {
-		endTime := shortlivedPage.StartTime.Add(
-			time.Duration(shortlivedPage.TTLSeconds))
+	ok, err := shortlivedpage.Add(ctx, htmlPageHash, shortlivedPage)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
 		logger.Infof("Added shortlived data page %s with end time %s",
-			htmlPageHash, endTime)
+			htmlPageHash, shortlivedPage.EndTime())
 	}
 
 	return htmlPage, nil
 }
 
-func addContent() {
-	bdb := db.New(conn)
+func addContent(t *testing.T, store *dbengine.Store) {
+	t.Helper()
+	ctx := context.Background()
 
 	for i := 1; i < 11; i++ {
-		// Expense
-		_, err := bdb.AddExpense(context.Background(), db.AddExpenseParams{
-			Username:    "Jorma",
-			ShopName:    "Lidl",
-			Category:    "Groceries",
-			Price:       float64(i) * 2,
-			ExpenseDate: time.Date(2020, 4, i, 1, 0, 0, 0, time.UTC),
-		})
-		if err != nil {
-			panic(err)
-		}
-		_, err = bdb.AddExpense(context.Background(), db.AddExpenseParams{
-			Username:    "Jorma",
-			ShopName:    "Beer",
-			Category:    "Leisure",
-			Price:       float64(i) * 2,
-			ExpenseDate: time.Date(2020, 8, i, 1, 0, 0, 0, time.UTC),
-		})
-		if err != nil {
-			panic(err)
+		for _, e := range []db.BudgetSchemaExpense{
+			{
+				Username:    "Jorma",
+				ShopName:    "Lidl",
+				Category:    "Groceries",
+				Price:       float64(i) * 2,
+				ExpenseDate: time.Date(2020, 4, i, 1, 0, 0, 0, time.UTC),
+			},
+			{
+				Username:    "Jorma",
+				ShopName:    "Beer",
+				Category:    "Leisure",
+				Price:       float64(i) * 2,
+				ExpenseDate: time.Date(2020, 8, i, 1, 0, 0, 0, time.UTC),
+			},
+			{
+				Username:    "Alice",
+				ShopName:    "IceHockery",
+				Category:    "Sports",
+				Price:       float64(i) * 3.14,
+				ExpenseDate: time.Date(2020, 4, 10+i, 1, 1, 0, 0, time.UTC),
+			},
+		} {
+			_, err := store.AddExpense(ctx, e.Username, e.ShopName, e.Category, e.ExpenseDate, e.Price)
+			if err != nil {
+				t.Fatal(err)
+			}
 		}
 
-		_, err = bdb.AddExpense(context.Background(), db.AddExpenseParams{
-			Username:    "Alice",
-			ShopName:    "IceHockery",
-			Category:    "Sports",
-			Price:       float64(i) * 3.14,
-			ExpenseDate: time.Date(2020, 4, 10+i, 1, 1, 0, 0, time.UTC),
-		})
-		if err != nil {
-			panic(err)
-		}
-
-		// Salary
-		_, err = bdb.AddSalary(context.Background(), db.AddSalaryParams{
-			Username:  "Jorma",
-			Salary:    1000.37,
-			StoreDate: time.Date(2020, time.Month(i), 1, 1, 0, 0, 0, time.UTC),
-		})
-		if err != nil {
-			panic(err)
-		}
-		_, err = bdb.AddSalary(context.Background(), db.AddSalaryParams{
-			Username:  "Alice",
-			Salary:    1788.12,
-			StoreDate: time.Date(2020, time.Month(i), 1, 1, 0, 0, 0, time.UTC),
-		})
-		if err != nil {
-			panic(err)
-		}
-		_, err = bdb.AddSalary(context.Background(), db.AddSalaryParams{
-			Username:  "Alice",
-			Salary:    1788.12,
-			StoreDate: time.Date(2021, time.Month(i)+1, 1, 1, 0, 0, 0, time.UTC),
-		})
-		if err != nil {
-			panic(err)
+		storeDate := time.Date(2020, time.Month(i), 1, 1, 0, 0, 0, time.UTC)
+		for _, s := range []db.BudgetSchemaSalary{
+			{Username: "Jorma", Salary: 1000.37, StoreDate: storeDate},
+			{Username: "Alice", Salary: 1788.12, StoreDate: storeDate},
+			{Username: "Alice", Salary: 1788.12, StoreDate: storeDate.AddDate(1, 1, 0)},
+		} {
+			if _, err := store.AddSalary(ctx, s.Username, s.Salary, s.StoreDate); err != nil {
+				t.Fatal(err)
+			}
 		}
 	}
 }
@@ -180,23 +208,84 @@ func TestIntegration_main(t *testing.T) {
 
 	ctx := context.Background()
 
-	shortlivedpage.InitScheduler()
+	// Both backends must produce the very same page
+	expectedPage, err := os.ReadFile("./stats-test_expected.html")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	startMonth := utils.GetDate([]string{"01-2020"}, "01-2006")
-	endMonth := utils.GetDate([]string{"06-2020"}, "01-2006")
+	for _, backend := range integrationBackends {
+		t.Run(backend, func(t *testing.T) {
+			store := setupStore(t, backend)
 
-	statsPage, err := generateStatsHTMLPage(ctx, startMonth, endMonth)
-	if err != nil {
-		t.Error(err)
+			janitorCtx, stopJanitor := context.WithCancel(ctx)
+			defer stopJanitor()
+			shortlivedpage.Init(janitorCtx, shortlivedpage.NewPostgresStore(store))
+
+			startMonth := utils.GetDate([]string{"01-2020"}, "01-2006")
+			endMonth := utils.GetDate([]string{"06-2020"}, "01-2006")
+
+			statsPage, err := generateStatsHTMLPage(ctx, store, startMonth, endMonth)
+			if err != nil {
+				t.Error(err)
+			}
+			// os.WriteFile("stats-out.html", statsPage, 0o600) // For observation
+
+			if diff := cmp.Diff(expectedPage, statsPage); diff != "" {
+				t.Errorf("%s: Stats HTML page differs from the expected one:\n%s",
+					t.Name(), diff)
+			}
+		})
 	}
-	// os.WriteFile("stats-out.html", statsPage, 0o600) // For observation
-	expectedPage, err := os.ReadFile("./stats-test_expected.html")
-	if err != nil {
-		panic(err)
+}
+
+// TestIntegration_withTx checks that a failing transaction leaves nothing behind
+func TestIntegration_withTx(t *testing.T) {
+	if testing.Short() {
+		t.Skipf("Skipping integration test %s due `short` was defined", t.Name())
+	}
+
+	ctx := context.Background()
+	injected := errors.New("injected failure")
+	expenses := []db.AddExpensesParams{
+		{Username: "Jorma", ShopName: "Lidl", Category: "Groceries", Price: 4.5, ExpenseDate: time.Now()},
+		{Username: "Alice", ShopName: "Alko", Category: "Leisure", Price: 19.9, ExpenseDate: time.Now()},
 	}
 
-	if diff := cmp.Diff(expectedPage, statsPage); diff != "" {
-		t.Errorf("%s: Stats HTML page differs from the expected one:\n%s",
-			t.Name(), diff)
+	for _, backend := range integrationBackends {
+		t.Run(backend, func(t *testing.T) {
+			store := setupStore(t, backend)
+			count := func() int {
+				t.Helper()
+				rows, err := store.ListExpenses(ctx, dbengine.Filter{}, 1000, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return len(rows)
+			}
+			before := count()
+
+			err := store.WithTx(ctx, func(tx *dbengine.Store) error {
+				if _, err := tx.AddExpenses(ctx, expenses); err != nil {
+					return err
+				}
+				return injected
+			})
+			if !errors.Is(err, injected) {
+				t.Errorf("WithTx() returned %v, expected the injected error", err)
+			}
+			if after := count(); after != before {
+				t.Errorf("rolled back transaction added %d expenses", after-before)
+			}
+
+			added, err := store.AddExpenses(ctx, expenses)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if after := count(); added != int64(len(expenses)) || after != before+len(expenses) {
+				t.Errorf("AddExpenses() added %d, %d expenses in total, expected %d",
+					added, after, before+len(expenses))
+			}
+		})
 	}
 }
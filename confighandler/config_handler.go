@@ -16,21 +16,124 @@ type Telegram struct {
 type Webserver struct {
 	HTTPPort string
 	Hostname string
+	// UIUsers are the Telegram usernames allowed to sign in to the web UI
+	UIUsers []string
+	// LinkSecret signs the long-lived report links, they're disabled when empty
+	LinkSecret string
+	// TLSCertFile and TLSKeyFile enable HTTPS on HTTPPort. The files are
+	// reloaded on SIGHUP and when they change.
+	TLSCertFile string
+	TLSKeyFile  string
+	// HTTPRedirectPort, e.g. ":80", redirects plain HTTP to HTTPS when TLS is on
+	HTTPRedirectPort string
+	// AdminPort, e.g. "127.0.0.1:9090", serves /metrics and the detailed health
+	// checks on a separate listener. Without it /metrics isn't served at all,
+	// HTTPPort is public.
+	AdminPort string
+	// TrustForwardedFor takes client addresses from X-Forwarded-For, set it
+	// only when running behind a reverse proxy
+	TrustForwardedFor bool
+	// MaxRequestBytes limits request bodies, 0 for the default
+	MaxRequestBytes int64
+	// APITokens maps usernames to the bearer tokens of the JSON API
+	APITokens map[string]string
 }
 
+// Database selects where the expenses and salaries are kept
+type Database struct {
+	// Backend is "postgres" (default) or "sqlite"
+	Backend string
+}
+
+// Postgres is either a full DSN or the discrete fields. The connection fields
+// are ignored when DSN is set, the pool sizing is applied to both.
 type Postgres struct {
+	// DSN, e.g. "postgres://budget@db.example.com/budget?sslmode=verify-full"
+	// or "host=/var/run/postgresql dbname=budget"
+	DSN      string
 	Hostname string
-	Port     string
-	Database string
-	Username string
-	Password string
+	// SocketDir, e.g. "/var/run/postgresql", connects through the unix socket
+	// in it instead of Hostname
+	SocketDir string
+	Port      string
+	Database  string
+	Username  string
+	Password  string
+	// SSLMode is one of the libpq modes, "disable" by default
+	SSLMode string
+	// SSLRootCert is the CA verifying the server, SSLCert and SSLKey are the
+	// client certificate
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
+	// MaxConns and MinConns size the connection pool, 0 for the defaults
+	MaxConns int32
+	MinConns int32
+}
+
+type SQLite struct {
+	// Path of the database file, relative to the working directory
+	Path string
+}
+
+// Budget holds the planned monthly spending. Categories are keyed by
+// the category name without the leading hash, e.g. "ruoka".
+type Budget struct {
+	Monthly    float64
+	Categories map[string]float64
+}
+
+// Anomaly controls when a purchase is considered unusual enough to be
+// confirmed before storing. Zero values fall back to defaults.
+type Anomaly struct {
+	Disabled        bool
+	ZScoreThreshold float64
+	MinSamples      int
+}
+
+// ShortLivedPages selects where the statistics pages are kept
+type ShortLivedPages struct {
+	// Backend is "memory" (default), "filesystem" or "database". The last one
+	// uses the database of the expenses, "postgres" is its old name.
+	Backend string
+	// MaxBytes limits the memory backend, least recently used pages are dropped first
+	MaxBytes int64
+	// Directory of the filesystem backend, relative to the working directory
+	Directory string
+}
+
+// Attachments selects where the receipt photos are kept
+type Attachments struct {
+	// Backend is "filesystem" (default) or "database". The latter keeps them
+	// as PostgreSQL large objects and isn't available with SQLite.
+	Backend string
+	// Directory of the filesystem backend, relative to the working directory
+	Directory string
+}
+
+// OCR reads the receipt photos sent without a purchase, it's disabled by default
+type OCR struct {
+	// Backend is "" (disabled) or "tesseract"
+	Backend string
+	// Binary is the tesseract executable, looked up from PATH by default
+	Binary string
+	// Languages of the text, "fin+eng" by default
+	Languages string
 }
 
 type TomlConfig struct {
 	General   General
 	Telegram  Telegram
 	Webserver Webserver
+	Database  Database
 	Postgres  Postgres
+	SQLite    SQLite
+	Budget    Budget
+	Anomaly   Anomaly
+	// ShortLivedPages is under [shortlivedpages]
+	ShortLivedPages ShortLivedPages
+	Attachments     Attachments
+	OCR             OCR
 }
 
 func LoadConfig(filedata []byte) (TomlConfig, error) {
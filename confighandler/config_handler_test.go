@@ -30,6 +30,20 @@ func TestLoadConfig(t *testing.T) {
 				[webserver]
 				HTTPPort = ":8080"
 				Hostname = "localhost"
+				UIUsers = ["tester", "toinen"]
+				LinkSecret = "linkkisalaisuus"
+				TrustForwardedFor = true
+				TLSCertFile = "/etc/ssl/budget.crt"
+				TLSKeyFile = "/etc/ssl/private/budget.key"
+				HTTPRedirectPort = ":80"
+				AdminPort = "127.0.0.1:9090"
+				MaxRequestBytes = 65536
+
+				[webserver.apitokens]
+				tester = "s3cr3t"
+
+				[database]
+				Backend = "sqlite"
 
 				[postgres]
 				Hostname = "localhost"
@@ -37,6 +51,30 @@ func TestLoadConfig(t *testing.T) {
 				Database = "dingdong"
 				Username = "tester"
 				Password = "you wouldn'T have gues$ed"
+				SocketDir = "/var/run/postgresql"
+				SSLMode = "verify-full"
+				SSLRootCert = "/etc/ssl/ca.crt"
+				SSLCert = "/etc/ssl/budget.crt"
+				SSLKey = "/etc/ssl/private/budget.key"
+				MaxConns = 8
+				MinConns = 2
+
+				[sqlite]
+				Path = "budget.db"
+
+				[budget]
+				Monthly = 1500.0
+
+				[budget.categories]
+				ruoka = 600.0
+				harrastukset = 120.5
+
+				[anomaly]
+				ZScoreThreshold = 4.0
+				MinSamples = 8
+				[shortlivedpages]
+				Backend = "filesystem"
+				Directory = "sivut"
 				`),
 			},
 			want: TomlConfig{
@@ -44,19 +82,58 @@ func TestLoadConfig(t *testing.T) {
 					WorkingDir: "/home/blaa/dingdong",
 				},
 				Webserver: Webserver{
-					HTTPPort: ":8080",
-					Hostname: "localhost",
+					HTTPPort:          ":8080",
+					Hostname:          "localhost",
+					UIUsers:           []string{"tester", "toinen"},
+					LinkSecret:        "linkkisalaisuus",
+					TrustForwardedFor: true,
+					TLSCertFile:       "/etc/ssl/budget.crt",
+					TLSKeyFile:        "/etc/ssl/private/budget.key",
+					HTTPRedirectPort:  ":80",
+					AdminPort:         "127.0.0.1:9090",
+					MaxRequestBytes:   65536,
+					APITokens: map[string]string{
+						"tester": "s3cr3t",
+					},
 				},
 				Telegram: Telegram{
 					APIKey:    "abcdefg:1234",
 					ChannelID: -987654,
 				},
+				Database: Database{
+					Backend: "sqlite",
+				},
 				Postgres: Postgres{
-					Hostname: "localhost",
-					Port:     "5432",
-					Database: "dingdong",
-					Username: "tester",
-					Password: "you wouldn'T have gues$ed",
+					Hostname:    "localhost",
+					Port:        "5432",
+					Database:    "dingdong",
+					Username:    "tester",
+					Password:    "you wouldn'T have gues$ed",
+					SocketDir:   "/var/run/postgresql",
+					SSLMode:     "verify-full",
+					SSLRootCert: "/etc/ssl/ca.crt",
+					SSLCert:     "/etc/ssl/budget.crt",
+					SSLKey:      "/etc/ssl/private/budget.key",
+					MaxConns:    8,
+					MinConns:    2,
+				},
+				SQLite: SQLite{
+					Path: "budget.db",
+				},
+				Budget: Budget{
+					Monthly: 1500.0,
+					Categories: map[string]float64{
+						"ruoka":        600.0,
+						"harrastukset": 120.5,
+					},
+				},
+				Anomaly: Anomaly{
+					ZScoreThreshold: 4.0,
+					MinSamples:      8,
+				},
+				ShortLivedPages: ShortLivedPages{
+					Backend:   "filesystem",
+					Directory: "sivut",
 				},
 			},
 			wantErr: false,
@@ -5,21 +5,73 @@
 package db
 
 import (
+	"database/sql"
+	"encoding/json"
 	"time"
 )
 
-type BudgetSchemaExpense struct {
+type BudgetSchemaAttachment struct {
 	ID          int32     `json:"id"`
-	Username    string    `json:"username"`
-	ShopName    string    `json:"shop_name"`
-	Category    string    `json:"category"`
-	Price       float64   `json:"price"`
-	ExpenseDate time.Time `json:"expense_date"`
+	ExpenseID   int32     `json:"expense_id"`
+	Hash        string    `json:"hash"`
+	ContentType string    `json:"content_type"`
+	SizeBytes   int64     `json:"size_bytes"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type BudgetSchemaAuditLog struct {
+	ID        int32           `json:"id"`
+	ChangedAt time.Time       `json:"changed_at"`
+	Actor     string          `json:"actor"`
+	Source    string          `json:"source"`
+	Action    string          `json:"action"`
+	TableName string          `json:"table_name"`
+	RowID     int32           `json:"row_id"`
+	BeforeRow json.RawMessage `json:"before_row"`
+	AfterRow  json.RawMessage `json:"after_row"`
+}
+
+type BudgetSchemaBlob struct {
+	Hash      string    `json:"hash"`
+	ObjectID  uint32    `json:"object_id"`
+	SizeBytes int64     `json:"size_bytes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type BudgetSchemaExpense struct {
+	ID             int32          `json:"id"`
+	Username       string         `json:"username"`
+	ShopName       string         `json:"shop_name"`
+	Category       string         `json:"category"`
+	Price          float64        `json:"price"`
+	ExpenseDate    time.Time      `json:"expense_date"`
+	DeletedAt      sql.NullTime   `json:"-"`
+	IdempotencyKey sql.NullString `json:"-"`
+	CreatedAt      sql.NullTime   `json:"-"`
+	Sharing        string         `json:"sharing"`
+	OwedBy         string         `json:"owed_by"`
+}
+
+type BudgetSchemaRevokedLink struct {
+	LinkID    string    `json:"link_id"`
+	RevokedBy string    `json:"revoked_by"`
+	RevokedAt time.Time `json:"revoked_at"`
 }
 
 type BudgetSchemaSalary struct {
-	ID        int32     `json:"id"`
-	Username  string    `json:"username"`
-	Salary    float64   `json:"salary"`
-	StoreDate time.Time `json:"store_date"`
+	ID             int32          `json:"id"`
+	Username       string         `json:"username"`
+	Salary         float64        `json:"salary"`
+	StoreDate      time.Time      `json:"store_date"`
+	DeletedAt      sql.NullTime   `json:"-"`
+	IdempotencyKey sql.NullString `json:"-"`
+}
+
+type BudgetSchemaShortLivedPage struct {
+	Hash          string    `json:"hash"`
+	Html          []byte    `json:"html"`
+	StartTime     time.Time `json:"start_time"`
+	TtlSeconds    int64     `json:"ttl_seconds"`
+	BurnAfterRead bool      `json:"burn_after_read"`
+	PinHash       string    `json:"pin_hash"`
 }
@@ -6,27 +6,82 @@ package db
 
 import (
 	"context"
+	"time"
 )
 
 type Querier interface {
+	//
+	// Attachments
+	//
+	// Attaching the same file again does nothing
+	AddAttachment(ctx context.Context, arg AddAttachmentParams) error
+	//
+	// Audit log
+	//
+	AddAuditLog(ctx context.Context, arg AddAuditLogParams) error
+	AddBlob(ctx context.Context, arg AddBlobParams) error
 	//
 	// Expenses
 	//
+	// Nothing is returned when the idempotency key has already been used
 	AddExpense(ctx context.Context, arg AddExpenseParams) (int32, error)
+	AddExpenses(ctx context.Context, arg []AddExpensesParams) (int64, error)
 	//
 	// Salaries
 	//
+	// Nothing is returned when the idempotency key has already been used
 	AddSalary(ctx context.Context, arg AddSalaryParams) (int32, error)
+	//
+	// Short-lived pages
+	//
+	AddShortLivedPage(ctx context.Context, arg AddShortLivedPageParams) (string, error)
+	// Expenses are only marked deleted, RestoreExpenseByID brings them back
 	DeleteExpenseByID(ctx context.Context, arg DeleteExpenseByIDParams) (*BudgetSchemaExpense, error)
+	DeleteExpiredShortLivedPages(ctx context.Context, now time.Time) (int64, error)
+	// Salaries are only marked deleted, RestoreSalaryByID brings them back
 	DeleteSalaryByID(ctx context.Context, arg DeleteSalaryByIDParams) (*BudgetSchemaSalary, error)
+	DeleteShortLivedPage(ctx context.Context, hash string) error
 	GetAggrExpensesByTimespan(ctx context.Context, arg GetAggrExpensesByTimespanParams) ([]*GetAggrExpensesByTimespanRow, error)
+	// Receipts of the deleted expenses aren't shown
+	GetAttachmentByHash(ctx context.Context, hash string) (*BudgetSchemaAttachment, error)
+	GetBlob(ctx context.Context, hash string) (*BudgetSchemaBlob, error)
+	GetCategoryExpensesByTimespan(ctx context.Context, arg GetCategoryExpensesByTimespanParams) ([]*GetCategoryExpensesByTimespanRow, error)
+	GetCategoryPriceHistory(ctx context.Context, arg GetCategoryPriceHistoryParams) ([]float64, error)
+	GetCategorySharesByTimespan(ctx context.Context, arg GetCategorySharesByTimespanParams) ([]*GetCategorySharesByTimespanRow, error)
+	GetDailyExpensesByTimespan(ctx context.Context, arg GetDailyExpensesByTimespanParams) ([]*GetDailyExpensesByTimespanRow, error)
+	GetExpenseByID(ctx context.Context, id int32) (*BudgetSchemaExpense, error)
 	GetExpensesByTimespan(ctx context.Context, arg GetExpensesByTimespanParams) ([]*GetExpensesByTimespanRow, error)
+	// Returns the latest same purchase of the user stored after created_after
+	GetRecentDuplicateExpense(ctx context.Context, arg GetRecentDuplicateExpenseParams) (*BudgetSchemaExpense, error)
 	GetSalariesByTimespan(ctx context.Context, arg GetSalariesByTimespanParams) ([]*GetSalariesByTimespanRow, error)
+	GetSalaryByID(ctx context.Context, id int32) (*BudgetSchemaSalary, error)
+	GetShopPriceHistory(ctx context.Context, arg GetShopPriceHistoryParams) ([]float64, error)
+	GetShortLivedPage(ctx context.Context, hash string) (*BudgetSchemaShortLivedPage, error)
+	GetShortLivedPageStats(ctx context.Context) (*GetShortLivedPageStatsRow, error)
+	GetTopShopsByTimespan(ctx context.Context, arg GetTopShopsByTimespanParams) ([]*GetTopShopsByTimespanRow, error)
 	GetUserSalaryByMonth(ctx context.Context, arg GetUserSalaryByMonthParams) (float64, error)
 	//
+	// Report links
+	//
+	IsLinkRevoked(ctx context.Context, linkID string) (bool, error)
+	ListAttachmentsByTimespan(ctx context.Context, arg ListAttachmentsByTimespanParams) ([]*ListAttachmentsByTimespanRow, error)
+	ListAuditLog(ctx context.Context, arg ListAuditLogParams) ([]*BudgetSchemaAuditLog, error)
+	ListExpenses(ctx context.Context, arg ListExpensesParams) ([]*BudgetSchemaExpense, error)
+	ListSalaries(ctx context.Context, arg ListSalariesParams) ([]*BudgetSchemaSalary, error)
+	// The users of the household are the ones who have stored a salary
+	ListSalaryUsernames(ctx context.Context) ([]string, error)
+	RestoreExpenseByID(ctx context.Context, arg RestoreExpenseByIDParams) (*BudgetSchemaExpense, error)
+	RestoreSalaryByID(ctx context.Context, arg RestoreSalaryByIDParams) (*BudgetSchemaSalary, error)
+	RevokeLink(ctx context.Context, arg RevokeLinkParams) error
+	//
 	// Miscellaneous
 	//
+	// expenses_sum has only the shared expenses, the personal ones and the ones
+	// paid for the others are summed separately
 	StatisticsAggrByTimespan(ctx context.Context, arg StatisticsAggrByTimespanParams) ([]*StatisticsAggrByTimespanRow, error)
+	TakeShortLivedPage(ctx context.Context, hash string) (*BudgetSchemaShortLivedPage, error)
+	UpdateExpenseByID(ctx context.Context, arg UpdateExpenseByIDParams) (*BudgetSchemaExpense, error)
+	UpdateSalaryByID(ctx context.Context, arg UpdateSalaryByIDParams) (*BudgetSchemaSalary, error)
 }
 
 var _ Querier = (*Queries)(nil)
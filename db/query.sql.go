@@ -7,31 +7,140 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"time"
 )
 
+const addAttachment = `-- name: AddAttachment :exec
+-- Attaching the same file again does nothing
+INSERT INTO budget_schema.attachment (
+	expense_id,
+	hash,
+	content_type,
+	size_bytes
+) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (expense_id, hash) DO NOTHING
+`
+
+type AddAttachmentParams struct {
+	ExpenseID   int32  `json:"expense_id"`
+	Hash        string `json:"hash"`
+	ContentType string `json:"content_type"`
+	SizeBytes   int64  `json:"size_bytes"`
+}
+
+//
+// Attachments
+//
+// Attaching the same file again does nothing
+func (q *Queries) AddAttachment(ctx context.Context, arg AddAttachmentParams) error {
+	_, err := q.db.Exec(ctx, addAttachment,
+		arg.ExpenseID,
+		arg.Hash,
+		arg.ContentType,
+		arg.SizeBytes,
+	)
+	return err
+}
+
+const addAuditLog = `-- name: AddAuditLog :exec
+INSERT INTO budget_schema.audit_log (
+	actor,
+	source,
+	action,
+	table_name,
+	row_id,
+	before_row,
+	after_row
+) VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6,
+	$7
+)
+`
+
+type AddAuditLogParams struct {
+	Actor     string          `json:"actor"`
+	Source    string          `json:"source"`
+	Action    string          `json:"action"`
+	TableName string          `json:"table_name"`
+	RowID     int32           `json:"row_id"`
+	BeforeRow json.RawMessage `json:"before_row"`
+	AfterRow  json.RawMessage `json:"after_row"`
+}
+
+//
+// Audit log
+//
+func (q *Queries) AddAuditLog(ctx context.Context, arg AddAuditLogParams) error {
+	_, err := q.db.Exec(ctx, addAuditLog,
+		arg.Actor,
+		arg.Source,
+		arg.Action,
+		arg.TableName,
+		arg.RowID,
+		arg.BeforeRow,
+		arg.AfterRow,
+	)
+	return err
+}
+
+const addBlob = `-- name: AddBlob :exec
+INSERT INTO budget_schema.blob (
+	hash,
+	object_id,
+	size_bytes
+) VALUES ($1, $2, $3)
+`
+
+type AddBlobParams struct {
+	Hash      string `json:"hash"`
+	ObjectID  uint32 `json:"object_id"`
+	SizeBytes int64  `json:"size_bytes"`
+}
+
+func (q *Queries) AddBlob(ctx context.Context, arg AddBlobParams) error {
+	_, err := q.db.Exec(ctx, addBlob, arg.Hash, arg.ObjectID, arg.SizeBytes)
+	return err
+}
+
 const addExpense = `-- name: AddExpense :one
 
+-- Nothing is returned when the idempotency key has already been used
 INSERT INTO budget_schema.expense(
 	username,
 	shop_name,
 	category,
 	price,
-	expense_date
-) VALUES ($1, $2, $3, $4, $5) RETURNING id
+	expense_date,
+	idempotency_key,
+	sharing,
+	owed_by
+) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	ON CONFLICT (idempotency_key) DO NOTHING
+	RETURNING id
 `
 
 type AddExpenseParams struct {
-	Username    string    `json:"username"`
-	ShopName    string    `json:"shop_name"`
-	Category    string    `json:"category"`
-	Price       float64   `json:"price"`
-	ExpenseDate time.Time `json:"expense_date"`
+	Username       string         `json:"username"`
+	ShopName       string         `json:"shop_name"`
+	Category       string         `json:"category"`
+	Price          float64        `json:"price"`
+	ExpenseDate    time.Time      `json:"expense_date"`
+	IdempotencyKey sql.NullString `json:"idempotency_key"`
+	Sharing        string         `json:"sharing"`
+	OwedBy         string         `json:"owed_by"`
 }
 
 //
 // Expenses
 //
+// Nothing is returned when the idempotency key has already been used
 func (q *Queries) AddExpense(ctx context.Context, arg AddExpenseParams) (int32, error) {
 	row := q.db.QueryRow(ctx, addExpense,
 		arg.Username,
@@ -39,38 +148,109 @@ func (q *Queries) AddExpense(ctx context.Context, arg AddExpenseParams) (int32,
 		arg.Category,
 		arg.Price,
 		arg.ExpenseDate,
+		arg.IdempotencyKey,
+		arg.Sharing,
+		arg.OwedBy,
 	)
 	var id int32
 	err := row.Scan(&id)
 	return id, err
 }
 
+type AddExpensesParams struct {
+	Username       string         `json:"username"`
+	ShopName       string         `json:"shop_name"`
+	Category       string         `json:"category"`
+	Price          float64        `json:"price"`
+	ExpenseDate    time.Time      `json:"expense_date"`
+	IdempotencyKey sql.NullString `json:"idempotency_key"`
+	Sharing        string         `json:"sharing"`
+	OwedBy         string         `json:"owed_by"`
+}
+
 const addSalary = `-- name: AddSalary :one
 
-INSERT INTO budget_schema.salary(username, salary, store_date)
-	VALUES($1, $2, $3) RETURNING id
+-- Nothing is returned when the idempotency key has already been used
+INSERT INTO budget_schema.salary(username, salary, store_date, idempotency_key)
+	VALUES($1, $2, $3, $4)
+	ON CONFLICT (idempotency_key) DO NOTHING
+	RETURNING id
 `
 
 type AddSalaryParams struct {
-	Username  string    `json:"username"`
-	Salary    float64   `json:"salary"`
-	StoreDate time.Time `json:"store_date"`
+	Username       string         `json:"username"`
+	Salary         float64        `json:"salary"`
+	StoreDate      time.Time      `json:"store_date"`
+	IdempotencyKey sql.NullString `json:"idempotency_key"`
 }
 
 //
 // Salaries
 //
+// Nothing is returned when the idempotency key has already been used
 func (q *Queries) AddSalary(ctx context.Context, arg AddSalaryParams) (int32, error) {
-	row := q.db.QueryRow(ctx, addSalary, arg.Username, arg.Salary, arg.StoreDate)
+	row := q.db.QueryRow(ctx, addSalary,
+		arg.Username,
+		arg.Salary,
+		arg.StoreDate,
+		arg.IdempotencyKey,
+	)
 	var id int32
 	err := row.Scan(&id)
 	return id, err
 }
 
+const addShortLivedPage = `-- name: AddShortLivedPage :one
+INSERT INTO budget_schema.short_lived_page (
+	hash,
+	html,
+	start_time,
+	ttl_seconds,
+	burn_after_read,
+	pin_hash
+) VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6
+) ON CONFLICT (hash) DO NOTHING
+RETURNING hash
+`
+
+type AddShortLivedPageParams struct {
+	Hash          string    `json:"hash"`
+	Html          []byte    `json:"html"`
+	StartTime     time.Time `json:"start_time"`
+	TtlSeconds    int64     `json:"ttl_seconds"`
+	BurnAfterRead bool      `json:"burn_after_read"`
+	PinHash       string    `json:"pin_hash"`
+}
+
+//
+// Short-lived pages
+//
+func (q *Queries) AddShortLivedPage(ctx context.Context, arg AddShortLivedPageParams) (string, error) {
+	row := q.db.QueryRow(ctx, addShortLivedPage,
+		arg.Hash,
+		arg.Html,
+		arg.StartTime,
+		arg.TtlSeconds,
+		arg.BurnAfterRead,
+		arg.PinHash,
+	)
+	var hash string
+	err := row.Scan(&hash)
+	return hash, err
+}
+
 const deleteExpenseByID = `-- name: DeleteExpenseByID :one
-DELETE FROM budget_schema.expense
-	WHERE id = $1 AND username = $2
-	RETURNING id, username, shop_name, category, price, expense_date
+-- Expenses are only marked deleted, RestoreExpenseByID brings them back
+UPDATE budget_schema.expense
+	SET deleted_at = now()
+	WHERE id = $1 AND username = $2 AND deleted_at IS NULL
+	RETURNING id, username, shop_name, category, price, expense_date, deleted_at, idempotency_key, created_at, sharing, owed_by
 `
 
 type DeleteExpenseByIDParams struct {
@@ -78,6 +258,7 @@ type DeleteExpenseByIDParams struct {
 	Username string `json:"username"`
 }
 
+// Expenses are only marked deleted, RestoreExpenseByID brings them back
 func (q *Queries) DeleteExpenseByID(ctx context.Context, arg DeleteExpenseByIDParams) (*BudgetSchemaExpense, error) {
 	row := q.db.QueryRow(ctx, deleteExpenseByID, arg.ID, arg.Username)
 	var i BudgetSchemaExpense
@@ -88,14 +269,34 @@ func (q *Queries) DeleteExpenseByID(ctx context.Context, arg DeleteExpenseByIDPa
 		&i.Category,
 		&i.Price,
 		&i.ExpenseDate,
+		&i.DeletedAt,
+		&i.IdempotencyKey,
+		&i.CreatedAt,
+		&i.Sharing,
+		&i.OwedBy,
 	)
 	return &i, err
 }
 
+const deleteExpiredShortLivedPages = `-- name: DeleteExpiredShortLivedPages :execrows
+DELETE FROM budget_schema.short_lived_page
+	WHERE start_time + ttl_seconds * interval '1 second' < $1
+`
+
+func (q *Queries) DeleteExpiredShortLivedPages(ctx context.Context, now time.Time) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredShortLivedPages, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const deleteSalaryByID = `-- name: DeleteSalaryByID :one
-DELETE FROM budget_schema.salary
-	WHERE id = $1 AND username = $2
-	RETURNING id, username, salary, store_date
+-- Salaries are only marked deleted, RestoreSalaryByID brings them back
+UPDATE budget_schema.salary
+	SET deleted_at = now()
+	WHERE id = $1 AND username = $2 AND deleted_at IS NULL
+	RETURNING id, username, salary, store_date, deleted_at, idempotency_key
 `
 
 type DeleteSalaryByIDParams struct {
@@ -103,6 +304,7 @@ type DeleteSalaryByIDParams struct {
 	Username string `json:"username"`
 }
 
+// Salaries are only marked deleted, RestoreSalaryByID brings them back
 func (q *Queries) DeleteSalaryByID(ctx context.Context, arg DeleteSalaryByIDParams) (*BudgetSchemaSalary, error) {
 	row := q.db.QueryRow(ctx, deleteSalaryByID, arg.ID, arg.Username)
 	var i BudgetSchemaSalary
@@ -111,14 +313,25 @@ func (q *Queries) DeleteSalaryByID(ctx context.Context, arg DeleteSalaryByIDPara
 		&i.Username,
 		&i.Salary,
 		&i.StoreDate,
+		&i.DeletedAt,
+		&i.IdempotencyKey,
 	)
 	return &i, err
 }
 
+const deleteShortLivedPage = `-- name: DeleteShortLivedPage :exec
+DELETE FROM budget_schema.short_lived_page WHERE hash = $1
+`
+
+func (q *Queries) DeleteShortLivedPage(ctx context.Context, hash string) error {
+	_, err := q.db.Exec(ctx, deleteShortLivedPage, hash)
+	return err
+}
+
 const getAggrExpensesByTimespan = `-- name: GetAggrExpensesByTimespan :many
 SELECT username, date_trunc('month', expense_date)::date AS months, SUM(price)::float AS expenses_sum
 	FROM budget_schema.expense
-	WHERE expense_date BETWEEN $1::date
+	WHERE deleted_at IS NULL AND expense_date BETWEEN $1::date
 		AND $2::date + interval '1 month - 1 day'
 	GROUP BY username, months, shop_name
 	ORDER BY months, username
@@ -155,9 +368,228 @@ func (q *Queries) GetAggrExpensesByTimespan(ctx context.Context, arg GetAggrExpe
 	return items, nil
 }
 
+const getAttachmentByHash = `-- name: GetAttachmentByHash :one
+-- Receipts of the deleted expenses aren't shown
+SELECT a.id, a.expense_id, a.hash, a.content_type, a.size_bytes, a.created_at
+	FROM budget_schema.attachment AS a
+	JOIN budget_schema.expense AS e ON e.id = a.expense_id
+	WHERE a.hash = $1 AND e.deleted_at IS NULL
+	ORDER BY a.id
+	LIMIT 1
+`
+
+// Receipts of the deleted expenses aren't shown
+func (q *Queries) GetAttachmentByHash(ctx context.Context, hash string) (*BudgetSchemaAttachment, error) {
+	row := q.db.QueryRow(ctx, getAttachmentByHash, hash)
+	var i BudgetSchemaAttachment
+	err := row.Scan(
+		&i.ID,
+		&i.ExpenseID,
+		&i.Hash,
+		&i.ContentType,
+		&i.SizeBytes,
+		&i.CreatedAt,
+	)
+	return &i, err
+}
+
+const getBlob = `-- name: GetBlob :one
+SELECT hash, object_id, size_bytes, created_at FROM budget_schema.blob
+	WHERE hash = $1
+`
+
+func (q *Queries) GetBlob(ctx context.Context, hash string) (*BudgetSchemaBlob, error) {
+	row := q.db.QueryRow(ctx, getBlob, hash)
+	var i BudgetSchemaBlob
+	err := row.Scan(
+		&i.Hash,
+		&i.ObjectID,
+		&i.SizeBytes,
+		&i.CreatedAt,
+	)
+	return &i, err
+}
+
+const getCategoryExpensesByTimespan = `-- name: GetCategoryExpensesByTimespan :many
+SELECT category, date_trunc('month', expense_date)::date AS months, SUM(price)::float AS expenses_sum
+	FROM budget_schema.expense
+	WHERE deleted_at IS NULL AND expense_date BETWEEN $1::date
+		AND $2::date + interval '1 month - 1 day'
+	GROUP BY category, months
+	ORDER BY months, expenses_sum DESC, category
+`
+
+type GetCategoryExpensesByTimespanParams struct {
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+type GetCategoryExpensesByTimespanRow struct {
+	Category    string    `json:"category"`
+	Months      time.Time `json:"months"`
+	ExpensesSum float64   `json:"expenses_sum"`
+}
+
+func (q *Queries) GetCategoryExpensesByTimespan(ctx context.Context, arg GetCategoryExpensesByTimespanParams) ([]*GetCategoryExpensesByTimespanRow, error) {
+	rows, err := q.db.Query(ctx, getCategoryExpensesByTimespan, arg.StartTime, arg.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*GetCategoryExpensesByTimespanRow
+	for rows.Next() {
+		var i GetCategoryExpensesByTimespanRow
+		if err := rows.Scan(&i.Category, &i.Months, &i.ExpensesSum); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getCategoryPriceHistory = `-- name: GetCategoryPriceHistory :many
+SELECT price FROM budget_schema.expense
+	WHERE deleted_at IS NULL AND category = $1
+	ORDER BY expense_date DESC, id DESC
+	LIMIT $2
+`
+
+type GetCategoryPriceHistoryParams struct {
+	Category     string `json:"category"`
+	HistoryLimit int32  `json:"history_limit"`
+}
+
+func (q *Queries) GetCategoryPriceHistory(ctx context.Context, arg GetCategoryPriceHistoryParams) ([]float64, error) {
+	rows, err := q.db.Query(ctx, getCategoryPriceHistory, arg.Category, arg.HistoryLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []float64
+	for rows.Next() {
+		var price float64
+		if err := rows.Scan(&price); err != nil {
+			return nil, err
+		}
+		items = append(items, price)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getCategorySharesByTimespan = `-- name: GetCategorySharesByTimespan :many
+SELECT category, SUM(price)::float AS expenses_sum,
+		COALESCE(SUM(price) / NULLIF(SUM(SUM(price)) OVER (), 0), 0)::float AS share
+	FROM budget_schema.expense
+	WHERE deleted_at IS NULL AND expense_date BETWEEN $1::date
+		AND $2::date + interval '1 month - 1 day'
+	GROUP BY category
+	ORDER BY expenses_sum DESC, category
+`
+
+type GetCategorySharesByTimespanParams struct {
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+type GetCategorySharesByTimespanRow struct {
+	Category    string  `json:"category"`
+	ExpensesSum float64 `json:"expenses_sum"`
+	Share       float64 `json:"share"`
+}
+
+func (q *Queries) GetCategorySharesByTimespan(ctx context.Context, arg GetCategorySharesByTimespanParams) ([]*GetCategorySharesByTimespanRow, error) {
+	rows, err := q.db.Query(ctx, getCategorySharesByTimespan, arg.StartTime, arg.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*GetCategorySharesByTimespanRow
+	for rows.Next() {
+		var i GetCategorySharesByTimespanRow
+		if err := rows.Scan(&i.Category, &i.ExpensesSum, &i.Share); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDailyExpensesByTimespan = `-- name: GetDailyExpensesByTimespan :many
+SELECT expense_date, category, SUM(price)::float AS expenses_sum
+	FROM budget_schema.expense
+	WHERE deleted_at IS NULL
+		AND expense_date BETWEEN $1::date AND $2::date
+	GROUP BY expense_date, category
+	ORDER BY expense_date, category
+`
+
+type GetDailyExpensesByTimespanParams struct {
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+}
+
+type GetDailyExpensesByTimespanRow struct {
+	ExpenseDate time.Time `json:"expense_date"`
+	Category    string    `json:"category"`
+	ExpensesSum float64   `json:"expenses_sum"`
+}
+
+func (q *Queries) GetDailyExpensesByTimespan(ctx context.Context, arg GetDailyExpensesByTimespanParams) ([]*GetDailyExpensesByTimespanRow, error) {
+	rows, err := q.db.Query(ctx, getDailyExpensesByTimespan, arg.StartDate, arg.EndDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*GetDailyExpensesByTimespanRow
+	for rows.Next() {
+		var i GetDailyExpensesByTimespanRow
+		if err := rows.Scan(&i.ExpenseDate, &i.Category, &i.ExpensesSum); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getExpenseByID = `-- name: GetExpenseByID :one
+SELECT id, username, shop_name, category, price, expense_date, deleted_at, idempotency_key, created_at, sharing, owed_by FROM budget_schema.expense
+	WHERE id = $1 AND deleted_at IS NULL
+`
+
+func (q *Queries) GetExpenseByID(ctx context.Context, id int32) (*BudgetSchemaExpense, error) {
+	row := q.db.QueryRow(ctx, getExpenseByID, id)
+	var i BudgetSchemaExpense
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.ShopName,
+		&i.Category,
+		&i.Price,
+		&i.ExpenseDate,
+		&i.DeletedAt,
+		&i.IdempotencyKey,
+		&i.CreatedAt,
+		&i.Sharing,
+		&i.OwedBy,
+	)
+	return &i, err
+}
+
 const getExpensesByTimespan = `-- name: GetExpensesByTimespan :many
-SELECT id, username, expense_date, shop_name, price FROM budget_schema.expense
-	WHERE expense_date BETWEEN $1::date
+SELECT id, username, expense_date, shop_name, category, price FROM budget_schema.expense
+	WHERE deleted_at IS NULL AND expense_date BETWEEN $1::date
 		AND $2::date + interval '1 month - 1 day'
 	ORDER BY username, expense_date, shop_name, price
 `
@@ -172,6 +604,7 @@ type GetExpensesByTimespanRow struct {
 	Username    string    `json:"username"`
 	ExpenseDate time.Time `json:"expense_date"`
 	ShopName    string    `json:"shop_name"`
+	Category    string    `json:"category"`
 	Price       float64   `json:"price"`
 }
 
@@ -189,6 +622,7 @@ func (q *Queries) GetExpensesByTimespan(ctx context.Context, arg GetExpensesByTi
 			&i.Username,
 			&i.ExpenseDate,
 			&i.ShopName,
+			&i.Category,
 			&i.Price,
 		); err != nil {
 			return nil, err
@@ -201,9 +635,56 @@ func (q *Queries) GetExpensesByTimespan(ctx context.Context, arg GetExpensesByTi
 	return items, nil
 }
 
+const getRecentDuplicateExpense = `-- name: GetRecentDuplicateExpense :one
+-- Returns the latest same purchase of the user stored after created_after
+SELECT id, username, shop_name, category, price, expense_date, deleted_at, idempotency_key, created_at, sharing, owed_by FROM budget_schema.expense
+	WHERE username = $1
+		AND lower(shop_name) = lower($2)
+		AND price = $3
+		AND expense_date = $4
+		AND created_at >= $5::timestamptz
+		AND deleted_at IS NULL
+	ORDER BY created_at DESC
+	LIMIT 1
+`
+
+type GetRecentDuplicateExpenseParams struct {
+	Username     string    `json:"username"`
+	ShopName     string    `json:"shop_name"`
+	Price        float64   `json:"price"`
+	ExpenseDate  time.Time `json:"expense_date"`
+	CreatedAfter time.Time `json:"created_after"`
+}
+
+// Returns the latest same purchase of the user stored after created_after
+func (q *Queries) GetRecentDuplicateExpense(ctx context.Context, arg GetRecentDuplicateExpenseParams) (*BudgetSchemaExpense, error) {
+	row := q.db.QueryRow(ctx, getRecentDuplicateExpense,
+		arg.Username,
+		arg.ShopName,
+		arg.Price,
+		arg.ExpenseDate,
+		arg.CreatedAfter,
+	)
+	var i BudgetSchemaExpense
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.ShopName,
+		&i.Category,
+		&i.Price,
+		&i.ExpenseDate,
+		&i.DeletedAt,
+		&i.IdempotencyKey,
+		&i.CreatedAt,
+		&i.Sharing,
+		&i.OwedBy,
+	)
+	return &i, err
+}
+
 const getSalariesByTimespan = `-- name: GetSalariesByTimespan :many
 SELECT username, salary, date_trunc('month', store_date)::date AS months FROM budget_schema.salary
-	WHERE store_date BETWEEN date_trunc('month', $1::date)::date
+	WHERE deleted_at IS NULL AND store_date BETWEEN date_trunc('month', $1::date)::date
 		AND date_trunc('month', $2::date)::date + interval '1 month - 1 day'
 	GROUP BY username, months, salary
 	ORDER BY username, months
@@ -240,9 +721,137 @@ func (q *Queries) GetSalariesByTimespan(ctx context.Context, arg GetSalariesByTi
 	return items, nil
 }
 
+const getSalaryByID = `-- name: GetSalaryByID :one
+SELECT id, username, salary, store_date, deleted_at, idempotency_key FROM budget_schema.salary
+	WHERE id = $1 AND deleted_at IS NULL
+`
+
+func (q *Queries) GetSalaryByID(ctx context.Context, id int32) (*BudgetSchemaSalary, error) {
+	row := q.db.QueryRow(ctx, getSalaryByID, id)
+	var i BudgetSchemaSalary
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Salary,
+		&i.StoreDate,
+		&i.DeletedAt,
+		&i.IdempotencyKey,
+	)
+	return &i, err
+}
+
+const getShopPriceHistory = `-- name: GetShopPriceHistory :many
+SELECT price FROM budget_schema.expense
+	WHERE deleted_at IS NULL AND lower(shop_name) = lower($1)
+	ORDER BY expense_date DESC, id DESC
+	LIMIT $2
+`
+
+type GetShopPriceHistoryParams struct {
+	ShopName     string `json:"shop_name"`
+	HistoryLimit int32  `json:"history_limit"`
+}
+
+func (q *Queries) GetShopPriceHistory(ctx context.Context, arg GetShopPriceHistoryParams) ([]float64, error) {
+	rows, err := q.db.Query(ctx, getShopPriceHistory, arg.ShopName, arg.HistoryLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []float64
+	for rows.Next() {
+		var price float64
+		if err := rows.Scan(&price); err != nil {
+			return nil, err
+		}
+		items = append(items, price)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getShortLivedPage = `-- name: GetShortLivedPage :one
+SELECT hash, html, start_time, ttl_seconds, burn_after_read, pin_hash FROM budget_schema.short_lived_page WHERE hash = $1
+`
+
+func (q *Queries) GetShortLivedPage(ctx context.Context, hash string) (*BudgetSchemaShortLivedPage, error) {
+	row := q.db.QueryRow(ctx, getShortLivedPage, hash)
+	var i BudgetSchemaShortLivedPage
+	err := row.Scan(
+		&i.Hash,
+		&i.Html,
+		&i.StartTime,
+		&i.TtlSeconds,
+		&i.BurnAfterRead,
+		&i.PinHash,
+	)
+	return &i, err
+}
+
+const getShortLivedPageStats = `-- name: GetShortLivedPageStats :one
+SELECT COUNT(*) AS pages, COALESCE(SUM(octet_length(html)), 0)::bigint AS bytes
+	FROM budget_schema.short_lived_page
+`
+
+type GetShortLivedPageStatsRow struct {
+	Pages int64 `json:"pages"`
+	Bytes int64 `json:"bytes"`
+}
+
+func (q *Queries) GetShortLivedPageStats(ctx context.Context) (*GetShortLivedPageStatsRow, error) {
+	row := q.db.QueryRow(ctx, getShortLivedPageStats)
+	var i GetShortLivedPageStatsRow
+	err := row.Scan(&i.Pages, &i.Bytes)
+	return &i, err
+}
+
+const getTopShopsByTimespan = `-- name: GetTopShopsByTimespan :many
+SELECT shop_name, COUNT(*) AS purchases, SUM(price)::float AS expenses_sum
+	FROM budget_schema.expense
+	WHERE deleted_at IS NULL AND expense_date BETWEEN $1::date
+		AND $2::date + interval '1 month - 1 day'
+	GROUP BY shop_name
+	ORDER BY expenses_sum DESC, shop_name
+	LIMIT $3
+`
+
+type GetTopShopsByTimespanParams struct {
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	ShopLimit int32     `json:"shop_limit"`
+}
+
+type GetTopShopsByTimespanRow struct {
+	ShopName    string  `json:"shop_name"`
+	Purchases   int64   `json:"purchases"`
+	ExpensesSum float64 `json:"expenses_sum"`
+}
+
+func (q *Queries) GetTopShopsByTimespan(ctx context.Context, arg GetTopShopsByTimespanParams) ([]*GetTopShopsByTimespanRow, error) {
+	rows, err := q.db.Query(ctx, getTopShopsByTimespan, arg.StartTime, arg.EndTime, arg.ShopLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*GetTopShopsByTimespanRow
+	for rows.Next() {
+		var i GetTopShopsByTimespanRow
+		if err := rows.Scan(&i.ShopName, &i.Purchases, &i.ExpensesSum); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserSalaryByMonth = `-- name: GetUserSalaryByMonth :one
 SELECT salary FROM budget_schema.salary
-	WHERE username = $1
+	WHERE username = $1 AND deleted_at IS NULL
 	AND store_date = date_trunc('month', $2::date)
 `
 
@@ -258,16 +867,354 @@ func (q *Queries) GetUserSalaryByMonth(ctx context.Context, arg GetUserSalaryByM
 	return salary, err
 }
 
-const statisticsAggrByTimespan = `-- name: StatisticsAggrByTimespan :many
+const isLinkRevoked = `-- name: IsLinkRevoked :one
+SELECT EXISTS(
+	SELECT 1 FROM budget_schema.revoked_link WHERE link_id = $1
+) AS revoked
+`
+
+//
+// Report links
+//
+func (q *Queries) IsLinkRevoked(ctx context.Context, linkID string) (bool, error) {
+	row := q.db.QueryRow(ctx, isLinkRevoked, linkID)
+	var revoked bool
+	err := row.Scan(&revoked)
+	return revoked, err
+}
+
+const listAttachmentsByTimespan = `-- name: ListAttachmentsByTimespan :many
+SELECT a.id, a.expense_id, a.hash, a.content_type, a.size_bytes
+	FROM budget_schema.attachment AS a
+	JOIN budget_schema.expense AS e ON e.id = a.expense_id
+	WHERE e.deleted_at IS NULL
+		AND e.expense_date BETWEEN $1::date AND $2::date
+	ORDER BY a.expense_id, a.id
+`
+
+type ListAttachmentsByTimespanParams struct {
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+}
+
+type ListAttachmentsByTimespanRow struct {
+	ID          int32  `json:"id"`
+	ExpenseID   int32  `json:"expense_id"`
+	Hash        string `json:"hash"`
+	ContentType string `json:"content_type"`
+	SizeBytes   int64  `json:"size_bytes"`
+}
+
+func (q *Queries) ListAttachmentsByTimespan(ctx context.Context, arg ListAttachmentsByTimespanParams) ([]*ListAttachmentsByTimespanRow, error) {
+	rows, err := q.db.Query(ctx, listAttachmentsByTimespan, arg.StartDate, arg.EndDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*ListAttachmentsByTimespanRow
+	for rows.Next() {
+		var i ListAttachmentsByTimespanRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.ExpenseID,
+			&i.Hash,
+			&i.ContentType,
+			&i.SizeBytes,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAuditLog = `-- name: ListAuditLog :many
+SELECT id, changed_at, actor, source, action, table_name, row_id, before_row, after_row FROM budget_schema.audit_log
+	ORDER BY id DESC
+	LIMIT $1 OFFSET $2
+`
+
+type ListAuditLogParams struct {
+	RowLimit  int32 `json:"row_limit"`
+	RowOffset int32 `json:"row_offset"`
+}
+
+func (q *Queries) ListAuditLog(ctx context.Context, arg ListAuditLogParams) ([]*BudgetSchemaAuditLog, error) {
+	rows, err := q.db.Query(ctx, listAuditLog, arg.RowLimit, arg.RowOffset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*BudgetSchemaAuditLog
+	for rows.Next() {
+		var i BudgetSchemaAuditLog
+		if err := rows.Scan(
+			&i.ID,
+			&i.ChangedAt,
+			&i.Actor,
+			&i.Source,
+			&i.Action,
+			&i.TableName,
+			&i.RowID,
+			&i.BeforeRow,
+			&i.AfterRow,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listExpenses = `-- name: ListExpenses :many
+SELECT id, username, shop_name, category, price, expense_date, deleted_at, idempotency_key, created_at, sharing, owed_by FROM budget_schema.expense
+	WHERE deleted_at IS NULL
+		AND ($1::text IS NULL OR username = $1)
+		AND ($2::text IS NULL OR category = $2)
+		AND ($3::date IS NULL OR expense_date >= $3)
+		AND ($4::date IS NULL OR expense_date <= $4)
+	ORDER BY
+		CASE WHEN $5::text = 'shop' THEN shop_name END,
+		CASE WHEN $5::text = '-shop' THEN shop_name END DESC,
+		CASE WHEN $5::text = 'category' THEN category END,
+		CASE WHEN $5::text = '-category' THEN category END DESC,
+		CASE WHEN $5::text = 'username' THEN username END,
+		CASE WHEN $5::text = '-username' THEN username END DESC,
+		CASE WHEN $5::text = 'price' THEN price END,
+		CASE WHEN $5::text = '-price' THEN price END DESC,
+		CASE WHEN $5::text = 'date' THEN expense_date END,
+		expense_date DESC, id DESC
+	LIMIT $6 OFFSET $7
+`
+
+type ListExpensesParams struct {
+	Username  sql.NullString `json:"username"`
+	Category  sql.NullString `json:"category"`
+	StartDate sql.NullTime   `json:"start_date"`
+	EndDate   sql.NullTime   `json:"end_date"`
+	SortBy    string         `json:"sort_by"`
+	RowLimit  int32          `json:"row_limit"`
+	RowOffset int32          `json:"row_offset"`
+}
+
+func (q *Queries) ListExpenses(ctx context.Context, arg ListExpensesParams) ([]*BudgetSchemaExpense, error) {
+	rows, err := q.db.Query(ctx, listExpenses,
+		arg.Username,
+		arg.Category,
+		arg.StartDate,
+		arg.EndDate,
+		arg.SortBy,
+		arg.RowLimit,
+		arg.RowOffset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*BudgetSchemaExpense
+	for rows.Next() {
+		var i BudgetSchemaExpense
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.ShopName,
+			&i.Category,
+			&i.Price,
+			&i.ExpenseDate,
+			&i.DeletedAt,
+			&i.IdempotencyKey,
+			&i.CreatedAt,
+			&i.Sharing,
+			&i.OwedBy,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSalaries = `-- name: ListSalaries :many
+SELECT id, username, salary, store_date, deleted_at, idempotency_key FROM budget_schema.salary
+	WHERE deleted_at IS NULL
+		AND ($1::text IS NULL OR username = $1)
+		AND ($2::date IS NULL OR store_date >= $2)
+		AND ($3::date IS NULL OR store_date <= $3)
+	ORDER BY store_date DESC, id DESC
+	LIMIT $4 OFFSET $5
+`
 
-SELECT b.username, date_trunc('month', b.expense_date)::date AS event_date, SUM(price)::float AS expenses_sum, s.salary, 0.0::float AS owes
+type ListSalariesParams struct {
+	Username  sql.NullString `json:"username"`
+	StartDate sql.NullTime   `json:"start_date"`
+	EndDate   sql.NullTime   `json:"end_date"`
+	RowLimit  int32          `json:"row_limit"`
+	RowOffset int32          `json:"row_offset"`
+}
+
+func (q *Queries) ListSalaries(ctx context.Context, arg ListSalariesParams) ([]*BudgetSchemaSalary, error) {
+	rows, err := q.db.Query(ctx, listSalaries,
+		arg.Username,
+		arg.StartDate,
+		arg.EndDate,
+		arg.RowLimit,
+		arg.RowOffset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*BudgetSchemaSalary
+	for rows.Next() {
+		var i BudgetSchemaSalary
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.Salary,
+			&i.StoreDate,
+			&i.DeletedAt,
+			&i.IdempotencyKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSalaryUsernames = `-- name: ListSalaryUsernames :many
+-- The users of the household are the ones who have stored a salary
+SELECT DISTINCT username FROM budget_schema.salary
+	WHERE deleted_at IS NULL
+	ORDER BY username
+`
+
+// The users of the household are the ones who have stored a salary
+func (q *Queries) ListSalaryUsernames(ctx context.Context) ([]string, error) {
+	rows, err := q.db.Query(ctx, listSalaryUsernames)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		items = append(items, username)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const restoreExpenseByID = `-- name: RestoreExpenseByID :one
+UPDATE budget_schema.expense
+	SET deleted_at = NULL
+	WHERE id = $1 AND username = $2 AND deleted_at IS NOT NULL
+	RETURNING id, username, shop_name, category, price, expense_date, deleted_at, idempotency_key, created_at, sharing, owed_by
+`
+
+type RestoreExpenseByIDParams struct {
+	ID       int32  `json:"id"`
+	Username string `json:"username"`
+}
+
+func (q *Queries) RestoreExpenseByID(ctx context.Context, arg RestoreExpenseByIDParams) (*BudgetSchemaExpense, error) {
+	row := q.db.QueryRow(ctx, restoreExpenseByID, arg.ID, arg.Username)
+	var i BudgetSchemaExpense
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.ShopName,
+		&i.Category,
+		&i.Price,
+		&i.ExpenseDate,
+		&i.DeletedAt,
+		&i.IdempotencyKey,
+		&i.CreatedAt,
+		&i.Sharing,
+		&i.OwedBy,
+	)
+	return &i, err
+}
+
+const restoreSalaryByID = `-- name: RestoreSalaryByID :one
+UPDATE budget_schema.salary
+	SET deleted_at = NULL
+	WHERE id = $1 AND username = $2 AND deleted_at IS NOT NULL
+	RETURNING id, username, salary, store_date, deleted_at, idempotency_key
+`
+
+type RestoreSalaryByIDParams struct {
+	ID       int32  `json:"id"`
+	Username string `json:"username"`
+}
+
+func (q *Queries) RestoreSalaryByID(ctx context.Context, arg RestoreSalaryByIDParams) (*BudgetSchemaSalary, error) {
+	row := q.db.QueryRow(ctx, restoreSalaryByID, arg.ID, arg.Username)
+	var i BudgetSchemaSalary
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Salary,
+		&i.StoreDate,
+		&i.DeletedAt,
+		&i.IdempotencyKey,
+	)
+	return &i, err
+}
+
+const revokeLink = `-- name: RevokeLink :exec
+INSERT INTO budget_schema.revoked_link (
+	link_id,
+	revoked_by
+) VALUES (
+	$1,
+	$2
+) ON CONFLICT (link_id) DO NOTHING
+`
+
+type RevokeLinkParams struct {
+	LinkID    string `json:"link_id"`
+	RevokedBy string `json:"revoked_by"`
+}
+
+func (q *Queries) RevokeLink(ctx context.Context, arg RevokeLinkParams) error {
+	_, err := q.db.Exec(ctx, revokeLink, arg.LinkID, arg.RevokedBy)
+	return err
+}
+
+const statisticsAggrByTimespan = `-- name: StatisticsAggrByTimespan :many
+-- expenses_sum has only the shared expenses, the personal ones and the ones
+-- paid for the others are summed separately
+SELECT b.username, date_trunc('month', b.expense_date)::date AS event_date,
+	COALESCE(SUM(price) FILTER (WHERE b.sharing = 'shared'), 0)::float AS expenses_sum,
+	COALESCE(SUM(price) FILTER (WHERE b.sharing = 'personal'), 0)::float AS personal_sum,
+	COALESCE(SUM(price) FILTER (WHERE b.sharing = 'owed'), 0)::float AS paid_for_others_sum,
+	s.salary, 0.0::float AS owes
 		FROM budget_schema.expense AS b
         JOIN budget_schema.salary AS s ON b.username = s.username
 		AND date_trunc('month', s.store_date) = date_trunc('month', b.expense_date)
-	WHERE b.expense_date BETWEEN date_trunc('month', $1::date)::date
+		AND s.deleted_at IS NULL
+	WHERE b.deleted_at IS NULL AND (b.expense_date BETWEEN date_trunc('month', $1::date)::date
 		AND date_trunc('month', $2::date)::date + interval '1 month - 1 day'
 		OR s.store_date BETWEEN date_trunc('month', $1::date)::date
-		AND date_trunc('month', $2::date)::date + interval '1 month - 1 day'
+		AND date_trunc('month', $2::date)::date + interval '1 month - 1 day')
 	GROUP BY b.username, date_trunc('month', b.expense_date), s.salary
 	ORDER BY b.username, date_trunc('month', b.expense_date), expenses_sum
 `
@@ -278,16 +1225,20 @@ type StatisticsAggrByTimespanParams struct {
 }
 
 type StatisticsAggrByTimespanRow struct {
-	Username    string    `json:"username"`
-	EventDate   time.Time `json:"event_date"`
-	ExpensesSum float64   `json:"expenses_sum"`
-	Salary      float64   `json:"salary"`
-	Owes        float64   `json:"owes"`
+	Username         string    `json:"username"`
+	EventDate        time.Time `json:"event_date"`
+	ExpensesSum      float64   `json:"expenses_sum"`
+	PersonalSum      float64   `json:"personal_sum"`
+	PaidForOthersSum float64   `json:"paid_for_others_sum"`
+	Salary           float64   `json:"salary"`
+	Owes             float64   `json:"owes"`
 }
 
 //
 // Miscellaneous
 //
+// expenses_sum has only the shared expenses, the personal ones and the ones
+// paid for the others are summed separately
 func (q *Queries) StatisticsAggrByTimespan(ctx context.Context, arg StatisticsAggrByTimespanParams) ([]*StatisticsAggrByTimespanRow, error) {
 	rows, err := q.db.Query(ctx, statisticsAggrByTimespan, arg.StartTime, arg.EndTime)
 	if err != nil {
@@ -301,6 +1252,8 @@ func (q *Queries) StatisticsAggrByTimespan(ctx context.Context, arg StatisticsAg
 			&i.Username,
 			&i.EventDate,
 			&i.ExpensesSum,
+			&i.PersonalSum,
+			&i.PaidForOthersSum,
 			&i.Salary,
 			&i.Owes,
 		); err != nil {
@@ -313,3 +1266,97 @@ func (q *Queries) StatisticsAggrByTimespan(ctx context.Context, arg StatisticsAg
 	}
 	return items, nil
 }
+
+const takeShortLivedPage = `-- name: TakeShortLivedPage :one
+DELETE FROM budget_schema.short_lived_page WHERE hash = $1
+RETURNING hash, html, start_time, ttl_seconds, burn_after_read, pin_hash
+`
+
+func (q *Queries) TakeShortLivedPage(ctx context.Context, hash string) (*BudgetSchemaShortLivedPage, error) {
+	row := q.db.QueryRow(ctx, takeShortLivedPage, hash)
+	var i BudgetSchemaShortLivedPage
+	err := row.Scan(
+		&i.Hash,
+		&i.Html,
+		&i.StartTime,
+		&i.TtlSeconds,
+		&i.BurnAfterRead,
+		&i.PinHash,
+	)
+	return &i, err
+}
+
+const updateExpenseByID = `-- name: UpdateExpenseByID :one
+UPDATE budget_schema.expense
+	SET shop_name = $3, category = $4, price = $5, expense_date = $6
+	WHERE id = $1 AND username = $2 AND deleted_at IS NULL
+	RETURNING id, username, shop_name, category, price, expense_date, deleted_at, idempotency_key, created_at, sharing, owed_by
+`
+
+type UpdateExpenseByIDParams struct {
+	ID          int32     `json:"id"`
+	Username    string    `json:"username"`
+	ShopName    string    `json:"shop_name"`
+	Category    string    `json:"category"`
+	Price       float64   `json:"price"`
+	ExpenseDate time.Time `json:"expense_date"`
+}
+
+func (q *Queries) UpdateExpenseByID(ctx context.Context, arg UpdateExpenseByIDParams) (*BudgetSchemaExpense, error) {
+	row := q.db.QueryRow(ctx, updateExpenseByID,
+		arg.ID,
+		arg.Username,
+		arg.ShopName,
+		arg.Category,
+		arg.Price,
+		arg.ExpenseDate,
+	)
+	var i BudgetSchemaExpense
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.ShopName,
+		&i.Category,
+		&i.Price,
+		&i.ExpenseDate,
+		&i.DeletedAt,
+		&i.IdempotencyKey,
+		&i.CreatedAt,
+		&i.Sharing,
+		&i.OwedBy,
+	)
+	return &i, err
+}
+
+const updateSalaryByID = `-- name: UpdateSalaryByID :one
+UPDATE budget_schema.salary
+	SET salary = $3, store_date = $4
+	WHERE id = $1 AND username = $2 AND deleted_at IS NULL
+	RETURNING id, username, salary, store_date, deleted_at, idempotency_key
+`
+
+type UpdateSalaryByIDParams struct {
+	ID        int32     `json:"id"`
+	Username  string    `json:"username"`
+	Salary    float64   `json:"salary"`
+	StoreDate time.Time `json:"store_date"`
+}
+
+func (q *Queries) UpdateSalaryByID(ctx context.Context, arg UpdateSalaryByIDParams) (*BudgetSchemaSalary, error) {
+	row := q.db.QueryRow(ctx, updateSalaryByID,
+		arg.ID,
+		arg.Username,
+		arg.Salary,
+		arg.StoreDate,
+	)
+	var i BudgetSchemaSalary
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Salary,
+		&i.StoreDate,
+		&i.DeletedAt,
+		&i.IdempotencyKey,
+	)
+	return &i, err
+}
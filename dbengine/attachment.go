@@ -0,0 +1,130 @@
+package dbengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+	"weezel/budget/blobstore"
+	"weezel/budget/db"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// AddAttachment links the file in the blob store to the expense
+func (s *Store) AddAttachment(ctx context.Context, expenseID int32, hash, contentType string, size int64) error {
+	return s.q.AddAttachment(ctx, db.AddAttachmentParams{
+		ExpenseID:   expenseID,
+		Hash:        hash,
+		ContentType: contentType,
+		SizeBytes:   size,
+	})
+}
+
+// GetAttachmentByHash returns the first attachment of the file. pgx.ErrNoRows
+// is returned when the file isn't attached to any expense left undeleted.
+func (s *Store) GetAttachmentByHash(ctx context.Context, hash string) (*db.BudgetSchemaAttachment, error) {
+	return s.q.GetAttachmentByHash(ctx, hash)
+}
+
+// ListAttachmentsByTimespan returns the attachments of the expenses between
+// the days, including both ends, ordered by the expense
+func (s *Store) ListAttachmentsByTimespan(
+	ctx context.Context,
+	startDate,
+	endDate time.Time,
+) ([]*db.ListAttachmentsByTimespanRow, error) {
+	return s.q.ListAttachmentsByTimespan(ctx, db.ListAttachmentsByTimespanParams{
+		StartDate: startDate,
+		EndDate:   endDate,
+	})
+}
+
+// LargeObjectStore keeps the blobs as PostgreSQL large objects, so that they
+// are backed up with the database. The objects are found by the hash from
+// the blob table.
+type LargeObjectStore struct {
+	dbPool *pgxpool.Pool
+}
+
+var _ blobstore.Store = (*LargeObjectStore)(nil)
+
+func NewLargeObjectStore(dbPool *pgxpool.Pool) *LargeObjectStore {
+	return &LargeObjectStore{dbPool: dbPool}
+}
+
+// Put stores the object and its hash in the same transaction, a failed Put
+// leaves nothing behind
+func (l *LargeObjectStore) Put(ctx context.Context, data []byte) (string, error) {
+	hash := blobstore.Hash(data)
+	err := l.dbPool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		q := db.New(timedDB{db: tx})
+		_, err := q.GetBlob(ctx, hash)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		objects := tx.LargeObjects()
+		oid, err := objects.Create(ctx, 0)
+		if err != nil {
+			return err
+		}
+		obj, err := objects.Open(ctx, oid, pgx.LargeObjectModeWrite)
+		if err != nil {
+			return err
+		}
+		if _, err = obj.Write(data); err != nil {
+			return err
+		}
+		if err = obj.Close(); err != nil {
+			return err
+		}
+		return q.AddBlob(ctx, db.AddBlobParams{
+			Hash:      hash,
+			ObjectID:  oid,
+			SizeBytes: int64(len(data)),
+		})
+	})
+	// Stored by a concurrent Put
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return hash, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("large object: %w", err)
+	}
+	return hash, nil
+}
+
+func (l *LargeObjectStore) Get(ctx context.Context, hash string) ([]byte, error) {
+	var data []byte
+	err := l.dbPool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		blob, err := db.New(timedDB{db: tx}).GetBlob(ctx, hash)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return blobstore.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		objects := tx.LargeObjects()
+		obj, err := objects.Open(ctx, blob.ObjectID, pgx.LargeObjectModeRead)
+		if err != nil {
+			return err
+		}
+		data, err = io.ReadAll(obj)
+		return err
+	})
+	if errors.Is(err, blobstore.ErrNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("large object: %w", err)
+	}
+	return data, nil
+}
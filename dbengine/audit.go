@@ -0,0 +1,83 @@
+package dbengine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"weezel/budget/db"
+)
+
+// Sources of the changes, stored in the audit log
+const (
+	SourceBot    = "bot"
+	SourceWeb    = "web"
+	SourceImport = "import"
+)
+
+// Actions of the audit log entries
+const (
+	ActionInsert  = "insert"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+)
+
+// Tables of the audit log entries
+const (
+	TableExpense = "expense"
+	TableSalary  = "salary"
+)
+
+// WithSource returns a Store recording its changes with the source, e.g.
+// SourceWeb. Changes are attributed to the bot by default.
+func (s *Store) WithSource(source string) *Store {
+	return &Store{q: s.q, tx: s.tx, source: source, key: s.key, queue: s.queue, sharing: s.sharing}
+}
+
+// inTx runs fn in a transaction when the store supports them, so that the
+// change and its audit log entry are stored together
+func (s *Store) inTx(ctx context.Context, fn func(q db.Querier) error) error {
+	if s.tx == nil {
+		return fn(s.q)
+	}
+	return s.tx.InTx(ctx, fn)
+}
+
+// audit records the change of the row made by actor. Before and after are
+// stored as JSON, nil as null.
+func (s *Store) audit(
+	ctx context.Context,
+	q db.Querier,
+	actor string,
+	action string,
+	table string,
+	rowID int32,
+	before any,
+	after any,
+) error {
+	beforeRow, err := json.Marshal(before)
+	if err != nil {
+		return fmt.Errorf("audit %s %d: %w", table, rowID, err)
+	}
+	afterRow, err := json.Marshal(after)
+	if err != nil {
+		return fmt.Errorf("audit %s %d: %w", table, rowID, err)
+	}
+	return q.AddAuditLog(ctx, db.AddAuditLogParams{
+		Actor:     actor,
+		Source:    s.source,
+		Action:    action,
+		TableName: table,
+		RowID:     rowID,
+		BeforeRow: beforeRow,
+		AfterRow:  afterRow,
+	})
+}
+
+// ListAuditLog returns the changes of expenses and salaries, newest first
+func (s *Store) ListAuditLog(ctx context.Context, limit int32, offset int32) ([]*db.BudgetSchemaAuditLog, error) {
+	return s.q.ListAuditLog(ctx, db.ListAuditLogParams{
+		RowLimit:  limit,
+		RowOffset: offset,
+	})
+}
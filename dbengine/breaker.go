@@ -0,0 +1,196 @@
+package dbengine
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"weezel/budget/logger"
+
+	"github.com/jackc/pgconn"
+)
+
+// ErrUnavailable is returned without querying while the breaker is open
+var ErrUnavailable = errors.New("database unavailable")
+
+const (
+	breakerThreshold = 3
+	monitorInterval  = 30 * time.Second
+	minBackoff       = time.Second
+	maxBackoff       = time.Minute
+)
+
+// Breaker fails the queries fast after consecutive connection errors, so that
+// the handlers don't wait for a database which is down. Monitor closes the
+// breaker again once the database answers.
+type Breaker struct {
+	lock     sync.Mutex
+	failures int
+	open     bool
+	// tripped wakes up Monitor when the breaker opens
+	tripped chan struct{}
+
+	threshold  int
+	interval   time.Duration
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// NewBreaker returns a closed Breaker, which opens after a few consecutive
+// connection errors
+func NewBreaker() *Breaker {
+	return &Breaker{
+		tripped:    make(chan struct{}, 1),
+		threshold:  breakerThreshold,
+		interval:   monitorInterval,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+	}
+}
+
+// Allow returns ErrUnavailable when the breaker is open. Nil Breaker allows
+// everything.
+func (b *Breaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.open {
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// Open tells whether the queries are failed fast
+func (b *Breaker) Open() bool {
+	return b.Allow() != nil
+}
+
+// Record counts the connection errors. Any other result, including the
+// errors of the queries themselves, proves the database is up.
+func (b *Breaker) Record(err error) {
+	if b == nil {
+		return
+	}
+	if !isConnError(err) {
+		b.lock.Lock()
+		b.failures = 0
+		b.lock.Unlock()
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.failures++
+	if b.open || b.failures < b.threshold {
+		return
+	}
+	b.open = true
+	logger.Warnf("Database unavailable after %d failed queries: %v", b.failures, err)
+	select {
+	case b.tripped <- struct{}{}:
+	default:
+	}
+}
+
+// close lets the queries through again and tells whether the breaker was open
+func (b *Breaker) close() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	wasOpen := b.open
+	b.open = false
+	b.failures = 0
+	return wasOpen
+}
+
+func (b *Breaker) trip() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.open = true
+}
+
+// backoff returns the delay before the nth retry, doubled on every retry
+func (b *Breaker) backoff(attempt int) time.Duration {
+	delay := b.minBackoff
+	for range attempt {
+		delay *= 2
+		if delay >= b.maxBackoff {
+			return b.maxBackoff
+		}
+	}
+	return delay
+}
+
+// Monitor pings the database on an interval until ctx is done. When a ping
+// fails or the queries trip the breaker, the breaker is kept open and the
+// pings are retried with exponential backoff. Once the database answers, the
+// breaker is closed and onRecover is called.
+func (b *Breaker) Monitor(
+	ctx context.Context,
+	ping func(ctx context.Context) error,
+	onRecover func(ctx context.Context),
+) {
+	attempt := 0
+	delay := b.interval
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.tripped:
+		case <-time.After(delay):
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err := ping(pingCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			if attempt == 0 {
+				logger.Warnf("Database unavailable, retrying with backoff: %v", err)
+			}
+			b.trip()
+			delay = b.backoff(attempt)
+			attempt++
+			continue
+		}
+
+		attempt = 0
+		delay = b.interval
+		if b.close() {
+			logger.Info("Database available again")
+			if onRecover != nil {
+				onRecover(ctx)
+			}
+		}
+	}
+}
+
+// isConnError tells the broken connections apart from the failed queries.
+// Cancelled requests don't tell anything about the database.
+func isConnError(err error) bool {
+	if err == nil ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Class 08 is connection exceptions, 57P01-57P03 are shutdowns
+		return strings.HasPrefix(pgErr.Code, "08") ||
+			pgErr.Code == "57P01" || pgErr.Code == "57P02" || pgErr.Code == "57P03"
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		pgconn.Timeout(err)
+}
@@ -0,0 +1,115 @@
+package dbengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+func TestIsConnError(t *testing.T) {
+	tests := map[string]struct {
+		err  error
+		want bool
+	}{
+		"nil":          {nil, false},
+		"no rows":      {pgx.ErrNoRows, false},
+		"unique":       {&pgconn.PgError{Code: "23505"}, false},
+		"cancelled":    {context.Canceled, false},
+		"deadline":     {fmt.Errorf("query: %w", context.DeadlineExceeded), false},
+		"refused":      {&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		"eof":          {fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		"admin":        {&pgconn.PgError{Code: "57P01"}, true},
+		"conn failure": {&pgconn.PgError{Code: "08006"}, true},
+	}
+	for name, tt := range tests {
+		if got := isConnError(tt.err); got != tt.want {
+			t.Errorf("%s: isConnError(%v) = %t, expected %t", name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	b := NewBreaker()
+	connErr := &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}
+
+	b.Record(connErr)
+	b.Record(connErr)
+	// Answers of the database reset the count
+	b.Record(pgx.ErrNoRows)
+	b.Record(connErr)
+	b.Record(connErr)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("breaker opened before %d consecutive failures: %v", breakerThreshold, err)
+	}
+	b.Record(connErr)
+	if err := b.Allow(); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("open breaker returned %v, expected ErrUnavailable", err)
+	}
+	if !b.close() || b.Open() {
+		t.Error("breaker didn't close")
+	}
+
+	var nilBreaker *Breaker
+	nilBreaker.Record(connErr)
+	if err := nilBreaker.Allow(); err != nil {
+		t.Errorf("nil breaker returned %v", err)
+	}
+}
+
+func TestBreakerBackoff(t *testing.T) {
+	b := NewBreaker()
+	want := []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second,
+		16 * time.Second, 32 * time.Second, time.Minute, time.Minute,
+	}
+	for attempt, expected := range want {
+		if got := b.backoff(attempt); got != expected {
+			t.Errorf("backoff(%d) = %s, expected %s", attempt, got, expected)
+		}
+	}
+}
+
+func TestBreakerMonitor(t *testing.T) {
+	b := NewBreaker()
+	b.interval = time.Hour
+	b.minBackoff = time.Millisecond
+	b.maxBackoff = 4 * time.Millisecond
+
+	var pings atomic.Int32
+	ping := func(context.Context) error {
+		// The database answers on the third ping
+		if pings.Add(1) < 3 {
+			return io.EOF
+		}
+		return nil
+	}
+	recovered := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Monitor(ctx, ping, func(context.Context) { close(recovered) })
+
+	// Failing queries wake up the monitor before the interval
+	for range breakerThreshold {
+		b.Record(io.EOF)
+	}
+	select {
+	case <-recovered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("monitor didn't recover")
+	}
+	if b.Open() {
+		t.Error("breaker still open after recovery")
+	}
+	if got := pings.Load(); got != 3 {
+		t.Errorf("pinged %d times, expected 3", got)
+	}
+}
@@ -2,9 +2,10 @@ package dbengine
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"math"
-	"sync"
 	"time"
 	"weezel/budget/confighandler"
 	"weezel/budget/db"
@@ -17,28 +18,51 @@ const (
 	dbConnRetries = 3
 )
 
-var (
-	once   sync.Once
-	dbPool *pgxpool.Pool
-	dbErr  error
-)
+// Filter limits listed rows. Zero values match everything.
+type Filter struct {
+	Username  string
+	Category  string
+	StartDate time.Time
+	EndDate   time.Time
+	// Sort is one of ExpenseSortKeys, prefixed with '-' for descending order.
+	// Only expenses can be sorted, they're listed newest first by default.
+	Sort string
+}
+
+// ExpenseSortKeys are the columns expenses can be sorted by
+var ExpenseSortKeys = []string{"date", "shop", "category", "username", "price"}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
 
-// New initializes database once. Also known as singleton.
+// New connects to the database. The connection is retried a few times, since
+// the database might still be starting up.
 func New(ctx context.Context, dbConf confighandler.Postgres) (*pgxpool.Pool, error) {
-	once.Do(func() {
-		// TODO Use unix-socket
-		pgConfigURL := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
-			dbConf.Username, dbConf.Password, dbConf.Hostname, dbConf.Port, dbConf.Database)
-		dbPool, dbErr = pgxpool.Connect(ctx, pgConfigURL)
-		if dbErr != nil {
-			logger.Fatal(dbErr)
-		}
-	})
+	poolConf, err := pgxpool.ParseConfig(PostgresDSN(dbConf))
+	if err != nil {
+		return nil, fmt.Errorf("postgres config: %w", err)
+	}
+	if dbConf.MaxConns > 0 {
+		poolConf.MaxConns = dbConf.MaxConns
+	}
+	if dbConf.MinConns > 0 {
+		poolConf.MinConns = dbConf.MinConns
+	}
+
+	dbPool, err := pgxpool.ConnectConfig(ctx, poolConf)
+	if err != nil {
+		return nil, err
+	}
 
 	retries := 0
 	started := time.Now()
 	for {
-		if dbErr = dbPool.Ping(ctx); dbErr == nil {
+		if err = dbPool.Ping(ctx); err == nil {
 			break
 		}
 		delay := math.Ceil(math.Pow(2, float64(retries)))
@@ -49,14 +73,111 @@ func New(ctx context.Context, dbConf confighandler.Postgres) (*pgxpool.Pool, err
 			retries, dbConnRetries, time.Since(started))
 
 		if retries > dbConnRetries {
+			dbPool.Close()
 			return nil, fmt.Errorf("Couldn't connect to database after %d retries", retries-1)
 		}
 	}
 
-	return dbPool, dbErr
+	return dbPool, nil
+}
+
+// CheckPool returns a health check pinging the database through the pool
+func CheckPool(dbPool *pgxpool.Pool) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		if dbPool == nil {
+			return "", errors.New("not connected")
+		}
+		stat := dbPool.Stat()
+		detail := fmt.Sprintf("%d/%d connections in use, max %d",
+			stat.AcquiredConns(), stat.TotalConns(), stat.MaxConns())
+		return detail, dbPool.Ping(ctx)
+	}
+}
+
+// Store runs the queries of the bot and the web server. The queries can be
+// served by anything implementing db.Querier, e.g. the in-memory fake in
+// dbenginetest. Changes of expenses and salaries are recorded in the audit
+// log, deleted rows are only marked deleted.
+type Store struct {
+	q      db.Querier
+	tx     Transactor
+	source string
+	// key is the idempotency key of the inserts, see WithIdempotencyKey
+	key string
+	// queue keeps the inserts while the database is down, see WithQueue
+	queue *WriteQueue
+	// sharing tells who pays the added expenses, see WithSharing
+	sharing Sharing
+}
+
+// Transactor runs fn in a transaction. The transaction is committed when fn
+// returns nil and rolled back otherwise. Queries of fn must go through q.
+type Transactor interface {
+	InTx(ctx context.Context, fn func(q db.Querier) error) error
+}
+
+// NewStore returns a Store using q. Transactions are supported when q is a
+// Transactor too.
+func NewStore(q db.Querier) *Store {
+	tx, _ := q.(Transactor)
+	return &Store{q: q, tx: tx, source: SourceBot}
+}
+
+// NewPostgresStore returns a Store using the pool. Durations of the queries
+// are measured. The queries fail with ErrUnavailable while the breaker is
+// open, nil breaker is never opened.
+func NewPostgresStore(dbPool *pgxpool.Pool, breaker *Breaker) *Store {
+	return &Store{
+		q:      db.New(timedDB{db: dbPool, breaker: breaker}),
+		tx:     pgTransactor{dbPool: dbPool, breaker: breaker},
+		source: SourceBot,
+	}
+}
+
+type pgTransactor struct {
+	dbPool  *pgxpool.Pool
+	breaker *Breaker
+}
+
+func (p pgTransactor) InTx(ctx context.Context, fn func(q db.Querier) error) error {
+	if err := p.breaker.Allow(); err != nil {
+		return err
+	}
+	tx, err := p.dbPool.Begin(ctx)
+	p.breaker.Record(err)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // Does nothing after the commit
+	if err = fn(db.New(timedDB{db: tx, breaker: p.breaker})); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// joinedTx runs the nested transactions in the outer one
+type joinedTx struct {
+	q db.Querier
+}
+
+func (j joinedTx) InTx(ctx context.Context, fn func(q db.Querier) error) error {
+	return fn(j.q)
+}
+
+// WithTx runs fn in a transaction, either all of its changes are stored or
+// none of them. fn must use only the Store it's given, the connection of the
+// transaction is reserved until fn returns. WithTx of the given Store runs
+// in the same transaction.
+func (s *Store) WithTx(ctx context.Context, fn func(tx *Store) error) error {
+	if s.tx == nil {
+		return errors.New("transactions are not supported by the store")
+	}
+	return s.tx.InTx(ctx, func(q db.Querier) error {
+		return fn(&Store{q: q, tx: joinedTx{q: q}, source: s.source, key: s.key, sharing: s.sharing})
+	})
 }
 
-func AddExpense(
+func (s *Store) AddExpense(
 	ctx context.Context,
 	username string,
 	shopName string,
@@ -64,88 +185,467 @@ func AddExpense(
 	expenseDate time.Time,
 	price float64,
 ) (int32, error) {
-	bdb := db.New(dbPool)
-	return bdb.AddExpense(ctx, db.AddExpenseParams{
-		Username:    username,
-		ShopName:    shopName,
-		Category:    category,
-		Price:       price,
-		ExpenseDate: expenseDate,
+	var id int32
+	err := s.inTx(ctx, func(q db.Querier) error {
+		var err error
+		id, err = q.AddExpense(ctx, db.AddExpenseParams{
+			Username:       username,
+			ShopName:       shopName,
+			Category:       category,
+			Price:          price,
+			ExpenseDate:    expenseDate,
+			IdempotencyKey: nullString(s.key),
+			Sharing:        s.sharing.mode(),
+			OwedBy:         s.sharing.OwedBy,
+		})
+		if err != nil {
+			return s.duplicateErr(err)
+		}
+		added, err := q.GetExpenseByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		return s.audit(ctx, q, username, ActionInsert, TableExpense, id, nil, added)
 	})
+	if err != nil {
+		return 0, s.enqueue(err, QueuedWrite{
+			Kind:     QueuedExpense,
+			Username: username,
+			ShopName: shopName,
+			Category: category,
+			Date:     expenseDate,
+			Amount:   price,
+			Sharing:  s.sharing.Mode,
+			OwedBy:   s.sharing.OwedBy,
+		})
+	}
+	return id, nil
 }
 
-func DeleteExpenseByID(ctx context.Context, bid int32, username string) (*db.BudgetSchemaExpense, error) {
-	bdb := db.New(dbPool)
-	return bdb.DeleteExpenseByID(ctx, db.DeleteExpenseByIDParams{
-		ID:       bid,
-		Username: username,
+// AddExpenses adds the expenses at once and returns how many were added.
+// With PostgreSQL the rows are copied in a single command. The IDs aren't
+// known, each user's expenses are audited as one entry with row ID 0.
+func (s *Store) AddExpenses(ctx context.Context, expenses []db.AddExpensesParams) (int64, error) {
+	expenses = expenseSharing(expenses)
+	var added int64
+	err := s.inTx(ctx, func(q db.Querier) error {
+		var err error
+		if added, err = q.AddExpenses(ctx, expenses); err != nil {
+			return err
+		}
+		byUser := map[string][]db.AddExpensesParams{}
+		var users []string
+		for _, e := range expenses {
+			if _, found := byUser[e.Username]; !found {
+				users = append(users, e.Username)
+			}
+			byUser[e.Username] = append(byUser[e.Username], e)
+		}
+		for _, username := range users {
+			// Bulk inserts don't return the IDs, the rows are logged per user
+			err = s.audit(ctx, q, username, ActionInsert, TableExpense, 0, nil, byUser[username])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
 	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
 }
 
-func GetAggrExpensesByTimespan(
+// DeleteExpenseByID marks the expense deleted if it belongs to the user
+func (s *Store) DeleteExpenseByID(ctx context.Context, bid int32, username string) (*db.BudgetSchemaExpense, error) {
+	var deleted *db.BudgetSchemaExpense
+	err := s.inTx(ctx, func(q db.Querier) error {
+		var err error
+		deleted, err = q.DeleteExpenseByID(ctx, db.DeleteExpenseByIDParams{
+			ID:       bid,
+			Username: username,
+		})
+		if err != nil {
+			return err
+		}
+		return s.audit(ctx, q, username, ActionDelete, TableExpense, bid, deleted, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// RestoreExpenseByID brings back the deleted expense if it belongs to the user
+func (s *Store) RestoreExpenseByID(ctx context.Context, id int32, username string) (*db.BudgetSchemaExpense, error) {
+	var restored *db.BudgetSchemaExpense
+	err := s.inTx(ctx, func(q db.Querier) error {
+		var err error
+		restored, err = q.RestoreExpenseByID(ctx, db.RestoreExpenseByIDParams{
+			ID:       id,
+			Username: username,
+		})
+		if err != nil {
+			return err
+		}
+		return s.audit(ctx, q, username, ActionRestore, TableExpense, id, nil, restored)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+func (s *Store) GetExpenseByID(ctx context.Context, id int32) (*db.BudgetSchemaExpense, error) {
+	return s.q.GetExpenseByID(ctx, id)
+}
+
+// UpdateExpenseByID updates the expense only if it belongs to the user
+func (s *Store) UpdateExpenseByID(
+	ctx context.Context,
+	id int32,
+	username string,
+	shopName string,
+	category string,
+	expenseDate time.Time,
+	price float64,
+) (*db.BudgetSchemaExpense, error) {
+	var updated *db.BudgetSchemaExpense
+	err := s.inTx(ctx, func(q db.Querier) error {
+		before, err := q.GetExpenseByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		updated, err = q.UpdateExpenseByID(ctx, db.UpdateExpenseByIDParams{
+			ID:          id,
+			Username:    username,
+			ShopName:    shopName,
+			Category:    category,
+			Price:       price,
+			ExpenseDate: expenseDate,
+		})
+		if err != nil {
+			return err
+		}
+		return s.audit(ctx, q, username, ActionUpdate, TableExpense, id, before, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// ListExpenses returns expenses matching the filter
+func (s *Store) ListExpenses(
+	ctx context.Context,
+	filter Filter,
+	limit int32,
+	offset int32,
+) ([]*db.BudgetSchemaExpense, error) {
+	return s.q.ListExpenses(ctx, db.ListExpensesParams{
+		Username:  nullString(filter.Username),
+		Category:  nullString(filter.Category),
+		StartDate: nullTime(filter.StartDate),
+		EndDate:   nullTime(filter.EndDate),
+		SortBy:    filter.Sort,
+		RowLimit:  limit,
+		RowOffset: offset,
+	})
+}
+
+func (s *Store) GetAggrExpensesByTimespan(
 	ctx context.Context,
 	startTime,
 	endTime time.Time,
 ) ([]*db.GetAggrExpensesByTimespanRow, error) {
-	bdb := db.New(dbPool)
-	return bdb.GetAggrExpensesByTimespan(ctx, db.GetAggrExpensesByTimespanParams{
+	return s.q.GetAggrExpensesByTimespan(ctx, db.GetAggrExpensesByTimespanParams{
 		StartTime: startTime,
 		EndTime:   endTime,
 	})
 }
 
-func GetExpensesByTimespan(ctx context.Context, startTime, endTime time.Time) ([]*db.GetExpensesByTimespanRow, error) {
-	bdb := db.New(dbPool)
-	return bdb.GetExpensesByTimespan(ctx, db.GetExpensesByTimespanParams{
+func (s *Store) GetExpensesByTimespan(
+	ctx context.Context,
+	startTime,
+	endTime time.Time,
+) ([]*db.GetExpensesByTimespanRow, error) {
+	return s.q.GetExpensesByTimespan(ctx, db.GetExpensesByTimespanParams{
 		StartTime: startTime,
 		EndTime:   endTime,
 	})
 }
 
-func AddSalary(ctx context.Context, username string, salary float64, storeDate time.Time) (int32, error) {
-	bdb := db.New(dbPool)
-	return bdb.AddSalary(ctx, db.AddSalaryParams{
-		Username:  username,
-		Salary:    salary,
-		StoreDate: storeDate,
+func (s *Store) GetCategoryExpensesByTimespan(
+	ctx context.Context,
+	startTime,
+	endTime time.Time,
+) ([]*db.GetCategoryExpensesByTimespanRow, error) {
+	return s.q.GetCategoryExpensesByTimespan(ctx, db.GetCategoryExpensesByTimespanParams{
+		StartTime: startTime,
+		EndTime:   endTime,
 	})
 }
 
-func DeleteSalaryByID(ctx context.Context, id int32, username string) (*db.BudgetSchemaSalary, error) {
-	bdb := db.New(dbPool)
-	return bdb.DeleteSalaryByID(ctx, db.DeleteSalaryByIDParams{
-		ID:       id,
-		Username: username,
+func (s *Store) GetCategorySharesByTimespan(
+	ctx context.Context,
+	startTime,
+	endTime time.Time,
+) ([]*db.GetCategorySharesByTimespanRow, error) {
+	return s.q.GetCategorySharesByTimespan(ctx, db.GetCategorySharesByTimespanParams{
+		StartTime: startTime,
+		EndTime:   endTime,
+	})
+}
+
+// GetShopPriceHistory returns the latest prices paid in the shop, newest first.
+// Shop name is matched case-insensitively.
+func (s *Store) GetShopPriceHistory(ctx context.Context, shopName string, historyLimit int32) ([]float64, error) {
+	return s.q.GetShopPriceHistory(ctx, db.GetShopPriceHistoryParams{
+		ShopName:     shopName,
+		HistoryLimit: historyLimit,
+	})
+}
+
+// GetCategoryPriceHistory returns the latest prices paid in the category, newest first.
+func (s *Store) GetCategoryPriceHistory(ctx context.Context, category string, historyLimit int32) ([]float64, error) {
+	return s.q.GetCategoryPriceHistory(ctx, db.GetCategoryPriceHistoryParams{
+		Category:     category,
+		HistoryLimit: historyLimit,
+	})
+}
+
+// GetDailyExpensesByTimespan returns expenses summed per day and category. Unlike
+// the monthly queries, both ends of the range are exact days.
+func (s *Store) GetDailyExpensesByTimespan(
+	ctx context.Context,
+	startDate,
+	endDate time.Time,
+) ([]*db.GetDailyExpensesByTimespanRow, error) {
+	return s.q.GetDailyExpensesByTimespan(ctx, db.GetDailyExpensesByTimespanParams{
+		StartDate: startDate,
+		EndDate:   endDate,
+	})
+}
+
+// GetTopShopsByTimespan returns at most shopLimit shops ordered by the money spent on them.
+func (s *Store) GetTopShopsByTimespan(
+	ctx context.Context,
+	startTime,
+	endTime time.Time,
+	shopLimit int32,
+) ([]*db.GetTopShopsByTimespanRow, error) {
+	return s.q.GetTopShopsByTimespan(ctx, db.GetTopShopsByTimespanParams{
+		StartTime: startTime,
+		EndTime:   endTime,
+		ShopLimit: shopLimit,
+	})
+}
+
+func (s *Store) AddSalary(ctx context.Context, username string, salary float64, storeDate time.Time) (int32, error) {
+	var id int32
+	err := s.inTx(ctx, func(q db.Querier) error {
+		var err error
+		id, err = q.AddSalary(ctx, db.AddSalaryParams{
+			Username:       username,
+			Salary:         salary,
+			StoreDate:      storeDate,
+			IdempotencyKey: nullString(s.key),
+		})
+		if err != nil {
+			return s.duplicateErr(err)
+		}
+		added, err := q.GetSalaryByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		return s.audit(ctx, q, username, ActionInsert, TableSalary, id, nil, added)
+	})
+	if err != nil {
+		return 0, s.enqueue(err, QueuedWrite{
+			Kind:     QueuedSalary,
+			Username: username,
+			Date:     storeDate,
+			Amount:   salary,
+		})
+	}
+	return id, nil
+}
+
+// DeleteSalaryByID marks the salary deleted if it belongs to the user
+func (s *Store) DeleteSalaryByID(ctx context.Context, id int32, username string) (*db.BudgetSchemaSalary, error) {
+	var deleted *db.BudgetSchemaSalary
+	err := s.inTx(ctx, func(q db.Querier) error {
+		var err error
+		deleted, err = q.DeleteSalaryByID(ctx, db.DeleteSalaryByIDParams{
+			ID:       id,
+			Username: username,
+		})
+		if err != nil {
+			return err
+		}
+		return s.audit(ctx, q, username, ActionDelete, TableSalary, id, deleted, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// RestoreSalaryByID brings back the deleted salary if it belongs to the user
+func (s *Store) RestoreSalaryByID(ctx context.Context, id int32, username string) (*db.BudgetSchemaSalary, error) {
+	var restored *db.BudgetSchemaSalary
+	err := s.inTx(ctx, func(q db.Querier) error {
+		var err error
+		restored, err = q.RestoreSalaryByID(ctx, db.RestoreSalaryByIDParams{
+			ID:       id,
+			Username: username,
+		})
+		if err != nil {
+			return err
+		}
+		return s.audit(ctx, q, username, ActionRestore, TableSalary, id, nil, restored)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+func (s *Store) GetSalaryByID(ctx context.Context, id int32) (*db.BudgetSchemaSalary, error) {
+	return s.q.GetSalaryByID(ctx, id)
+}
+
+// UpdateSalaryByID updates the salary only if it belongs to the user
+func (s *Store) UpdateSalaryByID(
+	ctx context.Context,
+	id int32,
+	username string,
+	salary float64,
+	storeDate time.Time,
+) (*db.BudgetSchemaSalary, error) {
+	var updated *db.BudgetSchemaSalary
+	err := s.inTx(ctx, func(q db.Querier) error {
+		before, err := q.GetSalaryByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		updated, err = q.UpdateSalaryByID(ctx, db.UpdateSalaryByIDParams{
+			ID:        id,
+			Username:  username,
+			Salary:    salary,
+			StoreDate: storeDate,
+		})
+		if err != nil {
+			return err
+		}
+		return s.audit(ctx, q, username, ActionUpdate, TableSalary, id, before, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// ListSalaries returns salaries matching the filter, newest first. Category
+// of the filter is ignored.
+func (s *Store) ListSalaries(
+	ctx context.Context,
+	filter Filter,
+	limit int32,
+	offset int32,
+) ([]*db.BudgetSchemaSalary, error) {
+	return s.q.ListSalaries(ctx, db.ListSalariesParams{
+		Username:  nullString(filter.Username),
+		StartDate: nullTime(filter.StartDate),
+		EndDate:   nullTime(filter.EndDate),
+		RowLimit:  limit,
+		RowOffset: offset,
 	})
 }
 
-func GetUserSalaryByMonth(ctx context.Context, username string, month time.Time) (float64, error) {
-	bdb := db.New(dbPool)
-	return bdb.GetUserSalaryByMonth(ctx, db.GetUserSalaryByMonthParams{
+// ListSalaryUsernames returns the users of the household, the ones who have
+// stored a salary
+func (s *Store) ListSalaryUsernames(ctx context.Context) ([]string, error) {
+	return s.q.ListSalaryUsernames(ctx)
+}
+
+func (s *Store) GetUserSalaryByMonth(ctx context.Context, username string, month time.Time) (float64, error) {
+	return s.q.GetUserSalaryByMonth(ctx, db.GetUserSalaryByMonthParams{
 		Username: username,
 		Month:    month,
 	})
 }
 
-func GetSalariesByTimespan(
+func (s *Store) GetSalariesByTimespan(
 	ctx context.Context,
 	startTime time.Time,
 	endTime time.Time,
 ) ([]*db.GetSalariesByTimespanRow, error) {
-	bdb := db.New(dbPool)
-	return bdb.GetSalariesByTimespan(ctx, db.GetSalariesByTimespanParams{
+	return s.q.GetSalariesByTimespan(ctx, db.GetSalariesByTimespanParams{
 		StartTime: startTime,
 		EndTime:   endTime,
 	})
 }
 
-func StatisticsByTimespan(
+func (s *Store) IsLinkRevoked(ctx context.Context, linkID string) (bool, error) {
+	return s.q.IsLinkRevoked(ctx, linkID)
+}
+
+func (s *Store) RevokeLink(ctx context.Context, linkID string, revokedBy string) error {
+	return s.q.RevokeLink(ctx, db.RevokeLinkParams{
+		LinkID:    linkID,
+		RevokedBy: revokedBy,
+	})
+}
+
+func (s *Store) AddShortLivedPage(
+	ctx context.Context,
+	hash string,
+	html []byte,
+	startTime time.Time,
+	ttlSeconds int64,
+	burnAfterRead bool,
+	pinHash string,
+) (string, error) {
+	return s.q.AddShortLivedPage(ctx, db.AddShortLivedPageParams{
+		Hash:          hash,
+		Html:          html,
+		StartTime:     startTime,
+		TtlSeconds:    ttlSeconds,
+		BurnAfterRead: burnAfterRead,
+		PinHash:       pinHash,
+	})
+}
+
+func (s *Store) GetShortLivedPage(ctx context.Context, hash string) (*db.BudgetSchemaShortLivedPage, error) {
+	return s.q.GetShortLivedPage(ctx, hash)
+}
+
+func (s *Store) DeleteShortLivedPage(ctx context.Context, hash string) error {
+	return s.q.DeleteShortLivedPage(ctx, hash)
+}
+
+// TakeShortLivedPage removes the page and returns it
+func (s *Store) TakeShortLivedPage(ctx context.Context, hash string) (*db.BudgetSchemaShortLivedPage, error) {
+	return s.q.TakeShortLivedPage(ctx, hash)
+}
+
+// DeleteExpiredShortLivedPages removes pages whose TTL has passed by now and
+// returns how many were removed
+func (s *Store) DeleteExpiredShortLivedPages(ctx context.Context, now time.Time) (int64, error) {
+	return s.q.DeleteExpiredShortLivedPages(ctx, now)
+}
+
+func (s *Store) GetShortLivedPageStats(ctx context.Context) (*db.GetShortLivedPageStatsRow, error) {
+	return s.q.GetShortLivedPageStats(ctx)
+}
+
+func (s *Store) StatisticsByTimespan(
 	ctx context.Context,
 	startTime time.Time,
 	endTime time.Time,
 ) ([]*db.StatisticsAggrByTimespanRow, error) {
-	bdb := db.New(dbPool)
-	stats, err := bdb.StatisticsAggrByTimespan(ctx, db.StatisticsAggrByTimespanParams{
+	stats, err := s.q.StatisticsAggrByTimespan(ctx, db.StatisticsAggrByTimespanParams{
 		StartTime: startTime,
 		EndTime:   endTime,
 	})
@@ -0,0 +1,1287 @@
+// Package dbenginetest provides an in-memory db.Querier for tests, so that
+// code using dbengine.Store can be tested without Postgres. The queries mimic
+// the SQL in sqlc/queries/query.sql, including the ordering of the rows.
+package dbenginetest
+
+import (
+	"context"
+	"database/sql"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"weezel/budget/db"
+	"weezel/budget/dbengine"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// errForeignKeyViolation is what PostgreSQL returns when the referenced row
+// doesn't exist
+var errForeignKeyViolation = &pgconn.PgError{
+	Code:    "23503",
+	Message: "insert or update violates foreign key constraint",
+}
+
+// errUniqueViolation is what PostgreSQL returns when a unique key is reused,
+// e.g. an idempotency key in a COPY
+var errUniqueViolation = &pgconn.PgError{
+	Code:    "23505",
+	Message: "duplicate key value violates unique constraint",
+}
+
+// Querier keeps the tables in maps. Setting Err makes every query fail with it.
+type Querier struct {
+	lock sync.Mutex
+
+	Err error
+
+	nextID       int32
+	expenses     map[int32]db.BudgetSchemaExpense
+	salaries     map[int32]db.BudgetSchemaSalary
+	revokedLinks map[string]db.BudgetSchemaRevokedLink
+	pages        map[string]db.BudgetSchemaShortLivedPage
+	// Soft deleted rows are kept apart, so that the queries don't see them
+	deletedExpenses map[int32]db.BudgetSchemaExpense
+	deletedSalaries map[int32]db.BudgetSchemaSalary
+	auditLog        []db.BudgetSchemaAuditLog
+	attachments     []db.BudgetSchemaAttachment
+	blobs           map[string]db.BudgetSchemaBlob
+}
+
+var (
+	_ db.Querier          = (*Querier)(nil)
+	_ dbengine.Transactor = (*Querier)(nil)
+)
+
+func NewQuerier() *Querier {
+	return &Querier{
+		expenses:     map[int32]db.BudgetSchemaExpense{},
+		salaries:     map[int32]db.BudgetSchemaSalary{},
+		revokedLinks: map[string]db.BudgetSchemaRevokedLink{},
+		pages:        map[string]db.BudgetSchemaShortLivedPage{},
+
+		deletedExpenses: map[int32]db.BudgetSchemaExpense{},
+		deletedSalaries: map[int32]db.BudgetSchemaSalary{},
+		blobs:           map[string]db.BudgetSchemaBlob{},
+	}
+}
+
+// NewStore returns a dbengine.Store using a new Querier
+func NewStore() (*dbengine.Store, *Querier) {
+	q := NewQuerier()
+	return dbengine.NewStore(q), q
+}
+
+// InTx runs fn with the Querier itself. The tables are restored when fn
+// fails, but concurrent queries see the changes before that.
+func (q *Querier) InTx(ctx context.Context, fn func(q db.Querier) error) error {
+	q.lock.Lock()
+	nextID := q.nextID
+	expenses := maps.Clone(q.expenses)
+	salaries := maps.Clone(q.salaries)
+	revokedLinks := maps.Clone(q.revokedLinks)
+	pages := maps.Clone(q.pages)
+	deletedExpenses := maps.Clone(q.deletedExpenses)
+	deletedSalaries := maps.Clone(q.deletedSalaries)
+	auditLog := slices.Clone(q.auditLog)
+	attachments := slices.Clone(q.attachments)
+	blobs := maps.Clone(q.blobs)
+	q.lock.Unlock()
+
+	if err := fn(q); err != nil {
+		q.lock.Lock()
+		defer q.lock.Unlock()
+		q.nextID = nextID
+		q.expenses = expenses
+		q.salaries = salaries
+		q.revokedLinks = revokedLinks
+		q.pages = pages
+		q.deletedExpenses = deletedExpenses
+		q.deletedSalaries = deletedSalaries
+		q.auditLog = auditLog
+		q.attachments = attachments
+		q.blobs = blobs
+		return err
+	}
+	return nil
+}
+
+// date drops the time of day, like the DATE columns do
+func date(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func month(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// lastDayOf returns t::date + interval '1 month - 1 day'. Postgres clamps the
+// day to the end of the month, unlike time.AddDate.
+func lastDayOf(t time.Time) time.Time {
+	t = date(t)
+	next := time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	day := min(t.Day(), next.AddDate(0, 1, -1).Day())
+	return time.Date(next.Year(), next.Month(), day, 0, 0, 0, 0, time.UTC).AddDate(0, 0, -1)
+}
+
+func between(t, start, end time.Time) bool {
+	return !t.Before(start) && !t.After(end)
+}
+
+// sortedExpenses returns the expenses in id order, so that the results don't
+// depend on the map order
+func (q *Querier) sortedExpenses() []db.BudgetSchemaExpense {
+	out := make([]db.BudgetSchemaExpense, 0, len(q.expenses))
+	for _, e := range q.expenses {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+func (q *Querier) sortedSalaries() []db.BudgetSchemaSalary {
+	out := make([]db.BudgetSchemaSalary, 0, len(q.salaries))
+	for _, s := range q.salaries {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// expenseKeyUsed tells whether an expense, deleted or not, has the key.
+// NULL keys never conflict.
+func (q *Querier) expenseKeyUsed(key sql.NullString) bool {
+	if !key.Valid {
+		return false
+	}
+	for _, table := range []map[int32]db.BudgetSchemaExpense{q.expenses, q.deletedExpenses} {
+		for _, e := range table {
+			if e.IdempotencyKey == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (q *Querier) salaryKeyUsed(key sql.NullString) bool {
+	if !key.Valid {
+		return false
+	}
+	for _, table := range []map[int32]db.BudgetSchemaSalary{q.salaries, q.deletedSalaries} {
+		for _, s := range table {
+			if s.IdempotencyKey == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expensesBetween returns the expenses between start::date and
+// end::date + interval '1 month - 1 day'
+func (q *Querier) expensesBetween(start, end time.Time) []db.BudgetSchemaExpense {
+	start, end = date(start), lastDayOf(end)
+	out := []db.BudgetSchemaExpense{}
+	for _, e := range q.sortedExpenses() {
+		if between(e.ExpenseDate, start, end) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+//
+// Expenses
+//
+
+func (q *Querier) AddExpense(ctx context.Context, arg db.AddExpenseParams) (int32, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return 0, q.Err
+	}
+	if q.expenseKeyUsed(arg.IdempotencyKey) {
+		return 0, pgx.ErrNoRows
+	}
+
+	q.nextID++
+	q.expenses[q.nextID] = db.BudgetSchemaExpense{
+		ID:             q.nextID,
+		Username:       arg.Username,
+		ShopName:       arg.ShopName,
+		Category:       arg.Category,
+		Price:          arg.Price,
+		ExpenseDate:    date(arg.ExpenseDate),
+		IdempotencyKey: arg.IdempotencyKey,
+		CreatedAt:      sql.NullTime{Time: time.Now(), Valid: true},
+		Sharing:        arg.Sharing,
+		OwedBy:         arg.OwedBy,
+	}
+	return q.nextID, nil
+}
+
+// AddExpenses adds all or none of the expenses, like COPY
+func (q *Querier) AddExpenses(ctx context.Context, arg []db.AddExpensesParams) (int64, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return 0, q.Err
+	}
+	keys := map[sql.NullString]bool{}
+	for _, e := range arg {
+		if e.IdempotencyKey.Valid && (keys[e.IdempotencyKey] || q.expenseKeyUsed(e.IdempotencyKey)) {
+			return 0, errUniqueViolation
+		}
+		keys[e.IdempotencyKey] = true
+	}
+
+	now := time.Now()
+	for _, e := range arg {
+		q.nextID++
+		q.expenses[q.nextID] = db.BudgetSchemaExpense{
+			ID:             q.nextID,
+			Username:       e.Username,
+			ShopName:       e.ShopName,
+			Category:       e.Category,
+			Price:          e.Price,
+			ExpenseDate:    date(e.ExpenseDate),
+			IdempotencyKey: e.IdempotencyKey,
+			Sharing:        e.Sharing,
+			OwedBy:         e.OwedBy,
+			CreatedAt:      sql.NullTime{Time: now, Valid: true},
+		}
+	}
+	return int64(len(arg)), nil
+}
+
+func (q *Querier) DeleteExpenseByID(
+	ctx context.Context,
+	arg db.DeleteExpenseByIDParams,
+) (*db.BudgetSchemaExpense, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	e, ok := q.expenses[arg.ID]
+	if !ok || e.Username != arg.Username {
+		return nil, pgx.ErrNoRows
+	}
+	delete(q.expenses, arg.ID)
+	e.DeletedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	q.deletedExpenses[arg.ID] = e
+	return &e, nil
+}
+
+func (q *Querier) GetExpenseByID(ctx context.Context, id int32) (*db.BudgetSchemaExpense, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	e, ok := q.expenses[id]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	return &e, nil
+}
+
+func (q *Querier) GetRecentDuplicateExpense(
+	ctx context.Context,
+	arg db.GetRecentDuplicateExpenseParams,
+) (*db.BudgetSchemaExpense, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	var found *db.BudgetSchemaExpense
+	for _, e := range q.sortedExpenses() {
+		if e.Username != arg.Username ||
+			!strings.EqualFold(e.ShopName, arg.ShopName) ||
+			e.Price != arg.Price ||
+			!e.ExpenseDate.Equal(date(arg.ExpenseDate)) ||
+			!e.CreatedAt.Valid ||
+			e.CreatedAt.Time.Before(arg.CreatedAfter) {
+			continue
+		}
+		if found == nil || !e.CreatedAt.Time.Before(found.CreatedAt.Time) {
+			found = &e
+		}
+	}
+	if found == nil {
+		return nil, pgx.ErrNoRows
+	}
+	return found, nil
+}
+
+func (q *Querier) RestoreExpenseByID(
+	ctx context.Context,
+	arg db.RestoreExpenseByIDParams,
+) (*db.BudgetSchemaExpense, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	e, ok := q.deletedExpenses[arg.ID]
+	if !ok || e.Username != arg.Username {
+		return nil, pgx.ErrNoRows
+	}
+	delete(q.deletedExpenses, arg.ID)
+	e.DeletedAt = sql.NullTime{}
+	q.expenses[arg.ID] = e
+	return &e, nil
+}
+
+func (q *Querier) UpdateExpenseByID(
+	ctx context.Context,
+	arg db.UpdateExpenseByIDParams,
+) (*db.BudgetSchemaExpense, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	e, ok := q.expenses[arg.ID]
+	if !ok || e.Username != arg.Username {
+		return nil, pgx.ErrNoRows
+	}
+	e.ShopName = arg.ShopName
+	e.Category = arg.Category
+	e.Price = arg.Price
+	e.ExpenseDate = date(arg.ExpenseDate)
+	q.expenses[arg.ID] = e
+	return &e, nil
+}
+
+// expenseSortKey returns a comparison for the sort_by argument of ListExpenses
+func expenseSortKey(sortBy string) func(a, b db.BudgetSchemaExpense) int {
+	key := strings.TrimPrefix(sortBy, "-")
+	desc := strings.HasPrefix(sortBy, "-")
+	// Only date can't be sorted descending, it's the default anyway
+	if key == "date" && desc {
+		return nil
+	}
+	var cmp func(a, b db.BudgetSchemaExpense) int
+	switch key {
+	case "shop":
+		cmp = func(a, b db.BudgetSchemaExpense) int { return strings.Compare(a.ShopName, b.ShopName) }
+	case "category":
+		cmp = func(a, b db.BudgetSchemaExpense) int { return strings.Compare(a.Category, b.Category) }
+	case "username":
+		cmp = func(a, b db.BudgetSchemaExpense) int { return strings.Compare(a.Username, b.Username) }
+	case "price":
+		cmp = func(a, b db.BudgetSchemaExpense) int { return compareFloat(a.Price, b.Price) }
+	case "date":
+		cmp = func(a, b db.BudgetSchemaExpense) int { return a.ExpenseDate.Compare(b.ExpenseDate) }
+	default:
+		return nil
+	}
+	if desc {
+		return func(a, b db.BudgetSchemaExpense) int { return cmp(b, a) }
+	}
+	return cmp
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// page returns the rows from offset, at most limit
+func page[T any](rows []T, limit, offset int32) []T {
+	if int(offset) >= len(rows) {
+		return []T{}
+	}
+	rows = rows[offset:]
+	if int(limit) < len(rows) {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+func (q *Querier) ListExpenses(ctx context.Context, arg db.ListExpensesParams) ([]*db.BudgetSchemaExpense, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	matching := []db.BudgetSchemaExpense{}
+	for _, e := range q.sortedExpenses() {
+		if (arg.Username.Valid && e.Username != arg.Username.String) ||
+			(arg.Category.Valid && e.Category != arg.Category.String) ||
+			(arg.StartDate.Valid && e.ExpenseDate.Before(date(arg.StartDate.Time))) ||
+			(arg.EndDate.Valid && e.ExpenseDate.After(date(arg.EndDate.Time))) {
+			continue
+		}
+		matching = append(matching, e)
+	}
+
+	sortKey := expenseSortKey(arg.SortBy)
+	sort.SliceStable(matching, func(i, j int) bool {
+		a, b := matching[i], matching[j]
+		if sortKey != nil {
+			if c := sortKey(a, b); c != 0 {
+				return c < 0
+			}
+		}
+		if !a.ExpenseDate.Equal(b.ExpenseDate) {
+			return a.ExpenseDate.After(b.ExpenseDate)
+		}
+		return a.ID > b.ID
+	})
+
+	out := []*db.BudgetSchemaExpense{}
+	for _, e := range page(matching, arg.RowLimit, arg.RowOffset) {
+		out = append(out, &e)
+	}
+	return out, nil
+}
+
+func (q *Querier) GetExpensesByTimespan(
+	ctx context.Context,
+	arg db.GetExpensesByTimespanParams,
+) ([]*db.GetExpensesByTimespanRow, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	out := []*db.GetExpensesByTimespanRow{}
+	for _, e := range q.expensesBetween(arg.StartTime, arg.EndTime) {
+		out = append(out, &db.GetExpensesByTimespanRow{
+			ID:          e.ID,
+			Username:    e.Username,
+			ExpenseDate: e.ExpenseDate,
+			ShopName:    e.ShopName,
+			Category:    e.Category,
+			Price:       e.Price,
+		})
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		switch {
+		case a.Username != b.Username:
+			return a.Username < b.Username
+		case !a.ExpenseDate.Equal(b.ExpenseDate):
+			return a.ExpenseDate.Before(b.ExpenseDate)
+		case a.ShopName != b.ShopName:
+			return a.ShopName < b.ShopName
+		}
+		return a.Price < b.Price
+	})
+	return out, nil
+}
+
+func (q *Querier) GetAggrExpensesByTimespan(
+	ctx context.Context,
+	arg db.GetAggrExpensesByTimespanParams,
+) ([]*db.GetAggrExpensesByTimespanRow, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	// The query groups by the shop too, so there's a row per shop
+	type groupKey struct {
+		username string
+		month    time.Time
+		shop     string
+	}
+	sums := map[groupKey]float64{}
+	for _, e := range q.expensesBetween(arg.StartTime, arg.EndTime) {
+		sums[groupKey{e.Username, month(e.ExpenseDate), e.ShopName}] += e.Price
+	}
+
+	keys := make([]groupKey, 0, len(sums))
+	for key := range sums {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		switch {
+		case !a.month.Equal(b.month):
+			return a.month.Before(b.month)
+		case a.username != b.username:
+			return a.username < b.username
+		}
+		return a.shop < b.shop
+	})
+
+	out := make([]*db.GetAggrExpensesByTimespanRow, 0, len(keys))
+	for _, key := range keys {
+		out = append(out, &db.GetAggrExpensesByTimespanRow{
+			Username:    key.username,
+			Months:      key.month,
+			ExpensesSum: sums[key],
+		})
+	}
+	return out, nil
+}
+
+func (q *Querier) GetCategoryExpensesByTimespan(
+	ctx context.Context,
+	arg db.GetCategoryExpensesByTimespanParams,
+) ([]*db.GetCategoryExpensesByTimespanRow, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	type groupKey struct {
+		category string
+		month    time.Time
+	}
+	sums := map[groupKey]float64{}
+	for _, e := range q.expensesBetween(arg.StartTime, arg.EndTime) {
+		sums[groupKey{e.Category, month(e.ExpenseDate)}] += e.Price
+	}
+
+	out := make([]*db.GetCategoryExpensesByTimespanRow, 0, len(sums))
+	for key, sum := range sums {
+		out = append(out, &db.GetCategoryExpensesByTimespanRow{
+			Category:    key.category,
+			Months:      key.month,
+			ExpensesSum: sum,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		switch {
+		case !a.Months.Equal(b.Months):
+			return a.Months.Before(b.Months)
+		case a.ExpensesSum != b.ExpensesSum:
+			return a.ExpensesSum > b.ExpensesSum
+		}
+		return a.Category < b.Category
+	})
+	return out, nil
+}
+
+func (q *Querier) GetCategorySharesByTimespan(
+	ctx context.Context,
+	arg db.GetCategorySharesByTimespanParams,
+) ([]*db.GetCategorySharesByTimespanRow, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	total := 0.0
+	sums := map[string]float64{}
+	for _, e := range q.expensesBetween(arg.StartTime, arg.EndTime) {
+		sums[e.Category] += e.Price
+		total += e.Price
+	}
+
+	out := make([]*db.GetCategorySharesByTimespanRow, 0, len(sums))
+	for category, sum := range sums {
+		row := &db.GetCategorySharesByTimespanRow{Category: category, ExpensesSum: sum}
+		if total != 0 {
+			row.Share = sum / total
+		}
+		out = append(out, row)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ExpensesSum != out[j].ExpensesSum {
+			return out[i].ExpensesSum > out[j].ExpensesSum
+		}
+		return out[i].Category < out[j].Category
+	})
+	return out, nil
+}
+
+func (q *Querier) GetDailyExpensesByTimespan(
+	ctx context.Context,
+	arg db.GetDailyExpensesByTimespanParams,
+) ([]*db.GetDailyExpensesByTimespanRow, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	type groupKey struct {
+		day      time.Time
+		category string
+	}
+	start, end := date(arg.StartDate), date(arg.EndDate)
+	sums := map[groupKey]float64{}
+	for _, e := range q.sortedExpenses() {
+		if between(e.ExpenseDate, start, end) {
+			sums[groupKey{e.ExpenseDate, e.Category}] += e.Price
+		}
+	}
+
+	out := make([]*db.GetDailyExpensesByTimespanRow, 0, len(sums))
+	for key, sum := range sums {
+		out = append(out, &db.GetDailyExpensesByTimespanRow{
+			ExpenseDate: key.day,
+			Category:    key.category,
+			ExpensesSum: sum,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].ExpenseDate.Equal(out[j].ExpenseDate) {
+			return out[i].ExpenseDate.Before(out[j].ExpenseDate)
+		}
+		return out[i].Category < out[j].Category
+	})
+	return out, nil
+}
+
+// priceHistory returns the prices of the matching expenses, newest first
+func (q *Querier) priceHistory(match func(db.BudgetSchemaExpense) bool, limit int32) []float64 {
+	matching := []db.BudgetSchemaExpense{}
+	for _, e := range q.sortedExpenses() {
+		if match(e) {
+			matching = append(matching, e)
+		}
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		if !matching[i].ExpenseDate.Equal(matching[j].ExpenseDate) {
+			return matching[i].ExpenseDate.After(matching[j].ExpenseDate)
+		}
+		return matching[i].ID > matching[j].ID
+	})
+
+	prices := []float64{}
+	for _, e := range page(matching, limit, 0) {
+		prices = append(prices, e.Price)
+	}
+	return prices
+}
+
+func (q *Querier) GetShopPriceHistory(ctx context.Context, arg db.GetShopPriceHistoryParams) ([]float64, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	return q.priceHistory(func(e db.BudgetSchemaExpense) bool {
+		return strings.EqualFold(e.ShopName, arg.ShopName)
+	}, arg.HistoryLimit), nil
+}
+
+func (q *Querier) GetCategoryPriceHistory(
+	ctx context.Context,
+	arg db.GetCategoryPriceHistoryParams,
+) ([]float64, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	return q.priceHistory(func(e db.BudgetSchemaExpense) bool {
+		return e.Category == arg.Category
+	}, arg.HistoryLimit), nil
+}
+
+func (q *Querier) GetTopShopsByTimespan(
+	ctx context.Context,
+	arg db.GetTopShopsByTimespanParams,
+) ([]*db.GetTopShopsByTimespanRow, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	shops := map[string]*db.GetTopShopsByTimespanRow{}
+	for _, e := range q.expensesBetween(arg.StartTime, arg.EndTime) {
+		row, ok := shops[e.ShopName]
+		if !ok {
+			row = &db.GetTopShopsByTimespanRow{ShopName: e.ShopName}
+			shops[e.ShopName] = row
+		}
+		row.Purchases++
+		row.ExpensesSum += e.Price
+	}
+
+	out := make([]*db.GetTopShopsByTimespanRow, 0, len(shops))
+	for _, row := range shops {
+		out = append(out, row)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ExpensesSum != out[j].ExpensesSum {
+			return out[i].ExpensesSum > out[j].ExpensesSum
+		}
+		return out[i].ShopName < out[j].ShopName
+	})
+	return page(out, arg.ShopLimit, 0), nil
+}
+
+//
+// Salaries
+//
+
+func (q *Querier) AddSalary(ctx context.Context, arg db.AddSalaryParams) (int32, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return 0, q.Err
+	}
+	if q.salaryKeyUsed(arg.IdempotencyKey) {
+		return 0, pgx.ErrNoRows
+	}
+
+	q.nextID++
+	q.salaries[q.nextID] = db.BudgetSchemaSalary{
+		ID:             q.nextID,
+		Username:       arg.Username,
+		Salary:         arg.Salary,
+		StoreDate:      date(arg.StoreDate),
+		IdempotencyKey: arg.IdempotencyKey,
+	}
+	return q.nextID, nil
+}
+
+func (q *Querier) DeleteSalaryByID(
+	ctx context.Context,
+	arg db.DeleteSalaryByIDParams,
+) (*db.BudgetSchemaSalary, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	s, ok := q.salaries[arg.ID]
+	if !ok || s.Username != arg.Username {
+		return nil, pgx.ErrNoRows
+	}
+	delete(q.salaries, arg.ID)
+	s.DeletedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	q.deletedSalaries[arg.ID] = s
+	return &s, nil
+}
+
+func (q *Querier) GetSalaryByID(ctx context.Context, id int32) (*db.BudgetSchemaSalary, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	s, ok := q.salaries[id]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	return &s, nil
+}
+
+func (q *Querier) RestoreSalaryByID(
+	ctx context.Context,
+	arg db.RestoreSalaryByIDParams,
+) (*db.BudgetSchemaSalary, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	s, ok := q.deletedSalaries[arg.ID]
+	if !ok || s.Username != arg.Username {
+		return nil, pgx.ErrNoRows
+	}
+	delete(q.deletedSalaries, arg.ID)
+	s.DeletedAt = sql.NullTime{}
+	q.salaries[arg.ID] = s
+	return &s, nil
+}
+
+func (q *Querier) UpdateSalaryByID(
+	ctx context.Context,
+	arg db.UpdateSalaryByIDParams,
+) (*db.BudgetSchemaSalary, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	s, ok := q.salaries[arg.ID]
+	if !ok || s.Username != arg.Username {
+		return nil, pgx.ErrNoRows
+	}
+	s.Salary = arg.Salary
+	s.StoreDate = date(arg.StoreDate)
+	q.salaries[arg.ID] = s
+	return &s, nil
+}
+
+func (q *Querier) ListSalaries(ctx context.Context, arg db.ListSalariesParams) ([]*db.BudgetSchemaSalary, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	matching := []db.BudgetSchemaSalary{}
+	for _, s := range q.sortedSalaries() {
+		if (arg.Username.Valid && s.Username != arg.Username.String) ||
+			(arg.StartDate.Valid && s.StoreDate.Before(date(arg.StartDate.Time))) ||
+			(arg.EndDate.Valid && s.StoreDate.After(date(arg.EndDate.Time))) {
+			continue
+		}
+		matching = append(matching, s)
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		if !matching[i].StoreDate.Equal(matching[j].StoreDate) {
+			return matching[i].StoreDate.After(matching[j].StoreDate)
+		}
+		return matching[i].ID > matching[j].ID
+	})
+
+	out := []*db.BudgetSchemaSalary{}
+	for _, s := range page(matching, arg.RowLimit, arg.RowOffset) {
+		out = append(out, &s)
+	}
+	return out, nil
+}
+
+func (q *Querier) ListSalaryUsernames(ctx context.Context) ([]string, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	usernames := []string{}
+	for _, s := range q.salaries {
+		if !slices.Contains(usernames, s.Username) {
+			usernames = append(usernames, s.Username)
+		}
+	}
+	sort.Strings(usernames)
+	return usernames, nil
+}
+
+func (q *Querier) GetUserSalaryByMonth(ctx context.Context, arg db.GetUserSalaryByMonthParams) (float64, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return 0, q.Err
+	}
+
+	for _, s := range q.sortedSalaries() {
+		if s.Username == arg.Username && s.StoreDate.Equal(month(arg.Month)) {
+			return s.Salary, nil
+		}
+	}
+	return 0, pgx.ErrNoRows
+}
+
+func (q *Querier) GetSalariesByTimespan(
+	ctx context.Context,
+	arg db.GetSalariesByTimespanParams,
+) ([]*db.GetSalariesByTimespanRow, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	start, end := month(arg.StartTime), lastDayOf(month(arg.EndTime))
+	seen := map[db.GetSalariesByTimespanRow]bool{}
+	out := []*db.GetSalariesByTimespanRow{}
+	for _, s := range q.sortedSalaries() {
+		if !between(s.StoreDate, start, end) {
+			continue
+		}
+		row := db.GetSalariesByTimespanRow{Username: s.Username, Salary: s.Salary, Months: month(s.StoreDate)}
+		if seen[row] {
+			continue
+		}
+		seen[row] = true
+		out = append(out, &row)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Username != out[j].Username {
+			return out[i].Username < out[j].Username
+		}
+		return out[i].Months.Before(out[j].Months)
+	})
+	return out, nil
+}
+
+//
+// Report links
+//
+
+func (q *Querier) IsLinkRevoked(ctx context.Context, linkID string) (bool, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return false, q.Err
+	}
+
+	_, found := q.revokedLinks[linkID]
+	return found, nil
+}
+
+func (q *Querier) RevokeLink(ctx context.Context, arg db.RevokeLinkParams) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return q.Err
+	}
+
+	if _, found := q.revokedLinks[arg.LinkID]; !found {
+		q.revokedLinks[arg.LinkID] = db.BudgetSchemaRevokedLink{
+			LinkID:    arg.LinkID,
+			RevokedBy: arg.RevokedBy,
+			RevokedAt: time.Now(),
+		}
+	}
+	return nil
+}
+
+//
+// Short-lived pages
+//
+
+func (q *Querier) AddShortLivedPage(ctx context.Context, arg db.AddShortLivedPageParams) (string, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return "", q.Err
+	}
+
+	if _, found := q.pages[arg.Hash]; found {
+		return "", pgx.ErrNoRows
+	}
+	q.pages[arg.Hash] = db.BudgetSchemaShortLivedPage{
+		Hash:          arg.Hash,
+		Html:          append([]byte{}, arg.Html...),
+		StartTime:     arg.StartTime,
+		TtlSeconds:    arg.TtlSeconds,
+		BurnAfterRead: arg.BurnAfterRead,
+		PinHash:       arg.PinHash,
+	}
+	return arg.Hash, nil
+}
+
+func (q *Querier) GetShortLivedPage(ctx context.Context, hash string) (*db.BudgetSchemaShortLivedPage, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	page, ok := q.pages[hash]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	return &page, nil
+}
+
+func (q *Querier) DeleteShortLivedPage(ctx context.Context, hash string) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return q.Err
+	}
+
+	delete(q.pages, hash)
+	return nil
+}
+
+func (q *Querier) TakeShortLivedPage(ctx context.Context, hash string) (*db.BudgetSchemaShortLivedPage, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	page, ok := q.pages[hash]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	delete(q.pages, hash)
+	return &page, nil
+}
+
+func (q *Querier) DeleteExpiredShortLivedPages(ctx context.Context, now time.Time) (int64, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return 0, q.Err
+	}
+
+	var removed int64
+	for hash, page := range q.pages {
+		if page.StartTime.Add(time.Duration(page.TtlSeconds) * time.Second).Before(now) {
+			delete(q.pages, hash)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (q *Querier) GetShortLivedPageStats(ctx context.Context) (*db.GetShortLivedPageStatsRow, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	stats := &db.GetShortLivedPageStatsRow{}
+	for _, page := range q.pages {
+		stats.Pages++
+		stats.Bytes += int64(len(page.Html))
+	}
+	return stats, nil
+}
+
+//
+// Audit log
+//
+
+// AddAuditLog numbers the entries apart from the other tables, so that the
+// IDs of the expenses and salaries don't depend on the auditing
+func (q *Querier) AddAuditLog(ctx context.Context, arg db.AddAuditLogParams) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return q.Err
+	}
+
+	q.auditLog = append(q.auditLog, db.BudgetSchemaAuditLog{
+		ID:        int32(len(q.auditLog) + 1),
+		ChangedAt: time.Now(),
+		Actor:     arg.Actor,
+		Source:    arg.Source,
+		Action:    arg.Action,
+		TableName: arg.TableName,
+		RowID:     arg.RowID,
+		BeforeRow: arg.BeforeRow,
+		AfterRow:  arg.AfterRow,
+	})
+	return nil
+}
+
+// ListAuditLog returns the newest entries first
+func (q *Querier) ListAuditLog(ctx context.Context, arg db.ListAuditLogParams) ([]*db.BudgetSchemaAuditLog, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	entries := slices.Clone(q.auditLog)
+	slices.Reverse(entries)
+	out := []*db.BudgetSchemaAuditLog{}
+	for _, entry := range page(entries, arg.RowLimit, arg.RowOffset) {
+		out = append(out, &entry)
+	}
+	return out, nil
+}
+
+//
+// Attachments
+//
+
+// AddAttachment requires the expense to exist, deleted or not
+func (q *Querier) AddAttachment(ctx context.Context, arg db.AddAttachmentParams) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return q.Err
+	}
+
+	_, found := q.expenses[arg.ExpenseID]
+	if _, deleted := q.deletedExpenses[arg.ExpenseID]; !found && !deleted {
+		return errForeignKeyViolation
+	}
+	for _, a := range q.attachments {
+		if a.ExpenseID == arg.ExpenseID && a.Hash == arg.Hash {
+			return nil
+		}
+	}
+	q.attachments = append(q.attachments, db.BudgetSchemaAttachment{
+		ID:          int32(len(q.attachments) + 1),
+		ExpenseID:   arg.ExpenseID,
+		Hash:        arg.Hash,
+		ContentType: arg.ContentType,
+		SizeBytes:   arg.SizeBytes,
+		CreatedAt:   time.Now(),
+	})
+	return nil
+}
+
+func (q *Querier) GetAttachmentByHash(ctx context.Context, hash string) (*db.BudgetSchemaAttachment, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	for _, a := range q.attachments {
+		if _, ok := q.expenses[a.ExpenseID]; ok && a.Hash == hash {
+			return &a, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+// ListAttachmentsByTimespan returns the attachments of the expenses between
+// the days, deleted expenses are left out
+func (q *Querier) ListAttachmentsByTimespan(
+	ctx context.Context,
+	arg db.ListAttachmentsByTimespanParams,
+) ([]*db.ListAttachmentsByTimespanRow, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	out := []*db.ListAttachmentsByTimespanRow{}
+	for _, a := range q.attachments {
+		e, found := q.expenses[a.ExpenseID]
+		if !found || !between(e.ExpenseDate, date(arg.StartDate), date(arg.EndDate)) {
+			continue
+		}
+		out = append(out, &db.ListAttachmentsByTimespanRow{
+			ID:          a.ID,
+			ExpenseID:   a.ExpenseID,
+			Hash:        a.Hash,
+			ContentType: a.ContentType,
+			SizeBytes:   a.SizeBytes,
+		})
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].ExpenseID < out[j].ExpenseID
+	})
+	return out, nil
+}
+
+func (q *Querier) AddBlob(ctx context.Context, arg db.AddBlobParams) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return q.Err
+	}
+
+	if _, found := q.blobs[arg.Hash]; found {
+		return errUniqueViolation
+	}
+	q.blobs[arg.Hash] = db.BudgetSchemaBlob{
+		Hash:      arg.Hash,
+		ObjectID:  arg.ObjectID,
+		SizeBytes: arg.SizeBytes,
+		CreatedAt: time.Now(),
+	}
+	return nil
+}
+
+func (q *Querier) GetBlob(ctx context.Context, hash string) (*db.BudgetSchemaBlob, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	b, found := q.blobs[hash]
+	if !found {
+		return nil, pgx.ErrNoRows
+	}
+	return &b, nil
+}
+
+//
+// Miscellaneous
+//
+
+// StatisticsAggrByTimespan joins the expenses with the salary of the same
+// user and month. Expenses of months without a salary are left out.
+func (q *Querier) StatisticsAggrByTimespan(
+	ctx context.Context,
+	arg db.StatisticsAggrByTimespanParams,
+) ([]*db.StatisticsAggrByTimespanRow, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.Err != nil {
+		return nil, q.Err
+	}
+
+	type groupKey struct {
+		username string
+		month    time.Time
+		salary   float64
+	}
+	start, end := month(arg.StartTime), lastDayOf(month(arg.EndTime))
+	// The sums are shared, personal and paid for the others
+	sums := map[groupKey]*[3]float64{}
+	for _, e := range q.sortedExpenses() {
+		for _, s := range q.sortedSalaries() {
+			if s.Username != e.Username || !month(s.StoreDate).Equal(month(e.ExpenseDate)) {
+				continue
+			}
+			if !between(e.ExpenseDate, start, end) && !between(s.StoreDate, start, end) {
+				continue
+			}
+			key := groupKey{e.Username, month(e.ExpenseDate), s.Salary}
+			if sums[key] == nil {
+				sums[key] = &[3]float64{}
+			}
+			switch e.Sharing {
+			case dbengine.SharingPersonal:
+				sums[key][1] += e.Price
+			case dbengine.SharingOwed:
+				sums[key][2] += e.Price
+			default:
+				sums[key][0] += e.Price
+			}
+		}
+	}
+
+	out := make([]*db.StatisticsAggrByTimespanRow, 0, len(sums))
+	for key, sum := range sums {
+		out = append(out, &db.StatisticsAggrByTimespanRow{
+			Username:         key.username,
+			EventDate:        key.month,
+			ExpensesSum:      sum[0],
+			PersonalSum:      sum[1],
+			PaidForOthersSum: sum[2],
+			Salary:           key.salary,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		switch {
+		case a.Username != b.Username:
+			return a.Username < b.Username
+		case !a.EventDate.Equal(b.EventDate):
+			return a.EventDate.Before(b.EventDate)
+		case a.ExpensesSum != b.ExpensesSum:
+			return a.ExpensesSum < b.ExpensesSum
+		}
+		return a.Salary < b.Salary
+	})
+	return out, nil
+}
@@ -0,0 +1,247 @@
+package dbenginetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"weezel/budget/db"
+	"weezel/budget/dbengine"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jackc/pgx/v4"
+)
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestLastDayOf(t *testing.T) {
+	tests := []struct {
+		in   time.Time
+		want time.Time
+	}{
+		{day(2024, 3, 1), day(2024, 3, 31)},
+		{day(2024, 1, 31), day(2024, 2, 28)},
+		{day(2023, 12, 1), day(2023, 12, 31)},
+		{time.Date(2024, 2, 1, 15, 4, 5, 0, time.UTC), day(2024, 2, 29)},
+	}
+	for _, tt := range tests {
+		if got := lastDayOf(tt.in); !got.Equal(tt.want) {
+			t.Errorf("lastDayOf(%s) = %s, expected %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func addExpenses(t *testing.T, store *dbengine.Store, expenses []db.BudgetSchemaExpense) {
+	t.Helper()
+	for _, e := range expenses {
+		if _, err := store.AddExpense(context.Background(),
+			e.Username, e.ShopName, e.Category, e.ExpenseDate, e.Price); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestListExpenses(t *testing.T) {
+	ctx := context.Background()
+	store, _ := NewStore()
+	addExpenses(t, store, []db.BudgetSchemaExpense{
+		{Username: "alice", ShopName: "Lidl", Category: "food", ExpenseDate: day(2024, 3, 2), Price: 10},
+		{Username: "bob", ShopName: "Alko", Category: "drinks", ExpenseDate: day(2024, 3, 5), Price: 30},
+		{Username: "alice", ShopName: "Prisma", Category: "food", ExpenseDate: day(2024, 4, 1), Price: 20},
+	})
+
+	tests := []struct {
+		name    string
+		filter  dbengine.Filter
+		limit   int32
+		offset  int32
+		wantIDs []int32
+	}{
+		{name: "newest first", limit: 10, wantIDs: []int32{3, 2, 1}},
+		{name: "by price", filter: dbengine.Filter{Sort: "-price"}, limit: 10, wantIDs: []int32{2, 3, 1}},
+		{name: "by shop", filter: dbengine.Filter{Sort: "shop"}, limit: 10, wantIDs: []int32{2, 1, 3}},
+		{
+			name:    "user and category",
+			filter:  dbengine.Filter{Username: "alice", Category: "food"},
+			limit:   10,
+			wantIDs: []int32{3, 1},
+		},
+		{
+			name:    "date range",
+			filter:  dbengine.Filter{StartDate: day(2024, 3, 3), EndDate: day(2024, 4, 1)},
+			limit:   10,
+			wantIDs: []int32{3, 2},
+		},
+		{name: "paginated", limit: 1, offset: 1, wantIDs: []int32{2}},
+		{name: "past the end", limit: 10, offset: 5, wantIDs: []int32{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expenses, err := store.ListExpenses(ctx, tt.filter, tt.limit, tt.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := []int32{}
+			for _, e := range expenses {
+				ids = append(ids, e.ID)
+			}
+			if diff := cmp.Diff(tt.wantIDs, ids); diff != "" {
+				t.Errorf("IDs differ:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestStatisticsByTimespan(t *testing.T) {
+	ctx := context.Background()
+	store, _ := NewStore()
+	addExpenses(t, store, []db.BudgetSchemaExpense{
+		{Username: "alice", ShopName: "Lidl", Category: "food", ExpenseDate: day(2024, 3, 2), Price: 10},
+		{Username: "alice", ShopName: "Lidl", Category: "food", ExpenseDate: day(2024, 3, 31), Price: 5},
+		{Username: "bob", ShopName: "Alko", Category: "drinks", ExpenseDate: day(2024, 3, 5), Price: 30},
+		// No salary for April, left out
+		{Username: "bob", ShopName: "Alko", Category: "drinks", ExpenseDate: day(2024, 4, 5), Price: 30},
+	})
+	for _, s := range []db.BudgetSchemaSalary{
+		{Username: "alice", Salary: 2000, StoreDate: day(2024, 3, 1)},
+		{Username: "bob", Salary: 1000, StoreDate: day(2024, 3, 1)},
+	} {
+		if _, err := store.AddSalary(ctx, s.Username, s.Salary, s.StoreDate); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := store.StatisticsByTimespan(ctx, day(2024, 3, 1), day(2024, 4, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*db.StatisticsAggrByTimespanRow{
+		{Username: "alice", EventDate: day(2024, 3, 1), ExpensesSum: 15, Salary: 2000},
+		{Username: "bob", EventDate: day(2024, 3, 1), ExpensesSum: 30, Salary: 1000},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("statistics differ:\n%s", diff)
+	}
+
+	shares, err := store.GetCategorySharesByTimespan(ctx, day(2024, 3, 1), day(2024, 3, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantShares := []*db.GetCategorySharesByTimespanRow{
+		{Category: "drinks", ExpensesSum: 30, Share: 30.0 / 45},
+		{Category: "food", ExpensesSum: 15, Share: 15.0 / 45},
+	}
+	if diff := cmp.Diff(wantShares, shares); diff != "" {
+		t.Errorf("shares differ:\n%s", diff)
+	}
+}
+
+func TestOwnership(t *testing.T) {
+	ctx := context.Background()
+	store, _ := NewStore()
+	id, err := store.AddExpense(ctx, "alice", "Lidl", "food", day(2024, 3, 2), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = store.DeleteExpenseByID(ctx, id, "bob"); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("expected no rows when deleting other's expense, got %v", err)
+	}
+	deleted, err := store.DeleteExpenseByID(ctx, id, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted.ShopName != "Lidl" {
+		t.Errorf("deleted %#v", deleted)
+	}
+	if _, err = store.GetExpenseByID(ctx, id); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("expected no rows after delete, got %v", err)
+	}
+}
+
+func TestErr(t *testing.T) {
+	store, q := NewStore()
+	q.Err = errors.New("connection refused")
+
+	_, err := store.StatisticsByTimespan(context.Background(), day(2024, 3, 1), day(2024, 3, 1))
+	if !errors.Is(err, q.Err) {
+		t.Errorf("expected the injected error, got %v", err)
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	ctx := context.Background()
+	injected := errors.New("connection reset")
+	expenses := []db.AddExpensesParams{
+		{Username: "alice", ShopName: "Lidl", Category: "food", ExpenseDate: day(2024, 3, 2), Price: 10},
+		{Username: "alice", ShopName: "Alko", Category: "drinks", ExpenseDate: day(2024, 3, 3), Price: 30},
+	}
+
+	tests := []struct {
+		name      string
+		fn        func(q *Querier, tx *dbengine.Store) error
+		wantErr   error
+		wantCount int
+	}{
+		{
+			name: "committed",
+			fn: func(q *Querier, tx *dbengine.Store) error {
+				_, err := tx.AddExpenses(ctx, expenses)
+				return err
+			},
+			wantCount: 3,
+		},
+		{
+			name: "failing query rolls back",
+			fn: func(q *Querier, tx *dbengine.Store) error {
+				if _, err := tx.AddExpenses(ctx, expenses); err != nil {
+					return err
+				}
+				q.Err = injected
+				_, err := tx.AddSalary(ctx, "alice", 3000, day(2024, 3, 1))
+				return err
+			},
+			wantErr:   injected,
+			wantCount: 1,
+		},
+		{
+			name: "nested transaction rolls back the outer one",
+			fn: func(q *Querier, tx *dbengine.Store) error {
+				if _, err := tx.AddExpenses(ctx, expenses); err != nil {
+					return err
+				}
+				return tx.WithTx(ctx, func(nested *dbengine.Store) error {
+					return injected
+				})
+			},
+			wantErr:   injected,
+			wantCount: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, q := NewStore()
+			if _, err := store.AddExpense(ctx, "bob", "Prisma", "food", day(2024, 3, 1), 5); err != nil {
+				t.Fatal(err)
+			}
+
+			err := store.WithTx(ctx, func(tx *dbengine.Store) error {
+				return tt.fn(q, tx)
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("WithTx() returned %v, expected %v", err, tt.wantErr)
+			}
+
+			q.Err = nil
+			got, err := store.ListExpenses(ctx, dbengine.Filter{}, 10, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != tt.wantCount {
+				t.Errorf("expected %d expenses after the transaction, got %d", tt.wantCount, len(got))
+			}
+		})
+	}
+}
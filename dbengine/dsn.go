@@ -0,0 +1,58 @@
+package dbengine
+
+import (
+	"strings"
+	"weezel/budget/confighandler"
+)
+
+// defaultSSLMode keeps the connections unencrypted unless configured
+// otherwise, the database usually runs on the same host
+const defaultSSLMode = "disable"
+
+var dsnEscape = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// dsnValue quotes the value of a key=value DSN when needed
+func dsnValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+	return "'" + dsnEscape.Replace(value) + "'"
+}
+
+// PostgresDSN returns the connection string of the configuration. Both the
+// pool and the migrations connect with it, so that they can't drift apart.
+// Pool sizing isn't included, see New.
+func PostgresDSN(conf confighandler.Postgres) string {
+	if conf.DSN != "" {
+		return conf.DSN
+	}
+
+	host := conf.Hostname
+	if conf.SocketDir != "" {
+		host = conf.SocketDir
+	}
+	sslMode := conf.SSLMode
+	if sslMode == "" {
+		sslMode = defaultSSLMode
+	}
+
+	params := []struct{ key, value string }{
+		{"host", host},
+		{"port", conf.Port},
+		{"dbname", conf.Database},
+		{"user", conf.Username},
+		{"password", conf.Password},
+		{"sslmode", sslMode},
+		{"sslrootcert", conf.SSLRootCert},
+		{"sslcert", conf.SSLCert},
+		{"sslkey", conf.SSLKey},
+	}
+	pairs := make([]string, 0, len(params))
+	for _, p := range params {
+		if p.value == "" {
+			continue
+		}
+		pairs = append(pairs, p.key+"="+dsnValue(p.value))
+	}
+	return strings.Join(pairs, " ")
+}
@@ -0,0 +1,109 @@
+package dbengine_test
+
+import (
+	"testing"
+	"weezel/budget/confighandler"
+	"weezel/budget/dbengine"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jackc/pgconn"
+)
+
+func TestPostgresDSN(t *testing.T) {
+	tests := []struct {
+		name string
+		conf confighandler.Postgres
+		want string
+	}{
+		{
+			name: "fields",
+			conf: confighandler.Postgres{
+				Hostname: "localhost",
+				Port:     "5432",
+				Database: "budget",
+				Username: "tester",
+				Password: `you wouldn'T have gues$ed \o/`,
+			},
+			want: `host=localhost port=5432 dbname=budget user=tester ` +
+				`password='you wouldn\'T have gues$ed \\o/' sslmode=disable`,
+		},
+		{
+			name: "unix socket",
+			conf: confighandler.Postgres{
+				Hostname:  "localhost",
+				SocketDir: "/var/run/postgresql",
+				Database:  "budget",
+				Username:  "budget",
+			},
+			want: "host=/var/run/postgresql dbname=budget user=budget sslmode=disable",
+		},
+		{
+			name: "client certificate",
+			conf: confighandler.Postgres{
+				Hostname:    "db.example.com",
+				Database:    "budget",
+				Username:    "budget",
+				SSLMode:     "verify-full",
+				SSLRootCert: "/etc/ssl/ca.crt",
+				SSLCert:     "/etc/ssl/budget.crt",
+				SSLKey:      "/etc/ssl/private/budget key.pem",
+			},
+			want: "host=db.example.com dbname=budget user=budget sslmode=verify-full sslrootcert=/etc/ssl/ca.crt " +
+				"sslcert=/etc/ssl/budget.crt sslkey='/etc/ssl/private/budget key.pem'",
+		},
+		{
+			name: "full DSN",
+			conf: confighandler.Postgres{
+				DSN:      "postgres://budget@db.example.com/budget?sslmode=require",
+				Hostname: "localhost",
+			},
+			want: "postgres://budget@db.example.com/budget?sslmode=require",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, dbengine.PostgresDSN(tt.conf)); diff != "" {
+				t.Errorf("PostgresDSN() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// TestPostgresDSNParses checks that pgx reads the quoted values back as they were
+func TestPostgresDSNParses(t *testing.T) {
+	conf := confighandler.Postgres{
+		SocketDir: "/var/run/postgresql",
+		Port:      "5433",
+		Database:  "budget",
+		Username:  "tester",
+		Password:  `you wouldn'T have gues$ed \o/`,
+	}
+	parsed, err := pgconn.ParseConfig(dbengine.PostgresDSN(conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type connConf struct {
+		Host, Database, User, Password string
+		Port                           uint16
+		TLS                            bool
+	}
+	want := connConf{
+		Host:     conf.SocketDir,
+		Database: conf.Database,
+		User:     conf.Username,
+		Password: conf.Password,
+		Port:     5433,
+	}
+	got := connConf{
+		Host:     parsed.Host,
+		Database: parsed.Database,
+		User:     parsed.User,
+		Password: parsed.Password,
+		Port:     parsed.Port,
+		TLS:      parsed.TLSConfig != nil,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("parsed config mismatch (-want +got):\n%s", diff)
+	}
+}
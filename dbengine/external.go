@@ -8,15 +8,36 @@ import (
 	_ "github.com/jackc/pgx/v4/stdlib"
 )
 
+// Backend returns the configured database backend, PostgreSQL by default
+func Backend(conf confighandler.TomlConfig) (string, error) {
+	switch conf.Database.Backend {
+	case "", BackendPostgres:
+		return BackendPostgres, nil
+	case BackendSQLite:
+		return BackendSQLite, nil
+	}
+	return "", fmt.Errorf("unknown database backend %q", conf.Database.Backend)
+}
+
+// MigrationDialect returns the goose dialect of the backend
+func MigrationDialect(backend string) string {
+	if backend == BackendSQLite {
+		return "sqlite3"
+	}
+	return "postgres"
+}
+
 // DBConnForMigrations this connection type is only to be used with database migrations.
 func DBConnForMigrations(conf confighandler.TomlConfig) (*sql.DB, error) {
-	psqlConfig := fmt.Sprintf("user=%s password=%s host=%s port=%s dbname=%s sslmode=disable",
-		conf.Postgres.Username,
-		conf.Postgres.Password,
-		conf.Postgres.Hostname,
-		conf.Postgres.Port,
-		conf.Postgres.Database)
-	dbConn, err := sql.Open("pgx", psqlConfig)
+	backend, err := Backend(conf)
+	if err != nil {
+		return nil, err
+	}
+	if backend == BackendSQLite {
+		return OpenSQLite(conf.SQLite.Path)
+	}
+
+	dbConn, err := sql.Open("pgx", PostgresDSN(conf.Postgres))
 	if err != nil {
 		return nil, err
 	}
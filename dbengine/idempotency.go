@@ -0,0 +1,50 @@
+package dbengine
+
+import (
+	"context"
+	"errors"
+	"time"
+	"weezel/budget/db"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrDuplicate is returned when the idempotency key of the Store has already
+// been used, the row was stored earlier
+var ErrDuplicate = errors.New("idempotency key already used")
+
+// WithIdempotencyKey returns a Store storing the key with the inserted
+// expenses and salaries, e.g. the ID of the Telegram message. Inserting again
+// with the same key stores nothing and returns ErrDuplicate.
+func (s *Store) WithIdempotencyKey(key string) *Store {
+	return &Store{q: s.q, tx: s.tx, source: s.source, key: key, queue: s.queue, sharing: s.sharing}
+}
+
+// duplicateErr tells the replays apart from the other failed inserts, which
+// return no rows only when the key conflicts
+func (s *Store) duplicateErr(err error) error {
+	if s.key != "" && errors.Is(err, pgx.ErrNoRows) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// GetRecentDuplicateExpense returns the latest expense of the user with the
+// same shop, price and date stored after since. pgx.ErrNoRows is returned when
+// there is none.
+func (s *Store) GetRecentDuplicateExpense(
+	ctx context.Context,
+	username string,
+	shopName string,
+	expenseDate time.Time,
+	price float64,
+	since time.Time,
+) (*db.BudgetSchemaExpense, error) {
+	return s.q.GetRecentDuplicateExpense(ctx, db.GetRecentDuplicateExpenseParams{
+		Username:     username,
+		ShopName:     shopName,
+		Price:        price,
+		ExpenseDate:  expenseDate,
+		CreatedAfter: since,
+	})
+}
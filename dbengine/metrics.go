@@ -0,0 +1,182 @@
+package dbengine
+
+import (
+	"context"
+	"regexp"
+	"time"
+	"weezel/budget/db"
+	"weezel/budget/metrics"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var queryDuration = metrics.NewHistogram(
+	"budget_db_query_duration_seconds",
+	"Duration of the database queries, including reading the rows.",
+	metrics.DefaultBuckets,
+	"query")
+
+// RegisterPoolMetrics exposes the statistics of the pool. Call it only once,
+// the metrics can't be registered twice.
+func RegisterPoolMetrics(dbPool *pgxpool.Pool) {
+	poolStat := func(fn func(*pgxpool.Stat) float64) func() float64 {
+		return func() float64 {
+			return fn(dbPool.Stat())
+		}
+	}
+
+	metrics.NewGaugeFunc("budget_db_pool_acquired_conns",
+		"Connections currently in use.",
+		poolStat(func(s *pgxpool.Stat) float64 { return float64(s.AcquiredConns()) }))
+	metrics.NewGaugeFunc("budget_db_pool_idle_conns",
+		"Idle connections in the pool.",
+		poolStat(func(s *pgxpool.Stat) float64 { return float64(s.IdleConns()) }))
+	metrics.NewGaugeFunc("budget_db_pool_total_conns",
+		"All connections in the pool.",
+		poolStat(func(s *pgxpool.Stat) float64 { return float64(s.TotalConns()) }))
+	metrics.NewGaugeFunc("budget_db_pool_max_conns",
+		"Maximum size of the pool.",
+		poolStat(func(s *pgxpool.Stat) float64 { return float64(s.MaxConns()) }))
+	metrics.NewCounterFunc("budget_db_pool_acquires_total",
+		"Connections acquired from the pool.",
+		poolStat(func(s *pgxpool.Stat) float64 { return float64(s.AcquireCount()) }))
+	metrics.NewCounterFunc("budget_db_pool_acquire_wait_seconds_total",
+		"Time spent waiting for a connection.",
+		poolStat(func(s *pgxpool.Stat) float64 { return s.AcquireDuration().Seconds() }))
+}
+
+// RegisterBreakerMetrics exposes the state of the breaker and the number of
+// the queued inserts. Call it only once.
+func RegisterBreakerMetrics(breaker *Breaker, queue *WriteQueue) {
+	metrics.NewGaugeFunc("budget_db_breaker_open",
+		"1 while the queries are failed fast because the database is unavailable.",
+		func() float64 {
+			if breaker.Open() {
+				return 1
+			}
+			return 0
+		})
+	metrics.NewGaugeFunc("budget_db_queued_writes",
+		"Inserts waiting for the database.",
+		func() float64 { return float64(queue.Len()) })
+}
+
+// queryNamePattern finds the name from the comment sqlc adds to every query
+var queryNamePattern = regexp.MustCompile(`^-- name: (\w+)`)
+
+func queryName(sql string) string {
+	if m := queryNamePattern.FindStringSubmatch(sql); m != nil {
+		return m[1]
+	}
+	return "unknown"
+}
+
+// timedDB measures the queries of the generated code. The results are
+// recorded in the breaker, which may also fail the queries fast.
+type timedDB struct {
+	db      db.DBTX
+	breaker *Breaker
+}
+
+func (t timedDB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	if err := t.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	started := time.Now()
+	defer func() {
+		queryDuration.Observe(time.Since(started).Seconds(), queryName(sql))
+	}()
+	tag, err := t.db.Exec(ctx, sql, args...)
+	t.breaker.Record(err)
+	return tag, err
+}
+
+func (t timedDB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	if err := t.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	started := time.Now()
+	rows, err := t.db.Query(ctx, sql, args...)
+	if err != nil {
+		t.breaker.Record(err)
+		queryDuration.Observe(time.Since(started).Seconds(), queryName(sql))
+		return nil, err
+	}
+	return &timedRows{Rows: rows, name: queryName(sql), started: started, breaker: t.breaker}, nil
+}
+
+func (t timedDB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	if err := t.breaker.Allow(); err != nil {
+		return errRow{err: err}
+	}
+	// pgx runs the query already in QueryRow, the reading ends in Scan
+	started := time.Now()
+	return &timedRow{
+		row:     t.db.QueryRow(ctx, sql, args...),
+		name:    queryName(sql),
+		started: started,
+		breaker: t.breaker,
+	}
+}
+
+func (t timedDB) CopyFrom(
+	ctx context.Context,
+	tableName pgx.Identifier,
+	columnNames []string,
+	rowSrc pgx.CopyFromSource,
+) (int64, error) {
+	if err := t.breaker.Allow(); err != nil {
+		return 0, err
+	}
+	started := time.Now()
+	defer func() {
+		queryDuration.Observe(time.Since(started).Seconds(), "CopyFrom")
+	}()
+	copied, err := t.db.CopyFrom(ctx, tableName, columnNames, rowSrc)
+	t.breaker.Record(err)
+	return copied, err
+}
+
+// timedRows is done when closed, the generated code always closes the rows
+type timedRows struct {
+	pgx.Rows
+	name     string
+	started  time.Time
+	breaker  *Breaker
+	observed bool
+}
+
+func (t *timedRows) Close() {
+	t.Rows.Close()
+	if !t.observed {
+		t.observed = true
+		t.breaker.Record(t.Rows.Err())
+		queryDuration.Observe(time.Since(t.started).Seconds(), t.name)
+	}
+}
+
+// timedRow is done when scanned
+type timedRow struct {
+	row     pgx.Row
+	name    string
+	started time.Time
+	breaker *Breaker
+}
+
+func (t *timedRow) Scan(dest ...interface{}) error {
+	err := t.row.Scan(dest...)
+	t.breaker.Record(err)
+	queryDuration.Observe(time.Since(t.started).Seconds(), t.name)
+	return err
+}
+
+// errRow is a row of a query which wasn't run
+type errRow struct {
+	err error
+}
+
+func (e errRow) Scan(...interface{}) error {
+	return e.err
+}
@@ -0,0 +1,49 @@
+package dbengine
+
+import (
+	"context"
+	"testing"
+	"time"
+	"weezel/budget/db"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestQueryName(t *testing.T) {
+	tests := map[string]string{
+		"-- name: AddExpense :one\nINSERT INTO budget_schema.expense": "AddExpense",
+		"SELECT 1": "unknown",
+	}
+	for sql, want := range tests {
+		if got := queryName(sql); got != want {
+			t.Errorf("queryName(%q) = %q, expected %q", sql, got, want)
+		}
+	}
+}
+
+// slowDB runs the query in QueryRow like pgx does
+type slowDB struct {
+	db.DBTX
+	called time.Time
+}
+
+func (s *slowDB) QueryRow(context.Context, string, ...interface{}) pgx.Row {
+	s.called = time.Now()
+	time.Sleep(10 * time.Millisecond)
+	return errRow{}
+}
+
+func TestTimedQueryRow(t *testing.T) {
+	slow := &slowDB{}
+	row := timedDB{db: slow}.QueryRow(context.Background(), "-- name: GetExpenseByID :one\nSELECT 1")
+	timed, ok := row.(*timedRow)
+	if !ok {
+		t.Fatalf("got %T", row)
+	}
+	if timed.started.After(slow.called) {
+		t.Errorf("timing started after the query was run")
+	}
+	if err := timed.Scan(); err != nil {
+		t.Fatal(err)
+	}
+}
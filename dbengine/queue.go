@@ -0,0 +1,261 @@
+package dbengine
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"weezel/budget/logger"
+)
+
+// ErrQueued is returned by the inserts stored in the WriteQueue while the
+// database is unavailable. They're replayed once it's available again.
+var ErrQueued = errors.New("database unavailable, insert queued")
+
+// Kinds of the queued inserts
+const (
+	QueuedExpense = "expense"
+	QueuedSalary  = "salary"
+)
+
+// QueuedWrite is an insert waiting for the database. Key is the idempotency
+// key of the insert, the replays are stored only once.
+type QueuedWrite struct {
+	Kind     string    `json:"kind"`
+	Key      string    `json:"key"`
+	Source   string    `json:"source"`
+	Username string    `json:"username"`
+	ShopName string    `json:"shop_name,omitempty"`
+	Category string    `json:"category,omitempty"`
+	Date     time.Time `json:"date"`
+	Amount   float64   `json:"amount"`
+	Sharing  string    `json:"sharing,omitempty"`
+	OwedBy   string    `json:"owed_by,omitempty"`
+	QueuedAt time.Time `json:"queued_at"`
+}
+
+// WriteQueue keeps the inserts in a file, one JSON object per line, so that
+// they survive restarts of the bot
+type WriteQueue struct {
+	// lock guards the writes and the file, it's never held during the inserts
+	lock   sync.Mutex
+	path   string
+	writes []QueuedWrite
+	// replaying serializes the replays, only they remove writes
+	replaying sync.Mutex
+}
+
+// OpenWriteQueue reads the inserts left in the file. The file is created on
+// the first insert.
+func OpenWriteQueue(path string) (*WriteQueue, error) {
+	q := &WriteQueue{path: path}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("write queue: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var w QueuedWrite
+		// The last line is cut if the bot died while writing it
+		if err = json.Unmarshal(line, &w); err != nil {
+			logger.Errorf("Skipping broken line of %s: %v", path, err)
+			continue
+		}
+		q.writes = append(q.writes, w)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("write queue: %w", err)
+	}
+	return q, nil
+}
+
+// Len returns the number of inserts waiting
+func (q *WriteQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.writes)
+}
+
+// Add appends the insert to the file. It's synced to the disk before
+// returning, so the user can be told it was stored.
+func (q *WriteQueue) Add(w QueuedWrite) error {
+	line, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	f, err := os.OpenFile(q.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("write queue: %w", err)
+	}
+	defer f.Close()
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write queue: %w", err)
+	}
+	if err = f.Sync(); err != nil {
+		return fmt.Errorf("write queue: %w", err)
+	}
+	q.writes = append(q.writes, w)
+	return nil
+}
+
+// CheckQueue returns a health check reporting the queued inserts. The queue
+// doesn't fail the check, the database check tells whether it's reachable.
+func CheckQueue(queue *WriteQueue) func(ctx context.Context) (string, error) {
+	return func(context.Context) (string, error) {
+		return fmt.Sprintf("%d inserts queued", queue.Len()), nil
+	}
+}
+
+// save replaces the file with the writes still waiting
+func (q *WriteQueue) save() error {
+	if len(q.writes) == 0 {
+		if err := os.Remove(q.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for _, w := range q.writes {
+		line, err := json.Marshal(w)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(line, '\n'))
+	}
+	f, err := os.CreateTemp(filepath.Dir(q.path), filepath.Base(q.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), q.path)
+}
+
+// randomKey is the idempotency key of the queued inserts without one
+func randomKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return "queue:" + hex.EncodeToString(b)
+}
+
+// WithQueue returns a Store adding the expenses and salaries to the queue when
+// the database is unavailable. ErrQueued is returned for them.
+func (s *Store) WithQueue(queue *WriteQueue) *Store {
+	return &Store{q: s.q, tx: s.tx, source: s.source, key: s.key, queue: queue, sharing: s.sharing}
+}
+
+// enqueue stores w in the queue if err was caused by the unavailable database
+func (s *Store) enqueue(err error, w QueuedWrite) error {
+	if s.queue == nil || !(errors.Is(err, ErrUnavailable) || isConnError(err)) {
+		return err
+	}
+	w.Source = s.source
+	if w.Key == "" {
+		w.Key = s.key
+	}
+	if w.Key == "" {
+		w.Key = randomKey()
+	}
+	w.QueuedAt = time.Now()
+	if qErr := s.queue.Add(w); qErr != nil {
+		logger.Errorf("Couldn't queue %s of %s: %v", w.Kind, w.Username, qErr)
+		return err
+	}
+	logger.Infof("Database unavailable, queued %s of %s with key %s", w.Kind, w.Username, w.Key)
+	return ErrQueued
+}
+
+// head returns the oldest write, false when the queue is empty
+func (q *WriteQueue) head() (QueuedWrite, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if len(q.writes) == 0 {
+		return QueuedWrite{}, false
+	}
+	return q.writes[0], true
+}
+
+// pop removes the oldest write, which the caller has replayed
+func (q *WriteQueue) pop() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.writes = q.writes[1:]
+	return q.save()
+}
+
+// ReplayQueue stores the queued inserts in order and returns how many were
+// replayed. Replaying stops when the database becomes unavailable again, the
+// rest are kept for the next time. Inserts failing otherwise are logged and
+// dropped, since they'd never succeed. New inserts can be queued meanwhile.
+func (s *Store) ReplayQueue(ctx context.Context) (int, error) {
+	if s.queue == nil {
+		return 0, nil
+	}
+	s.queue.replaying.Lock()
+	defer s.queue.replaying.Unlock()
+
+	replayed := 0
+	for {
+		w, ok := s.queue.head()
+		if !ok {
+			return replayed, nil
+		}
+		var err error
+		// Replays mustn't be queued again
+		store := &Store{q: s.q, tx: s.tx, source: w.Source, key: w.Key}
+		switch w.Kind {
+		case QueuedExpense:
+			_, err = store.WithSharing(Sharing{Mode: w.Sharing, OwedBy: w.OwedBy}).
+				AddExpense(ctx, w.Username, w.ShopName, w.Category, w.Date, w.Amount)
+		case QueuedSalary:
+			_, err = store.AddSalary(ctx, w.Username, w.Amount, w.Date)
+		default:
+			err = fmt.Errorf("unknown kind %q", w.Kind)
+		}
+		if errors.Is(err, ErrUnavailable) || isConnError(err) || ctx.Err() != nil {
+			return replayed, err
+		}
+		switch {
+		case err == nil:
+			replayed++
+		case errors.Is(err, ErrDuplicate):
+			logger.Infof("Queued %s with key %s was already stored", w.Kind, w.Key)
+		default:
+			line, _ := json.Marshal(w)
+			logger.Errorf("Dropping queued insert %s: %v", line, err)
+		}
+		if err = s.queue.pop(); err != nil {
+			return replayed, fmt.Errorf("write queue: %w", err)
+		}
+	}
+}
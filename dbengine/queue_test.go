@@ -0,0 +1,203 @@
+package dbengine_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+	"weezel/budget/db"
+	"weezel/budget/dbengine"
+	"weezel/budget/dbengine/dbenginetest"
+)
+
+func TestWriteQueue(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "pending_writes.jsonl")
+	queue, err := dbengine.OpenWriteQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, fake := dbenginetest.NewStore()
+	queued := store.WithQueue(queue)
+
+	fake.Err = dbengine.ErrUnavailable
+	_, err = queued.WithIdempotencyKey("telegram:1:1").
+		AddExpense(ctx, "alice", "Lidl", "ruoka", day(2024, 2, 3), 10)
+	if !errors.Is(err, dbengine.ErrQueued) {
+		t.Errorf("expense returned %v, expected ErrQueued", err)
+	}
+	if _, err = queued.AddSalary(ctx, "alice", 3000, day(2024, 2, 1)); !errors.Is(err, dbengine.ErrQueued) {
+		t.Errorf("salary returned %v, expected ErrQueued", err)
+	}
+	// Only the inserts are queued
+	if _, err = queued.DeleteExpenseByID(ctx, 1, "alice"); !errors.Is(err, dbengine.ErrUnavailable) {
+		t.Errorf("delete returned %v, expected ErrUnavailable", err)
+	}
+	// Stores without the queue fail as before
+	if _, err = store.AddSalary(ctx, "bob", 2000, day(2024, 2, 1)); !errors.Is(err, dbengine.ErrUnavailable) {
+		t.Errorf("salary without queue returned %v, expected ErrUnavailable", err)
+	}
+
+	// The queue survives restarts
+	queue, err = dbengine.OpenWriteQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queue.Len() != 2 {
+		t.Fatalf("reopened queue has %d inserts, expected 2", queue.Len())
+	}
+	queued = store.WithQueue(queue)
+
+	replayed, err := queued.ReplayQueue(ctx)
+	if !errors.Is(err, dbengine.ErrUnavailable) {
+		t.Errorf("replay returned %v, expected ErrUnavailable", err)
+	}
+	if replayed != 0 || queue.Len() != 2 {
+		t.Errorf("replayed %d with %d left while unavailable, expected 0 and 2", replayed, queue.Len())
+	}
+
+	fake.Err = nil
+	// The expense got stored although the connection broke before the reply
+	_, err = store.WithIdempotencyKey("telegram:1:1").
+		AddExpense(ctx, "alice", "Lidl", "ruoka", day(2024, 2, 3), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed, err = queued.ReplayQueue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if replayed != 1 || queue.Len() != 0 {
+		t.Errorf("replayed %d with %d left, expected 1 and 0", replayed, queue.Len())
+	}
+
+	expenses, err := store.ListExpenses(ctx, dbengine.Filter{}, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expenses) != 1 {
+		t.Errorf("got %d expenses, expected 1", len(expenses))
+	}
+	salaries, err := store.GetSalariesByTimespan(ctx, day(2024, 1, 1), day(2024, 3, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(salaries) != 1 || salaries[0].Username != "alice" {
+		t.Errorf("unexpected salaries %+v", salaries)
+	}
+
+	if queue, err = dbengine.OpenWriteQueue(path); err != nil {
+		t.Fatal(err)
+	}
+	if queue.Len() != 0 {
+		t.Errorf("replayed inserts left in the file: %d", queue.Len())
+	}
+}
+
+func TestWriteQueueItems(t *testing.T) {
+	ctx := context.Background()
+	queue, err := dbengine.OpenWriteQueue(filepath.Join(t.TempDir(), "pending_writes.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, fake := dbenginetest.NewStore()
+	queued := store.WithQueue(queue)
+
+	fake.Err = dbengine.ErrUnavailable
+	_, err = queued.WithIdempotencyKey("telegram:1:1").AddExpenseItems(ctx,
+		"alice", "Lidl", "ruoka", day(2024, 2, 3), []dbengine.ExpenseItem{
+			{Price: 4, Sharing: dbengine.Sharing{Mode: dbengine.SharingPersonal}},
+			{Price: 16},
+		})
+	if !errors.Is(err, dbengine.ErrQueued) {
+		t.Errorf("items returned %v, expected ErrQueued", err)
+	}
+	if queue.Len() != 2 {
+		t.Fatalf("queue has %d inserts, expected 2", queue.Len())
+	}
+
+	fake.Err = nil
+	replayed, err := queued.ReplayQueue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed != 2 {
+		t.Errorf("replayed %d, expected 2", replayed)
+	}
+	expenses, err := store.ListExpenses(ctx, dbengine.Filter{Sort: "price"}, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expenses) != 2 || expenses[0].Sharing != dbengine.SharingPersonal ||
+		expenses[1].Sharing != dbengine.SharingShared || expenses[1].IdempotencyKey.String != "telegram:1:1:2" {
+		t.Errorf("unexpected expenses %+v", expenses)
+	}
+}
+
+// blockingQuerier holds the transactions until released
+type blockingQuerier struct {
+	*dbenginetest.Querier
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b blockingQuerier) InTx(ctx context.Context, fn func(q db.Querier) error) error {
+	b.started <- struct{}{}
+	<-b.release
+	return b.Querier.InTx(ctx, fn)
+}
+
+func TestReplayQueueDoesNotBlockQueue(t *testing.T) {
+	ctx := context.Background()
+	queue, err := dbengine.OpenWriteQueue(filepath.Join(t.TempDir(), "pending_writes.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	salary := dbengine.QueuedWrite{Kind: dbengine.QueuedSalary, Key: "queue:1", Username: "alice",
+		Date: day(2024, 2, 1), Amount: 3000}
+	if err = queue.Add(salary); err != nil {
+		t.Fatal(err)
+	}
+	blocking := blockingQuerier{
+		Querier: dbenginetest.NewQuerier(),
+		// Both replayed inserts start a transaction
+		started: make(chan struct{}, 2),
+		release: make(chan struct{}),
+	}
+	store := dbengine.NewStore(blocking).WithQueue(queue)
+
+	type result struct {
+		replayed int
+		err      error
+	}
+	done := make(chan result)
+	go func() {
+		replayed, err := store.ReplayQueue(ctx)
+		done <- result{replayed, err}
+	}()
+	<-blocking.started
+
+	// Inserts are queued while the replay waits for the database
+	added := make(chan error)
+	go func() {
+		salary.Key = "queue:2"
+		added <- queue.Add(salary)
+	}()
+	select {
+	case err = <-added:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Add() blocked during the replay")
+	}
+	if queue.Len() != 2 {
+		t.Errorf("queue has %d inserts, expected 2", queue.Len())
+	}
+
+	close(blocking.release)
+	res := <-done
+	if res.err != nil || res.replayed != 2 || queue.Len() != 0 {
+		t.Errorf("replayed %d with %d left: %v", res.replayed, queue.Len(), res.err)
+	}
+}
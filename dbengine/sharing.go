@@ -0,0 +1,123 @@
+package dbengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"weezel/budget/db"
+)
+
+// Sharing modes of the expenses
+const (
+	// SharingShared expenses are divided by the ratio of the salaries
+	SharingShared = "shared"
+	// SharingPersonal expenses are paid by the buyer alone
+	SharingPersonal = "personal"
+	// SharingOwed expenses are owed wholly by the user in OwedBy
+	SharingOwed = "owed"
+)
+
+// Sharing tells who pays the expense. The zero value is a shared expense.
+type Sharing struct {
+	Mode   string
+	OwedBy string
+}
+
+func (s Sharing) mode() string {
+	if s.Mode == "" {
+		return SharingShared
+	}
+	return s.Mode
+}
+
+// ExpenseItem is a part of a purchase, e.g. the personal items of a receipt
+type ExpenseItem struct {
+	Price   float64
+	Sharing Sharing
+}
+
+// WithSharing returns a Store adding the expenses with the sharing mode.
+// Expenses are shared by default.
+func (s *Store) WithSharing(sharing Sharing) *Store {
+	return &Store{q: s.q, tx: s.tx, source: s.source, key: s.key, queue: s.queue, sharing: sharing}
+}
+
+// AddExpenseItems adds each item of the purchase as its own expense in one
+// transaction and returns their IDs. The first item gets the idempotency key
+// of the Store, the rest get the key with their position as a suffix.
+func (s *Store) AddExpenseItems(
+	ctx context.Context,
+	username string,
+	shopName string,
+	category string,
+	expenseDate time.Time,
+	items []ExpenseItem,
+) ([]int32, error) {
+	switch len(items) {
+	case 0:
+		return nil, errors.New("no items")
+	case 1:
+		id, err := s.WithSharing(items[0].Sharing).
+			AddExpense(ctx, username, shopName, category, expenseDate, items[0].Price)
+		if err != nil {
+			return nil, err
+		}
+		return []int32{id}, nil
+	}
+
+	ids := make([]int32, 0, len(items))
+	err := s.WithTx(ctx, func(tx *Store) error {
+		for i, item := range items {
+			id, err := tx.WithIdempotencyKey(s.itemKey(i)).WithSharing(item.Sharing).
+				AddExpense(ctx, username, shopName, category, expenseDate, item.Price)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err == nil {
+		return ids, nil
+	}
+	// Every item is queued on its own, they're replayed in order
+	for i, item := range items {
+		qErr := s.enqueue(err, QueuedWrite{
+			Kind:     QueuedExpense,
+			Key:      s.itemKey(i),
+			Username: username,
+			ShopName: shopName,
+			Category: category,
+			Date:     expenseDate,
+			Amount:   item.Price,
+			Sharing:  item.Sharing.Mode,
+			OwedBy:   item.Sharing.OwedBy,
+		})
+		if !errors.Is(qErr, ErrQueued) {
+			return nil, qErr
+		}
+	}
+	return nil, ErrQueued
+}
+
+// itemKey is the idempotency key of the i:th item of a purchase
+func (s *Store) itemKey(i int) string {
+	if s.key == "" || i == 0 {
+		return s.key
+	}
+	return fmt.Sprintf("%s:%d", s.key, i+1)
+}
+
+// expenseSharing fills the sharing columns of the bulk inserts, the rows are
+// shared unless told otherwise
+func expenseSharing(expenses []db.AddExpensesParams) []db.AddExpensesParams {
+	out := make([]db.AddExpensesParams, len(expenses))
+	for i, e := range expenses {
+		if e.Sharing == "" {
+			e.Sharing = SharingShared
+		}
+		out[i] = e
+	}
+	return out
+}
@@ -0,0 +1,778 @@
+package dbengine
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+	"weezel/budget/db"
+	"weezel/budget/db/sqlitedb"
+
+	"github.com/jackc/pgx/v4"
+	_ "github.com/mattn/go-sqlite3" // Registers the sqlite3 driver
+)
+
+const (
+	BackendPostgres = "postgres"
+	BackendSQLite   = "sqlite"
+)
+
+// DefaultSQLitePath is used when the path of the SQLite database isn't configured
+const DefaultSQLitePath = "budget.db"
+
+// sqliteDayLayout is the format of the dates computed in the SQLite queries
+const sqliteDayLayout = "2006-01-02"
+
+// OpenSQLite opens the database file, it's created when missing. The driver
+// needs cgo, build with CGO_ENABLED=1.
+func OpenSQLite(path string) (*sql.DB, error) {
+	if path == "" {
+		path = DefaultSQLitePath
+	}
+	conn, err := sql.Open("sqlite3",
+		fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=on", path))
+	if err != nil {
+		return nil, err
+	}
+	// Only one writer at a time is possible, queueing in the pool is nicer
+	// than waiting for the busy timeout
+	conn.SetMaxOpenConns(1)
+	if err = conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	return conn, nil
+}
+
+// CheckSQLite returns a health check pinging the database file
+func CheckSQLite(conn *sql.DB) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		if conn == nil {
+			return "", errors.New("not connected")
+		}
+		stat := conn.Stats()
+		detail := fmt.Sprintf("%d/%d connections in use", stat.InUse, stat.OpenConnections)
+		return detail, conn.PingContext(ctx)
+	}
+}
+
+// NewSQLiteStore returns a Store using the SQLite database. Durations of the
+// queries are measured.
+func NewSQLiteStore(conn *sql.DB) *Store {
+	return NewStore(sqliteQuerier{q: sqlitedb.New(timedSQLDB{db: conn}), conn: conn})
+}
+
+// timedSQLDB measures the queries of the generated SQLite code. Reading of the
+// rows isn't included, they can't be wrapped.
+type timedSQLDB struct {
+	db sqlitedb.DBTX
+}
+
+func (t timedSQLDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	defer observeQuery(time.Now(), query)
+	return t.db.ExecContext(ctx, query, args...)
+}
+
+func (t timedSQLDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return t.db.PrepareContext(ctx, query)
+}
+
+func (t timedSQLDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	defer observeQuery(time.Now(), query)
+	return t.db.QueryContext(ctx, query, args...)
+}
+
+func (t timedSQLDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	defer observeQuery(time.Now(), query)
+	return t.db.QueryRowContext(ctx, query, args...)
+}
+
+func observeQuery(started time.Time, query string) {
+	queryDuration.Observe(time.Since(started).Seconds(), queryName(query))
+}
+
+// sqliteQuerier serves db.Querier with the SQLite queries. The results are
+// converted to the types of PostgreSQL and sql.ErrNoRows to pgx.ErrNoRows,
+// so that the callers can't tell the backends apart.
+type sqliteQuerier struct {
+	q sqlitedb.Querier
+	// conn starts the transactions, it's nil in a transaction
+	conn *sql.DB
+}
+
+var (
+	_ db.Querier = sqliteQuerier{}
+	_ Transactor = sqliteQuerier{}
+)
+
+var errNoLargeObjects = errors.New("large objects are not supported by SQLite")
+
+func (s sqliteQuerier) InTx(ctx context.Context, fn func(q db.Querier) error) error {
+	if s.conn == nil {
+		return fn(s)
+	}
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck // does nothing after commit
+
+	if err = fn(sqliteQuerier{q: sqlitedb.New(timedSQLDB{db: tx})}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqliteDay drops the time and the time zone from t. PostgreSQL does the same
+// when storing a DATE, but SQLite would convert the time to UTC first.
+func sqliteDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func sqliteNullDay(t sql.NullTime) sql.NullTime {
+	if !t.Valid {
+		return t
+	}
+	return sql.NullTime{Time: sqliteDay(t.Time), Valid: true}
+}
+
+func parseSQLiteDay(s string) (time.Time, error) {
+	t, err := time.Parse(sqliteDayLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse date %q: %w", s, err)
+	}
+	return t, nil
+}
+
+func sqliteErr(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return pgx.ErrNoRows
+	}
+	return err
+}
+
+func sqliteExpense(e *sqlitedb.Expense, err error) (*db.BudgetSchemaExpense, error) {
+	if err != nil {
+		return nil, sqliteErr(err)
+	}
+	return &db.BudgetSchemaExpense{
+		ID:             int32(e.ID),
+		Username:       e.Username,
+		ShopName:       e.ShopName,
+		Category:       e.Category,
+		Price:          e.Price,
+		ExpenseDate:    e.ExpenseDate,
+		DeletedAt:      e.DeletedAt,
+		IdempotencyKey: e.IdempotencyKey,
+		CreatedAt:      e.CreatedAt,
+		Sharing:        e.Sharing,
+		OwedBy:         e.OwedBy,
+	}, nil
+}
+
+func sqliteSalary(s *sqlitedb.Salary, err error) (*db.BudgetSchemaSalary, error) {
+	if err != nil {
+		return nil, sqliteErr(err)
+	}
+	return &db.BudgetSchemaSalary{
+		ID:             int32(s.ID),
+		Username:       s.Username,
+		Salary:         s.Salary,
+		StoreDate:      s.StoreDate,
+		DeletedAt:      s.DeletedAt,
+		IdempotencyKey: s.IdempotencyKey,
+	}, nil
+}
+
+func sqliteShortLivedPage(p *sqlitedb.ShortLivedPage, err error) (*db.BudgetSchemaShortLivedPage, error) {
+	if err != nil {
+		return nil, sqliteErr(err)
+	}
+	return &db.BudgetSchemaShortLivedPage{
+		Hash:          p.Hash,
+		Html:          p.Html,
+		StartTime:     p.StartTime,
+		TtlSeconds:    p.TtlSeconds,
+		BurnAfterRead: p.BurnAfterRead,
+		PinHash:       p.PinHash,
+	}, nil
+}
+
+//
+// Expenses
+//
+
+func (s sqliteQuerier) AddExpense(ctx context.Context, arg db.AddExpenseParams) (int32, error) {
+	id, err := s.q.AddExpense(ctx, sqlitedb.AddExpenseParams{
+		Username:       arg.Username,
+		ShopName:       arg.ShopName,
+		Category:       arg.Category,
+		Price:          arg.Price,
+		ExpenseDate:    sqliteDay(arg.ExpenseDate),
+		IdempotencyKey: arg.IdempotencyKey,
+		Sharing:        arg.Sharing,
+		OwedBy:         arg.OwedBy,
+	})
+	return int32(id), sqliteErr(err)
+}
+
+// AddExpenses inserts the rows one by one in a transaction, SQLite has
+// nothing like COPY
+func (s sqliteQuerier) AddExpenses(ctx context.Context, arg []db.AddExpensesParams) (int64, error) {
+	var added int64
+	err := s.InTx(ctx, func(q db.Querier) error {
+		for _, e := range arg {
+			if _, err := q.AddExpense(ctx, db.AddExpenseParams(e)); err != nil {
+				return err
+			}
+			added++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+func (s sqliteQuerier) DeleteExpenseByID(
+	ctx context.Context,
+	arg db.DeleteExpenseByIDParams,
+) (*db.BudgetSchemaExpense, error) {
+	return sqliteExpense(s.q.DeleteExpenseByID(ctx, sqlitedb.DeleteExpenseByIDParams{
+		ID:       int64(arg.ID),
+		Username: arg.Username,
+	}))
+}
+
+func (s sqliteQuerier) GetExpenseByID(ctx context.Context, id int32) (*db.BudgetSchemaExpense, error) {
+	return sqliteExpense(s.q.GetExpenseByID(ctx, int64(id)))
+}
+
+// GetRecentDuplicateExpense compares created_at in UTC, which is the time
+// zone of CURRENT_TIMESTAMP
+func (s sqliteQuerier) GetRecentDuplicateExpense(
+	ctx context.Context,
+	arg db.GetRecentDuplicateExpenseParams,
+) (*db.BudgetSchemaExpense, error) {
+	return sqliteExpense(s.q.GetRecentDuplicateExpense(ctx, sqlitedb.GetRecentDuplicateExpenseParams{
+		Username:     arg.Username,
+		ShopName:     arg.ShopName,
+		Price:        arg.Price,
+		ExpenseDate:  sqliteDay(arg.ExpenseDate),
+		CreatedAfter: sql.NullTime{Time: arg.CreatedAfter.UTC(), Valid: true},
+	}))
+}
+
+func (s sqliteQuerier) RestoreExpenseByID(
+	ctx context.Context,
+	arg db.RestoreExpenseByIDParams,
+) (*db.BudgetSchemaExpense, error) {
+	return sqliteExpense(s.q.RestoreExpenseByID(ctx, sqlitedb.RestoreExpenseByIDParams{
+		ID:       int64(arg.ID),
+		Username: arg.Username,
+	}))
+}
+
+func (s sqliteQuerier) UpdateExpenseByID(
+	ctx context.Context,
+	arg db.UpdateExpenseByIDParams,
+) (*db.BudgetSchemaExpense, error) {
+	return sqliteExpense(s.q.UpdateExpenseByID(ctx, sqlitedb.UpdateExpenseByIDParams{
+		ShopName:    arg.ShopName,
+		Category:    arg.Category,
+		Price:       arg.Price,
+		ExpenseDate: sqliteDay(arg.ExpenseDate),
+		ID:          int64(arg.ID),
+		Username:    arg.Username,
+	}))
+}
+
+func (s sqliteQuerier) ListExpenses(ctx context.Context, arg db.ListExpensesParams) ([]*db.BudgetSchemaExpense, error) {
+	rows, err := s.q.ListExpenses(ctx, sqlitedb.ListExpensesParams{
+		Username:  arg.Username,
+		Category:  arg.Category,
+		StartDate: sqliteNullDay(arg.StartDate),
+		EndDate:   sqliteNullDay(arg.EndDate),
+		SortBy:    arg.SortBy,
+		RowLimit:  int64(arg.RowLimit),
+		RowOffset: int64(arg.RowOffset),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var items []*db.BudgetSchemaExpense
+	for _, row := range rows {
+		item, _ := sqliteExpense(row, nil)
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (s sqliteQuerier) GetExpensesByTimespan(
+	ctx context.Context,
+	arg db.GetExpensesByTimespanParams,
+) ([]*db.GetExpensesByTimespanRow, error) {
+	rows, err := s.q.GetExpensesByTimespan(ctx, sqlitedb.GetExpensesByTimespanParams{
+		StartTime: sqliteDay(arg.StartTime),
+		EndTime:   sqliteDay(arg.EndTime),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var items []*db.GetExpensesByTimespanRow
+	for _, row := range rows {
+		items = append(items, &db.GetExpensesByTimespanRow{
+			ID:          int32(row.ID),
+			Username:    row.Username,
+			ExpenseDate: row.ExpenseDate,
+			ShopName:    row.ShopName,
+			Category:    row.Category,
+			Price:       row.Price,
+		})
+	}
+	return items, nil
+}
+
+func (s sqliteQuerier) GetAggrExpensesByTimespan(
+	ctx context.Context,
+	arg db.GetAggrExpensesByTimespanParams,
+) ([]*db.GetAggrExpensesByTimespanRow, error) {
+	rows, err := s.q.GetAggrExpensesByTimespan(ctx, sqlitedb.GetAggrExpensesByTimespanParams{
+		StartTime: sqliteDay(arg.StartTime),
+		EndTime:   sqliteDay(arg.EndTime),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var items []*db.GetAggrExpensesByTimespanRow
+	for _, row := range rows {
+		item := &db.GetAggrExpensesByTimespanRow{
+			Username:    row.Username,
+			ExpensesSum: row.ExpensesSum,
+		}
+		if item.Months, err = parseSQLiteDay(row.Months); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (s sqliteQuerier) GetCategoryExpensesByTimespan(
+	ctx context.Context,
+	arg db.GetCategoryExpensesByTimespanParams,
+) ([]*db.GetCategoryExpensesByTimespanRow, error) {
+	rows, err := s.q.GetCategoryExpensesByTimespan(ctx, sqlitedb.GetCategoryExpensesByTimespanParams{
+		StartTime: sqliteDay(arg.StartTime),
+		EndTime:   sqliteDay(arg.EndTime),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var items []*db.GetCategoryExpensesByTimespanRow
+	for _, row := range rows {
+		item := &db.GetCategoryExpensesByTimespanRow{
+			Category:    row.Category,
+			ExpensesSum: row.ExpensesSum,
+		}
+		if item.Months, err = parseSQLiteDay(row.Months); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (s sqliteQuerier) GetCategorySharesByTimespan(
+	ctx context.Context,
+	arg db.GetCategorySharesByTimespanParams,
+) ([]*db.GetCategorySharesByTimespanRow, error) {
+	rows, err := s.q.GetCategorySharesByTimespan(ctx, sqlitedb.GetCategorySharesByTimespanParams{
+		StartTime: sqliteDay(arg.StartTime),
+		EndTime:   sqliteDay(arg.EndTime),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var items []*db.GetCategorySharesByTimespanRow
+	for _, row := range rows {
+		items = append(items, &db.GetCategorySharesByTimespanRow{
+			Category:    row.Category,
+			ExpensesSum: row.ExpensesSum,
+			Share:       row.Share,
+		})
+	}
+	return items, nil
+}
+
+func (s sqliteQuerier) GetDailyExpensesByTimespan(
+	ctx context.Context,
+	arg db.GetDailyExpensesByTimespanParams,
+) ([]*db.GetDailyExpensesByTimespanRow, error) {
+	rows, err := s.q.GetDailyExpensesByTimespan(ctx, sqlitedb.GetDailyExpensesByTimespanParams{
+		StartDate: sqliteDay(arg.StartDate),
+		EndDate:   sqliteDay(arg.EndDate),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var items []*db.GetDailyExpensesByTimespanRow
+	for _, row := range rows {
+		item := &db.GetDailyExpensesByTimespanRow{
+			Category:    row.Category,
+			ExpensesSum: row.ExpensesSum,
+		}
+		if item.ExpenseDate, err = parseSQLiteDay(row.ExpenseDay); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (s sqliteQuerier) GetShopPriceHistory(ctx context.Context, arg db.GetShopPriceHistoryParams) ([]float64, error) {
+	return s.q.GetShopPriceHistory(ctx, sqlitedb.GetShopPriceHistoryParams{
+		ShopName:     arg.ShopName,
+		HistoryLimit: int64(arg.HistoryLimit),
+	})
+}
+
+func (s sqliteQuerier) GetCategoryPriceHistory(
+	ctx context.Context,
+	arg db.GetCategoryPriceHistoryParams,
+) ([]float64, error) {
+	return s.q.GetCategoryPriceHistory(ctx, sqlitedb.GetCategoryPriceHistoryParams{
+		Category:     arg.Category,
+		HistoryLimit: int64(arg.HistoryLimit),
+	})
+}
+
+func (s sqliteQuerier) GetTopShopsByTimespan(
+	ctx context.Context,
+	arg db.GetTopShopsByTimespanParams,
+) ([]*db.GetTopShopsByTimespanRow, error) {
+	rows, err := s.q.GetTopShopsByTimespan(ctx, sqlitedb.GetTopShopsByTimespanParams{
+		StartTime: sqliteDay(arg.StartTime),
+		EndTime:   sqliteDay(arg.EndTime),
+		ShopLimit: int64(arg.ShopLimit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var items []*db.GetTopShopsByTimespanRow
+	for _, row := range rows {
+		items = append(items, &db.GetTopShopsByTimespanRow{
+			ShopName:    row.ShopName,
+			Purchases:   row.Purchases,
+			ExpensesSum: row.ExpensesSum,
+		})
+	}
+	return items, nil
+}
+
+//
+// Salaries
+//
+
+func (s sqliteQuerier) AddSalary(ctx context.Context, arg db.AddSalaryParams) (int32, error) {
+	id, err := s.q.AddSalary(ctx, sqlitedb.AddSalaryParams{
+		Username:       arg.Username,
+		Salary:         arg.Salary,
+		StoreDate:      sqliteDay(arg.StoreDate),
+		IdempotencyKey: arg.IdempotencyKey,
+	})
+	return int32(id), sqliteErr(err)
+}
+
+func (s sqliteQuerier) DeleteSalaryByID(
+	ctx context.Context,
+	arg db.DeleteSalaryByIDParams,
+) (*db.BudgetSchemaSalary, error) {
+	return sqliteSalary(s.q.DeleteSalaryByID(ctx, sqlitedb.DeleteSalaryByIDParams{
+		ID:       int64(arg.ID),
+		Username: arg.Username,
+	}))
+}
+
+func (s sqliteQuerier) GetSalaryByID(ctx context.Context, id int32) (*db.BudgetSchemaSalary, error) {
+	return sqliteSalary(s.q.GetSalaryByID(ctx, int64(id)))
+}
+
+func (s sqliteQuerier) RestoreSalaryByID(
+	ctx context.Context,
+	arg db.RestoreSalaryByIDParams,
+) (*db.BudgetSchemaSalary, error) {
+	return sqliteSalary(s.q.RestoreSalaryByID(ctx, sqlitedb.RestoreSalaryByIDParams{
+		ID:       int64(arg.ID),
+		Username: arg.Username,
+	}))
+}
+
+func (s sqliteQuerier) UpdateSalaryByID(
+	ctx context.Context,
+	arg db.UpdateSalaryByIDParams,
+) (*db.BudgetSchemaSalary, error) {
+	return sqliteSalary(s.q.UpdateSalaryByID(ctx, sqlitedb.UpdateSalaryByIDParams{
+		Salary:    arg.Salary,
+		StoreDate: sqliteDay(arg.StoreDate),
+		ID:        int64(arg.ID),
+		Username:  arg.Username,
+	}))
+}
+
+func (s sqliteQuerier) ListSalaries(ctx context.Context, arg db.ListSalariesParams) ([]*db.BudgetSchemaSalary, error) {
+	rows, err := s.q.ListSalaries(ctx, sqlitedb.ListSalariesParams{
+		Username:  arg.Username,
+		StartDate: sqliteNullDay(arg.StartDate),
+		EndDate:   sqliteNullDay(arg.EndDate),
+		RowLimit:  int64(arg.RowLimit),
+		RowOffset: int64(arg.RowOffset),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var items []*db.BudgetSchemaSalary
+	for _, row := range rows {
+		item, _ := sqliteSalary(row, nil)
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (s sqliteQuerier) ListSalaryUsernames(ctx context.Context) ([]string, error) {
+	return s.q.ListSalaryUsernames(ctx)
+}
+
+func (s sqliteQuerier) GetUserSalaryByMonth(ctx context.Context, arg db.GetUserSalaryByMonthParams) (float64, error) {
+	salary, err := s.q.GetUserSalaryByMonth(ctx, sqlitedb.GetUserSalaryByMonthParams{
+		Username: arg.Username,
+		Month:    sqliteDay(arg.Month),
+	})
+	return salary, sqliteErr(err)
+}
+
+func (s sqliteQuerier) GetSalariesByTimespan(
+	ctx context.Context,
+	arg db.GetSalariesByTimespanParams,
+) ([]*db.GetSalariesByTimespanRow, error) {
+	rows, err := s.q.GetSalariesByTimespan(ctx, sqlitedb.GetSalariesByTimespanParams{
+		StartTime: sqliteDay(arg.StartTime),
+		EndTime:   sqliteDay(arg.EndTime),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var items []*db.GetSalariesByTimespanRow
+	for _, row := range rows {
+		item := &db.GetSalariesByTimespanRow{
+			Username: row.Username,
+			Salary:   row.Salary,
+		}
+		if item.Months, err = parseSQLiteDay(row.Months); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+//
+// Report links
+//
+
+func (s sqliteQuerier) IsLinkRevoked(ctx context.Context, linkID string) (bool, error) {
+	return s.q.IsLinkRevoked(ctx, linkID)
+}
+
+func (s sqliteQuerier) RevokeLink(ctx context.Context, arg db.RevokeLinkParams) error {
+	return s.q.RevokeLink(ctx, sqlitedb.RevokeLinkParams{
+		LinkID:    arg.LinkID,
+		RevokedBy: arg.RevokedBy,
+	})
+}
+
+//
+// Short-lived pages
+//
+
+func (s sqliteQuerier) AddShortLivedPage(ctx context.Context, arg db.AddShortLivedPageParams) (string, error) {
+	hash, err := s.q.AddShortLivedPage(ctx, sqlitedb.AddShortLivedPageParams{
+		Hash:          arg.Hash,
+		Html:          arg.Html,
+		StartTime:     arg.StartTime,
+		TtlSeconds:    arg.TtlSeconds,
+		BurnAfterRead: arg.BurnAfterRead,
+		PinHash:       arg.PinHash,
+	})
+	return hash, sqliteErr(err)
+}
+
+func (s sqliteQuerier) GetShortLivedPage(ctx context.Context, hash string) (*db.BudgetSchemaShortLivedPage, error) {
+	return sqliteShortLivedPage(s.q.GetShortLivedPage(ctx, hash))
+}
+
+func (s sqliteQuerier) DeleteShortLivedPage(ctx context.Context, hash string) error {
+	return s.q.DeleteShortLivedPage(ctx, hash)
+}
+
+func (s sqliteQuerier) TakeShortLivedPage(ctx context.Context, hash string) (*db.BudgetSchemaShortLivedPage, error) {
+	return sqliteShortLivedPage(s.q.TakeShortLivedPage(ctx, hash))
+}
+
+func (s sqliteQuerier) DeleteExpiredShortLivedPages(ctx context.Context, now time.Time) (int64, error) {
+	return s.q.DeleteExpiredShortLivedPages(ctx, now)
+}
+
+func (s sqliteQuerier) GetShortLivedPageStats(ctx context.Context) (*db.GetShortLivedPageStatsRow, error) {
+	row, err := s.q.GetShortLivedPageStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &db.GetShortLivedPageStatsRow{
+		Pages: row.Pages,
+		Bytes: row.Bytes,
+	}, nil
+}
+
+//
+// Audit log
+//
+
+// AddAuditLog stores the rows as JSON text, there's no JSON type in SQLite
+func (s sqliteQuerier) AddAuditLog(ctx context.Context, arg db.AddAuditLogParams) error {
+	return s.q.AddAuditLog(ctx, sqlitedb.AddAuditLogParams{
+		Actor:     arg.Actor,
+		Source:    arg.Source,
+		Action:    arg.Action,
+		TableName: arg.TableName,
+		RowID:     int64(arg.RowID),
+		BeforeRow: string(arg.BeforeRow),
+		AfterRow:  string(arg.AfterRow),
+	})
+}
+
+func (s sqliteQuerier) ListAuditLog(
+	ctx context.Context,
+	arg db.ListAuditLogParams,
+) ([]*db.BudgetSchemaAuditLog, error) {
+	rows, err := s.q.ListAuditLog(ctx, sqlitedb.ListAuditLogParams{
+		RowLimit:  int64(arg.RowLimit),
+		RowOffset: int64(arg.RowOffset),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var items []*db.BudgetSchemaAuditLog
+	for _, row := range rows {
+		items = append(items, &db.BudgetSchemaAuditLog{
+			ID:        int32(row.ID),
+			ChangedAt: row.ChangedAt,
+			Actor:     row.Actor,
+			Source:    row.Source,
+			Action:    row.Action,
+			TableName: row.TableName,
+			RowID:     int32(row.RowID),
+			BeforeRow: json.RawMessage(row.BeforeRow),
+			AfterRow:  json.RawMessage(row.AfterRow),
+		})
+	}
+	return items, nil
+}
+
+//
+// Attachments
+//
+
+func (s sqliteQuerier) AddAttachment(ctx context.Context, arg db.AddAttachmentParams) error {
+	return s.q.AddAttachment(ctx, sqlitedb.AddAttachmentParams{
+		ExpenseID:   int64(arg.ExpenseID),
+		Hash:        arg.Hash,
+		ContentType: arg.ContentType,
+		SizeBytes:   arg.SizeBytes,
+	})
+}
+
+func (s sqliteQuerier) GetAttachmentByHash(ctx context.Context, hash string) (*db.BudgetSchemaAttachment, error) {
+	a, err := s.q.GetAttachmentByHash(ctx, hash)
+	if err != nil {
+		return nil, sqliteErr(err)
+	}
+	return &db.BudgetSchemaAttachment{
+		ID:          int32(a.ID),
+		ExpenseID:   int32(a.ExpenseID),
+		Hash:        a.Hash,
+		ContentType: a.ContentType,
+		SizeBytes:   a.SizeBytes,
+		CreatedAt:   a.CreatedAt,
+	}, nil
+}
+
+func (s sqliteQuerier) ListAttachmentsByTimespan(
+	ctx context.Context,
+	arg db.ListAttachmentsByTimespanParams,
+) ([]*db.ListAttachmentsByTimespanRow, error) {
+	rows, err := s.q.ListAttachmentsByTimespan(ctx, sqlitedb.ListAttachmentsByTimespanParams{
+		StartDate: sqliteDay(arg.StartDate),
+		EndDate:   sqliteDay(arg.EndDate),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var items []*db.ListAttachmentsByTimespanRow
+	for _, row := range rows {
+		items = append(items, &db.ListAttachmentsByTimespanRow{
+			ID:          int32(row.ID),
+			ExpenseID:   int32(row.ExpenseID),
+			Hash:        row.Hash,
+			ContentType: row.ContentType,
+			SizeBytes:   row.SizeBytes,
+		})
+	}
+	return items, nil
+}
+
+// AddBlob fails, large objects are a PostgreSQL feature. Use the filesystem
+// blob store with SQLite.
+func (s sqliteQuerier) AddBlob(context.Context, db.AddBlobParams) error {
+	return errNoLargeObjects
+}
+
+func (s sqliteQuerier) GetBlob(context.Context, string) (*db.BudgetSchemaBlob, error) {
+	return nil, errNoLargeObjects
+}
+
+//
+// Miscellaneous
+//
+
+func (s sqliteQuerier) StatisticsAggrByTimespan(
+	ctx context.Context,
+	arg db.StatisticsAggrByTimespanParams,
+) ([]*db.StatisticsAggrByTimespanRow, error) {
+	rows, err := s.q.StatisticsAggrByTimespan(ctx, sqlitedb.StatisticsAggrByTimespanParams{
+		StartTime: sqliteDay(arg.StartTime),
+		EndTime:   sqliteDay(arg.EndTime),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var items []*db.StatisticsAggrByTimespanRow
+	for _, row := range rows {
+		item := &db.StatisticsAggrByTimespanRow{
+			Username:         row.Username,
+			ExpensesSum:      row.ExpensesSum,
+			PersonalSum:      row.PersonalSum,
+			PaidForOthersSum: row.PaidForOthersSum,
+			Salary:           row.Salary,
+			Owes:             row.Owes,
+		}
+		if item.EventDate, err = parseSQLiteDay(row.EventDate); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
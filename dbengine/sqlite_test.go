@@ -0,0 +1,663 @@
+package dbengine_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+	"weezel/budget/db"
+	"weezel/budget/dbengine"
+	"weezel/budget/dbengine/dbenginetest"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/jackc/pgx/v4"
+	"github.com/pressly/goose/v3"
+)
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func newSQLiteStore(t *testing.T) *dbengine.Store {
+	t.Helper()
+	conn, err := dbengine.OpenSQLite(filepath.Join(t.TempDir(), "budget.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	goose.SetLogger(goose.NopLogger())
+	if err = goose.SetDialect(dbengine.MigrationDialect(dbengine.BackendSQLite)); err != nil {
+		t.Fatal(err)
+	}
+	if err = goose.Up(conn, "../sqlc/sqlite/schemas"); err != nil {
+		t.Fatal(err)
+	}
+	return dbengine.NewSQLiteStore(conn)
+}
+
+// TestSQLiteStore runs the same calls against SQLite and the in-memory fake,
+// which mimics the PostgreSQL queries
+func TestSQLiteStore(t *testing.T) {
+	ctx := context.Background()
+	sqliteStore := newSQLiteStore(t)
+	fakeStore, _ := dbenginetest.NewStore()
+	// A time zone east of UTC catches dates converted to UTC
+	lateFebruary := time.Date(2024, 2, 29, 0, 30, 0, 0, time.FixedZone("EET", 2*60*60))
+
+	for _, store := range []*dbengine.Store{sqliteStore, fakeStore} {
+		for _, e := range []struct {
+			user, shop, category string
+			date                 time.Time
+			price                float64
+		}{
+			{"alice", "Lidl", "ruoka", day(2024, 1, 31), 12.5},
+			{"alice", "Prisma", "ruoka", day(2024, 2, 3), 20},
+			{"bob", "Alko", "juomat", day(2024, 2, 3), 30},
+			{"bob", "lidl", "ruoka", lateFebruary, 7.25},
+			{"alice", "Verkkokauppa", "tekniikka", day(2024, 3, 1), 99},
+		} {
+			if _, err := store.AddExpense(ctx, e.user, e.shop, e.category, e.date, e.price); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, s := range []db.BudgetSchemaSalary{
+			{Username: "alice", Salary: 3000, StoreDate: day(2024, 2, 1)},
+			{Username: "bob", Salary: 2000, StoreDate: day(2024, 2, 1)},
+			{Username: "alice", Salary: 3100, StoreDate: day(2024, 3, 1)},
+		} {
+			if _, err := store.AddSalary(ctx, s.Username, s.Salary, s.StoreDate); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query func(store *dbengine.Store) (any, error)
+	}{
+		{
+			name: "list expenses",
+			query: func(store *dbengine.Store) (any, error) {
+				return store.ListExpenses(ctx, dbengine.Filter{}, 10, 0)
+			},
+		},
+		{
+			name: "list expenses sorted by price within a month",
+			query: func(store *dbengine.Store) (any, error) {
+				return store.ListExpenses(ctx, dbengine.Filter{
+					StartDate: day(2024, 2, 1),
+					EndDate:   day(2024, 2, 29),
+					Sort:      "-price",
+				}, 10, 0)
+			},
+		},
+		{
+			name: "expenses by timespan",
+			query: func(store *dbengine.Store) (any, error) {
+				return store.GetExpensesByTimespan(ctx, day(2024, 2, 1), day(2024, 2, 1))
+			},
+		},
+		{
+			name: "category expenses by timespan",
+			query: func(store *dbengine.Store) (any, error) {
+				return store.GetCategoryExpensesByTimespan(ctx, day(2024, 1, 1), day(2024, 3, 1))
+			},
+		},
+		{
+			name: "category shares",
+			query: func(store *dbengine.Store) (any, error) {
+				return store.GetCategorySharesByTimespan(ctx, day(2024, 2, 1), day(2024, 2, 1))
+			},
+		},
+		{
+			name: "daily expenses",
+			query: func(store *dbengine.Store) (any, error) {
+				return store.GetDailyExpensesByTimespan(ctx, day(2024, 2, 1), day(2024, 3, 1))
+			},
+		},
+		{
+			name: "shop price history",
+			query: func(store *dbengine.Store) (any, error) {
+				return store.GetShopPriceHistory(ctx, "LIDL", 5)
+			},
+		},
+		{
+			name: "top shops",
+			query: func(store *dbengine.Store) (any, error) {
+				return store.GetTopShopsByTimespan(ctx, day(2024, 1, 1), day(2024, 3, 1), 3)
+			},
+		},
+		{
+			name: "salary by month",
+			query: func(store *dbengine.Store) (any, error) {
+				return store.GetUserSalaryByMonth(ctx, "alice", day(2024, 3, 15))
+			},
+		},
+		{
+			name: "salaries by timespan",
+			query: func(store *dbengine.Store) (any, error) {
+				return store.GetSalariesByTimespan(ctx, day(2024, 2, 1), day(2024, 3, 1))
+			},
+		},
+		{
+			name: "salary usernames",
+			query: func(store *dbengine.Store) (any, error) {
+				return store.ListSalaryUsernames(ctx)
+			},
+		},
+		{
+			name: "statistics",
+			query: func(store *dbengine.Store) (any, error) {
+				return store.StatisticsByTimespan(ctx, day(2024, 2, 1), day(2024, 3, 1))
+			},
+		},
+	}
+	// IDs differ, the fake shares the sequence between the tables. SQLite
+	// stores the insert time in seconds.
+	opts := cmp.Options{
+		cmpopts.EquateEmpty(),
+		cmpopts.IgnoreFields(db.BudgetSchemaExpense{}, "ID", "CreatedAt"),
+		cmpopts.IgnoreFields(db.GetExpensesByTimespanRow{}, "ID"),
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.query(sqliteStore)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := tt.query(fakeStore)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(want, got, opts); diff != "" {
+				t.Errorf("SQLite mismatch (-fake +sqlite):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSQLiteStoreNoRows(t *testing.T) {
+	ctx := context.Background()
+	store := newSQLiteStore(t)
+
+	id, err := store.AddExpense(ctx, "alice", "Lidl", "ruoka", day(2024, 2, 3), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.DeleteExpenseByID(ctx, id, "bob"); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("deleting someone else's expense returned %v, expected pgx.ErrNoRows", err)
+	}
+	deleted, err := store.DeleteExpenseByID(ctx, id, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted.ID != id || deleted.ShopName != "Lidl" {
+		t.Errorf("unexpected deleted expense %+v", deleted)
+	}
+	if _, err = store.GetExpenseByID(ctx, id); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("missing expense returned %v, expected pgx.ErrNoRows", err)
+	}
+	if _, err = store.GetUserSalaryByMonth(ctx, "alice", day(2024, 2, 1)); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("missing salary returned %v, expected pgx.ErrNoRows", err)
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	ctx := context.Background()
+	sqliteStore := newSQLiteStore(t)
+	fakeStore, _ := dbenginetest.NewStore()
+
+	for _, store := range []*dbengine.Store{sqliteStore, fakeStore} {
+		lidl, err := store.AddExpense(ctx, "alice", "Lidl", "ruoka", day(2024, 2, 3), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		alko, err := store.AddExpense(ctx, "bob", "Alko", "juomat", day(2024, 3, 1), 30)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, a := range []struct {
+			expenseID int32
+			hash      string
+		}{{lidl, "aa"}, {lidl, "bb"}, {alko, "cc"}, {lidl, "aa"}} {
+			if err = store.AddAttachment(ctx, a.expenseID, a.hash, "image/jpeg", 100); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = store.AddAttachment(ctx, 1000, "dd", "image/jpeg", 100); err == nil {
+			t.Error("attachment of a missing expense was stored")
+		}
+
+		attachment, err := store.GetAttachmentByHash(ctx, "bb")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if attachment.ExpenseID != lidl || attachment.ContentType != "image/jpeg" ||
+			attachment.SizeBytes != 100 {
+			t.Errorf("unexpected attachment %+v", attachment)
+		}
+		if _, err = store.GetAttachmentByHash(ctx, "dd"); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("missing attachment returned %v, expected pgx.ErrNoRows", err)
+		}
+
+		rows, err := store.ListAttachmentsByTimespan(ctx, day(2024, 2, 1), day(2024, 2, 29))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var hashes []string
+		for _, r := range rows {
+			hashes = append(hashes, r.Hash)
+		}
+		if diff := cmp.Diff([]string{"aa", "bb"}, hashes); diff != "" {
+			t.Errorf("attachments of February mismatch (-want +got):\n%s", diff)
+		}
+
+		// Attachments of the removed expenses are hidden
+		if _, err = store.DeleteExpenseByID(ctx, lidl, "alice"); err != nil {
+			t.Fatal(err)
+		}
+		rows, err = store.ListAttachmentsByTimespan(ctx, day(2024, 2, 1), day(2024, 3, 31))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 1 || rows[0].Hash != "cc" {
+			t.Errorf("unexpected attachments %+v", rows)
+		}
+		if _, err = store.GetAttachmentByHash(ctx, "aa"); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("attachment of a removed expense returned %v, expected pgx.ErrNoRows", err)
+		}
+	}
+}
+
+func TestSQLiteShortLivedPages(t *testing.T) {
+	ctx := context.Background()
+	store := newSQLiteStore(t)
+	started := time.Date(2024, 2, 3, 12, 0, 0, 0, time.UTC)
+
+	if _, err := store.AddShortLivedPage(ctx, "abc", []byte("<html>"), started, 60, true, "pin"); err != nil {
+		t.Fatal(err)
+	}
+	// Nothing is returned on conflict
+	_, err := store.AddShortLivedPage(ctx, "abc", []byte("<html>"), started, 60, true, "pin")
+	if !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("adding a duplicate page returned %v, expected pgx.ErrNoRows", err)
+	}
+	if revoked, err := store.IsLinkRevoked(ctx, "abc"); err != nil || revoked {
+		t.Errorf("IsLinkRevoked() = %t, %v", revoked, err)
+	}
+
+	page, err := store.GetShortLivedPage(ctx, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &db.BudgetSchemaShortLivedPage{
+		Hash:          "abc",
+		Html:          []byte("<html>"),
+		StartTime:     started,
+		TtlSeconds:    60,
+		BurnAfterRead: true,
+		PinHash:       "pin",
+	}
+	if diff := cmp.Diff(want, page, cmpopts.EquateApproxTime(0)); diff != "" {
+		t.Errorf("GetShortLivedPage() mismatch (-want +got):\n%s", diff)
+	}
+
+	removed, err := store.DeleteExpiredShortLivedPages(ctx, started.Add(time.Minute))
+	if err != nil || removed != 0 {
+		t.Errorf("page expired too early: %d, %v", removed, err)
+	}
+	removed, err = store.DeleteExpiredShortLivedPages(ctx, started.Add(time.Minute+time.Second))
+	if err != nil || removed != 1 {
+		t.Errorf("expired page wasn't removed: %d, %v", removed, err)
+	}
+}
+
+func TestSQLiteWithTx(t *testing.T) {
+	ctx := context.Background()
+	store := newSQLiteStore(t)
+	expenses := []db.AddExpensesParams{
+		{Username: "alice", ShopName: "Lidl", Category: "ruoka", ExpenseDate: day(2024, 3, 2), Price: 10},
+		{Username: "alice", ShopName: "Alko", Category: "juomat", ExpenseDate: day(2024, 3, 3), Price: 30},
+	}
+	count := func() int {
+		t.Helper()
+		got, err := store.ListExpenses(ctx, dbengine.Filter{}, 100, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(got)
+	}
+
+	// A failing query rolls back the rows added before it
+	failing := func(tx *dbengine.Store) error {
+		if _, err := tx.AddExpenses(ctx, expenses); err != nil {
+			return err
+		}
+		_, err := tx.UpdateExpenseByID(ctx, 12345, "alice", "Lidl", "ruoka", day(2024, 3, 2), 10)
+		return err
+	}
+	committed := func(tx *dbengine.Store) error {
+		added, err := tx.AddExpenses(ctx, expenses)
+		if err != nil {
+			return err
+		}
+		if added != int64(len(expenses)) {
+			t.Errorf("AddExpenses() added %d, expected %d", added, len(expenses))
+		}
+		_, err = tx.AddSalary(ctx, "alice", 3000, day(2024, 3, 1))
+		return err
+	}
+
+	if err := store.WithTx(ctx, failing); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("WithTx() returned %v, expected pgx.ErrNoRows", err)
+	}
+	if n := count(); n != 0 {
+		t.Errorf("expected the transaction to be rolled back, got %d expenses", n)
+	}
+
+	if err := store.WithTx(ctx, committed); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != len(expenses) {
+		t.Errorf("expected %d committed expenses, got %d", len(expenses), n)
+	}
+
+	// Outside a transaction the bulk insert runs in its own
+	if _, err := store.AddExpenses(ctx, expenses); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 2*len(expenses) {
+		t.Errorf("expected %d expenses, got %d", 2*len(expenses), n)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	ctx := context.Background()
+	fakeStore, _ := dbenginetest.NewStore()
+
+	for name, store := range map[string]*dbengine.Store{"sqlite": newSQLiteStore(t), "fake": fakeStore} {
+		t.Run(name, func(t *testing.T) {
+			web := store.WithSource(dbengine.SourceWeb)
+			id, err := web.AddExpense(ctx, "alice", "Lidl", "ruoka", day(2024, 2, 3), 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = web.UpdateExpenseByID(ctx, id, "alice", "Prisma", "ruoka", day(2024, 2, 3), 12)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = store.DeleteExpenseByID(ctx, id, "alice"); err != nil {
+				t.Fatal(err)
+			}
+			// Soft deleted rows are hidden
+			if _, err = store.GetExpenseByID(ctx, id); !errors.Is(err, pgx.ErrNoRows) {
+				t.Errorf("deleted expense returned %v, expected pgx.ErrNoRows", err)
+			}
+			if _, err = store.RestoreExpenseByID(ctx, id, "bob"); !errors.Is(err, pgx.ErrNoRows) {
+				t.Errorf("restoring someone else's expense returned %v, expected pgx.ErrNoRows", err)
+			}
+			restored, err := store.RestoreExpenseByID(ctx, id, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if restored.ShopName != "Prisma" || restored.DeletedAt.Valid {
+				t.Errorf("unexpected restored expense %+v", restored)
+			}
+			if _, err = store.RestoreExpenseByID(ctx, id, "alice"); !errors.Is(err, pgx.ErrNoRows) {
+				t.Errorf("restoring a visible expense returned %v, expected pgx.ErrNoRows", err)
+			}
+
+			entries, err := store.ListAuditLog(ctx, 10, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			type entry struct {
+				Source, Action, Before, After string
+			}
+			got := []entry{}
+			for _, e := range entries {
+				if e.Actor != "alice" || e.TableName != dbengine.TableExpense || e.RowID != id {
+					t.Errorf("unexpected audit log entry %+v", e)
+				}
+				before, after := shopName(t, e.BeforeRow), shopName(t, e.AfterRow)
+				got = append(got, entry{e.Source, e.Action, before, after})
+			}
+			want := []entry{
+				{dbengine.SourceBot, dbengine.ActionRestore, "", "Prisma"},
+				{dbengine.SourceBot, dbengine.ActionDelete, "Prisma", ""},
+				{dbengine.SourceWeb, dbengine.ActionUpdate, "Lidl", "Prisma"},
+				{dbengine.SourceWeb, dbengine.ActionInsert, "", "Lidl"},
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("audit log mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// shopName returns the shop of the expense stored in the audit log, empty for null
+func shopName(t *testing.T, row []byte) string {
+	t.Helper()
+	var expense *db.BudgetSchemaExpense
+	if err := json.Unmarshal(row, &expense); err != nil {
+		t.Fatal(err)
+	}
+	if expense == nil {
+		return ""
+	}
+	return expense.ShopName
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+	fakeStore, _ := dbenginetest.NewStore()
+
+	for name, store := range map[string]*dbengine.Store{"sqlite": newSQLiteStore(t), "fake": fakeStore} {
+		t.Run(name, func(t *testing.T) {
+			keyed := store.WithIdempotencyKey("telegram:1:1")
+			id, err := keyed.AddExpense(ctx, "alice", "Lidl", "ruoka", day(2024, 2, 3), 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = keyed.AddExpense(ctx, "alice", "Lidl", "ruoka", day(2024, 2, 3), 10); !errors.Is(
+				err, dbengine.ErrDuplicate) {
+				t.Errorf("replay returned %v, expected ErrDuplicate", err)
+			}
+			// Deleted rows keep their keys
+			if _, err = store.DeleteExpenseByID(ctx, id, "alice"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = keyed.AddExpense(ctx, "alice", "Lidl", "ruoka", day(2024, 2, 3), 10); !errors.Is(
+				err, dbengine.ErrDuplicate) {
+				t.Errorf("replay of a deleted expense returned %v, expected ErrDuplicate", err)
+			}
+			if _, err = store.RestoreExpenseByID(ctx, id, "alice"); err != nil {
+				t.Fatal(err)
+			}
+
+			// Without keys nothing conflicts
+			for range 2 {
+				if _, err = store.AddSalary(ctx, "alice", 3000, day(2024, 2, 1)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err = keyed.AddSalary(ctx, "alice", 3000, day(2024, 3, 1)); err != nil {
+				t.Fatal(err)
+			}
+			_, err = keyed.AddSalary(ctx, "alice", 3000, day(2024, 3, 1))
+			if !errors.Is(err, dbengine.ErrDuplicate) {
+				t.Errorf("salary replay returned %v, expected ErrDuplicate", err)
+			}
+
+			// A reused key fails the whole bulk insert
+			bulk := db.AddExpensesParams{
+				Username:    "bob",
+				ShopName:    "Alko",
+				Category:    "juomat",
+				ExpenseDate: day(2024, 2, 3),
+				Price:       30,
+			}
+			reused := bulk
+			reused.IdempotencyKey = sql.NullString{String: "telegram:1:1", Valid: true}
+			_, err = store.AddExpenses(ctx, []db.AddExpensesParams{bulk, reused})
+			if err == nil {
+				t.Error("bulk insert with a used key succeeded")
+			}
+			expenses, err := store.ListExpenses(ctx, dbengine.Filter{}, 10, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(expenses) != 1 {
+				t.Errorf("got %d expenses, expected 1", len(expenses))
+			}
+
+			dup, err := store.GetRecentDuplicateExpense(ctx, "alice", "LIDL", day(2024, 2, 3), 10,
+				time.Now().Add(-time.Minute))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dup.ID != id || dup.IdempotencyKey.String != "telegram:1:1" {
+				t.Errorf("unexpected duplicate %+v", dup)
+			}
+			_, err = store.GetRecentDuplicateExpense(ctx, "alice", "Lidl", day(2024, 2, 3), 10,
+				time.Now().Add(time.Minute))
+			if !errors.Is(err, pgx.ErrNoRows) {
+				t.Errorf("duplicate stored before since returned %v, expected pgx.ErrNoRows", err)
+			}
+		})
+	}
+}
+
+func TestSharing(t *testing.T) {
+	ctx := context.Background()
+	fakeStore, _ := dbenginetest.NewStore()
+
+	for name, store := range map[string]*dbengine.Store{"sqlite": newSQLiteStore(t), "fake": fakeStore} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := store.AddSalary(ctx, "alice", 3000, day(2024, 2, 1)); err != nil {
+				t.Fatal(err)
+			}
+			personal := store.WithSharing(dbengine.Sharing{Mode: dbengine.SharingPersonal})
+			_, err := personal.AddExpense(ctx, "alice", "Stadium", "vaatteet", day(2024, 2, 2), 60)
+			if err != nil {
+				t.Fatal(err)
+			}
+			owedByBob := dbengine.Sharing{Mode: dbengine.SharingOwed, OwedBy: "bob"}
+			keyed := store.WithIdempotencyKey("telegram:1:1")
+			ids, err := keyed.AddExpenseItems(ctx, "alice", "Lidl", "ruoka", day(2024, 2, 3),
+				[]dbengine.ExpenseItem{{Price: 4, Sharing: owedByBob}, {Price: 16}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ids) != 2 {
+				t.Fatalf("got IDs %v", ids)
+			}
+			owed, err := store.GetExpenseByID(ctx, ids[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if owed.Sharing != dbengine.SharingOwed || owed.OwedBy != "bob" ||
+				owed.IdempotencyKey.String != "telegram:1:1" {
+				t.Errorf("unexpected owed item %+v", owed)
+			}
+			shared, err := store.GetExpenseByID(ctx, ids[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if shared.Sharing != dbengine.SharingShared ||
+				shared.IdempotencyKey.String != "telegram:1:1:2" {
+				t.Errorf("unexpected shared item %+v", shared)
+			}
+
+			// A replayed purchase stores none of the items
+			_, err = keyed.AddExpenseItems(ctx, "alice", "Lidl", "ruoka", day(2024, 2, 3),
+				[]dbengine.ExpenseItem{{Price: 4}, {Price: 16}})
+			if !errors.Is(err, dbengine.ErrDuplicate) {
+				t.Errorf("replay returned %v, expected ErrDuplicate", err)
+			}
+
+			stats, err := store.StatisticsByTimespan(ctx, day(2024, 2, 1), day(2024, 2, 1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []*db.StatisticsAggrByTimespanRow{{
+				Username:         "alice",
+				EventDate:        day(2024, 2, 1),
+				ExpensesSum:      16,
+				PersonalSum:      60,
+				PaidForOthersSum: 4,
+				Salary:           3000,
+			}}
+			if diff := cmp.Diff(want, stats); diff != "" {
+				t.Errorf("statistics mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// TestSharingMigration checks that the purchases tagged #oma before the
+// sharing modes become personal
+func TestSharingMigration(t *testing.T) {
+	ctx := context.Background()
+	conn, err := dbengine.OpenSQLite(filepath.Join(t.TempDir(), "budget.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	goose.SetLogger(goose.NopLogger())
+	if err = goose.SetDialect(dbengine.MigrationDialect(dbengine.BackendSQLite)); err != nil {
+		t.Fatal(err)
+	}
+	const dir = "../sqlc/sqlite/schemas"
+	if err = goose.UpTo(conn, dir, 7); err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.ExecContext(ctx, `INSERT INTO expense (username, shop_name, category, price, expense_date)
+		VALUES ('alice', 'Stadium', 'oma', 60, '2024-02-02'), ('alice', 'Lidl', 'ruoka', 20, '2024-02-03')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type row struct{ Category, Sharing string }
+	rows := func() []row {
+		t.Helper()
+		res, err := conn.QueryContext(ctx, "SELECT category, sharing FROM expense ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Close()
+		var out []row
+		for res.Next() {
+			var r row
+			if err = res.Scan(&r.Category, &r.Sharing); err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, r)
+		}
+		return out
+	}
+
+	if err = goose.Up(conn, dir); err != nil {
+		t.Fatal(err)
+	}
+	want := []row{{"", dbengine.SharingPersonal}, {"ruoka", dbengine.SharingShared}}
+	if diff := cmp.Diff(want, rows()); diff != "" {
+		t.Errorf("migrated rows mismatch (-want +got):\n%s", diff)
+	}
+
+	if err = goose.DownTo(conn, dir, 7); err != nil {
+		t.Fatal(err)
+	}
+	var category string
+	if err = conn.QueryRowContext(ctx, "SELECT category FROM expense ORDER BY id LIMIT 1").Scan(&category); err != nil {
+		t.Fatal(err)
+	}
+	if category != "oma" {
+		t.Errorf("category %q wasn't restored", category)
+	}
+}
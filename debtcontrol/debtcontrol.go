@@ -32,8 +32,10 @@ func CalculateCompensatedDebts(
 	lowerIncomeRatio := debts[0].Salary / sumSalaries
 	greaterIncomeRatio := debts[1].Salary / sumSalaries
 
-	debts[1].Owes = debts[1].ExpensesSum * lowerIncomeRatio
-	debts[0].Owes = debts[0].ExpensesSum * greaterIncomeRatio
+	// Only the shared expenses are divided, the ones paid for the other
+	// user are owed wholly and the personal ones not at all
+	debts[1].Owes = debts[1].ExpensesSum*lowerIncomeRatio + debts[1].PaidForOthersSum
+	debts[0].Owes = debts[0].ExpensesSum*greaterIncomeRatio + debts[0].PaidForOthersSum
 
 	debt := math.Abs(debts[0].Owes - debts[1].Owes)
 
@@ -113,6 +113,49 @@ func TestCalculateCompensatedDebts(t *testing.T) {
 				"tom":   29.4117,
 			},
 		},
+		{
+			name: "Personal purchases are not divided",
+			args: args{
+				user1: &db.StatisticsAggrByTimespanRow{
+					Username:    "alice",
+					ExpensesSum: 0,
+					PersonalSum: 500.0,
+					Salary:      900.0,
+				},
+				user2: &db.StatisticsAggrByTimespanRow{
+					Username:    "tom",
+					ExpensesSum: 80.0,
+					PersonalSum: 30.0,
+					Salary:      1000.0,
+				},
+			},
+			wantErr: false,
+			updatedArgs: map[string]float64{
+				"alice": 37.8947,
+				"tom":   0.0,
+			},
+		},
+		{
+			name: "Purchases paid for the other are owed wholly",
+			args: args{
+				user1: &db.StatisticsAggrByTimespanRow{
+					Username:         "alice",
+					ExpensesSum:      0,
+					PaidForOthersSum: 20.0,
+					Salary:           900.0,
+				},
+				user2: &db.StatisticsAggrByTimespanRow{
+					Username:    "tom",
+					ExpensesSum: 80.0,
+					Salary:      1000.0,
+				},
+			},
+			wantErr: false,
+			updatedArgs: map[string]float64{
+				"alice": 17.8947,
+				"tom":   0.0,
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
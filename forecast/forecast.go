@@ -0,0 +1,237 @@
+package forecast
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+	"weezel/budget/confighandler"
+	"weezel/budget/db"
+	"weezel/budget/dbengine"
+)
+
+const (
+	// yearsOfHistory tells how many previous years of the same month are used
+	yearsOfHistory = 3
+	// zScore95 gives a 95% confidence band assuming normally distributed errors
+	zScore95 = 1.96
+)
+
+// Projection is the forecasted month-end spending. Budget is zero when
+// no budget has been configured.
+type Projection struct {
+	Category  string  `json:"category"`
+	Spent     float64 `json:"spent"`
+	Projected float64 `json:"projected"`
+	Low       float64 `json:"low"`
+	High      float64 `json:"high"`
+	Budget    float64 `json:"budget"`
+}
+
+// OverBudget returns true when the projected spending exceeds the budget
+func (p Projection) OverBudget() bool {
+	return p.Budget > 0 && p.Projected > p.Budget
+}
+
+type Forecast struct {
+	Month       time.Time    `json:"month"`
+	Today       time.Time    `json:"today"`
+	DaysElapsed int          `json:"days_elapsed"`
+	DaysInMonth int          `json:"days_in_month"`
+	Total       Projection   `json:"total"`
+	Categories  []Projection `json:"categories"`
+}
+
+// OverBudget returns the projections which are about to exceed their budgets,
+// total being the first one if it does.
+func (f Forecast) OverBudget() []Projection {
+	exceeding := []Projection{}
+	if f.Total.OverBudget() {
+		exceeding = append(exceeding, f.Total)
+	}
+	for _, c := range f.Categories {
+		if c.OverBudget() {
+			exceeding = append(exceeding, c)
+		}
+	}
+	return exceeding
+}
+
+func firstOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func daysIn(month time.Time) int {
+	return firstOfMonth(month).AddDate(0, 1, -1).Day()
+}
+
+// dailySeries returns spending per day of the month (index 0 is the first day)
+// for each category. Empty category key holds the total.
+func dailySeries(rows []*db.GetDailyExpensesByTimespanRow, days int) map[string][]float64 {
+	series := map[string][]float64{"": make([]float64, days)}
+	for _, r := range rows {
+		day := r.ExpenseDate.Day() - 1
+		if day >= days {
+			continue
+		}
+		key := categoryKey(r.Category)
+		if _, ok := series[key]; !ok {
+			series[key] = make([]float64, days)
+		}
+		series[key][day] += r.ExpensesSum
+		series[""][day] += r.ExpensesSum
+	}
+	return series
+}
+
+// categoryKey separates uncategorized expenses from the total
+func categoryKey(category string) string {
+	return "#" + category
+}
+
+func sum(values []float64) float64 {
+	s := 0.0
+	for _, v := range values {
+		s += v
+	}
+	return s
+}
+
+func variance(values []float64) float64 {
+	if len(values) < 2 {
+		return 0.0
+	}
+	mean := sum(values) / float64(len(values))
+	v := 0.0
+	for _, x := range values {
+		v += (x - mean) * (x - mean)
+	}
+	return v / float64(len(values)-1)
+}
+
+// project forecasts the month-end sum for a single daily series.
+// Current month's pace is blended with what happened during the rest of
+// the month in the previous years. The more days have elapsed, the more
+// the current pace weighs.
+func project(current []float64, history [][]float64, elapsed int) (projected, low, high float64) {
+	days := len(current)
+	spent := sum(current[:elapsed])
+	remaining := days - elapsed
+
+	pace := spent / float64(elapsed) * float64(days)
+
+	historical := make([]float64, 0, len(history))
+	for _, h := range history {
+		historical = append(historical, spent+sum(h[min(elapsed, len(h)):]))
+	}
+
+	projected = pace
+	if len(historical) > 0 {
+		weight := float64(elapsed) / float64(days)
+		projected = weight*pace + (1-weight)*(sum(historical)/float64(len(historical)))
+	}
+
+	// Uncertainty of the remaining days plus disagreement between the years
+	halfWidth := zScore95 * math.Sqrt(
+		variance(current[:elapsed])*float64(remaining)+variance(historical))
+
+	return projected, math.Max(spent, projected-halfWidth), projected + halfWidth
+}
+
+// Project forecasts month-end spending for the month of today. Current holds
+// daily expenses of the ongoing month and history the same month from
+// previous years.
+func Project(
+	today time.Time,
+	current []*db.GetDailyExpensesByTimespanRow,
+	history [][]*db.GetDailyExpensesByTimespanRow,
+	budget confighandler.Budget,
+) Forecast {
+	month := firstOfMonth(today)
+	days := daysIn(month)
+	elapsed := today.Day()
+
+	currentSeries := dailySeries(current, days)
+	historySeries := make([]map[string][]float64, 0, len(history))
+	for _, h := range history {
+		if len(h) == 0 {
+			continue
+		}
+		historySeries = append(historySeries, dailySeries(h, days))
+	}
+
+	forecast := Forecast{
+		Month:       month,
+		Today:       today,
+		DaysElapsed: elapsed,
+		DaysInMonth: days,
+	}
+	// Categories seen only in the previous years can still be spent on
+	for _, h := range historySeries {
+		for key := range h {
+			if _, ok := currentSeries[key]; !ok {
+				currentSeries[key] = make([]float64, days)
+			}
+		}
+	}
+
+	for key, series := range currentSeries {
+		past := [][]float64{}
+		for _, h := range historySeries {
+			if s, ok := h[key]; ok {
+				past = append(past, s)
+			} else {
+				past = append(past, make([]float64, days))
+			}
+		}
+
+		projected, low, high := project(series, past, elapsed)
+		p := Projection{
+			Spent:     sum(series[:elapsed]),
+			Projected: projected,
+			Low:       low,
+			High:      high,
+		}
+		if key == "" {
+			p.Budget = budget.Monthly
+			forecast.Total = p
+			continue
+		}
+		p.Category = key[1:]
+		p.Budget = budget.Categories[p.Category]
+		forecast.Categories = append(forecast.Categories, p)
+	}
+
+	sort.Slice(forecast.Categories, func(i, j int) bool {
+		if forecast.Categories[i].Projected == forecast.Categories[j].Projected {
+			return forecast.Categories[i].Category < forecast.Categories[j].Category
+		}
+		return forecast.Categories[i].Projected > forecast.Categories[j].Projected
+	})
+
+	return forecast
+}
+
+// Load fetches daily expenses of the ongoing month and the same month of
+// the previous years, and projects the month-end spending.
+func Load(ctx context.Context, store *dbengine.Store, today time.Time, budget confighandler.Budget) (Forecast, error) {
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	month := firstOfMonth(today)
+
+	current, err := store.GetDailyExpensesByTimespan(ctx, month, today)
+	if err != nil {
+		return Forecast{}, err
+	}
+
+	history := make([][]*db.GetDailyExpensesByTimespanRow, 0, yearsOfHistory)
+	for i := 1; i <= yearsOfHistory; i++ {
+		start := month.AddDate(-i, 0, 0)
+		rows, err := store.GetDailyExpensesByTimespan(ctx, start, start.AddDate(0, 1, -1))
+		if err != nil {
+			return Forecast{}, err
+		}
+		history = append(history, rows)
+	}
+
+	return Project(today, current, history, budget), nil
+}
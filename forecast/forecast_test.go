@@ -0,0 +1,102 @@
+package forecast
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+	"weezel/budget/confighandler"
+	"weezel/budget/db"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+const floatDelta = float64(1e-3)
+
+type fixture struct {
+	Today   time.Time                             `json:"today"`
+	Current []*db.GetDailyExpensesByTimespanRow   `json:"current"`
+	History [][]*db.GetDailyExpensesByTimespanRow `json:"history"`
+}
+
+func TestProject(t *testing.T) {
+	// March 2022, ten days elapsed. Food has been bought daily, uncategorized
+	// only once. Previous years had the same month with different pace.
+	data, err := os.ReadFile("daily_expenses.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f fixture
+	if err = json.Unmarshal(data, &f); err != nil {
+		t.Fatal(err)
+	}
+
+	budget := confighandler.Budget{
+		Monthly: 350,
+		Categories: map[string]float64{
+			"ruoka": 400,
+		},
+	}
+
+	want := Forecast{
+		Month:       time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC),
+		Today:       f.Today,
+		DaysElapsed: 10,
+		DaysInMonth: 31,
+		Total: Projection{
+			Spent:     140,
+			Projected: 377.0968,
+			Low:       263.4844,
+			High:      490.7092,
+			Budget:    350,
+		},
+		Categories: []Projection{
+			{
+				Category:  "ruoka",
+				Spent:     100,
+				Projected: 299.8387,
+				Low:       258.2608,
+				High:      341.4166,
+				Budget:    400,
+			},
+			{
+				Category:  "",
+				Spent:     40,
+				Projected: 77.2581,
+				Low:       40,
+				High:      198.2395,
+			},
+		},
+	}
+
+	got := Project(f.Today, f.Current, f.History, budget)
+	if diff := cmp.Diff(want, got, cmpopts.EquateApprox(0, floatDelta)); diff != "" {
+		t.Errorf("Project() mismatch:\n%s", diff)
+	}
+
+	overBudget := got.OverBudget()
+	if len(overBudget) != 1 || overBudget[0].Category != "" || overBudget[0].Budget != 350 {
+		t.Errorf("OverBudget() = %+v, want only the total", overBudget)
+	}
+}
+
+func TestProjectWithoutHistory(t *testing.T) {
+	today := time.Date(2022, 2, 14, 0, 0, 0, 0, time.UTC)
+	current := []*db.GetDailyExpensesByTimespanRow{
+		{ExpenseDate: today.AddDate(0, 0, -13), Category: "ruoka", ExpensesSum: 70},
+		{ExpenseDate: today, Category: "ruoka", ExpensesSum: 70},
+	}
+
+	got := Project(today, current, nil, confighandler.Budget{})
+	if got.DaysInMonth != 28 {
+		t.Errorf("Project() days in month = %d, want 28", got.DaysInMonth)
+	}
+	// Pace only: 140€ in 14 days continues for the rest of February
+	if got.Total.Projected != 280 {
+		t.Errorf("Project() total = %.2f, want 280.00", got.Total.Projected)
+	}
+	if len(got.OverBudget()) != 0 {
+		t.Errorf("OverBudget() without budgets = %+v", got.OverBudget())
+	}
+}
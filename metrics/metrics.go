@@ -0,0 +1,329 @@
+// Package metrics is a minimal implementation of Prometheus metrics: counters,
+// histograms and values read on scrape. They're exposed in the text format,
+// see https://prometheus.io/docs/instrumenting/exposition_formats/
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the histogram buckets in seconds, same as in the Prometheus client
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type collector interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry holds the metrics exposed together
+type Registry struct {
+	lock       sync.Mutex
+	collectors map[string]collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: map[string]collector{},
+	}
+}
+
+// DefaultRegistry is used by the package level constructors and Handler
+var DefaultRegistry = NewRegistry()
+
+// register panics on duplicate names, like the Prometheus client does. Metrics
+// are registered in package variables, so duplicates are programming errors.
+func (r *Registry) register(c collector) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, found := r.collectors[c.name()]; found {
+		panic("metrics: duplicate metric " + c.name())
+	}
+	r.collectors[c.name()] = c
+}
+
+// WriteText writes all metrics sorted by name
+func (r *Registry) WriteText(w io.Writer) error {
+	r.lock.Lock()
+	collectors := make([]collector, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		collectors = append(collectors, c)
+	}
+	r.lock.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool {
+		return collectors[i].name() < collectors[j].name()
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler serves the metrics for Prometheus
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := r.WriteText(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// Handler serves the metrics of DefaultRegistry
+func Handler() http.Handler {
+	return DefaultRegistry.Handler()
+}
+
+var labelEscape = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelString returns e.g. {command="osto",outcome="ok"}
+func labelString(names, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(names)+len(extra)/2)
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+labelEscape.Replace(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+labelEscape.Replace(extra[i+1])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// labelKey joins the label values for map keys
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func checkLabels(name string, names, values []string) {
+	if len(names) != len(values) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", name, len(names), len(values)))
+	}
+}
+
+// series holds the label values of one time series, sorted for the output
+type series[T any] struct {
+	values []string
+	data   T
+}
+
+func sortedSeries[T any](m map[string]*series[T]) []*series[T] {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := make([]*series[T], 0, len(keys))
+	for _, key := range keys {
+		out = append(out, m[key])
+	}
+	return out
+}
+
+// Counter only goes up, e.g. processed commands
+type Counter struct {
+	metricName string
+	help       string
+	labels     []string
+
+	lock   sync.Mutex
+	series map[string]*series[float64]
+}
+
+// NewCounter registers a counter to DefaultRegistry
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{
+		metricName: name,
+		help:       help,
+		labels:     labels,
+		series:     map[string]*series[float64]{},
+	}
+	DefaultRegistry.register(c)
+	return c
+}
+
+func (c *Counter) name() string { return c.metricName }
+
+// Inc adds one to the series with the label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the series with the label values
+func (c *Counter) Add(v float64, labelValues ...string) {
+	checkLabels(c.metricName, c.labels, labelValues)
+	if v < 0 {
+		panic("metrics: counter " + c.metricName + " can't decrease")
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	key := labelKey(labelValues)
+	s, ok := c.series[key]
+	if !ok {
+		s = &series[float64]{values: append([]string{}, labelValues...)}
+		c.series[key] = s
+	}
+	s.data += v
+}
+
+// Value returns the current value of the series
+func (c *Counter) Value(labelValues ...string) float64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if s, ok := c.series[labelKey(labelValues)]; ok {
+		return s.data
+	}
+	return 0
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	writeHeader(w, c.metricName, c.help, "counter")
+	for _, s := range sortedSeries(c.series) {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, labelString(c.labels, s.values), formatFloat(s.data))
+	}
+}
+
+type histogramData struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Histogram counts observations into buckets, e.g. request durations
+type Histogram struct {
+	metricName string
+	help       string
+	buckets    []float64
+	labels     []string
+
+	lock   sync.Mutex
+	series map[string]*series[*histogramData]
+}
+
+// NewHistogram registers a histogram to DefaultRegistry. Buckets are the upper
+// bounds in increasing order, +Inf is added automatically.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		metricName: name,
+		help:       help,
+		buckets:    buckets,
+		labels:     labels,
+		series:     map[string]*series[*histogramData]{},
+	}
+	DefaultRegistry.register(h)
+	return h
+}
+
+func (h *Histogram) name() string { return h.metricName }
+
+// Observe adds the value to the series with the label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	checkLabels(h.metricName, h.labels, labelValues)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	key := labelKey(labelValues)
+	s, ok := h.series[key]
+	if !ok {
+		s = &series[*histogramData]{
+			values: append([]string{}, labelValues...),
+			data:   &histogramData{counts: make([]uint64, len(h.buckets))},
+		}
+		h.series[key] = s
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			s.data.counts[i]++
+		}
+	}
+	s.data.count++
+	s.data.sum += v
+}
+
+// Count returns how many values the series has
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if s, ok := h.series[labelKey(labelValues)]; ok {
+		return s.data.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	writeHeader(w, h.metricName, h.help, "histogram")
+	for _, s := range sortedSeries(h.series) {
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n",
+				h.metricName, labelString(h.labels, s.values, "le", formatFloat(bound)), s.data.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n",
+			h.metricName, labelString(h.labels, s.values, "le", "+Inf"), s.data.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, labelString(h.labels, s.values), formatFloat(s.data.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, labelString(h.labels, s.values), s.data.count)
+	}
+}
+
+// funcMetric is read on every scrape, e.g. from pgxpool stats
+type funcMetric struct {
+	metricName string
+	help       string
+	typ        string
+	fn         func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value is read with fn on every scrape
+func NewGaugeFunc(name, help string, fn func() float64) {
+	DefaultRegistry.register(&funcMetric{metricName: name, help: help, typ: "gauge", fn: fn})
+}
+
+// NewCounterFunc registers a counter whose value is read with fn on every
+// scrape. fn must never return a smaller value than before.
+func NewCounterFunc(name, help string, fn func() float64) {
+	DefaultRegistry.register(&funcMetric{metricName: name, help: help, typ: "counter", fn: fn})
+}
+
+func (f *funcMetric) name() string { return f.metricName }
+
+func (f *funcMetric) write(w *bufio.Writer) {
+	writeHeader(w, f.metricName, f.help, f.typ)
+	fmt.Fprintf(w, "%s %s\n", f.metricName, formatFloat(f.fn()))
+}
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// Metrics are registered to DefaultRegistry, so every test uses its own names
+
+func scrape(t *testing.T, prefix string) string {
+	t.Helper()
+	buf := bytes.Buffer{}
+	if err := DefaultRegistry.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.Contains(line, prefix) {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestCounter(t *testing.T) {
+	c := NewCounter("test_commands_total", "Commands.", "command", "outcome")
+	c.Inc("osto", "ok")
+	c.Inc("osto", "ok")
+	c.Add(3, "palkka", `quo"te`)
+
+	expected := `# HELP test_commands_total Commands.
+# TYPE test_commands_total counter
+test_commands_total{command="osto",outcome="ok"} 2
+test_commands_total{command="palkka",outcome="quo\"te"} 3`
+	if diff := cmp.Diff(expected, scrape(t, "test_commands_total")); diff != "" {
+		t.Errorf("output differs:\n%s", diff)
+	}
+	if v := c.Value("osto", "ok"); v != 2 {
+		t.Errorf("got value %v", v)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram("test_duration_seconds", "Durations.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "/ui")
+	h.Observe(0.5, "/ui")
+	h.Observe(5, "/ui")
+
+	expected := `# HELP test_duration_seconds Durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{route="/ui",le="0.1"} 1
+test_duration_seconds_bucket{route="/ui",le="1"} 2
+test_duration_seconds_bucket{route="/ui",le="+Inf"} 3
+test_duration_seconds_sum{route="/ui"} 5.55
+test_duration_seconds_count{route="/ui"} 3`
+	if diff := cmp.Diff(expected, scrape(t, "test_duration_seconds")); diff != "" {
+		t.Errorf("output differs:\n%s", diff)
+	}
+	if n := h.Count("/ui"); n != 3 {
+		t.Errorf("got count %d", n)
+	}
+}
+
+func TestFuncMetrics(t *testing.T) {
+	value := 1.0
+	NewGaugeFunc("test_pages", "Pages.", func() float64 { return value })
+	value = 7
+
+	expected := `# HELP test_pages Pages.
+# TYPE test_pages gauge
+test_pages 7`
+	if diff := cmp.Diff(expected, scrape(t, "test_pages")); diff != "" {
+		t.Errorf("output differs:\n%s", diff)
+	}
+}
+
+func TestMisuse(t *testing.T) {
+	c := NewCounter("test_misuse_total", "Misuse.", "label")
+
+	tests := []struct {
+		name string
+		fn   func()
+	}{
+		{name: "duplicate", fn: func() { NewCounter("test_misuse_total", "Again.") }},
+		{name: "missing label", fn: func() { c.Inc() }},
+		{name: "decrease", fn: func() { c.Add(-1, "x") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic")
+				}
+			}()
+			tt.fn()
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("got content type %q", ct)
+	}
+}
@@ -0,0 +1,232 @@
+// Package ocr reads the merchant, date and total from photos of receipts.
+// The text recognition is done by an Engine, the parsing of the text is
+// tuned for Finnish receipts.
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"weezel/budget/confighandler"
+)
+
+const (
+	// DefaultBinary is looked up from PATH
+	DefaultBinary = "tesseract"
+	// DefaultLanguages are the Tesseract language models, Finnish and English
+	// for the product names
+	DefaultLanguages = "fin+eng"
+	// timeout stops a stuck recognition, the user is waiting for the answer
+	timeout = time.Minute
+)
+
+// Engine turns the image into text
+type Engine interface {
+	Text(ctx context.Context, image []byte) (string, error)
+}
+
+// Receipt holds what was found from the receipt. Fields which couldn't be
+// read are left to zero values.
+type Receipt struct {
+	Merchant string
+	Date     time.Time
+	Total    float64
+}
+
+// Complete tells whether the receipt has everything needed for a purchase.
+// The date defaults to the current day.
+func (r Receipt) Complete() bool {
+	return r.Merchant != "" && r.Total > 0
+}
+
+// New returns the engine selected in the configuration, nil when OCR is disabled
+func New(conf confighandler.OCR) (Engine, error) {
+	switch conf.Backend {
+	case "":
+		return nil, nil
+	case "tesseract":
+		return NewTesseract(conf.Binary, conf.Languages)
+	}
+	return nil, fmt.Errorf("unknown OCR backend %q", conf.Backend)
+}
+
+// Tesseract runs the local tesseract binary
+type Tesseract struct {
+	binary    string
+	languages string
+}
+
+var _ Engine = (*Tesseract)(nil)
+
+// NewTesseract fails if the binary can't be found, so that a missing
+// installation is noticed on start up
+func NewTesseract(binary, languages string) (*Tesseract, error) {
+	if binary == "" {
+		binary = DefaultBinary
+	}
+	if languages == "" {
+		languages = DefaultLanguages
+	}
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		return nil, fmt.Errorf("tesseract: %w", err)
+	}
+	return &Tesseract{binary: path, languages: languages}, nil
+}
+
+// Text passes the image through stdin and reads the text from stdout
+func (t *Tesseract) Text(ctx context.Context, image []byte) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.binary, "stdin", "stdout", "-l", t.languages)
+	cmd.Stdin = bytes.NewReader(image)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("tesseract: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// Read recognizes the text of the image and parses it
+func Read(ctx context.Context, engine Engine, image []byte) (Receipt, error) {
+	if engine == nil {
+		return Receipt{}, errors.New("OCR is disabled")
+	}
+	text, err := engine.Text(ctx, image)
+	if err != nil {
+		return Receipt{}, err
+	}
+	return Parse(text), nil
+}
+
+var (
+	datePattern    = regexp.MustCompile(`\b(\d{1,2})\.(\d{1,2})\.(\d{4}|\d{2})\b`)
+	isoDatePattern = regexp.MustCompile(`\b(\d{4})-(\d{2})-(\d{2})\b`)
+	// Amounts have always two decimals, OCR may read the comma as a point
+	amountPattern = regexp.MustCompile(`(\d+)\s?[,.]\s?(\d{2})\b`)
+)
+
+// totalKeywords are the labels of the total in the order of preference.
+// OCR loses the umlauts often, both forms are accepted.
+var totalKeywords = []string{
+	"yhteensä", "yhteensa", "maksettava", "summa", "total", "yht",
+}
+
+// merchantSkipWords are found in the header lines which aren't the name
+var merchantSkipWords = []string{
+	"kuitti", "tervetuloa", "y-tunnus", "ytunnus", "puh", "www", "http", "kassa", "myyjä", "alv",
+}
+
+// Parse finds the merchant, date and total from the text of the receipt
+func Parse(text string) Receipt {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return Receipt{
+		Merchant: parseMerchant(lines),
+		Date:     parseDate(lines),
+		Total:    parseTotal(lines),
+	}
+}
+
+// parseMerchant returns the first line of the header which looks like a name
+func parseMerchant(lines []string) string {
+	for _, line := range lines {
+		if amountPattern.MatchString(line) && !datePattern.MatchString(line) {
+			// Rows of the products have prices, the header is over
+			break
+		}
+		lower := strings.ToLower(line)
+		letters := 0
+		for _, r := range line {
+			if unicode.IsLetter(r) {
+				letters++
+			}
+		}
+		if letters < 3 || containsAny(lower, merchantSkipWords) {
+			continue
+		}
+		return line
+	}
+	return ""
+}
+
+// parseDate returns the first valid date, in either Finnish or ISO format
+func parseDate(lines []string) time.Time {
+	for _, line := range lines {
+		if m := datePattern.FindStringSubmatch(line); m != nil {
+			year, _ := strconv.Atoi(m[3])
+			if len(m[3]) == 2 {
+				year += 2000
+			}
+			month, _ := strconv.Atoi(m[2])
+			day, _ := strconv.Atoi(m[1])
+			if date, ok := validDate(year, month, day); ok {
+				return date
+			}
+		}
+		if m := isoDatePattern.FindStringSubmatch(line); m != nil {
+			year, _ := strconv.Atoi(m[1])
+			month, _ := strconv.Atoi(m[2])
+			day, _ := strconv.Atoi(m[3])
+			if date, ok := validDate(year, month, day); ok {
+				return date
+			}
+		}
+	}
+	return time.Time{}
+}
+
+func validDate(year, month, day int) (time.Time, bool) {
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	// time.Date normalizes e.g. 31.2. to March
+	if date.Year() != year || int(date.Month()) != month || date.Day() != day {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// parseTotal returns the last amount on the line of the most preferred label.
+// The lines of the VAT breakdown repeat the labels, they're skipped.
+func parseTotal(lines []string) float64 {
+	for _, keyword := range totalKeywords {
+		for _, line := range lines {
+			lower := strings.ToLower(line)
+			if !strings.Contains(lower, keyword) || strings.Contains(lower, "alv") {
+				continue
+			}
+			matches := amountPattern.FindAllStringSubmatch(line, -1)
+			if len(matches) == 0 {
+				continue
+			}
+			last := matches[len(matches)-1]
+			total, err := strconv.ParseFloat(last[1]+"."+last[2], 64)
+			if err == nil && total > 0 {
+				return total
+			}
+		}
+	}
+	return 0
+}
+
+func containsAny(s string, words []string) bool {
+	for _, w := range words {
+		if strings.Contains(s, w) {
+			return true
+		}
+	}
+	return false
+}
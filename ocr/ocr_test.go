@@ -0,0 +1,146 @@
+package ocr
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type cannedEngine string
+
+func (c cannedEngine) Text(context.Context, []byte) (string, error) {
+	return string(c), nil
+}
+
+const kMarket = `
+  *** KUITTI ***
+K-Market Kalevanpuisto
+Y-tunnus 1234567-8
+Puh. 010 123 4567
+
+MAITO 1L                 1,19
+RUISLEIPÄ                2,49
+BANAANI 0,812 KG         1,62
+-----------------------------
+YHTEENSÄ                 5,30
+PANKKIKORTTI             5,30
+
+ALV%   VEROTON   VERO   VEROLLINEN
+14,00    4,65    0,65      5,30
+ALV YHTEENSÄ              0,65
+
+03.02.24 17:45  Kassa 2
+Kiitos käynnistä!
+`
+
+const sMarket = `
+S-MARKET HERVANTA
+Tervetuloa!
+2024-03-15 09:12
+KAHVI 500G               5,99
+Valisumma                5,99
+YHTEENSA EUR             5.99
+`
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want Receipt
+	}{
+		{
+			name: "k-market",
+			text: kMarket,
+			want: Receipt{
+				Merchant: "K-Market Kalevanpuisto",
+				Date:     time.Date(2024, 2, 3, 0, 0, 0, 0, time.UTC),
+				Total:    5.30,
+			},
+		},
+		{
+			name: "s-market without umlauts",
+			text: sMarket,
+			want: Receipt{
+				Merchant: "S-MARKET HERVANTA",
+				Date:     time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC),
+				Total:    5.99,
+			},
+		},
+		{
+			name: "invalid date and no total",
+			text: "Kioski\n31.02.2024\nLEHTI 4,90\n",
+			want: Receipt{Merchant: "Kioski"},
+		},
+		{
+			name: "garbage",
+			text: "~~ |\n12\n",
+			want: Receipt{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Parse(tt.text)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Parse() mismatch (-want +got):\n%s", diff)
+			}
+			if got.Complete() != (tt.want.Merchant != "" && tt.want.Total > 0) {
+				t.Errorf("Complete() = %t", got.Complete())
+			}
+		})
+	}
+}
+
+func TestRead(t *testing.T) {
+	got, err := Read(context.Background(), cannedEngine(sMarket), []byte("kuva"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Merchant != "S-MARKET HERVANTA" || got.Total != 5.99 {
+		t.Errorf("Read() = %+v", got)
+	}
+	if _, err = Read(context.Background(), nil, nil); err == nil {
+		t.Error("Read() without engine succeeded")
+	}
+}
+
+func TestTesseract(t *testing.T) {
+	if _, err := NewTesseract(filepath.Join(t.TempDir(), "missing"), ""); err == nil {
+		t.Error("NewTesseract() accepted a missing binary")
+	}
+
+	// The fake binary prints its arguments and the image
+	binary := filepath.Join(t.TempDir(), "tesseract")
+	script := "#!/bin/sh\necho \"$@\"\ncat\n"
+	if err := os.WriteFile(binary, []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	engine, err := NewTesseract(binary, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := engine.Text(context.Background(), []byte("Lidl\nYHTEENSÄ 3,50\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "stdin stdout -l fin+eng\nLidl\nYHTEENSÄ 3,50\n"; text != want {
+		t.Errorf("Text() = %q, want %q", text, want)
+	}
+
+	failing := filepath.Join(t.TempDir(), "tesseract")
+	script = "#!/bin/sh\necho 'Error opening data file' >&2\nexit 1\n"
+	if err = os.WriteFile(failing, []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	engine, err = NewTesseract(failing, "fin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = engine.Text(context.Background(), nil); err == nil || !strings.Contains(err.Error(), "data file") {
+		t.Errorf("Text() returned %v, expected the stderr of tesseract", err)
+	}
+}
@@ -0,0 +1,94 @@
+package outputs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"weezel/budget/db"
+)
+
+// BalanceVars holds month-to-date data for the quick balance check.
+type BalanceVars struct {
+	Month           time.Time
+	Today           time.Time
+	Expenses        []*db.GetAggrExpensesByTimespanRow
+	Debts           []*db.StatisticsAggrByTimespanRow
+	Categories      []*db.GetCategoryExpensesByTimespanRow
+	MonthlyBudget   float64
+	CategoryBudgets map[string]float64
+}
+
+// RenderBalanceText renders month-to-date totals per user, the current debt and
+// the remaining budgets as a fixed width text.
+func RenderBalanceText(balanceVars BalanceVars) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "Saldo %s (1.-%d.)\n",
+		balanceVars.Month.Format("01-2006"),
+		balanceVars.Today.Day())
+
+	// Expense rows are split by shops too, hence sum them up per user
+	userTotals := map[string]float64{}
+	usernames := []string{}
+	total := 0.0
+	for _, e := range balanceVars.Expenses {
+		if _, ok := userTotals[e.Username]; !ok {
+			usernames = append(usernames, e.Username)
+		}
+		userTotals[e.Username] += e.ExpensesSum
+		total += e.ExpensesSum
+	}
+	sort.Strings(usernames)
+
+	sb.WriteString("\nKulut:\n")
+	for _, username := range usernames {
+		fmt.Fprintf(&sb, "  %-16s %9.2f€\n", username, userTotals[username])
+	}
+	fmt.Fprintf(&sb, "  %-16s %9.2f€\n", "yhteensä", total)
+
+	sb.WriteString("\nVelka:\n")
+	if len(balanceVars.Debts) != 2 {
+		sb.WriteString("  ei laskettavissa, palkkatiedot puuttuvat\n")
+	} else {
+		settled := true
+		for _, d := range balanceVars.Debts {
+			if d.Owes > 0 {
+				settled = false
+				fmt.Fprintf(&sb, "  %-16s %9.2f€\n", d.Username, d.Owes)
+			}
+		}
+		if settled {
+			sb.WriteString("  ei velkaa\n")
+		}
+	}
+
+	categoryTotals := map[string]float64{}
+	for _, c := range balanceVars.Categories {
+		categoryTotals[c.Category] += c.ExpensesSum
+	}
+	categories := make([]string, 0, len(balanceVars.CategoryBudgets))
+	for category := range balanceVars.CategoryBudgets {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	if balanceVars.MonthlyBudget > 0 || len(categories) > 0 {
+		sb.WriteString("\nBudjettia jäljellä:\n")
+	}
+	if balanceVars.MonthlyBudget > 0 {
+		fmt.Fprintf(&sb, "  %-16s %9.2f€ / %.2f€\n",
+			"kaikki",
+			balanceVars.MonthlyBudget-total,
+			balanceVars.MonthlyBudget)
+	}
+	for _, category := range categories {
+		budget := balanceVars.CategoryBudgets[category]
+		fmt.Fprintf(&sb, "  %-16s %9.2f€ / %.2f€\n",
+			category,
+			budget-categoryTotals[category],
+			budget)
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
@@ -0,0 +1,86 @@
+package outputs
+
+import (
+	"testing"
+	"time"
+	"weezel/budget/db"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRenderBalanceText(t *testing.T) {
+	month := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	today := time.Date(2022, 3, 14, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		vars BalanceVars
+		want string
+	}{
+		{
+			name: "Salaries missing and no budgets",
+			vars: BalanceVars{
+				Month: month,
+				Today: today,
+				Expenses: []*db.GetAggrExpensesByTimespanRow{
+					{Username: "tom", Months: month, ExpensesSum: 10},
+				},
+			},
+			want: "Saldo 03-2022 (1.-14.)\n" +
+				"\n" +
+				"Kulut:\n" +
+				"  tom                  10.00€\n" +
+				"  yhteensä             10.00€\n" +
+				"\n" +
+				"Velka:\n" +
+				"  ei laskettavissa, palkkatiedot puuttuvat",
+		},
+		{
+			name: "Debts and budgets",
+			vars: BalanceVars{
+				Month: month,
+				Today: today,
+				Expenses: []*db.GetAggrExpensesByTimespanRow{
+					{Username: "tom", Months: month, ExpensesSum: 10},
+					{Username: "alice", Months: month, ExpensesSum: 40},
+					{Username: "tom", Months: month, ExpensesSum: 20.5},
+				},
+				Debts: []*db.StatisticsAggrByTimespanRow{
+					{Username: "alice", Owes: 0},
+					{Username: "tom", Owes: 4.25},
+				},
+				Categories: []*db.GetCategoryExpensesByTimespanRow{
+					{Category: "ruoka", Months: month, ExpensesSum: 50},
+					{Category: "", Months: month, ExpensesSum: 20.5},
+				},
+				MonthlyBudget: 100,
+				CategoryBudgets: map[string]float64{
+					"ruoka":    60,
+					"alkoholi": 20,
+				},
+			},
+			want: "Saldo 03-2022 (1.-14.)\n" +
+				"\n" +
+				"Kulut:\n" +
+				"  alice                40.00€\n" +
+				"  tom                  30.50€\n" +
+				"  yhteensä             70.50€\n" +
+				"\n" +
+				"Velka:\n" +
+				"  tom                   4.25€\n" +
+				"\n" +
+				"Budjettia jäljellä:\n" +
+				"  kaikki               29.50€ / 100.00€\n" +
+				"  alkoholi             20.00€ / 20.00€\n" +
+				"  ruoka                10.00€ / 60.00€",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RenderBalanceText(tt.vars)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("%s: RenderBalanceText() mismatch:\n%s", tt.name, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package outputs
+
+import (
+	"fmt"
+	"strings"
+	"weezel/budget/forecast"
+)
+
+func writeProjection(sb *strings.Builder, name string, p forecast.Projection) {
+	fmt.Fprintf(sb, "%-12s %8.2f %8.2f %8.2f-%-8.2f",
+		name,
+		p.Spent,
+		p.Projected,
+		p.Low,
+		p.High)
+	if p.Budget > 0 {
+		fmt.Fprintf(sb, " %8.2f", p.Budget)
+		if p.OverBudget() {
+			sb.WriteString(" !")
+		}
+	}
+	sb.WriteString("\n")
+}
+
+// RenderForecastText renders month-end projections as a fixed width text
+func RenderForecastText(f forecast.Forecast) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "Ennuste %s (päivä %d/%d)\n\n",
+		f.Month.Format("01-2006"),
+		f.DaysElapsed,
+		f.DaysInMonth)
+	fmt.Fprintf(&sb, "%-12s %8s %8s %-17s %8s\n", "", "nyt", "ennuste", "95% väli", "budjetti")
+	writeProjection(&sb, "yhteensä", f.Total)
+	for _, c := range f.Categories {
+		writeProjection(&sb, CategoryName(c.Category), c)
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// RenderForecastAlert lists the projections that are about to exceed
+// their budgets. Empty string is returned when budgets hold.
+func RenderForecastAlert(f forecast.Forecast) string {
+	overBudget := f.OverBudget()
+	if len(overBudget) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Budjetti ylittymässä %s:\n", f.Month.Format("01-2006"))
+	for i, p := range overBudget {
+		name := CategoryName(p.Category)
+		if i == 0 && f.Total.OverBudget() {
+			name = "yhteensä"
+		}
+		fmt.Fprintf(&sb, "%-12s ennuste %.2f€ (%.2f-%.2f€), budjetti %.2f€\n",
+			name,
+			p.Projected,
+			p.Low,
+			p.High,
+			p.Budget)
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
@@ -0,0 +1,50 @@
+package outputs
+
+import (
+	"testing"
+	"time"
+	"weezel/budget/forecast"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRenderForecastAlert(t *testing.T) {
+	month := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		forecast forecast.Forecast
+		want     string
+	}{
+		{
+			name: "Within budget",
+			forecast: forecast.Forecast{
+				Month: month,
+				Total: forecast.Projection{Projected: 90, Budget: 100},
+			},
+			want: "",
+		},
+		{
+			name: "Total and category over budget",
+			forecast: forecast.Forecast{
+				Month: month,
+				Total: forecast.Projection{Projected: 120, Low: 110, High: 130, Budget: 100},
+				Categories: []forecast.Projection{
+					{Category: "ruoka", Projected: 80, Low: 70, High: 90, Budget: 60},
+					{Category: "", Projected: 40, Low: 30, High: 50},
+				},
+			},
+			want: "Budjetti ylittymässä 03-2022:\n" +
+				"yhteensä     ennuste 120.00€ (110.00-130.00€), budjetti 100.00€\n" +
+				"ruoka        ennuste 80.00€ (70.00-90.00€), budjetti 60.00€",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RenderForecastAlert(tt.forecast)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("%s: RenderForecastAlert() mismatch:\n%s", tt.name, diff)
+			}
+		})
+	}
+}
@@ -4,19 +4,39 @@ import (
 	"bytes"
 	"database/sql"
 	"embed"
+	"fmt"
 	"html/template"
 	"time"
+	"weezel/budget/analytics"
 	"weezel/budget/db"
 )
 
 //go:embed stats.gohtml
 var dataTemplateFS embed.FS
 
+// uncategorized is shown for the expenses that were stored without a #category
+const uncategorized = "muut"
+
 type StatisticsVars struct {
-	From       time.Time
-	To         time.Time
-	Statistics []*db.StatisticsAggrByTimespanRow
-	Detailed   []*db.GetExpensesByTimespanRow
+	From           time.Time
+	To             time.Time
+	Statistics     []*db.StatisticsAggrByTimespanRow
+	Detailed       []*db.GetExpensesByTimespanRow
+	Categories     []*db.GetCategoryExpensesByTimespanRow
+	CategoryShares []*db.GetCategorySharesByTimespanRow
+	TopShops       []*db.GetTopShopsByTimespanRow
+	Trends         analytics.Report
+	// Receipts maps the IDs of the expenses to the hashes of their receipts
+	Receipts map[int32][]string
+}
+
+// ReceiptsByExpense groups the hashes of the attachments by their expenses
+func ReceiptsByExpense(attachments []*db.ListAttachmentsByTimespanRow) map[int32][]string {
+	receipts := map[int32][]string{}
+	for _, a := range attachments {
+		receipts[a.ExpenseID] = append(receipts[a.ExpenseID], a.Hash)
+	}
+	return receipts
 }
 
 func FormatNullFloat(f sql.NullFloat64) float64 {
@@ -26,11 +46,27 @@ func FormatNullFloat(f sql.NullFloat64) float64 {
 	return 0.0
 }
 
+// CategoryName returns a printable name for the category
+func CategoryName(category string) string {
+	if category == "" {
+		return uncategorized
+	}
+	return category
+}
+
+// Percent formats share in range [0, 1] as a percentage
+func Percent(share float64) string {
+	return fmt.Sprintf("%.1f %%", share*100)
+}
+
 func RenderStatsHTML(templateVars StatisticsVars) ([]byte, error) {
 	filename := "stats.gohtml"
 
 	tpl, err := template.New(filename).Funcs(template.FuncMap{
 		"FormatNullFloat": FormatNullFloat,
+		"CategoryName":    CategoryName,
+		"Percent":         Percent,
+		"FormatDelta":     FormatDelta,
 	}).ParseFS(dataTemplateFS, filename)
 	if err != nil {
 		return nil, err
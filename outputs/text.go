@@ -0,0 +1,53 @@
+package outputs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RenderStatsText renders a compact version of the category and shop sections
+// so that it can be sent directly to the chat.
+func RenderStatsText(templateVars StatisticsVars) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "Kategoriat %s - %s:\n",
+		templateVars.From.Format("01-2006"),
+		templateVars.To.Format("01-2006"))
+	if len(templateVars.CategoryShares) == 0 {
+		sb.WriteString("  ei kulutuksia\n")
+	}
+	for _, c := range templateVars.CategoryShares {
+		fmt.Fprintf(&sb, "  %-14s %9.2f€ %6.1f%%\n",
+			CategoryName(c.Category),
+			c.ExpensesSum,
+			c.Share*100)
+	}
+
+	// Months are ordered, hence consecutive rows belong together
+	var month string
+	for _, c := range templateVars.Categories {
+		if m := c.Months.Format("01-2006"); m != month {
+			month = m
+			fmt.Fprintf(&sb, "\n%s:", month)
+		} else {
+			sb.WriteString(",")
+		}
+		fmt.Fprintf(&sb, " %s %.2f€", CategoryName(c.Category), c.ExpensesSum)
+	}
+	if month != "" {
+		sb.WriteString("\n")
+	}
+
+	if len(templateVars.TopShops) > 0 {
+		fmt.Fprintf(&sb, "\nTop %d kaupat:\n", len(templateVars.TopShops))
+	}
+	for i, shop := range templateVars.TopShops {
+		fmt.Fprintf(&sb, "  %2d. %-14s %9.2f€ (%d kpl)\n",
+			i+1,
+			shop.ShopName,
+			shop.ExpensesSum,
+			shop.Purchases)
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
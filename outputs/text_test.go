@@ -0,0 +1,64 @@
+package outputs
+
+import (
+	"testing"
+	"time"
+	"weezel/budget/db"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRenderStatsText(t *testing.T) {
+	jan := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		vars StatisticsVars
+		want string
+	}{
+		{
+			name: "No expenses",
+			vars: StatisticsVars{From: jan, To: feb},
+			want: "Kategoriat 01-2022 - 02-2022:\n  ei kulutuksia",
+		},
+		{
+			name: "Categories and shops",
+			vars: StatisticsVars{
+				From: jan,
+				To:   feb,
+				Categories: []*db.GetCategoryExpensesByTimespanRow{
+					{Category: "ruoka", Months: jan, ExpensesSum: 60},
+					{Category: "", Months: jan, ExpensesSum: 15},
+					{Category: "ruoka", Months: feb, ExpensesSum: 25},
+				},
+				CategoryShares: []*db.GetCategorySharesByTimespanRow{
+					{Category: "ruoka", ExpensesSum: 85, Share: 0.85},
+					{Category: "", ExpensesSum: 15, Share: 0.15},
+				},
+				TopShops: []*db.GetTopShopsByTimespanRow{
+					{ShopName: "lidl", Purchases: 3, ExpensesSum: 85},
+					{ShopName: "kioski", Purchases: 1, ExpensesSum: 15},
+				},
+			},
+			want: "Kategoriat 01-2022 - 02-2022:\n" +
+				"  ruoka              85.00€   85.0%\n" +
+				"  muut               15.00€   15.0%\n" +
+				"\n" +
+				"01-2022: ruoka 60.00€, muut 15.00€\n" +
+				"02-2022: ruoka 25.00€\n" +
+				"\n" +
+				"Top 2 kaupat:\n" +
+				"   1. lidl               85.00€ (3 kpl)\n" +
+				"   2. kioski             15.00€ (1 kpl)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RenderStatsText(tt.vars)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("%s: RenderStatsText() mismatch:\n%s", tt.name, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package outputs
+
+import (
+	"fmt"
+	"strings"
+	"weezel/budget/analytics"
+)
+
+// savingsMonthsInText limits the savings rate history sent to the chat
+const savingsMonthsInText = 3
+
+// FormatDelta formats relative change with a sign, or absolute change when
+// relative one cannot be computed.
+func FormatDelta(d analytics.Delta) string {
+	if !d.PctValid {
+		if d.Abs == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%+.0f€", d.Abs)
+	}
+	return fmt.Sprintf("%+.1f%%", d.Pct*100)
+}
+
+func writeTrends(sb *strings.Builder, title string, trends []analytics.Trend, nameFn func(string) string) {
+	fmt.Fprintf(sb, "\n%-12s %8s %7s %7s %8s %8s\n", title, "kk", "kk/kk", "v/v", "ka3", "ka12")
+	for _, t := range trends {
+		fmt.Fprintf(sb, "%-12s %8.2f %7s %7s %8.2f %8.2f\n",
+			nameFn(t.Name),
+			t.Value,
+			FormatDelta(t.MoM),
+			FormatDelta(t.YoY),
+			t.Rolling3,
+			t.Rolling12)
+	}
+}
+
+// RenderTrendText renders trends as a fixed width text for the chat.
+func RenderTrendText(report analytics.Report) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "Trendit %s\n", report.Month.Format("01-2006"))
+	writeTrends(&sb, "Kategoria", report.Categories, CategoryName)
+	writeTrends(&sb, "Käyttäjä", report.Users, func(s string) string { return s })
+
+	sb.WriteString("\nSäästöaste:\n")
+	savings := report.Savings[max(0, len(report.Savings)-savingsMonthsInText):]
+	for _, s := range savings {
+		fmt.Fprintf(&sb, "%s %9.2f€ %6.1f%%\n",
+			s.Month.Format("01-2006"),
+			s.Savings,
+			s.Rate*100)
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
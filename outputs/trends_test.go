@@ -0,0 +1,55 @@
+package outputs
+
+import (
+	"testing"
+	"time"
+	"weezel/budget/analytics"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRenderTrendText(t *testing.T) {
+	month := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	report := analytics.Report{
+		Month: month,
+		Categories: []analytics.Trend{
+			{
+				Name:      "ruoka",
+				Value:     150,
+				MoM:       analytics.Delta{Abs: 50, Pct: 0.5, PctValid: true},
+				YoY:       analytics.Delta{Abs: -50, Pct: -0.25, PctValid: true},
+				Rolling3:  83.33,
+				Rolling12: 20.83,
+			},
+			{Name: "", Value: 50, MoM: analytics.Delta{Abs: 50}, Rolling3: 16.67, Rolling12: 4.17},
+		},
+		Users: []analytics.Trend{
+			{Name: "alice", Value: 150, Rolling3: 50, Rolling12: 12.5},
+		},
+		Savings: []analytics.SavingsRate{
+			{Month: month.AddDate(0, -3, 0)},
+			{Month: month.AddDate(0, -2, 0)},
+			{Month: month.AddDate(0, -1, 0), Salaries: 800, Savings: 800, Rate: 1},
+			{Month: month, Salaries: 800, Expenses: 200, Savings: 600, Rate: 0.75},
+		},
+	}
+
+	want := "Trendit 03-2022\n" +
+		"\n" +
+		"Kategoria          kk   kk/kk     v/v      ka3     ka12\n" +
+		"ruoka          150.00  +50.0%  -25.0%    83.33    20.83\n" +
+		"muut            50.00    +50€       -    16.67     4.17\n" +
+		"\n" +
+		"Käyttäjä           kk   kk/kk     v/v      ka3     ka12\n" +
+		"alice          150.00       -       -    50.00    12.50\n" +
+		"\n" +
+		"Säästöaste:\n" +
+		"01-2022      0.00€    0.0%\n" +
+		"02-2022    800.00€  100.0%\n" +
+		"03-2022    600.00€   75.0%"
+
+	got := RenderTrendText(report)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("RenderTrendText() mismatch:\n%s", diff)
+	}
+}
@@ -0,0 +1,146 @@
+// Package reportlink signs statistics links so that the report can be
+// regenerated on demand instead of keeping the rendered page in memory.
+// Links survive restarts and stay valid until they expire or get revoked.
+package reportlink
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	monthFormat = "2006-01"
+	// MaxTTL limits how long a link can be valid
+	MaxTTL = 365 * 24 * time.Hour
+	// signatureVersion is part of the signed data so that the format can be changed later
+	signatureVersion = "v1"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpired          = errors.New("link has expired")
+	ErrWrongHousehold   = errors.New("link belongs to another household")
+
+	ttlPattern = regexp.MustCompile(`^([1-9][0-9]*)([hdw])$`)
+)
+
+// Link holds the parameters of a statistics report
+type Link struct {
+	// ID identifies the link when revoking it
+	ID   string
+	From time.Time
+	To   time.Time
+	// Household is the Telegram channel the report was requested from
+	Household int64
+	Expires   time.Time
+}
+
+func randomID() string {
+	b := make([]byte, 9)
+	if _, err := rand.Read(b); err != nil {
+		// Never happens on supported platforms, see crypto/rand
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// New returns a link with a random ID, expiring after ttl
+func New(from, to time.Time, household int64, ttl time.Duration, now time.Time) Link {
+	return Link{
+		ID:        randomID(),
+		From:      from,
+		To:        to,
+		Household: household,
+		Expires:   now.Add(ttl).Truncate(time.Second),
+	}
+}
+
+// ParseTTL parses durations like 12h, 7d and 2w
+func ParseTTL(s string) (time.Duration, error) {
+	m := ttlPattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	n, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	unit := time.Hour
+	switch m[2] {
+	case "d":
+		unit = 24 * time.Hour
+	case "w":
+		unit = 7 * 24 * time.Hour
+	}
+	if n > int64(MaxTTL/unit) {
+		return 0, fmt.Errorf("duration %q is longer than %d days", s, MaxTTL/(24*time.Hour))
+	}
+	return time.Duration(n) * unit, nil
+}
+
+func (l Link) signature(secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s|%s|%s|%s|%d|%d",
+		signatureVersion,
+		l.ID,
+		l.From.Format(monthFormat),
+		l.To.Format(monthFormat),
+		l.Household,
+		l.Expires.Unix())
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Query returns the signed query parameters of the link
+func (l Link) Query(secret []byte) url.Values {
+	return url.Values{
+		"id":   {l.ID},
+		"from": {l.From.Format(monthFormat)},
+		"to":   {l.To.Format(monthFormat)},
+		"h":    {strconv.FormatInt(l.Household, 10)},
+		"exp":  {strconv.FormatInt(l.Expires.Unix(), 10)},
+		"sig":  {l.signature(secret)},
+	}
+}
+
+// Parse verifies the signature, expiry and household of the link. Revocation
+// is up to the caller.
+func Parse(q url.Values, secret []byte, household int64, now time.Time) (Link, error) {
+	if len(secret) == 0 {
+		return Link{}, ErrInvalidSignature
+	}
+
+	from, errFrom := time.Parse(monthFormat, q.Get("from"))
+	to, errTo := time.Parse(monthFormat, q.Get("to"))
+	h, errH := strconv.ParseInt(q.Get("h"), 10, 64)
+	exp, errExp := strconv.ParseInt(q.Get("exp"), 10, 64)
+	if err := errors.Join(errFrom, errTo, errH, errExp); err != nil || q.Get("id") == "" {
+		return Link{}, ErrInvalidSignature
+	}
+	l := Link{
+		ID:        q.Get("id"),
+		From:      from,
+		To:        to,
+		Household: h,
+		Expires:   time.Unix(exp, 0),
+	}
+
+	if !hmac.Equal([]byte(q.Get("sig")), []byte(l.signature(secret))) {
+		return Link{}, ErrInvalidSignature
+	}
+	if now.After(l.Expires) {
+		return Link{}, ErrExpired
+	}
+	if l.Household != household {
+		return Link{}, ErrWrongHousehold
+	}
+	return l, nil
+}
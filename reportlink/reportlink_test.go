@@ -0,0 +1,81 @@
+package reportlink
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var secret = []byte("s3cr3t")
+
+func TestParseTTL(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{"12h", 12 * time.Hour, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"365d", MaxTTL, false},
+		{"366d", 0, true},
+		{"0d", 0, true},
+		{"7", 0, true},
+		{"7m", 0, true},
+		{"-1d", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseTTL(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTTL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("got %s, expected %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	now := time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+	link := New(from, to, -100, 7*24*time.Hour, now)
+
+	tests := []struct {
+		name      string
+		modify    func(q map[string][]string)
+		secret    []byte
+		household int64
+		now       time.Time
+		expected  error
+	}{
+		{"Valid", nil, secret, -100, now, nil},
+		{"Last second", nil, secret, -100, link.Expires, nil},
+		{"Expired", nil, secret, -100, link.Expires.Add(time.Second), ErrExpired},
+		{"Other household", nil, secret, -200, now, ErrWrongHousehold},
+		{"Wrong secret", nil, []byte("other"), -100, now, ErrInvalidSignature},
+		{"No secret", nil, nil, -100, now, ErrInvalidSignature},
+		{"Extended range", func(q map[string][]string) { q["to"] = []string{"2026-12"} }, secret, -100, now, ErrInvalidSignature},
+		{"Extended expiry", func(q map[string][]string) { q["exp"] = []string{"9999999999"} }, secret, -100, now, ErrInvalidSignature},
+		{"Missing ID", func(q map[string][]string) { delete(q, "id") }, secret, -100, now, ErrInvalidSignature},
+		{"Garbage", func(q map[string][]string) { q["from"] = []string{"x"} }, secret, -100, now, ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := link.Query(secret)
+			if tt.modify != nil {
+				tt.modify(q)
+			}
+
+			got, err := Parse(q, tt.secret, tt.household, tt.now)
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("Parse() error = %v, expected %v", err, tt.expected)
+			}
+			if err == nil && (got.ID != link.ID || !got.From.Equal(from) || !got.To.Equal(to)) {
+				t.Errorf("got %+v, expected %+v", got, link)
+			}
+		})
+	}
+}
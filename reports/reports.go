@@ -0,0 +1,71 @@
+// Package reports gathers the data of the reports shown both in Telegram and
+// in the web UI, so that both show the same numbers.
+package reports
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"weezel/budget/analytics"
+	"weezel/budget/dbengine"
+	"weezel/budget/debtcontrol"
+	"weezel/budget/outputs"
+)
+
+// Statistics loads the statistics of the given months, including both ends
+func Statistics(
+	ctx context.Context,
+	store *dbengine.Store,
+	startMonth,
+	endMonth time.Time,
+	topShops int32,
+) (outputs.StatisticsVars, error) {
+	stats, err := store.StatisticsByTimespan(ctx, startMonth, endMonth)
+	if err != nil {
+		return outputs.StatisticsVars{}, fmt.Errorf("statistics: %w", err)
+	}
+	debtcontrol.FillDebts(stats)
+
+	detailedExpenses, err := store.GetExpensesByTimespan(ctx, startMonth, endMonth)
+	if err != nil {
+		return outputs.StatisticsVars{}, fmt.Errorf("expenses: %w", err)
+	}
+
+	categories, err := store.GetCategoryExpensesByTimespan(ctx, startMonth, endMonth)
+	if err != nil {
+		return outputs.StatisticsVars{}, fmt.Errorf("categories: %w", err)
+	}
+
+	categoryShares, err := store.GetCategorySharesByTimespan(ctx, startMonth, endMonth)
+	if err != nil {
+		return outputs.StatisticsVars{}, fmt.Errorf("category shares: %w", err)
+	}
+
+	topShopsRows, err := store.GetTopShopsByTimespan(ctx, startMonth, endMonth, topShops)
+	if err != nil {
+		return outputs.StatisticsVars{}, fmt.Errorf("top shops: %w", err)
+	}
+
+	// The expenses above include the whole end month
+	attachments, err := store.ListAttachmentsByTimespan(ctx, startMonth, endMonth.AddDate(0, 1, -1))
+	if err != nil {
+		return outputs.StatisticsVars{}, fmt.Errorf("attachments: %w", err)
+	}
+
+	trends, err := analytics.Load(ctx, store, endMonth)
+	if err != nil {
+		return outputs.StatisticsVars{}, fmt.Errorf("trends: %w", err)
+	}
+
+	return outputs.StatisticsVars{
+		From:           startMonth,
+		To:             endMonth,
+		Statistics:     stats,
+		Detailed:       detailedExpenses,
+		Categories:     categories,
+		CategoryShares: categoryShares,
+		TopShops:       topShopsRows,
+		Trends:         trends,
+		Receipts:       outputs.ReceiptsByExpense(attachments),
+	}, nil
+}
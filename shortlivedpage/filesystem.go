@@ -0,0 +1,259 @@
+package shortlivedpage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"weezel/budget/logger"
+)
+
+const (
+	htmlSuffix = ".html"
+	metaSuffix = ".json"
+)
+
+// errCorruptMeta is returned for meta files which can't be decoded
+var errCorruptMeta = errors.New("corrupt meta file")
+
+// validHash keeps the hashes from escaping the directory
+var validHash = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+type fileMeta struct {
+	StartTime     time.Time `json:"start_time"`
+	TTLSeconds    int64     `json:"ttl_seconds"`
+	BurnAfterRead bool      `json:"burn_after_read,omitempty"`
+	PINHash       string    `json:"pin_hash,omitempty"`
+}
+
+// FileStore keeps every page as two files in a directory: the HTML and a JSON
+// file with the expiry details. Pages survive restarts.
+type FileStore struct {
+	// lock serializes writers, files are replaced atomically so readers don't need it
+	lock sync.Mutex
+	dir  string
+}
+
+// NewFileStore creates the directory if it doesn't exist yet
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create page directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (f *FileStore) path(pageHash, suffix string) string {
+	return filepath.Join(f.dir, pageHash+suffix)
+}
+
+func (f *FileStore) Add(_ context.Context, pageHash string, page ShortLivedPage) (bool, error) {
+	if !validHash.MatchString(pageHash) {
+		return false, fmt.Errorf("invalid page hash %q", pageHash)
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if _, err := os.Stat(f.path(pageHash, metaSuffix)); err == nil {
+		return false, nil
+	}
+
+	var html []byte
+	if page.HTMLPage != nil {
+		html = *page.HTMLPage
+	}
+	meta, err := json.Marshal(fileMeta{
+		StartTime:     page.StartTime,
+		TTLSeconds:    page.TTLSeconds,
+		BurnAfterRead: page.BurnAfterRead,
+		PINHash:       page.PINHash,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	// Meta file is written last, pages without one are not complete
+	if err := writeFileAtomic(f.path(pageHash, htmlSuffix), html); err != nil {
+		return false, err
+	}
+	if err := writeFileAtomic(f.path(pageHash, metaSuffix), meta); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (f *FileStore) Get(_ context.Context, pageHash string) (ShortLivedPage, error) {
+	if !validHash.MatchString(pageHash) {
+		return ShortLivedPage{}, ErrNotFound
+	}
+
+	meta, err := f.readMeta(pageHash)
+	if err != nil {
+		return ShortLivedPage{}, err
+	}
+	html, err := os.ReadFile(f.path(pageHash, htmlSuffix))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ShortLivedPage{}, ErrNotFound
+	} else if err != nil {
+		return ShortLivedPage{}, err
+	}
+
+	return ShortLivedPage{
+		StartTime:     meta.StartTime,
+		TTLSeconds:    meta.TTLSeconds,
+		BurnAfterRead: meta.BurnAfterRead,
+		PINHash:       meta.PINHash,
+		HTMLPage:      &html,
+	}, nil
+}
+
+func (f *FileStore) Take(ctx context.Context, pageHash string) (ShortLivedPage, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	page, err := f.Get(ctx, pageHash)
+	if err != nil {
+		return ShortLivedPage{}, err
+	}
+	if err := f.remove(pageHash); err != nil {
+		return ShortLivedPage{}, err
+	}
+	return page, nil
+}
+
+func (f *FileStore) Remove(_ context.Context, pageHash string) error {
+	if !validHash.MatchString(pageHash) {
+		return nil
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.remove(pageHash)
+}
+
+func (f *FileStore) RemoveExpired(_ context.Context, now time.Time) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	hashes, err := f.hashes()
+	if err != nil {
+		return 0, err
+	}
+
+	// A bad page mustn't stop the sweep, the pages have salary data
+	removed := 0
+	for _, pageHash := range hashes {
+		meta, err := f.readMeta(pageHash)
+		if errors.Is(err, errCorruptMeta) {
+			// The page can't be served either, its expiry is unknown
+			logger.Errorf("Removing short-lived page with a broken meta file: %s", err)
+			if err = f.remove(pageHash); err != nil {
+				logger.Errorf("Couldn't remove short-lived page %s: %s", pageHash, err)
+				continue
+			}
+			removed++
+			continue
+		}
+		if err != nil {
+			logger.Errorf("Skipping short-lived page %s: %s", pageHash, err)
+			continue
+		}
+		page := ShortLivedPage{StartTime: meta.StartTime, TTLSeconds: meta.TTLSeconds}
+		if !page.Expired(now) {
+			continue
+		}
+		if err := f.remove(pageHash); err != nil {
+			logger.Errorf("Couldn't remove short-lived page %s: %s", pageHash, err)
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func (f *FileStore) Stats(context.Context) (Stats, error) {
+	hashes, err := f.hashes()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stats := Stats{}
+	for _, pageHash := range hashes {
+		info, err := os.Stat(f.path(pageHash, htmlSuffix))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return Stats{}, err
+		}
+		stats.Pages++
+		stats.Bytes += info.Size()
+	}
+	return stats, nil
+}
+
+func (f *FileStore) readMeta(pageHash string) (fileMeta, error) {
+	data, err := os.ReadFile(f.path(pageHash, metaSuffix))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fileMeta{}, ErrNotFound
+	} else if err != nil {
+		return fileMeta{}, err
+	}
+
+	meta := fileMeta{}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return fileMeta{}, fmt.Errorf("page %s: %w: %w", pageHash, errCorruptMeta, err)
+	}
+	return meta, nil
+}
+
+// hashes returns the hashes of the complete pages
+func (f *FileStore) hashes() ([]string, error) {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := []string{}
+	for _, entry := range entries {
+		if pageHash, ok := strings.CutSuffix(entry.Name(), metaSuffix); ok && validHash.MatchString(pageHash) {
+			hashes = append(hashes, pageHash)
+		}
+	}
+	return hashes, nil
+}
+
+// remove must be called with the lock held
+func (f *FileStore) remove(pageHash string) error {
+	// Meta file first so that a half removed page is not served
+	for _, suffix := range []string{metaSuffix, htmlSuffix} {
+		if err := os.Remove(f.path(pageHash, suffix)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
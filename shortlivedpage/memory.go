@@ -0,0 +1,116 @@
+package shortlivedpage
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	hash string
+	page ShortLivedPage
+}
+
+// MemoryStore keeps the pages in memory. When the pages take more than
+// maxBytes, the least recently used ones are dropped.
+type MemoryStore struct {
+	lock     sync.Mutex
+	maxBytes int64
+	bytes    int64
+	// order has the most recently used page at the front
+	order *list.List
+	pages map[string]*list.Element
+}
+
+func NewMemoryStore(maxBytes int64) *MemoryStore {
+	return &MemoryStore{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		pages:    map[string]*list.Element{},
+	}
+}
+
+func (m *MemoryStore) Add(_ context.Context, pageHash string, page ShortLivedPage) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.pages[pageHash]; ok {
+		return false, nil
+	}
+	if page.size() > m.maxBytes {
+		return false, ErrTooLarge
+	}
+
+	m.pages[pageHash] = m.order.PushFront(memoryEntry{hash: pageHash, page: page})
+	m.bytes += page.size()
+	for m.bytes > m.maxBytes {
+		m.remove(m.order.Back())
+	}
+	return true, nil
+}
+
+func (m *MemoryStore) Get(_ context.Context, pageHash string) (ShortLivedPage, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	elem, ok := m.pages[pageHash]
+	if !ok {
+		return ShortLivedPage{}, ErrNotFound
+	}
+	m.order.MoveToFront(elem)
+	return elem.Value.(memoryEntry).page, nil
+}
+
+func (m *MemoryStore) Remove(_ context.Context, pageHash string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if elem, ok := m.pages[pageHash]; ok {
+		m.remove(elem)
+	}
+	return nil
+}
+
+func (m *MemoryStore) Take(_ context.Context, pageHash string) (ShortLivedPage, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	elem, ok := m.pages[pageHash]
+	if !ok {
+		return ShortLivedPage{}, ErrNotFound
+	}
+	page := elem.Value.(memoryEntry).page
+	m.remove(elem)
+	return page, nil
+}
+
+func (m *MemoryStore) RemoveExpired(_ context.Context, now time.Time) (int, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	removed := 0
+	for elem := m.order.Front(); elem != nil; {
+		next := elem.Next()
+		if elem.Value.(memoryEntry).page.Expired(now) {
+			m.remove(elem)
+			removed++
+		}
+		elem = next
+	}
+	return removed, nil
+}
+
+func (m *MemoryStore) Stats(context.Context) (Stats, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return Stats{Pages: int64(len(m.pages)), Bytes: m.bytes}, nil
+}
+
+// remove must be called with the lock held
+func (m *MemoryStore) remove(elem *list.Element) {
+	entry := m.order.Remove(elem).(memoryEntry)
+	delete(m.pages, entry.hash)
+	m.bytes -= entry.page.size()
+}
@@ -0,0 +1,83 @@
+package shortlivedpage
+
+import (
+	"context"
+	"errors"
+	"time"
+	"weezel/budget/db"
+	"weezel/budget/dbengine"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// PostgresStore keeps the pages in the database
+type PostgresStore struct {
+	db *dbengine.Store
+}
+
+func NewPostgresStore(dbStore *dbengine.Store) PostgresStore {
+	return PostgresStore{db: dbStore}
+}
+
+func (p PostgresStore) Add(ctx context.Context, pageHash string, page ShortLivedPage) (bool, error) {
+	var html []byte
+	if page.HTMLPage != nil {
+		html = *page.HTMLPage
+	}
+
+	_, err := p.db.AddShortLivedPage(ctx,
+		pageHash,
+		html,
+		page.StartTime,
+		page.TTLSeconds,
+		page.BurnAfterRead,
+		page.PINHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Nothing is returned on conflict
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (p PostgresStore) Get(ctx context.Context, pageHash string) (ShortLivedPage, error) {
+	return pageFromRow(p.db.GetShortLivedPage(ctx, pageHash))
+}
+
+func (p PostgresStore) Take(ctx context.Context, pageHash string) (ShortLivedPage, error) {
+	return pageFromRow(p.db.TakeShortLivedPage(ctx, pageHash))
+}
+
+func pageFromRow(row *db.BudgetSchemaShortLivedPage, err error) (ShortLivedPage, error) {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ShortLivedPage{}, ErrNotFound
+	} else if err != nil {
+		return ShortLivedPage{}, err
+	}
+
+	return ShortLivedPage{
+		StartTime:     row.StartTime,
+		TTLSeconds:    row.TtlSeconds,
+		BurnAfterRead: row.BurnAfterRead,
+		PINHash:       row.PinHash,
+		HTMLPage:      &row.Html,
+	}, nil
+}
+
+func (p PostgresStore) Remove(ctx context.Context, pageHash string) error {
+	return p.db.DeleteShortLivedPage(ctx, pageHash)
+}
+
+func (p PostgresStore) RemoveExpired(ctx context.Context, now time.Time) (int, error) {
+	removed, err := p.db.DeleteExpiredShortLivedPages(ctx, now)
+	return int(removed), err
+}
+
+func (p PostgresStore) Stats(ctx context.Context) (Stats, error) {
+	row, err := p.db.GetShortLivedPageStats(ctx)
+	if err != nil {
+		return Stats{}, err
+	}
+	return Stats{Pages: row.Pages, Bytes: row.Bytes}, nil
+}
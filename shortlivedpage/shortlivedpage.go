@@ -1,93 +1,313 @@
 package shortlivedpage
 
 import (
-	"log"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"weezel/budget/confighandler"
+	"weezel/budget/dbengine"
 	"weezel/budget/logger"
+	"weezel/budget/metrics"
+)
 
-	"github.com/prprprus/scheduler"
+const (
+	// defaultJanitorInterval is how often expired pages are removed
+	defaultJanitorInterval = time.Minute
+	// DefaultMaxBytes limits the memory store when nothing is configured
+	DefaultMaxBytes int64 = 64 << 20
+	// DefaultDirectory is used by the filesystem store, relative to the working directory
+	DefaultDirectory = "pages"
 )
 
 var (
-	lock            sync.RWMutex
-	shortLivedPages map[string]ShortLivedPage
+	// ErrNotFound is returned for unknown and expired pages
+	ErrNotFound = errors.New("no such page")
+	// ErrTooLarge is returned when a page doesn't fit in the store at all
+	ErrTooLarge = errors.New("page too large")
+)
+
+var (
+	lock  sync.RWMutex
+	store Store = NewMemoryStore(DefaultMaxBytes)
+
+	// lastJanitorRun is Unix nanoseconds, zero when the janitor isn't running
+	lastJanitorRun  atomic.Int64
+	janitorInterval atomic.Int64
+	// lastStats is read by the janitor, so that the scrapes of the metrics
+	// don't query the store. Nil until the janitor has started.
+	lastStats atomic.Pointer[Stats]
 )
 
 type ShortLivedPage struct {
 	StartTime  time.Time
 	HTMLPage   *[]byte
 	TTLSeconds int64
+	// BurnAfterRead pages are removed when they're opened the first time
+	BurnAfterRead bool
+	// PINHash is set with SetPIN, pages without it are served without asking
+	PINHash string
 }
 
-func cleaner() {
-	removableHashes := []string{}
+// NewToken returns a random token identifying a page. Tokens are unguessable,
+// unlike the content hashes that were used before.
+func NewToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		// Never happens on supported platforms, see crypto/rand
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
 
-	logger.Debugf("Starting scheduled cleaning for short lived pages")
-	for pageHash, page := range shortLivedPages {
-		endTime := page.StartTime.Add(
-			time.Duration(
-				int64(time.Second) * page.TTLSeconds))
-		if time.Now().After(endTime) {
-			logger.Infof("Removing page due timeout: %v [%s]",
-				page,
-				endTime)
-			removableHashes = append(removableHashes, pageHash)
-		}
+// NewPIN returns a random six digit PIN
+func NewPIN() string {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		panic(err)
 	}
-	for _, pageHash := range removableHashes {
-		lock.Lock()
-		delete(shortLivedPages, pageHash)
-		lock.Unlock()
+	return fmt.Sprintf("%06d", n.Int64())
+}
+
+func hashPIN(salt []byte, pin string) []byte {
+	sum := sha256.Sum256(append(append([]byte{}, salt...), pin...))
+	return sum[:]
+}
+
+// SetPIN stores a salted hash of the PIN in the page
+func (p *ShortLivedPage) SetPIN(pin string) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		panic(err)
 	}
-	logger.Debugf("Stopping scheduled cleaning for short lived pages")
+	p.PINHash = hex.EncodeToString(salt) + "$" + hex.EncodeToString(hashPIN(salt, pin))
 }
 
-func InitScheduler() {
-	shortLivedPages = make(map[string]ShortLivedPage)
+func (p ShortLivedPage) HasPIN() bool {
+	return p.PINHash != ""
+}
 
-	cleanerSchedule, err := scheduler.NewScheduler(1000)
+// CheckPIN tells whether the PIN matches the one set with SetPIN
+func (p ShortLivedPage) CheckPIN(pin string) bool {
+	saltHex, sumHex, found := strings.Cut(p.PINHash, "$")
+	if !found {
+		return false
+	}
+	salt, err := hex.DecodeString(saltHex)
+	if err != nil {
+		return false
+	}
+	sum, err := hex.DecodeString(sumHex)
 	if err != nil {
-		log.Fatalf("Error while initializing scheduler: %s", err)
+		return false
+	}
+	return subtle.ConstantTimeCompare(sum, hashPIN(salt, pin)) == 1
+}
+
+// EndTime returns when the page stops being served
+func (p ShortLivedPage) EndTime() time.Time {
+	return p.StartTime.Add(time.Duration(p.TTLSeconds) * time.Second)
+}
+
+// Expired tells whether the page has outlived its TTL by now
+func (p ShortLivedPage) Expired(now time.Time) bool {
+	return now.After(p.EndTime())
+}
+
+func (p ShortLivedPage) size() int64 {
+	if p.HTMLPage == nil {
+		return 0
+	}
+	return int64(len(*p.HTMLPage))
+}
+
+// Stats describes the contents of a store
+type Stats struct {
+	Pages int64
+	Bytes int64
+}
+
+// Store keeps the pages until they're removed. Stores don't check expiry on
+// Get, that's done by the package level Get.
+type Store interface {
+	// Add returns false if the hash was already stored
+	Add(ctx context.Context, pageHash string, page ShortLivedPage) (bool, error)
+	// Get returns ErrNotFound if there's no such page
+	Get(ctx context.Context, pageHash string) (ShortLivedPage, error)
+	Remove(ctx context.Context, pageHash string) error
+	// Take removes the page and returns it. Only one of concurrent callers gets
+	// the page, others get ErrNotFound.
+	Take(ctx context.Context, pageHash string) (ShortLivedPage, error)
+	// RemoveExpired removes the pages expired by now and returns how many were removed
+	RemoveExpired(ctx context.Context, now time.Time) (int, error)
+	Stats(ctx context.Context) (Stats, error)
+}
+
+// NewStore returns the store selected in the configuration. Memory store is
+// used by default, dbStore is needed only by the database backend.
+func NewStore(conf confighandler.ShortLivedPages, dbStore *dbengine.Store) (Store, error) {
+	switch conf.Backend {
+	case "", "memory":
+		maxBytes := conf.MaxBytes
+		if maxBytes <= 0 {
+			maxBytes = DefaultMaxBytes
+		}
+		return NewMemoryStore(maxBytes), nil
+	case "filesystem":
+		dir := conf.Directory
+		if dir == "" {
+			dir = DefaultDirectory
+		}
+		return NewFileStore(dir)
+	case "database", "postgres":
+		return NewPostgresStore(dbStore), nil
+	}
+	return nil, fmt.Errorf("unknown short-lived page backend %q", conf.Backend)
+}
+
+// cachedStats returns the stats of the last janitor run, zeros before it
+func cachedStats() Stats {
+	if stats := lastStats.Load(); stats != nil {
+		return *stats
 	}
-	logger.Infof("Cleaner scheduler started")
-	cleanerSchedule.Every().Second(0).Do(cleaner)
+	return Stats{}
 }
 
-// Get returns ShortLivedPage regarding the given pageHash.
-func Get(pageHash string) ShortLivedPage {
+func init() {
+	metrics.NewGaugeFunc("budget_shortlived_pages",
+		"Short-lived pages stored.",
+		func() float64 { return float64(cachedStats().Pages) })
+	metrics.NewGaugeFunc("budget_shortlived_page_bytes",
+		"Total size of the stored short-lived pages.",
+		func() float64 { return float64(cachedStats().Bytes) })
+}
+
+func currentStore() Store {
 	lock.RLock()
 	defer lock.RUnlock()
+	return store
+}
+
+// Init sets the store used by the package and removes expired pages from it
+// until ctx is done
+func Init(ctx context.Context, s Store) {
+	lock.Lock()
+	store = s
+	lock.Unlock()
+
+	logger.Infof("Short-lived page cleaner started")
+	go RunJanitor(ctx, s, defaultJanitorInterval)
+}
 
-	if _, ok := shortLivedPages[pageHash]; ok {
-		return shortLivedPages[pageHash]
+// RunJanitor removes expired pages from the store every interval. Returns
+// when ctx is done.
+func RunJanitor(ctx context.Context, s Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	janitorInterval.Store(int64(interval))
+	lastJanitorRun.Store(time.Now().UnixNano())
+	defer lastJanitorRun.Store(0)
+	updateStats(ctx, s)
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Infof("Short-lived page cleaner stopped")
+			return
+		case now := <-ticker.C:
+			clean(ctx, s, now)
+			lastJanitorRun.Store(time.Now().UnixNano())
+		}
 	}
+}
 
-	return ShortLivedPage{}
+func clean(ctx context.Context, s Store, now time.Time) {
+	removed, err := s.RemoveExpired(ctx, now)
+	switch {
+	case err != nil:
+		logger.Errorf("Couldn't remove expired short-lived pages: %s", err)
+	case removed > 0:
+		logger.Infof("Removed %d expired short-lived pages", removed)
+	}
+	updateStats(ctx, s)
 }
 
-// Add returns false if the key was already in the map and true otherwise.
-func Add(pageHash string, page ShortLivedPage) bool {
-	lock.Lock()
-	defer lock.Unlock()
+// updateStats reads the stats for the metrics, the previous ones are kept
+// when the store fails
+func updateStats(ctx context.Context, s Store) {
+	stats, err := s.Stats(ctx)
+	if err != nil {
+		logger.Errorf("Couldn't get short-lived page stats: %s", err)
+		return
+	}
+	lastStats.Store(&stats)
+	logger.Debugf("Short-lived pages: %d pages, %d bytes", stats.Pages, stats.Bytes)
+}
 
-	if _, ok := shortLivedPages[pageHash]; !ok {
-		shortLivedPages[pageHash] = page
-		return true
+// Get returns ShortLivedPage regarding the given pageHash. ErrNotFound is
+// returned if there's no such page or it has expired.
+func Get(ctx context.Context, pageHash string) (ShortLivedPage, error) {
+	page, err := currentStore().Get(ctx, pageHash)
+	if err != nil {
+		return ShortLivedPage{}, err
+	}
+	if page.Expired(time.Now()) {
+		return ShortLivedPage{}, ErrNotFound
 	}
-	return false
+	return page, nil
 }
 
-// Remove deletes the key from the map and returns removed ShortLivedPage, nil if
-// nothing is found.
-func Remove(pageHash string) *ShortLivedPage {
-	lock.Lock()
-	defer lock.Unlock()
+// Add returns false if the key was already stored and true otherwise.
+func Add(ctx context.Context, pageHash string, page ShortLivedPage) (bool, error) {
+	return currentStore().Add(ctx, pageHash, page)
+}
 
-	if _, ok := shortLivedPages[pageHash]; ok {
-		deletable := shortLivedPages[pageHash]
-		delete(shortLivedPages, pageHash)
-		return &deletable
+// Take removes the page and returns it, see Store.Take. ErrNotFound is returned
+// if there's no such page or it has expired.
+func Take(ctx context.Context, pageHash string) (ShortLivedPage, error) {
+	page, err := currentStore().Take(ctx, pageHash)
+	if err != nil {
+		return ShortLivedPage{}, err
+	}
+	if page.Expired(time.Now()) {
+		return ShortLivedPage{}, ErrNotFound
+	}
+	return page, nil
+}
+
+// Remove deletes the page. Removing a missing page is not an error.
+func Remove(ctx context.Context, pageHash string) error {
+	return currentStore().Remove(ctx, pageHash)
+}
+
+// CurrentStats returns the number and total size of stored pages
+func CurrentStats(ctx context.Context) (Stats, error) {
+	return currentStore().Stats(ctx)
+}
+
+// CheckJanitor fails if the janitor has stopped or missed its runs
+func CheckJanitor(context.Context) (string, error) {
+	return checkJanitor(lastJanitorRun.Load(), time.Duration(janitorInterval.Load()), time.Now())
+}
+
+func checkJanitor(lastRun int64, interval time.Duration, now time.Time) (string, error) {
+	if lastRun == 0 {
+		return "", errors.New("janitor is not running")
+	}
+	since := now.Sub(time.Unix(0, lastRun))
+	detail := fmt.Sprintf("last run %s ago", since.Round(time.Second))
+	if since > 3*interval {
+		return detail, errors.New("janitor has stopped")
 	}
-	return nil
+	return detail, nil
 }
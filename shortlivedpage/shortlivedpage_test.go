@@ -0,0 +1,352 @@
+package shortlivedpage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"weezel/budget/confighandler"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func page(start time.Time, ttlSeconds int64, html string) ShortLivedPage {
+	b := []byte(html)
+	return ShortLivedPage{StartTime: start, TTLSeconds: ttlSeconds, HTMLPage: &b}
+}
+
+func newFileStore(t *testing.T) Store {
+	t.Helper()
+	s, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// testStore runs the behaviour common to all stores
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	ok, err := s.Add(ctx, "abc", page(start, 600, "<p>abc</p>"))
+	if err != nil || !ok {
+		t.Fatalf("Add() = %v, %v", ok, err)
+	}
+	ok, err = s.Add(ctx, "abc", page(start, 600, "<p>other</p>"))
+	if err != nil || ok {
+		t.Fatalf("second Add() = %v, %v", ok, err)
+	}
+	if _, err := s.Add(ctx, "def", page(start, 60, "<p>def</p>")); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Get(ctx, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("<p>abc</p>", string(*got.HTMLPage)); diff != "" {
+		t.Errorf("page differs:\n%s", diff)
+	}
+	if !got.StartTime.Equal(start) || got.TTLSeconds != 600 {
+		t.Errorf("got start %s and TTL %d", got.StartTime, got.TTLSeconds)
+	}
+	if _, err := s.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v for missing page", err)
+	}
+
+	stats, err := s.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(Stats{Pages: 2, Bytes: 20}, stats); diff != "" {
+		t.Errorf("stats differ:\n%s", diff)
+	}
+
+	removed, err := s.RemoveExpired(ctx, start.Add(2*time.Minute))
+	if err != nil || removed != 1 {
+		t.Fatalf("RemoveExpired() = %d, %v", removed, err)
+	}
+	if _, err := s.Get(ctx, "def"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expired page was not removed: %v", err)
+	}
+
+	burn := page(start, 600, "<p>ghi</p>")
+	burn.BurnAfterRead = true
+	burn.SetPIN("1234")
+	if _, err := s.Add(ctx, "ghi", burn); err != nil {
+		t.Fatal(err)
+	}
+	taken, err := s.Take(ctx, "ghi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !taken.BurnAfterRead || !taken.CheckPIN("1234") {
+		t.Errorf("access settings were lost: %+v", taken)
+	}
+	if _, err := s.Take(ctx, "ghi"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("page was taken twice: %v", err)
+	}
+
+	if err := s.Remove(ctx, "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Remove(ctx, "abc"); err != nil {
+		t.Errorf("removing missing page failed: %v", err)
+	}
+	stats, err = s.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(Stats{}, stats); diff != "" {
+		t.Errorf("stats differ after removal:\n%s", diff)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore(DefaultMaxBytes))
+}
+
+func TestFileStore(t *testing.T) {
+	testStore(t, newFileStore(t))
+}
+
+func TestFileStorePersists(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(ctx, "abc", page(time.Now(), 600, "<p>abc</p>")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Imitates a restart
+	s, err = NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Get(ctx, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(*got.HTMLPage) != "<p>abc</p>" {
+		t.Errorf("got %q", *got.HTMLPage)
+	}
+}
+
+func TestFileStoreRemoveExpiredSkipsBadPages(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, hash := range []string{"aaa", "bbb", "ccc"} {
+		if _, err = s.Add(ctx, hash, page(start, 60, "<p>"+hash+"</p>")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The broken page is swept first
+	if err = os.WriteFile(filepath.Join(dir, "aaa"+metaSuffix), []byte("{broken"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := s.RemoveExpired(ctx, start.Add(2*time.Minute))
+	if err != nil || removed != 3 {
+		t.Fatalf("RemoveExpired() = %d, %v", removed, err)
+	}
+	stats, err := s.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Pages != 0 {
+		t.Errorf("%d pages left", stats.Pages)
+	}
+}
+
+func TestFileStoreRejectsPaths(t *testing.T) {
+	ctx := context.Background()
+	s := newFileStore(t)
+
+	if _, err := s.Add(ctx, "../escape", page(time.Now(), 600, "x")); err == nil {
+		t.Error("expected an error for a hash with a path")
+	}
+	if _, err := s.Get(ctx, "../escape"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestMemoryStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(10)
+	now := time.Now()
+
+	for _, hash := range []string{"a", "b"} {
+		if _, err := s.Add(ctx, hash, page(now, 600, "1234")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Makes b the least recently used
+	if _, err := s.Get(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(ctx, "c", page(now, 600, "1234")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Get(ctx, "b"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("b should have been evicted, got %v", err)
+	}
+	for _, hash := range []string{"a", "c"} {
+		if _, err := s.Get(ctx, hash); err != nil {
+			t.Errorf("%s: %v", hash, err)
+		}
+	}
+	stats, _ := s.Stats(ctx)
+	if diff := cmp.Diff(Stats{Pages: 2, Bytes: 8}, stats); diff != "" {
+		t.Errorf("stats differ:\n%s", diff)
+	}
+
+	if _, err := s.Add(ctx, "huge", page(now, 600, "12345678901")); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("got %v for a too large page", err)
+	}
+}
+
+func TestGetSkipsExpired(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	Init(ctx, NewMemoryStore(DefaultMaxBytes))
+
+	if _, err := Add(ctx, "old", page(time.Now().Add(-time.Hour), 60, "x")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Get(ctx, "old"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v for an expired page", err)
+	}
+}
+
+func TestRunJanitor(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := NewMemoryStore(DefaultMaxBytes)
+	if _, err := s.Add(ctx, "old", page(time.Now().Add(-time.Hour), 60, "x")); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		RunJanitor(ctx, s, time.Millisecond)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats, _ := s.Stats(ctx)
+		if stats.Pages == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("janitor didn't remove the expired page")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("janitor didn't stop")
+	}
+}
+
+func TestStatsReadByJanitor(t *testing.T) {
+	lastStats.Store(nil)
+	if got := cachedStats(); got != (Stats{}) {
+		t.Errorf("got %+v before the janitor has run", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := NewMemoryStore(DefaultMaxBytes)
+	if _, err := s.Add(ctx, "new", page(time.Now(), 60, "abc")); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		RunJanitor(ctx, s, time.Hour)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for cachedStats() != (Stats{Pages: 1, Bytes: 3}) {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %+v from the janitor", cachedStats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestNewStore(t *testing.T) {
+	if _, err := NewStore(confighandler.ShortLivedPages{Backend: "floppy"}, nil); err == nil {
+		t.Error("expected an error for unknown backend")
+	}
+	s, err := NewStore(confighandler.ShortLivedPages{Backend: "filesystem", Directory: t.TempDir()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.(*FileStore); !ok {
+		t.Errorf("got %T", s)
+	}
+}
+
+func TestPIN(t *testing.T) {
+	p := ShortLivedPage{}
+	if p.HasPIN() || p.CheckPIN("") {
+		t.Fatal("page without PIN accepted a PIN")
+	}
+
+	pin := NewPIN()
+	if len(pin) != 6 {
+		t.Errorf("got PIN %q", pin)
+	}
+	p.SetPIN(pin)
+	if !p.HasPIN() || !p.CheckPIN(pin) {
+		t.Error("correct PIN was rejected")
+	}
+	if p.CheckPIN(pin + "0") {
+		t.Error("wrong PIN was accepted")
+	}
+	if strings.Contains(p.PINHash, pin) {
+		t.Error("PIN is stored in plain text")
+	}
+}
+
+func TestNewToken(t *testing.T) {
+	a, b := NewToken(), NewToken()
+	if a == b || !validHash.MatchString(a) {
+		t.Errorf("got tokens %q and %q", a, b)
+	}
+}
+
+func TestCheckJanitor(t *testing.T) {
+	now := time.Now()
+
+	if _, err := checkJanitor(0, time.Minute, now); err == nil {
+		t.Error("expected an error when janitor isn't running")
+	}
+	if _, err := checkJanitor(now.Add(-time.Minute).UnixNano(), time.Minute, now); err != nil {
+		t.Errorf("got %v for a recent run", err)
+	}
+	if _, err := checkJanitor(now.Add(-time.Hour).UnixNano(), time.Minute, now); err == nil {
+		t.Error("expected an error for a missed run")
+	}
+}
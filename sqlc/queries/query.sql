@@ -3,72 +3,356 @@
 --
 
 -- name: AddExpense :one
+-- Nothing is returned when the idempotency key has already been used
 INSERT INTO budget_schema.expense(
 	username,
 	shop_name,
 	category,
 	price,
-	expense_date
-) VALUES ($1, $2, $3, $4, $5) RETURNING id;
+	expense_date,
+	idempotency_key,
+	sharing,
+	owed_by
+) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	ON CONFLICT (idempotency_key) DO NOTHING
+	RETURNING id;
 
+-- name: AddExpenses :copyfrom
+INSERT INTO budget_schema.expense(
+	username,
+	shop_name,
+	category,
+	price,
+	expense_date,
+	idempotency_key,
+	sharing,
+	owed_by
+) VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
 
 -- name: DeleteExpenseByID :one
-DELETE FROM budget_schema.expense
-	WHERE id = $1 AND username = $2
+-- Expenses are only marked deleted, RestoreExpenseByID brings them back
+UPDATE budget_schema.expense
+	SET deleted_at = now()
+	WHERE id = $1 AND username = $2 AND deleted_at IS NULL
 	RETURNING *;
 
+-- name: GetExpenseByID :one
+SELECT * FROM budget_schema.expense
+	WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: GetRecentDuplicateExpense :one
+-- Returns the latest same purchase of the user stored after created_after
+SELECT * FROM budget_schema.expense
+	WHERE username = sqlc.arg('username')
+		AND lower(shop_name) = lower(sqlc.arg('shop_name'))
+		AND price = sqlc.arg('price')
+		AND expense_date = sqlc.arg('expense_date')
+		AND created_at >= sqlc.arg('created_after')::timestamptz
+		AND deleted_at IS NULL
+	ORDER BY created_at DESC
+	LIMIT 1;
+
+-- name: RestoreExpenseByID :one
+UPDATE budget_schema.expense
+	SET deleted_at = NULL
+	WHERE id = $1 AND username = $2 AND deleted_at IS NOT NULL
+	RETURNING *;
+
+-- name: UpdateExpenseByID :one
+UPDATE budget_schema.expense
+	SET shop_name = $3, category = $4, price = $5, expense_date = $6
+	WHERE id = $1 AND username = $2 AND deleted_at IS NULL
+	RETURNING *;
+
+-- name: ListExpenses :many
+SELECT * FROM budget_schema.expense
+	WHERE deleted_at IS NULL
+		AND (sqlc.narg('username')::text IS NULL OR username = sqlc.narg('username'))
+		AND (sqlc.narg('category')::text IS NULL OR category = sqlc.narg('category'))
+		AND (sqlc.narg('start_date')::date IS NULL OR expense_date >= sqlc.narg('start_date'))
+		AND (sqlc.narg('end_date')::date IS NULL OR expense_date <= sqlc.narg('end_date'))
+	ORDER BY
+		CASE WHEN sqlc.arg('sort_by')::text = 'shop' THEN shop_name END,
+		CASE WHEN sqlc.arg('sort_by')::text = '-shop' THEN shop_name END DESC,
+		CASE WHEN sqlc.arg('sort_by')::text = 'category' THEN category END,
+		CASE WHEN sqlc.arg('sort_by')::text = '-category' THEN category END DESC,
+		CASE WHEN sqlc.arg('sort_by')::text = 'username' THEN username END,
+		CASE WHEN sqlc.arg('sort_by')::text = '-username' THEN username END DESC,
+		CASE WHEN sqlc.arg('sort_by')::text = 'price' THEN price END,
+		CASE WHEN sqlc.arg('sort_by')::text = '-price' THEN price END DESC,
+		CASE WHEN sqlc.arg('sort_by')::text = 'date' THEN expense_date END,
+		expense_date DESC, id DESC
+	LIMIT sqlc.arg('row_limit') OFFSET sqlc.arg('row_offset');
+
 -- name: GetExpensesByTimespan :many
-SELECT id, username, expense_date, shop_name, price FROM budget_schema.expense
-	WHERE expense_date BETWEEN sqlc.arg('start_time')::date
+SELECT id, username, expense_date, shop_name, category, price FROM budget_schema.expense
+	WHERE deleted_at IS NULL AND expense_date BETWEEN sqlc.arg('start_time')::date
 		AND sqlc.arg('end_time')::date + interval '1 month - 1 day'
 	ORDER BY username, expense_date, shop_name, price;
 
 -- name: GetAggrExpensesByTimespan :many
 SELECT username, date_trunc('month', expense_date)::date AS months, SUM(price)::float AS expenses_sum
 	FROM budget_schema.expense
-	WHERE expense_date BETWEEN sqlc.arg('start_time')::date
+	WHERE deleted_at IS NULL AND expense_date BETWEEN sqlc.arg('start_time')::date
 		AND sqlc.arg('end_time')::date + interval '1 month - 1 day'
 	GROUP BY username, months, shop_name
 	ORDER BY months, username;
 
+-- name: GetCategoryExpensesByTimespan :many
+SELECT category, date_trunc('month', expense_date)::date AS months, SUM(price)::float AS expenses_sum
+	FROM budget_schema.expense
+	WHERE deleted_at IS NULL AND expense_date BETWEEN sqlc.arg('start_time')::date
+		AND sqlc.arg('end_time')::date + interval '1 month - 1 day'
+	GROUP BY category, months
+	ORDER BY months, expenses_sum DESC, category;
+
+-- name: GetCategorySharesByTimespan :many
+SELECT category, SUM(price)::float AS expenses_sum,
+		COALESCE(SUM(price) / NULLIF(SUM(SUM(price)) OVER (), 0), 0)::float AS share
+	FROM budget_schema.expense
+	WHERE deleted_at IS NULL AND expense_date BETWEEN sqlc.arg('start_time')::date
+		AND sqlc.arg('end_time')::date + interval '1 month - 1 day'
+	GROUP BY category
+	ORDER BY expenses_sum DESC, category;
+
+-- name: GetDailyExpensesByTimespan :many
+SELECT expense_date, category, SUM(price)::float AS expenses_sum
+	FROM budget_schema.expense
+	WHERE deleted_at IS NULL
+		AND expense_date BETWEEN sqlc.arg('start_date')::date AND sqlc.arg('end_date')::date
+	GROUP BY expense_date, category
+	ORDER BY expense_date, category;
+
+-- name: GetShopPriceHistory :many
+SELECT price FROM budget_schema.expense
+	WHERE deleted_at IS NULL AND lower(shop_name) = lower(sqlc.arg('shop_name'))
+	ORDER BY expense_date DESC, id DESC
+	LIMIT sqlc.arg('history_limit');
+
+-- name: GetCategoryPriceHistory :many
+SELECT price FROM budget_schema.expense
+	WHERE deleted_at IS NULL AND category = sqlc.arg('category')
+	ORDER BY expense_date DESC, id DESC
+	LIMIT sqlc.arg('history_limit');
+
+-- name: GetTopShopsByTimespan :many
+SELECT shop_name, COUNT(*) AS purchases, SUM(price)::float AS expenses_sum
+	FROM budget_schema.expense
+	WHERE deleted_at IS NULL AND expense_date BETWEEN sqlc.arg('start_time')::date
+		AND sqlc.arg('end_time')::date + interval '1 month - 1 day'
+	GROUP BY shop_name
+	ORDER BY expenses_sum DESC, shop_name
+	LIMIT sqlc.arg('shop_limit');
+
 --
 -- Salaries
 --
 
 -- name: AddSalary :one
-INSERT INTO budget_schema.salary(username, salary, store_date)
-	VALUES($1, $2, $3) RETURNING id;
+-- Nothing is returned when the idempotency key has already been used
+INSERT INTO budget_schema.salary(username, salary, store_date, idempotency_key)
+	VALUES($1, $2, $3, $4)
+	ON CONFLICT (idempotency_key) DO NOTHING
+	RETURNING id;
 
 -- name: DeleteSalaryByID :one
-DELETE FROM budget_schema.salary
-	WHERE id = $1 AND username = $2
+-- Salaries are only marked deleted, RestoreSalaryByID brings them back
+UPDATE budget_schema.salary
+	SET deleted_at = now()
+	WHERE id = $1 AND username = $2 AND deleted_at IS NULL
+	RETURNING *;
+
+-- name: GetSalaryByID :one
+SELECT * FROM budget_schema.salary
+	WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: RestoreSalaryByID :one
+UPDATE budget_schema.salary
+	SET deleted_at = NULL
+	WHERE id = $1 AND username = $2 AND deleted_at IS NOT NULL
+	RETURNING *;
+
+-- name: UpdateSalaryByID :one
+UPDATE budget_schema.salary
+	SET salary = $3, store_date = $4
+	WHERE id = $1 AND username = $2 AND deleted_at IS NULL
 	RETURNING *;
 
+-- name: ListSalaries :many
+SELECT * FROM budget_schema.salary
+	WHERE deleted_at IS NULL
+		AND (sqlc.narg('username')::text IS NULL OR username = sqlc.narg('username'))
+		AND (sqlc.narg('start_date')::date IS NULL OR store_date >= sqlc.narg('start_date'))
+		AND (sqlc.narg('end_date')::date IS NULL OR store_date <= sqlc.narg('end_date'))
+	ORDER BY store_date DESC, id DESC
+	LIMIT sqlc.arg('row_limit') OFFSET sqlc.arg('row_offset');
+
 -- name: GetUserSalaryByMonth :one
 SELECT salary FROM budget_schema.salary
-	WHERE username = $1
+	WHERE username = $1 AND deleted_at IS NULL
 	AND store_date = date_trunc('month', sqlc.arg('month')::date);
 
 -- name: GetSalariesByTimespan :many
 SELECT username, salary, date_trunc('month', store_date)::date AS months FROM budget_schema.salary
-	WHERE store_date BETWEEN date_trunc('month', sqlc.arg('start_time')::date)::date
+	WHERE deleted_at IS NULL AND store_date BETWEEN date_trunc('month', sqlc.arg('start_time')::date)::date
 		AND date_trunc('month', sqlc.arg('end_time')::date)::date + interval '1 month - 1 day'
 	GROUP BY username, months, salary
 	ORDER BY username, months;
 
+-- name: ListSalaryUsernames :many
+-- The users of the household are the ones who have stored a salary
+SELECT DISTINCT username FROM budget_schema.salary
+	WHERE deleted_at IS NULL
+	ORDER BY username;
+
+--
+-- Report links
+--
+
+-- name: IsLinkRevoked :one
+SELECT EXISTS(
+	SELECT 1 FROM budget_schema.revoked_link WHERE link_id = $1
+) AS revoked;
+
+-- name: RevokeLink :exec
+INSERT INTO budget_schema.revoked_link (
+	link_id,
+	revoked_by
+) VALUES (
+	$1,
+	$2
+) ON CONFLICT (link_id) DO NOTHING;
+
+--
+-- Short-lived pages
+--
+
+-- name: AddShortLivedPage :one
+INSERT INTO budget_schema.short_lived_page (
+	hash,
+	html,
+	start_time,
+	ttl_seconds,
+	burn_after_read,
+	pin_hash
+) VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6
+) ON CONFLICT (hash) DO NOTHING
+RETURNING hash;
+
+-- name: GetShortLivedPage :one
+SELECT * FROM budget_schema.short_lived_page WHERE hash = $1;
+
+-- name: DeleteShortLivedPage :exec
+DELETE FROM budget_schema.short_lived_page WHERE hash = $1;
+
+-- name: TakeShortLivedPage :one
+DELETE FROM budget_schema.short_lived_page WHERE hash = $1
+RETURNING *;
+
+-- name: DeleteExpiredShortLivedPages :execrows
+DELETE FROM budget_schema.short_lived_page
+	WHERE start_time + ttl_seconds * interval '1 second' < sqlc.arg('now');
+
+-- name: GetShortLivedPageStats :one
+SELECT COUNT(*) AS pages, COALESCE(SUM(octet_length(html)), 0)::bigint AS bytes
+	FROM budget_schema.short_lived_page;
+
+--
+-- Audit log
+--
+
+-- name: AddAuditLog :exec
+INSERT INTO budget_schema.audit_log (
+	actor,
+	source,
+	action,
+	table_name,
+	row_id,
+	before_row,
+	after_row
+) VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6,
+	$7
+);
+
+-- name: ListAuditLog :many
+SELECT * FROM budget_schema.audit_log
+	ORDER BY id DESC
+	LIMIT sqlc.arg('row_limit') OFFSET sqlc.arg('row_offset');
+
+--
+-- Attachments
+--
+
+-- name: AddAttachment :exec
+-- Attaching the same file again does nothing
+INSERT INTO budget_schema.attachment (
+	expense_id,
+	hash,
+	content_type,
+	size_bytes
+) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (expense_id, hash) DO NOTHING;
+
+-- name: GetAttachmentByHash :one
+-- Receipts of the deleted expenses aren't shown
+SELECT a.id, a.expense_id, a.hash, a.content_type, a.size_bytes, a.created_at
+	FROM budget_schema.attachment AS a
+	JOIN budget_schema.expense AS e ON e.id = a.expense_id
+	WHERE a.hash = $1 AND e.deleted_at IS NULL
+	ORDER BY a.id
+	LIMIT 1;
+
+-- name: ListAttachmentsByTimespan :many
+SELECT a.id, a.expense_id, a.hash, a.content_type, a.size_bytes
+	FROM budget_schema.attachment AS a
+	JOIN budget_schema.expense AS e ON e.id = a.expense_id
+	WHERE e.deleted_at IS NULL
+		AND e.expense_date BETWEEN sqlc.arg('start_date')::date AND sqlc.arg('end_date')::date
+	ORDER BY a.expense_id, a.id;
+
+-- name: AddBlob :exec
+INSERT INTO budget_schema.blob (
+	hash,
+	object_id,
+	size_bytes
+) VALUES ($1, $2, $3);
+
+-- name: GetBlob :one
+SELECT * FROM budget_schema.blob
+	WHERE hash = $1;
+
 --
 -- Miscellaneous
 --
 
 -- name: StatisticsAggrByTimespan :many
-SELECT b.username, date_trunc('month', b.expense_date)::date AS event_date, SUM(price)::float AS expenses_sum, s.salary, 0.0::float AS owes
+-- expenses_sum has only the shared expenses, the personal ones and the ones
+-- paid for the others are summed separately
+SELECT b.username, date_trunc('month', b.expense_date)::date AS event_date,
+	COALESCE(SUM(price) FILTER (WHERE b.sharing = 'shared'), 0)::float AS expenses_sum,
+	COALESCE(SUM(price) FILTER (WHERE b.sharing = 'personal'), 0)::float AS personal_sum,
+	COALESCE(SUM(price) FILTER (WHERE b.sharing = 'owed'), 0)::float AS paid_for_others_sum,
+	s.salary, 0.0::float AS owes
 		FROM budget_schema.expense AS b
         JOIN budget_schema.salary AS s ON b.username = s.username
 		AND date_trunc('month', s.store_date) = date_trunc('month', b.expense_date)
-	WHERE b.expense_date BETWEEN date_trunc('month', sqlc.arg('start_time')::date)::date
+		AND s.deleted_at IS NULL
+	WHERE b.deleted_at IS NULL AND (b.expense_date BETWEEN date_trunc('month', sqlc.arg('start_time')::date)::date
 		AND date_trunc('month', sqlc.arg('end_time')::date)::date + interval '1 month - 1 day'
 		OR s.store_date BETWEEN date_trunc('month', sqlc.arg('start_time')::date)::date
-		AND date_trunc('month', sqlc.arg('end_time')::date)::date + interval '1 month - 1 day'
+		AND date_trunc('month', sqlc.arg('end_time')::date)::date + interval '1 month - 1 day')
 	GROUP BY b.username, date_trunc('month', b.expense_date), s.salary
 	ORDER BY b.username, date_trunc('month', b.expense_date), expenses_sum;
 
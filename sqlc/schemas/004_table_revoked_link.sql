@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS budget_schema.revoked_link(
+	link_id TEXT PRIMARY KEY NOT NULL,
+	revoked_by TEXT NOT NULL,
+	revoked_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS budget_schema.revoked_link CASCADE;
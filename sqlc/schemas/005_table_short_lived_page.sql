@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS budget_schema.short_lived_page(
+	hash TEXT PRIMARY KEY NOT NULL,
+	html BYTEA NOT NULL,
+	start_time TIMESTAMPTZ NOT NULL,
+	ttl_seconds BIGINT NOT NULL
+);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS budget_schema.short_lived_page CASCADE;
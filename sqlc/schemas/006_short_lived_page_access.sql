@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE budget_schema.short_lived_page
+	ADD COLUMN IF NOT EXISTS burn_after_read BOOLEAN NOT NULL DEFAULT false,
+	ADD COLUMN IF NOT EXISTS pin_hash TEXT NOT NULL DEFAULT '';
+
+
+-- +goose Down
+ALTER TABLE budget_schema.short_lived_page
+	DROP COLUMN IF EXISTS burn_after_read,
+	DROP COLUMN IF EXISTS pin_hash;
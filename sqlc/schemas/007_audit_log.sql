@@ -0,0 +1,28 @@
+-- +goose Up
+ALTER TABLE budget_schema.expense
+	ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+ALTER TABLE budget_schema.salary
+	ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS budget_schema.audit_log(
+	id INT GENERATED ALWAYS AS IDENTITY PRIMARY KEY NOT NULL,
+	changed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	actor TEXT NOT NULL,
+	source TEXT NOT NULL,
+	action TEXT NOT NULL,
+	table_name TEXT NOT NULL,
+	row_id INT NOT NULL,
+	before_row JSONB NOT NULL DEFAULT 'null',
+	after_row JSONB NOT NULL DEFAULT 'null'
+);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS budget_schema.audit_log CASCADE;
+
+ALTER TABLE budget_schema.salary
+	DROP COLUMN IF EXISTS deleted_at;
+
+ALTER TABLE budget_schema.expense
+	DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,35 @@
+-- +goose Up
+-- Telegram re-delivers messages after reconnects, the key makes the replays no-ops
+ALTER TABLE budget_schema.expense
+	ADD COLUMN IF NOT EXISTS idempotency_key TEXT;
+
+-- Rows stored before the column existed are left without the time
+ALTER TABLE budget_schema.expense
+	ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ;
+
+ALTER TABLE budget_schema.expense
+	ALTER COLUMN created_at SET DEFAULT now();
+
+ALTER TABLE budget_schema.salary
+	ADD COLUMN IF NOT EXISTS idempotency_key TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS expense_idempotency_key_idx
+	ON budget_schema.expense(idempotency_key);
+
+CREATE UNIQUE INDEX IF NOT EXISTS salary_idempotency_key_idx
+	ON budget_schema.salary(idempotency_key);
+
+
+-- +goose Down
+DROP INDEX IF EXISTS budget_schema.salary_idempotency_key_idx;
+
+DROP INDEX IF EXISTS budget_schema.expense_idempotency_key_idx;
+
+ALTER TABLE budget_schema.salary
+	DROP COLUMN IF EXISTS idempotency_key;
+
+ALTER TABLE budget_schema.expense
+	DROP COLUMN IF EXISTS created_at;
+
+ALTER TABLE budget_schema.expense
+	DROP COLUMN IF EXISTS idempotency_key;
@@ -0,0 +1,29 @@
+-- +goose Up
+-- Files are kept in the blob store, the hash is the SHA-256 of the content
+CREATE TABLE IF NOT EXISTS budget_schema.attachment(
+	id INT GENERATED ALWAYS AS IDENTITY PRIMARY KEY NOT NULL,
+	expense_id INT NOT NULL REFERENCES budget_schema.expense(id),
+	hash TEXT NOT NULL,
+	content_type TEXT NOT NULL,
+	size_bytes BIGINT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	UNIQUE (expense_id, hash)
+);
+
+CREATE INDEX IF NOT EXISTS attachment_hash_idx ON budget_schema.attachment(hash);
+
+-- Large objects of the PostgreSQL blob store
+CREATE TABLE IF NOT EXISTS budget_schema.blob(
+	hash TEXT PRIMARY KEY NOT NULL,
+	object_id OID NOT NULL,
+	size_bytes BIGINT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+
+-- +goose Down
+SELECT lo_unlink(object_id) FROM budget_schema.blob;
+
+DROP TABLE IF EXISTS budget_schema.blob;
+
+DROP TABLE IF EXISTS budget_schema.attachment;
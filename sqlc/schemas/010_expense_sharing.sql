@@ -0,0 +1,26 @@
+-- +goose Up
+-- Shared expenses are split by the salaries, personal ones aren't split at
+-- all and owed ones are paid back wholly by owed_by
+ALTER TABLE budget_schema.expense
+	ADD COLUMN IF NOT EXISTS sharing TEXT NOT NULL DEFAULT 'shared'
+	CHECK (sharing IN ('shared', 'personal', 'owed'));
+
+ALTER TABLE budget_schema.expense
+	ADD COLUMN IF NOT EXISTS owed_by TEXT NOT NULL DEFAULT '';
+
+-- #oma used to be stored as the category, it marks personal purchases now
+UPDATE budget_schema.expense
+	SET sharing = 'personal', category = ''
+	WHERE category = 'oma';
+
+
+-- +goose Down
+UPDATE budget_schema.expense
+	SET category = 'oma'
+	WHERE sharing = 'personal' AND category = '';
+
+ALTER TABLE budget_schema.expense
+	DROP COLUMN IF EXISTS owed_by;
+
+ALTER TABLE budget_schema.expense
+	DROP COLUMN IF EXISTS sharing;
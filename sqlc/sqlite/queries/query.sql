@@ -0,0 +1,340 @@
+--
+-- Expenses
+--
+
+-- name: AddExpense :one
+-- Nothing is returned when the idempotency key has already been used
+INSERT INTO expense(
+	username,
+	shop_name,
+	category,
+	price,
+	expense_date,
+	idempotency_key,
+	sharing,
+	owed_by,
+	created_at
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT (idempotency_key) DO NOTHING
+	RETURNING id;
+
+
+-- name: DeleteExpenseByID :one
+-- Expenses are only marked deleted, RestoreExpenseByID brings them back
+UPDATE expense
+	SET deleted_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND username = ? AND deleted_at IS NULL
+	RETURNING *;
+
+-- name: GetExpenseByID :one
+SELECT * FROM expense
+	WHERE id = ? AND deleted_at IS NULL;
+
+-- name: GetRecentDuplicateExpense :one
+-- Returns the latest same purchase of the user stored after created_after
+SELECT * FROM expense
+	WHERE username = sqlc.arg('username')
+		AND lower(shop_name) = lower(sqlc.arg('shop_name'))
+		AND price = sqlc.arg('price')
+		AND expense_date = sqlc.arg('expense_date')
+		AND created_at >= sqlc.arg('created_after')
+		AND deleted_at IS NULL
+	ORDER BY created_at DESC
+	LIMIT 1;
+
+-- name: RestoreExpenseByID :one
+UPDATE expense
+	SET deleted_at = NULL
+	WHERE id = ? AND username = ? AND deleted_at IS NOT NULL
+	RETURNING *;
+
+-- name: UpdateExpenseByID :one
+UPDATE expense
+	SET shop_name = sqlc.arg('shop_name'), category = sqlc.arg('category'),
+		price = sqlc.arg('price'), expense_date = sqlc.arg('expense_date')
+	WHERE id = sqlc.arg('id') AND username = sqlc.arg('username') AND deleted_at IS NULL
+	RETURNING *;
+
+-- name: ListExpenses :many
+SELECT * FROM expense
+	WHERE deleted_at IS NULL
+		AND (sqlc.narg('username') IS NULL OR username = sqlc.narg('username'))
+		AND (sqlc.narg('category') IS NULL OR category = sqlc.narg('category'))
+		AND (sqlc.narg('start_date') IS NULL OR date(expense_date) >= date(sqlc.narg('start_date')))
+		AND (sqlc.narg('end_date') IS NULL OR date(expense_date) <= date(sqlc.narg('end_date')))
+	ORDER BY
+		CASE WHEN sqlc.arg('sort_by') = 'shop' THEN shop_name END,
+		CASE WHEN sqlc.arg('sort_by') = '-shop' THEN shop_name END DESC,
+		CASE WHEN sqlc.arg('sort_by') = 'category' THEN category END,
+		CASE WHEN sqlc.arg('sort_by') = '-category' THEN category END DESC,
+		CASE WHEN sqlc.arg('sort_by') = 'username' THEN username END,
+		CASE WHEN sqlc.arg('sort_by') = '-username' THEN username END DESC,
+		CASE WHEN sqlc.arg('sort_by') = 'price' THEN price END,
+		CASE WHEN sqlc.arg('sort_by') = '-price' THEN price END DESC,
+		CASE WHEN sqlc.arg('sort_by') = 'date' THEN expense_date END,
+		expense_date DESC, id DESC
+	LIMIT sqlc.arg('row_limit') OFFSET sqlc.arg('row_offset');
+
+-- name: GetExpensesByTimespan :many
+SELECT id, username, expense_date, shop_name, category, price FROM expense
+	WHERE deleted_at IS NULL AND date(expense_date) BETWEEN date(sqlc.arg('start_time'))
+		AND date(sqlc.arg('end_time'), '+1 month', '-1 day')
+	ORDER BY username, expense_date, shop_name, price;
+
+-- name: GetAggrExpensesByTimespan :many
+SELECT username, CAST(date(expense_date, 'start of month') AS TEXT) AS months,
+		CAST(SUM(price) AS REAL) AS expenses_sum
+	FROM expense
+	WHERE deleted_at IS NULL AND date(expense_date) BETWEEN date(sqlc.arg('start_time'))
+		AND date(sqlc.arg('end_time'), '+1 month', '-1 day')
+	GROUP BY username, months, shop_name
+	ORDER BY months, username;
+
+-- name: GetCategoryExpensesByTimespan :many
+SELECT category, CAST(date(expense_date, 'start of month') AS TEXT) AS months,
+		CAST(SUM(price) AS REAL) AS expenses_sum
+	FROM expense
+	WHERE deleted_at IS NULL AND date(expense_date) BETWEEN date(sqlc.arg('start_time'))
+		AND date(sqlc.arg('end_time'), '+1 month', '-1 day')
+	GROUP BY category, months
+	ORDER BY months, expenses_sum DESC, category;
+
+-- name: GetCategorySharesByTimespan :many
+SELECT category, CAST(SUM(price) AS REAL) AS expenses_sum,
+		CAST(COALESCE(SUM(price) / NULLIF(SUM(SUM(price)) OVER (), 0), 0) AS REAL) AS share
+	FROM expense
+	WHERE deleted_at IS NULL AND date(expense_date) BETWEEN date(sqlc.arg('start_time'))
+		AND date(sqlc.arg('end_time'), '+1 month', '-1 day')
+	GROUP BY category
+	ORDER BY expenses_sum DESC, category;
+
+-- name: GetDailyExpensesByTimespan :many
+SELECT CAST(date(expense_date) AS TEXT) AS expense_day, category, CAST(SUM(price) AS REAL) AS expenses_sum
+	FROM expense
+	WHERE deleted_at IS NULL
+		AND date(expense_date) BETWEEN date(sqlc.arg('start_date')) AND date(sqlc.arg('end_date'))
+	GROUP BY expense_day, category
+	ORDER BY expense_day, category;
+
+-- name: GetShopPriceHistory :many
+-- lower() of SQLite folds only ASCII letters, unlike the one of PostgreSQL
+SELECT price FROM expense
+	WHERE deleted_at IS NULL AND lower(shop_name) = lower(sqlc.arg('shop_name'))
+	ORDER BY expense_date DESC, id DESC
+	LIMIT sqlc.arg('history_limit');
+
+-- name: GetCategoryPriceHistory :many
+SELECT price FROM expense
+	WHERE deleted_at IS NULL AND category = sqlc.arg('category')
+	ORDER BY expense_date DESC, id DESC
+	LIMIT sqlc.arg('history_limit');
+
+-- name: GetTopShopsByTimespan :many
+SELECT shop_name, COUNT(*) AS purchases, CAST(SUM(price) AS REAL) AS expenses_sum
+	FROM expense
+	WHERE deleted_at IS NULL AND date(expense_date) BETWEEN date(sqlc.arg('start_time'))
+		AND date(sqlc.arg('end_time'), '+1 month', '-1 day')
+	GROUP BY shop_name
+	ORDER BY expenses_sum DESC, shop_name
+	LIMIT sqlc.arg('shop_limit');
+
+--
+-- Salaries
+--
+
+-- name: AddSalary :one
+-- Nothing is returned when the idempotency key has already been used
+INSERT INTO salary(username, salary, store_date, idempotency_key)
+	VALUES(?, ?, ?, ?)
+	ON CONFLICT (idempotency_key) DO NOTHING
+	RETURNING id;
+
+-- name: DeleteSalaryByID :one
+-- Salaries are only marked deleted, RestoreSalaryByID brings them back
+UPDATE salary
+	SET deleted_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND username = ? AND deleted_at IS NULL
+	RETURNING *;
+
+-- name: GetSalaryByID :one
+SELECT * FROM salary
+	WHERE id = ? AND deleted_at IS NULL;
+
+-- name: RestoreSalaryByID :one
+UPDATE salary
+	SET deleted_at = NULL
+	WHERE id = ? AND username = ? AND deleted_at IS NOT NULL
+	RETURNING *;
+
+-- name: UpdateSalaryByID :one
+UPDATE salary
+	SET salary = sqlc.arg('salary'), store_date = sqlc.arg('store_date')
+	WHERE id = sqlc.arg('id') AND username = sqlc.arg('username') AND deleted_at IS NULL
+	RETURNING *;
+
+-- name: ListSalaries :many
+SELECT * FROM salary
+	WHERE deleted_at IS NULL
+		AND (sqlc.narg('username') IS NULL OR username = sqlc.narg('username'))
+		AND (sqlc.narg('start_date') IS NULL OR date(store_date) >= date(sqlc.narg('start_date')))
+		AND (sqlc.narg('end_date') IS NULL OR date(store_date) <= date(sqlc.narg('end_date')))
+	ORDER BY store_date DESC, id DESC
+	LIMIT sqlc.arg('row_limit') OFFSET sqlc.arg('row_offset');
+
+-- name: GetUserSalaryByMonth :one
+SELECT salary FROM salary
+	WHERE username = sqlc.arg('username') AND deleted_at IS NULL
+	AND date(store_date) = date(sqlc.arg('month'), 'start of month');
+
+-- name: GetSalariesByTimespan :many
+SELECT username, salary, CAST(date(store_date, 'start of month') AS TEXT) AS months FROM salary
+	WHERE deleted_at IS NULL AND date(store_date) BETWEEN date(sqlc.arg('start_time'), 'start of month')
+		AND date(sqlc.arg('end_time'), 'start of month', '+1 month', '-1 day')
+	GROUP BY username, months, salary
+	ORDER BY username, months;
+
+-- name: ListSalaryUsernames :many
+-- The users of the household are the ones who have stored a salary
+SELECT DISTINCT username FROM salary
+	WHERE deleted_at IS NULL
+	ORDER BY username;
+
+--
+-- Report links
+--
+
+-- name: IsLinkRevoked :one
+SELECT EXISTS(
+	SELECT 1 FROM revoked_link WHERE link_id = ?
+) AS revoked;
+
+-- name: RevokeLink :exec
+INSERT INTO revoked_link (
+	link_id,
+	revoked_by
+) VALUES (
+	?,
+	?
+) ON CONFLICT (link_id) DO NOTHING;
+
+--
+-- Short-lived pages
+--
+
+-- name: AddShortLivedPage :one
+INSERT INTO short_lived_page (
+	hash,
+	html,
+	start_time,
+	ttl_seconds,
+	burn_after_read,
+	pin_hash
+) VALUES (
+	?,
+	?,
+	?,
+	?,
+	?,
+	?
+) ON CONFLICT (hash) DO NOTHING
+RETURNING hash;
+
+-- name: GetShortLivedPage :one
+SELECT * FROM short_lived_page WHERE hash = ?;
+
+-- name: DeleteShortLivedPage :exec
+DELETE FROM short_lived_page WHERE hash = ?;
+
+-- name: TakeShortLivedPage :one
+DELETE FROM short_lived_page WHERE hash = ?
+RETURNING *;
+
+-- name: DeleteExpiredShortLivedPages :execrows
+DELETE FROM short_lived_page
+	WHERE unixepoch(start_time) + ttl_seconds < unixepoch(sqlc.arg('now'));
+
+-- name: GetShortLivedPageStats :one
+SELECT COUNT(*) AS pages, CAST(COALESCE(SUM(length(html)), 0) AS INTEGER) AS bytes
+	FROM short_lived_page;
+
+--
+-- Audit log
+--
+
+-- name: AddAuditLog :exec
+INSERT INTO audit_log (
+	actor,
+	source,
+	action,
+	table_name,
+	row_id,
+	before_row,
+	after_row
+) VALUES (
+	?,
+	?,
+	?,
+	?,
+	?,
+	?,
+	?
+);
+
+-- name: ListAuditLog :many
+SELECT * FROM audit_log
+	ORDER BY id DESC
+	LIMIT sqlc.arg('row_limit') OFFSET sqlc.arg('row_offset');
+
+--
+-- Attachments
+--
+
+-- name: AddAttachment :exec
+-- Attaching the same file again does nothing
+INSERT INTO attachment (
+	expense_id,
+	hash,
+	content_type,
+	size_bytes
+) VALUES (?, ?, ?, ?)
+	ON CONFLICT (expense_id, hash) DO NOTHING;
+
+-- name: GetAttachmentByHash :one
+-- Receipts of the deleted expenses aren't shown
+SELECT a.id, a.expense_id, a.hash, a.content_type, a.size_bytes, a.created_at
+	FROM attachment AS a
+	JOIN expense AS e ON e.id = a.expense_id
+	WHERE a.hash = ? AND e.deleted_at IS NULL
+	ORDER BY a.id
+	LIMIT 1;
+
+-- name: ListAttachmentsByTimespan :many
+SELECT a.id, a.expense_id, a.hash, a.content_type, a.size_bytes
+	FROM attachment AS a
+	JOIN expense AS e ON e.id = a.expense_id
+	WHERE e.deleted_at IS NULL
+		AND date(e.expense_date) BETWEEN date(sqlc.arg('start_date')) AND date(sqlc.arg('end_date'))
+	ORDER BY a.expense_id, a.id;
+
+--
+-- Miscellaneous
+--
+
+-- name: StatisticsAggrByTimespan :many
+-- expenses_sum has only the shared expenses, the personal ones and the ones
+-- paid for the others are summed separately
+SELECT b.username, CAST(date(b.expense_date, 'start of month') AS TEXT) AS event_date,
+		CAST(TOTAL(CASE WHEN b.sharing = 'shared' THEN price END) AS REAL) AS expenses_sum,
+		CAST(TOTAL(CASE WHEN b.sharing = 'personal' THEN price END) AS REAL) AS personal_sum,
+		CAST(TOTAL(CASE WHEN b.sharing = 'owed' THEN price END) AS REAL) AS paid_for_others_sum,
+		s.salary, CAST(0.0 AS REAL) AS owes
+	FROM expense AS b
+	JOIN salary AS s ON b.username = s.username
+		AND date(s.store_date, 'start of month') = date(b.expense_date, 'start of month')
+		AND s.deleted_at IS NULL
+	WHERE b.deleted_at IS NULL AND (date(b.expense_date) BETWEEN date(sqlc.arg('start_time'), 'start of month')
+		AND date(sqlc.arg('end_time'), 'start of month', '+1 month', '-1 day')
+		OR date(s.store_date) BETWEEN date(sqlc.arg('start_time'), 'start of month')
+		AND date(sqlc.arg('end_time'), 'start of month', '+1 month', '-1 day'))
+	GROUP BY b.username, event_date, s.salary
+	ORDER BY b.username, event_date, expenses_sum;
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS expense(
+	id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+	username TEXT NOT NULL,
+	shop_name TEXT NOT NULL,
+	category TEXT NOT NULL,
+	price REAL NOT NULL,
+	expense_date DATE NOT NULL
+);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS expense;
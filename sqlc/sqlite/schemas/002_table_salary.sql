@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS salary(
+	id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+	username TEXT NOT NULL,
+	salary REAL NOT NULL,
+	store_date DATE NOT NULL
+);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS salary;
@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS revoked_link(
+	link_id TEXT PRIMARY KEY NOT NULL,
+	revoked_by TEXT NOT NULL,
+	revoked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS revoked_link;
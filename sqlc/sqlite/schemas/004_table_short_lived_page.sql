@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS short_lived_page(
+	hash TEXT PRIMARY KEY NOT NULL,
+	html BLOB NOT NULL,
+	start_time TIMESTAMP NOT NULL,
+	ttl_seconds INTEGER NOT NULL,
+	burn_after_read BOOLEAN NOT NULL DEFAULT false,
+	pin_hash TEXT NOT NULL DEFAULT ''
+);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS short_lived_page;
@@ -0,0 +1,24 @@
+-- +goose Up
+ALTER TABLE expense ADD COLUMN deleted_at TIMESTAMP;
+
+ALTER TABLE salary ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS audit_log(
+	id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+	changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	actor TEXT NOT NULL,
+	source TEXT NOT NULL,
+	action TEXT NOT NULL,
+	table_name TEXT NOT NULL,
+	row_id INTEGER NOT NULL,
+	before_row TEXT NOT NULL DEFAULT 'null',
+	after_row TEXT NOT NULL DEFAULT 'null'
+);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS audit_log;
+
+ALTER TABLE salary DROP COLUMN deleted_at;
+
+ALTER TABLE expense DROP COLUMN deleted_at;
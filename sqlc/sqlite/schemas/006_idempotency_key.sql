@@ -0,0 +1,24 @@
+-- +goose Up
+-- Telegram re-delivers messages after reconnects, the key makes the replays no-ops
+ALTER TABLE expense ADD COLUMN idempotency_key TEXT;
+
+-- SQLite can't add a column defaulting to the current time, AddExpense sets it
+ALTER TABLE expense ADD COLUMN created_at TIMESTAMP;
+
+ALTER TABLE salary ADD COLUMN idempotency_key TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS expense_idempotency_key_idx ON expense(idempotency_key);
+
+CREATE UNIQUE INDEX IF NOT EXISTS salary_idempotency_key_idx ON salary(idempotency_key);
+
+
+-- +goose Down
+DROP INDEX IF EXISTS salary_idempotency_key_idx;
+
+DROP INDEX IF EXISTS expense_idempotency_key_idx;
+
+ALTER TABLE salary DROP COLUMN idempotency_key;
+
+ALTER TABLE expense DROP COLUMN created_at;
+
+ALTER TABLE expense DROP COLUMN idempotency_key;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- Files are kept in the blob store, the hash is the SHA-256 of the content
+CREATE TABLE IF NOT EXISTS attachment(
+	id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+	expense_id INTEGER NOT NULL REFERENCES expense(id),
+	hash TEXT NOT NULL,
+	content_type TEXT NOT NULL,
+	size_bytes INTEGER NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (expense_id, hash)
+);
+
+CREATE INDEX IF NOT EXISTS attachment_hash_idx ON attachment(hash);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS attachment;
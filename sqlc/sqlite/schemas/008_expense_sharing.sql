@@ -0,0 +1,18 @@
+-- +goose Up
+-- Shared expenses are split by the salaries, personal ones aren't split at
+-- all and owed ones are paid back wholly by owed_by
+ALTER TABLE expense ADD COLUMN sharing TEXT NOT NULL DEFAULT 'shared'
+	CHECK (sharing IN ('shared', 'personal', 'owed'));
+
+ALTER TABLE expense ADD COLUMN owed_by TEXT NOT NULL DEFAULT '';
+
+-- #oma used to be stored as the category, it marks personal purchases now
+UPDATE expense SET sharing = 'personal', category = '' WHERE category = 'oma';
+
+
+-- +goose Down
+UPDATE expense SET category = 'oma' WHERE sharing = 'personal' AND category = '';
+
+ALTER TABLE expense DROP COLUMN owed_by;
+
+ALTER TABLE expense DROP COLUMN sharing;
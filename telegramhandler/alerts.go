@@ -0,0 +1,66 @@
+package telegramhandler
+
+import (
+	"context"
+	"time"
+	"weezel/budget/confighandler"
+	"weezel/budget/dbengine"
+	"weezel/budget/forecast"
+	"weezel/budget/logger"
+	"weezel/budget/outputs"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/prprprus/scheduler"
+)
+
+// forecastAlertHour is the hour of the day when forecast is checked
+const forecastAlertHour = 18
+
+func forecastAlert(bot *tgbotapi.BotAPI, store *dbengine.Store, channelID int64, budget confighandler.Budget) {
+	ctx := context.Background()
+
+	f, err := forecast.Load(ctx, store, time.Now(), budget)
+	if err != nil {
+		logger.Errorf("couldn't forecast month-end spending: %s", err)
+		return
+	}
+
+	alert := outputs.RenderForecastAlert(f)
+	if alert == "" {
+		logger.Debugf("Forecasted spending %.2f within the budget", f.Total.Projected)
+		return
+	}
+
+	logger.Infof("Forecasted spending exceeds the budget, alerting the channel")
+	outMsg := tgbotapi.NewMessage(channelID, codeBlock(alert))
+	if err = SendTelegram(bot, outMsg, true); err != nil {
+		logger.Error(err)
+	}
+}
+
+// ScheduleForecastAlerts checks daily whether the month-end spending is projected
+// to exceed the configured budgets and alerts the channel if so.
+func ScheduleForecastAlerts(
+	bot *tgbotapi.BotAPI,
+	store *dbengine.Store,
+	channelID int64,
+	budget confighandler.Budget,
+) {
+	if budget.Monthly <= 0 && len(budget.Categories) == 0 {
+		logger.Info("No budgets configured, forecast alerts disabled")
+		return
+	}
+
+	alertSchedule, err := scheduler.NewScheduler(1000)
+	if err != nil {
+		logger.Fatalf("Error while initializing scheduler: %s", err)
+	}
+	logger.Infof("Forecast alert scheduler started")
+	alertSchedule.Every().Hour(forecastAlertHour).Minute(0).Second(0).Do(
+		forecastAlert, bot, store, channelID, budget)
+
+	// The alert runs only once a day, heartbeat tells that the scheduler still runs
+	schedulerEnabled.Store(true)
+	schedulerHeartbeat()
+	alertSchedule.Every().Second(0).Do(schedulerHeartbeat)
+}
@@ -4,43 +4,109 @@ import (
 	"context"
 	"regexp"
 	"strings"
+	"time"
+	"weezel/budget/blobstore"
+	"weezel/budget/confighandler"
+	"weezel/budget/dbengine"
 	"weezel/budget/logger"
+	"weezel/budget/ocr"
+	"weezel/budget/web"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-var splitPath = regexp.MustCompile(`\s+`)
+var (
+	splitPath       = regexp.MustCompile(`\s+`)
+	codeBlockEscape = strings.NewReplacer("\\", "\\\\", "`", "\\`")
+)
 
-// SendTelegram returns true if message sending succeeds and false otherwise
+// SendTelegram returns true if message sending succeeds and false otherwise.
+// Markdown messages are parsed as MarkdownV2.
 func SendTelegram(
 	bot *tgbotapi.BotAPI,
 	msg tgbotapi.MessageConfig,
 	markdown bool,
 ) error {
 	if markdown {
-		msg.ParseMode = tgbotapi.ModeMarkdown
+		msg.ParseMode = tgbotapi.ModeMarkdownV2
 	}
 	if _, err := bot.Send(msg); err != nil {
+		sendFailures.Inc()
 		return err
 	}
 	return nil
 }
 
-func ConnectionHandler(bot *tgbotapi.BotAPI, channelID int64, hostname string) {
+// codeBlock wraps text into a MarkdownV2 pre-formatted block so that
+// columns stay aligned in the chat.
+func codeBlock(text string) string {
+	return "```\n" + codeBlockEscape.Replace(text) + "\n```"
+}
+
+// handleCallback handles presses of the inline keyboard buttons
+func handleCallback(
+	ctx context.Context,
+	bot *tgbotapi.BotAPI,
+	store *dbengine.Store,
+	query *tgbotapi.CallbackQuery) {
+	username := query.From.String()
+	answer := tgbotapi.NewCallback(query.ID, "")
+
+	msg := handlePurchaseConfirmation(ctx, store, username, query.Data)
+	if msg == "" {
+		answer.Text = "Vanhentunut tai toisen käyttäjän osto"
+	} else if query.Message != nil {
+		edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, msg)
+		if _, err := bot.Send(edit); err != nil {
+			logger.Error(err)
+		}
+	}
+
+	if _, err := bot.Request(answer); err != nil {
+		logger.Error(err)
+	}
+}
+
+// ConnectionHandler handles the updates until the bot is stopped. Photos of
+// the receipts sent with the purchases are kept in receipts. Photos sent
+// alone are read with ocrEngine, they're ignored when it's nil.
+func ConnectionHandler(
+	bot *tgbotapi.BotAPI,
+	store *dbengine.Store,
+	receipts blobstore.Store,
+	ocrEngine ocr.Engine,
+	channelID int64,
+	hostname string,
+	budget confighandler.Budget,
+	anomalyConf confighandler.Anomaly,
+	linkSecret string,
+) {
 	var err error
 
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
 	ctx := context.Background()
 
+	updateLoopRunning.Store(true)
+	defer updateLoopRunning.Store(false)
+
 	updates := bot.GetUpdatesChan(u)
 	for update := range updates {
+		lastUpdate.Store(time.Now().UnixNano())
+		if update.CallbackQuery != nil {
+			handleCallback(ctx, bot, store, update.CallbackQuery)
+			continue
+		}
 		if update.Message == nil { // ignore any non-Message Updates
 			continue
 		}
 
 		username := update.Message.From.String()
 		msg := update.Message.Text
+		if msg == "" {
+			// Photos carry the command in the caption
+			msg = update.Message.Caption
+		}
 		tokenized := splitPath.Split(msg, -1)
 		lastElem := strings.ReplaceAll(tokenized[len(tokenized)-1], ",", ".")
 		logger.Infof("Tokenized: %v", tokenized)
@@ -50,33 +116,76 @@ func ConnectionHandler(bot *tgbotapi.BotAPI, channelID int64, hostname string) {
 		case "osto":
 			if len(tokenized) < 3 {
 				displayHelp(username, channelID, bot)
+				commandsProcessed.Inc(command, outcomeInvalid)
 				continue
 			}
 
 			shopName := tokenized[1]
-			msg = handlePurchase(ctx, shopName, lastElem, username, tokenized)
+			var rcpt *receipt
+			if fileID := receiptFileID(update.Message); fileID != "" {
+				// The purchase is stored even if the receipt can't be
+				if rcpt, err = fetchReceipt(ctx, bot, receipts, fileID); err != nil {
+					logger.Errorf("couldn't store receipt of %s: %v", username, err)
+				}
+			} else if reply := update.Message.ReplyToMessage; reply != nil {
+				// Correction of a purchase read from a receipt
+				if held, ok := pending.TakeByMessage(reply.MessageID, username, time.Now()); ok {
+					rcpt = held.receipt
+				}
+			}
+			var keyboard *tgbotapi.InlineKeyboardMarkup
+			msg, keyboard = handlePurchase(ctx, store, messageKey(update.Message),
+				shopName, lastElem, username, tokenized, anomalyConf, rcpt)
+			if msg == "" {
+				// Telegram re-delivered an already stored message
+				commandsProcessed.Inc(command, outcomeIgnored)
+				continue
+			}
 			outMsg := tgbotapi.NewMessage(channelID, msg)
+			if keyboard != nil {
+				outMsg.ReplyMarkup = keyboard
+			}
 			if err = SendTelegram(bot, outMsg, false); err != nil {
 				logger.Error(err)
 			}
 		case "tilastot":
-			if len(tokenized) != 3 {
+			if len(tokenized) < 3 || len(tokenized) > 5 {
 				displayHelp(username, channelID, bot)
+				commandsProcessed.Inc(command, outcomeInvalid)
 				continue
 			}
 
-			msg = getStatsTimeSpan(ctx, hostname, tokenized)
+			var pin string
+			msg, pin = getStatsTimeSpan(ctx, store, hostname, linkSecret, channelID, tokenized)
 			outMsg := tgbotapi.NewMessage(channelID, msg)
+			outMsg.DisableWebPagePreview = true
 			if err = SendTelegram(bot, outMsg, false); err != nil {
 				logger.Error(err)
 			}
+			if pin != "" {
+				// Only the requester gets the PIN
+				outMsg = tgbotapi.NewMessage(update.Message.From.ID, "PIN tilastosivulle: "+pin)
+				if err = SendTelegram(bot, outMsg, false); err != nil {
+					logger.Error(err)
+					outMsg = tgbotapi.NewMessage(channelID,
+						"PIN-koodin lähetys epäonnistui, aloita ensin yksityiskeskustelu botin kanssa")
+					if err = SendTelegram(bot, outMsg, false); err != nil {
+						logger.Error(err)
+					}
+				}
+			}
 		case "palkka":
 			if len(tokenized) != 3 {
 				displayHelp(username, channelID, bot)
+				commandsProcessed.Inc(command, outcomeInvalid)
 				continue
 			}
 
-			msg = handleSalaryInsert(ctx, username, lastElem, tokenized)
+			msg = handleSalaryInsert(ctx, store, messageKey(update.Message), username, lastElem, tokenized)
+			if msg == "" {
+				commandsProcessed.Inc(command, outcomeIgnored)
+				continue
+			}
 			outMsg := tgbotapi.NewMessage(channelID, msg)
 			if err = SendTelegram(bot, outMsg, false); err != nil {
 				logger.Error(err)
@@ -84,18 +193,115 @@ func ConnectionHandler(bot *tgbotapi.BotAPI, channelID int64, hostname string) {
 		case "poista":
 			if len(tokenized) != 3 {
 				displayHelp(username, channelID, bot)
+				commandsProcessed.Inc(command, outcomeInvalid)
 				continue
 			}
 
-			msg := handleRemovePurchase(ctx, username, tokenized)
+			msg = handleRemovePurchase(ctx, store, username, tokenized)
 			outMsg := tgbotapi.NewMessage(channelID, msg)
 			if err = SendTelegram(bot, outMsg, false); err != nil {
 				logger.Error(err)
 			}
+		case "palauta":
+			if len(tokenized) != 2 && len(tokenized) != 3 {
+				displayHelp(username, channelID, bot)
+				commandsProcessed.Inc(command, outcomeInvalid)
+				continue
+			}
+
+			msg = handleRestore(ctx, store, username, tokenized)
+			outMsg := tgbotapi.NewMessage(channelID, msg)
+			if err = SendTelegram(bot, outMsg, false); err != nil {
+				logger.Error(err)
+			}
+		case "saldo":
+			msg = handleBalance(ctx, store, budget, time.Now())
+			outMsg := tgbotapi.NewMessage(channelID, msg)
+			if err = SendTelegram(bot, outMsg, true); err != nil {
+				logger.Error(err)
+			}
+		case "trendi":
+			msg = handleTrends(ctx, store, tokenized)
+			outMsg := tgbotapi.NewMessage(channelID, msg)
+			if err = SendTelegram(bot, outMsg, true); err != nil {
+				logger.Error(err)
+			}
+		case "ennuste":
+			msg = handleForecast(ctx, store, budget, time.Now())
+			outMsg := tgbotapi.NewMessage(channelID, msg)
+			if err = SendTelegram(bot, outMsg, true); err != nil {
+				logger.Error(err)
+			}
+		case "mitatoi":
+			if len(tokenized) != 2 {
+				displayHelp(username, channelID, bot)
+				commandsProcessed.Inc(command, outcomeInvalid)
+				continue
+			}
+
+			msg = handleRevokeLink(ctx, store, username, tokenized[1])
+			outMsg := tgbotapi.NewMessage(channelID, msg)
+			if err = SendTelegram(bot, outMsg, false); err != nil {
+				logger.Error(err)
+			}
+		case "kirjaudu":
+			// The link is sent privately, since anyone on the channel could use it
+			link := web.LoginURL(hostname, web.IssueLoginToken(username))
+			outMsg := tgbotapi.NewMessage(update.Message.From.ID,
+				"Kertakäyttöinen kirjautumislinkki, voimassa 10min: "+link)
+			outMsg.DisableWebPagePreview = true
+			if err = SendTelegram(bot, outMsg, false); err != nil {
+				logger.Error(err)
+				msg = "Linkin lähetys epäonnistui, aloita ensin yksityiskeskustelu botin kanssa"
+				outMsg = tgbotapi.NewMessage(channelID, msg)
+				if err = SendTelegram(bot, outMsg, false); err != nil {
+					logger.Error(err)
+				}
+			}
+		case "":
+			// Photos sent without a command are read as receipts
+			fileID := receiptFileID(update.Message)
+			if ocrEngine == nil || fileID == "" {
+				commandsProcessed.Inc("unknown", outcomeIgnored)
+				continue
+			}
+			command = "kuitti"
+
+			var keyboard *tgbotapi.InlineKeyboardMarkup
+			var id string
+			image, dlErr := downloadFile(ctx, bot, fileID)
+			if dlErr != nil {
+				logger.Errorf("couldn't download receipt of %s: %v", username, dlErr)
+				msg = "Kuitin lataus epäonnistui"
+			} else {
+				key := messageKey(update.Message)
+				msg, keyboard, id = handleReceiptScan(ctx, store, ocrEngine, receipts,
+					key, username, image, anomalyConf)
+			}
+			if msg == "" {
+				// Telegram re-delivered an already stored message
+				commandsProcessed.Inc(command, outcomeIgnored)
+				continue
+			}
+			outMsg := tgbotapi.NewMessage(channelID, msg)
+			if keyboard != nil {
+				outMsg.ReplyMarkup = keyboard
+			}
+			sent, sendErr := bot.Send(outMsg)
+			if sendErr != nil {
+				sendFailures.Inc()
+				logger.Error(sendErr)
+			} else if id != "" {
+				pending.SetMessage(id, sent.MessageID)
+			}
 		case "help", "apua":
 			displayHelp(username, channelID, bot)
+		default:
+			// Label values must stay bounded, so the text is not used
+			commandsProcessed.Inc("unknown", outcomeIgnored)
 			continue
 		}
+		commandsProcessed.Inc(command, replyOutcome(msg))
 
 	}
 }
@@ -2,26 +2,49 @@ package telegramhandler
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
+	"weezel/budget/analytics"
+	"weezel/budget/anomaly"
+	"weezel/budget/confighandler"
 	"weezel/budget/dbengine"
 	"weezel/budget/debtcontrol"
+	"weezel/budget/forecast"
 	"weezel/budget/logger"
 	"weezel/budget/outputs"
+	"weezel/budget/reportlink"
+	"weezel/budget/reports"
 	"weezel/budget/shortlivedpage"
 	"weezel/budget/utils"
+	"weezel/budget/web"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/jackc/pgx/v4"
 )
 
+// topShopsCount limits how many shops are shown in the statistics
+const topShopsCount = 5
+
 func displayHelp(username string, channelID int64, bot *tgbotapi.BotAPI) {
 	logger.Infof("Help requested by %s", username)
 	helpMsg := "Tunnistan seuraavat komennot:\n\n"
-	helpMsg += "**osto** paikka [vapaaehtoinen pvm muodossa kk-vvvv] xx.xx\n\n"
+	helpMsg += "**osto** paikka [vapaaehtoinen pvm muodossa pp-kk-vvvv tai kk-vvvv] xx.xx\n"
+	helpMsg += "(#oma kirjaa oston omaksi ja @käyttäjä toisen maksettavaksi, osat esim. #oma=2,50)\n"
+	helpMsg += "(kuitin saa liitettyä lähettämällä kuvan, jonka kuvatekstinä on osto)\n"
+	helpMsg += "(pelkkä kuitin kuva luetaan ja osto ehdotetaan kirjattavaksi, jos luku on käytössä)\n\n"
 	helpMsg += "**palkka** kk-vvvv xxxx.xx (nettona)\r\n"
 	helpMsg += "**poista** [osto TAI palkka] ID\r\n"
-	helpMsg += "**tilastot** kk-vvvv kk-vvvv\r\n"
+	helpMsg += "**palauta** [vapaaehtoinen osto TAI palkka] ID (poistetun palautus)\r\n"
+	helpMsg += "**tilastot** kk-vvvv kk-vvvv [vapaaehtoinen voimassaoloaika, esim. 7d] [kerta] [pin]\r\n"
+	helpMsg += "**mitatoi** linkin tunniste\r\n"
+	helpMsg += "**saldo** (kuluvan kuun tilanne)\r\n"
+	helpMsg += "**trendi** [vapaaehtoinen kk-vvvv]\r\n"
+	helpMsg += "**ennuste** (kuluvan kuun loppusumma)\r\n"
+	helpMsg += "**kirjaudu** (kirjautumislinkki web-käyttöliittymään)\r\n"
 	outMsg := tgbotapi.NewMessage(channelID, tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, helpMsg))
 	outMsg.ParseMode = tgbotapi.ModeMarkdownV2
 	if _, err := bot.Send(outMsg); err != nil {
@@ -29,59 +52,174 @@ func displayHelp(username string, channelID int64, bot *tgbotapi.BotAPI) {
 	}
 }
 
-func getStatsTimeSpan(ctx context.Context, hostname string, tokenized []string) string {
+// getStatsTimeSpan returns a link to the statistics. With the optional duration,
+// e.g. 7d, the link is signed and the report is regenerated on each visit.
+// Otherwise the page is kept for 10 minutes. Short-lived pages can be made
+// one-time with "kerta" and protected with a PIN with "pin". The PIN is
+// returned separately, since it must not be sent to the channel.
+func getStatsTimeSpan(
+	ctx context.Context,
+	store *dbengine.Store,
+	hostname string,
+	linkSecret string,
+	channelID int64,
+	tokenized []string,
+) (string, string) {
 	startMonth := utils.GetDate(tokenized[1:], "01-2006")
 	endMonth := utils.GetDate(tokenized[2:], "01-2006")
 
 	if startMonth.IsZero() || endMonth.IsZero() {
 		logger.Errorf("couldn't parse date for stats, start=%#v, end=%#v",
 			startMonth, endMonth)
-		return "Virhe päivämäärän parsinnassa. Oltava muotoa kk-vvvv"
+		return "Virhe päivämäärän parsinnassa. Oltava muotoa kk-vvvv", ""
 	}
 
-	stats, err := dbengine.StatisticsByTimespan(ctx, startMonth, endMonth)
-	if err != nil {
-		logger.Error(err)
-		return "virhe, ei saatu tilastoja"
+	var linkTTL time.Duration
+	burnAfterRead := false
+	withPIN := false
+	for _, option := range tokenized[3:] {
+		switch strings.ToLower(option) {
+		case "kerta":
+			burnAfterRead = true
+		case "pin":
+			withPIN = true
+		default:
+			if linkSecret == "" {
+				return "Pitkäikäiset linkit eivät ole käytössä", ""
+			}
+			var err error
+			if linkTTL, err = reportlink.ParseTTL(option); err != nil {
+				logger.Errorf("couldn't parse link duration: %s", err)
+				return "Virheellinen voimassaoloaika, esim. 12h, 7d tai 2w (enintään 365d)", ""
+			}
+		}
+	}
+	if linkTTL > 0 && (burnAfterRead || withPIN) {
+		return "Kertakäyttöisyys ja PIN eivät ole käytössä pitkäikäisissä linkeissä", ""
 	}
-	debtcontrol.FillDebts(stats)
 
-	detailedExpenses, err := dbengine.GetExpensesByTimespan(ctx, startMonth, endMonth)
+	statsVars, err := reports.Statistics(ctx, store, startMonth, endMonth, topShopsCount)
 	if err != nil {
 		logger.Error(err)
-		return "virhe, ei saatu kulutustietoja"
+		return "virhe, ei saatu tilastoja", ""
+	}
+
+	if linkTTL > 0 {
+		link := reportlink.New(startMonth, endMonth, channelID, linkTTL, time.Now())
+		logger.Infof("Issued report link %s for %s - %s, expires at %s",
+			link.ID,
+			startMonth.Format("01-2006"),
+			endMonth.Format("01-2006"),
+			link.Expires)
+
+		return fmt.Sprintf("Tilastot saatavilla %s asti täällä: %s\nMitätöinti: mitatoi %s\n\n%s",
+			link.Expires.Format("02-01-2006 15:04"),
+			web.ReportURL(hostname, link, linkSecret),
+			link.ID,
+			outputs.RenderStatsText(statsVars)), ""
 	}
 
-	htmlPage, err := outputs.RenderStatsHTML(outputs.StatisticsVars{
-		From:       startMonth,
-		To:         endMonth,
-		Statistics: stats,
-		Detailed:   detailedExpenses,
-	})
+	htmlPage, err := outputs.RenderStatsHTML(statsVars)
 	if err != nil {
 		logger.Error(err)
-		return "virhe, HTML sivun muodostus epäonnistui"
+		return "virhe, HTML sivun muodostus epäonnistui", ""
 	}
 
-	htmlPageHash := utils.CalcSha256Sum(htmlPage)
+	pageToken := shortlivedpage.NewToken()
 	shortlivedPage := shortlivedpage.ShortLivedPage{
-		TTLSeconds: 600,
-		StartTime:  time.Now(),
-		HTMLPage:   &htmlPage,
+		TTLSeconds:    600,
+		StartTime:     time.Now(),
+		HTMLPage:      &htmlPage,
+		BurnAfterRead: burnAfterRead,
+	}
+	pin := ""
+	if withPIN {
+		pin = shortlivedpage.NewPIN()
+		shortlivedPage.SetPIN(pin)
 	}
-	if ok := shortlivedpage.Add(htmlPageHash, shortlivedPage); ok {
-		endTime := shortlivedPage.StartTime.Add(
-			time.Duration(shortlivedPage.TTLSeconds))
-		logger.Infof("Added shortlived data page %s with end time %s",
-			htmlPageHash, endTime)
+	if _, err := shortlivedpage.Add(ctx, pageToken, shortlivedPage); err != nil {
+		logger.Errorf("Couldn't store shortlived data page: %s", err)
+		return "virhe, HTML sivun tallennus epäonnistui", ""
 	}
+	logger.Infof("Added shortlived data page %.8s with end time %s (one-time: %t, PIN: %t)",
+		pageToken, shortlivedPage.EndTime(), burnAfterRead, withPIN)
 
-	return fmt.Sprintf("Tilastot saatavilla 10min ajan täällä: https://%s/statistics?page_hash=%s",
+	extra := ""
+	if burnAfterRead {
+		extra += ", avattavissa kerran"
+	}
+	if withPIN {
+		extra += ", PIN lähetetty yksityisviestinä"
+	}
+	return fmt.Sprintf("Tilastot saatavilla 10min ajan%s täällä: https://%s/statistics?page_hash=%s\n\n%s",
+		extra,
 		hostname,
-		htmlPageHash)
+		pageToken,
+		outputs.RenderStatsText(statsVars)), pin
+}
+
+// handleBalance returns month-to-date situation as MarkdownV2 formatted text
+func handleBalance(ctx context.Context, store *dbengine.Store, budget confighandler.Budget, now time.Time) string {
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	expenses, err := store.GetAggrExpensesByTimespan(ctx, month, month)
+	if err != nil {
+		logger.Error(err)
+		return tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, "virhe, ei saatu kulutustietoja")
+	}
+
+	stats, err := store.StatisticsByTimespan(ctx, month, month)
+	if err != nil {
+		logger.Error(err)
+		return tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, "virhe, ei saatu tilastoja")
+	}
+	debtcontrol.FillDebts(stats)
+
+	categories, err := store.GetCategoryExpensesByTimespan(ctx, month, month)
+	if err != nil {
+		logger.Error(err)
+		return tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, "virhe, ei saatu kategoriatietoja")
+	}
+
+	return codeBlock(outputs.RenderBalanceText(outputs.BalanceVars{
+		Month:           month,
+		Today:           now,
+		Expenses:        expenses,
+		Debts:           stats,
+		Categories:      categories,
+		MonthlyBudget:   budget.Monthly,
+		CategoryBudgets: budget.Categories,
+	}))
+}
+
+// handleTrends returns spending trends for the month as MarkdownV2 formatted text
+func handleTrends(ctx context.Context, store *dbengine.Store, tokenized []string) string {
+	month := utils.GetDate(tokenized[1:], "01-2006")
+	if month.IsZero() {
+		month = time.Now()
+	}
+
+	report, err := analytics.Load(ctx, store, month)
+	if err != nil {
+		logger.Error(err)
+		return tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, "virhe, ei saatu trenditietoja")
+	}
+
+	return codeBlock(outputs.RenderTrendText(report))
+}
+
+// handleForecast returns month-end projection as MarkdownV2 formatted text
+func handleForecast(ctx context.Context, store *dbengine.Store, budget confighandler.Budget, now time.Time) string {
+	f, err := forecast.Load(ctx, store, now, budget)
+	if err != nil {
+		logger.Error(err)
+		return tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, "virhe, ennusteen laskenta epäonnistui")
+	}
+
+	return codeBlock(outputs.RenderForecastText(f))
 }
 
-func handleRemovePurchase(ctx context.Context, username string, tokenized []string) string {
+func handleRemovePurchase(ctx context.Context, store *dbengine.Store, username string, tokenized []string) string {
 	switch tokenized[1] {
 	case "osto":
 		pid, err := strconv.ParseInt(tokenized[2], 10, 32)
@@ -90,15 +228,16 @@ func handleRemovePurchase(ctx context.Context, username string, tokenized []stri
 			return "Oston ID parsinta epäonnistui"
 		}
 
-		deletedID, err := dbengine.DeleteExpenseByID(ctx, int32(pid), username)
+		deletedID, err := store.DeleteExpenseByID(ctx, int32(pid), username)
 		if err != nil {
 			logger.Error(err)
 			return fmt.Sprintf("Oston ID (%d) poisto epäonnistui", pid)
 		}
 		logger.Infof("Removed expense item ID=%d %s %.2f€ [%s] by %s",
 			deletedID.ID, deletedID.ShopName, deletedID.Price, deletedID.ExpenseDate, username)
-		return fmt.Sprintf("Poistettu kulutapahtuma (ID %d) %s %.2f€ [%s] by %s",
-			deletedID.ID, deletedID.ShopName, deletedID.Price, deletedID.ExpenseDate, username)
+		return fmt.Sprintf("Poistettu kulutapahtuma (ID %d) %s %.2f€ [%s] by %s, palautus: palauta osto %d",
+			deletedID.ID, deletedID.ShopName, deletedID.Price, deletedID.ExpenseDate, username,
+			deletedID.ID)
 	case "palkka":
 		pid, err := strconv.ParseInt(tokenized[2], 10, 32)
 		if err != nil {
@@ -106,29 +245,173 @@ func handleRemovePurchase(ctx context.Context, username string, tokenized []stri
 			return "Palkan ID parsinta epäonnistui"
 		}
 
-		deletedID, err := dbengine.DeleteSalaryByID(ctx, int32(pid), username)
+		deletedID, err := store.DeleteSalaryByID(ctx, int32(pid), username)
 		if err != nil {
 			logger.Error(err)
 			return fmt.Sprintf("Palkan ID (%d) poisto epäonnistui", pid)
 		}
 		logger.Infof("Removed salary item ID=%d %s %.2f by %s",
 			deletedID.ID, deletedID.StoreDate, deletedID.Salary, username)
-		return fmt.Sprintf("Poistettu palkkatapahtuma (ID %d) %s %.2f€ [%s]",
-			deletedID.ID, deletedID.StoreDate, deletedID.Salary, username)
+		return fmt.Sprintf("Poistettu palkkatapahtuma (ID %d) %s %.2f€ [%s], palautus: palauta palkka %d",
+			deletedID.ID, deletedID.StoreDate, deletedID.Salary, username, deletedID.ID)
 	}
 
 	return "Vain 'osto' tai 'palkka' kelepaa"
 }
 
+// handleRestore brings back a purchase or a salary removed by the user. The
+// type is optional, "palauta ID" restores a purchase.
+func handleRestore(ctx context.Context, store *dbengine.Store, username string, tokenized []string) string {
+	kind, rawID := "osto", tokenized[len(tokenized)-1]
+	if len(tokenized) == 3 {
+		kind = tokenized[1]
+	}
+
+	switch kind {
+	case "osto":
+		pid, err := strconv.ParseInt(rawID, 10, 32)
+		if err != nil {
+			logger.Error(err)
+			return "Oston ID parsinta epäonnistui"
+		}
+
+		restored, err := store.RestoreExpenseByID(ctx, int32(pid), username)
+		if err != nil {
+			logger.Error(err)
+			return fmt.Sprintf("Oston ID (%d) palautus epäonnistui", pid)
+		}
+		logger.Infof("Restored expense item ID=%d %s %.2f€ [%s] by %s",
+			restored.ID, restored.ShopName, restored.Price, restored.ExpenseDate, username)
+		return fmt.Sprintf("Palautettu kulutapahtuma (ID %d) %s %.2f€ [%s] by %s",
+			restored.ID, restored.ShopName, restored.Price, restored.ExpenseDate, username)
+	case "palkka":
+		pid, err := strconv.ParseInt(rawID, 10, 32)
+		if err != nil {
+			logger.Error(err)
+			return "Palkan ID parsinta epäonnistui"
+		}
+
+		restored, err := store.RestoreSalaryByID(ctx, int32(pid), username)
+		if err != nil {
+			logger.Error(err)
+			return fmt.Sprintf("Palkan ID (%d) palautus epäonnistui", pid)
+		}
+		logger.Infof("Restored salary item ID=%d %s %.2f by %s",
+			restored.ID, restored.StoreDate, restored.Salary, username)
+		return fmt.Sprintf("Palautettu palkkatapahtuma (ID %d) %s %.2f€ [%s]",
+			restored.ID, restored.StoreDate, restored.Salary, username)
+	}
+
+	return "Vain 'osto' tai 'palkka' kelpaa"
+}
+
+// handleRevokeLink adds the report link to the denylist
+func handleRevokeLink(ctx context.Context, store *dbengine.Store, username string, linkID string) string {
+	if err := store.RevokeLink(ctx, linkID, username); err != nil {
+		logger.Error(err)
+		return "Linkin mitätöinti epäonnistui"
+	}
+
+	logger.Infof("Report link %s revoked by %s", linkID, username)
+	return fmt.Sprintf("Linkki %s mitätöity", linkID)
+}
+
+// Callback data prefixes for the purchase confirmation buttons
+const (
+	confirmPurchasePrefix = "osto:vahvista:"
+	cancelPurchasePrefix  = "osto:peru:"
+)
+
+// duplicateWindow is how long the same purchase is asked to be confirmed
+const duplicateWindow = 10 * time.Minute
+
+// messageKey is the idempotency key of the message, Telegram re-delivers
+// the same message after reconnects
+func messageKey(msg *tgbotapi.Message) string {
+	return fmt.Sprintf("telegram:%d:%d", msg.Chat.ID, msg.MessageID)
+}
+
+// storePurchase returns an empty text when the purchase was already stored.
+// The user is told when the purchase is queued until the database is back.
+func storePurchase(ctx context.Context, store *dbengine.Store, p purchase) string {
+	items := p.items
+	if items == nil {
+		items = []dbengine.ExpenseItem{{Price: p.price}}
+	}
+	ids, err := store.WithIdempotencyKey(p.key).
+		AddExpenseItems(ctx, p.username, p.shopName, p.category, p.purchaseDate, items)
+	if errors.Is(err, dbengine.ErrDuplicate) {
+		logger.Infof("Purchase of message %s was already stored", p.key)
+		return ""
+	}
+	if errors.Is(err, dbengine.ErrQueued) && p.receipt != nil {
+		// Only the inserts are queued, the receipt stays in the blob store unattached
+		return fmt.Sprintf(
+			"Tietokanta ei ole nyt tavoitettavissa. Ostosi kirjataan ilman kuittia, kun yhteys palaa, %s.",
+			p.username)
+	}
+	if errors.Is(err, dbengine.ErrQueued) {
+		return fmt.Sprintf("Tietokanta ei ole nyt tavoitettavissa. Ostosi kirjataan, kun yhteys palaa, %s.",
+			p.username)
+	}
+	if err != nil {
+		logger.Error(err)
+		return "Ostotapahtuman kirjaus epäonnistui"
+	}
+
+	logger.Infof("Purchased from %s [%s] with price %.2f by %s on %s, IDs=%v",
+		p.shopName,
+		p.category,
+		p.price,
+		p.username,
+		p.purchaseDate.Format("02-01-2006"),
+		ids)
+
+	if p.receipt == nil {
+		return fmt.Sprintf("Ostosi on kirjattu, %s. Kiitos!", p.username)
+	}
+	// Every item of the purchase shows the same receipt
+	for _, pid := range ids {
+		err = store.AddAttachment(ctx, pid, p.receipt.hash, p.receipt.contentType, p.receipt.size)
+		if err != nil {
+			logger.Errorf("couldn't attach receipt %s to purchase %d: %v", p.receipt.hash, pid, err)
+			return fmt.Sprintf("Ostosi on kirjattu, mutta kuitin tallennus epäonnistui, %s.", p.username)
+		}
+	}
+	return fmt.Sprintf("Ostosi ja kuitti on kirjattu, %s. Kiitos!", p.username)
+}
+
+// confirmKeyboard asks to confirm the purchase put on hold
+func confirmKeyboard(id string) *tgbotapi.InlineKeyboardMarkup {
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Kyllä, kirjaa", confirmPurchasePrefix+id),
+		tgbotapi.NewInlineKeyboardButtonData("Peru", cancelPurchasePrefix+id),
+	))
+	return &keyboard
+}
+
+// handlePurchase stores the purchase, unless the same purchase was just stored
+// or the price looks unusual. In that case the purchase is put on hold and a
+// keyboard for confirming it is returned. Empty text is returned for messages
+// which were already handled. The receipt is attached to the stored purchase,
+// rcpt is nil when there's none.
 func handlePurchase(
 	ctx context.Context,
+	store *dbengine.Store,
+	key string,
 	shopName string,
 	rawPrice string,
 	username string,
 	tokenized []string,
-) string {
+	anomalyConf confighandler.Anomaly,
+	rcpt *receipt,
+) (string, *tgbotapi.InlineKeyboardMarkup) {
 	category := utils.GetCategory(tokenized)
-	purchaseDate := utils.GetDate(tokenized, "01-2006")
+	// Day precision is preferred, month alone points to the first day
+	purchaseDate := utils.GetDate(tokenized, "02-01-2006")
+	if purchaseDate.IsZero() {
+		purchaseDate = utils.GetDate(tokenized, "01-2006")
+	}
 	if purchaseDate.IsZero() {
 		logger.Info("No time given, using current time")
 		purchaseDate = time.Now()
@@ -136,27 +419,155 @@ func handlePurchase(
 	price, err := strconv.ParseFloat(rawPrice, 64)
 	if err != nil {
 		logger.Error(err)
-		return "Virhe, hinta täytyy olla komennon viimeinen elementti ja muodossa x,xx tai x.xx"
+		return "Virhe, hinta täytyy olla komennon viimeinen elementti ja muodossa x,xx tai x.xx", nil
+	}
+	// Only the tokens between the shop name and the price tell the sharing
+	var sharingTokens []string
+	if len(tokenized) > 3 {
+		sharingTokens = tokenized[2 : len(tokenized)-1]
+	}
+	items, err := parseSharing(sharingTokens, username, householdUsers(ctx, store, sharingTokens), price)
+	switch {
+	case errors.Is(err, errUnknownUser):
+		logger.Error(err)
+		return fmt.Sprintf("Virhe jaossa, tuntematon käyttäjä. @käyttäjän täytyy olla kirjannut palkkansa, %s.",
+			username), nil
+	case err != nil:
+		logger.Error(err)
+		return "Virhe jaossa. Omat osat muodossa #oma=x,xx ja toisen osat @käyttäjä=x,xx, " +
+			"osien summa ei saa ylittää hintaa", nil
 	}
 
-	pid, err := dbengine.AddExpense(ctx, username, shopName, category, purchaseDate, price)
+	p := purchase{
+		key:          key,
+		username:     username,
+		shopName:     shopName,
+		category:     category,
+		purchaseDate: purchaseDate,
+		price:        price,
+		items:        items,
+		receipt:      rcpt,
+	}
+
+	warning, stored := checkPurchase(ctx, store, p, anomalyConf)
+	if stored {
+		return "", nil
+	}
+	if warning == "" {
+		return storePurchase(ctx, store, p), nil
+	}
+	id := pending.Add(p, time.Now())
+	return warning, confirmKeyboard(id)
+}
+
+// householdUsers returns the users the purchase may be owed by. They're not
+// fetched unless the tokens mention a user. Nil is returned when the users
+// can't be listed, so that the purchase can still be queued during an outage.
+func householdUsers(ctx context.Context, store *dbengine.Store, tokens []string) []string {
+	if !slices.ContainsFunc(tokens, func(t string) bool { return strings.HasPrefix(t, owedPrefix) }) {
+		return nil
+	}
+	users, err := store.ListSalaryUsernames(ctx)
 	if err != nil {
-		logger.Error(err)
-		return "Ostotapahtuman kirjaus epäonnistui"
+		logger.Errorf("couldn't list the users, @users aren't checked: %v", err)
+		return nil
 	}
+	if users == nil {
+		users = []string{}
+	}
+	return users
+}
 
-	logger.Infof("Purchased from %s [%s] with price %.2f by %s on %s, ID=%d",
-		shopName,
-		category,
-		price,
-		username,
-		purchaseDate.Format("01-2006"),
-		pid)
+// checkPurchase looks for the same purchase stored just before and for an
+// unusual price. The returned warning asks to confirm the purchase, it's
+// empty when the purchase looks fine. stored tells that the message was
+// already stored. Failing checks shouldn't prevent storing the purchase.
+func checkPurchase(
+	ctx context.Context,
+	store *dbengine.Store,
+	p purchase,
+	anomalyConf confighandler.Anomaly,
+) (string, bool) {
+	since := time.Now().Add(-duplicateWindow)
+	// Items are stored as rows of their own, the first one carries the key of
+	// the message. The other rows are compared by the whole price.
+	if len(p.items) > 1 && p.key != "" {
+		dup, err := store.GetRecentDuplicateExpense(ctx, p.username, p.shopName, p.purchaseDate,
+			p.items[0].Price, since)
+		switch {
+		case err == nil && dup.IdempotencyKey.String == p.key:
+			logger.Infof("Purchase of message %s was already stored, ID=%d", p.key, dup.ID)
+			return "", true
+		case err != nil && !errors.Is(err, pgx.ErrNoRows):
+			logger.Errorf("duplicate check failed: %s", err)
+		}
+	}
+
+	dup, err := store.GetRecentDuplicateExpense(ctx, p.username, p.shopName, p.purchaseDate, p.price, since)
+	switch {
+	case err == nil && p.key != "" && dup.IdempotencyKey.String == p.key:
+		logger.Infof("Purchase of message %s was already stored, ID=%d", p.key, dup.ID)
+		return "", true
+	case err == nil:
+		logger.Infof("Possible duplicate purchase from %s with price %.2f by %s, ID=%d",
+			p.shopName, p.price, p.username, dup.ID)
+		return fmt.Sprintf("Oletko varma? %s %.2f€ on jo kirjattu hetki sitten (ID %d), %s.",
+			p.shopName, p.price, dup.ID, p.username), false
+	case !errors.Is(err, pgx.ErrNoRows):
+		logger.Errorf("duplicate check failed: %s", err)
+	}
 
-	return fmt.Sprintf("Ostosi on kirjattu, %s. Kiitos!", username)
+	res, err := anomaly.CheckExpense(ctx, store, p.shopName, p.category, p.price, anomalyConf)
+	if err != nil {
+		logger.Errorf("anomaly check failed: %s", err)
+	}
+	if !res.Outlier {
+		return "", false
+	}
+	logger.Infof("Unusual purchase from %s with price %.2f by %s (score %.2f, median %.2f)",
+		p.shopName, p.price, p.username, res.Score, res.Median)
+	return fmt.Sprintf("Oletko varma? %s %.2f€ poikkeaa tavallisesta (yleensä noin %.2f€), %s.",
+		p.shopName, p.price, res.Median, p.username), false
 }
 
-func handleSalaryInsert(ctx context.Context, username string, lastElem string, tokenized []string) string {
+// handlePurchaseConfirmation stores or drops the purchase put on hold by
+// handlePurchase. Returned text replaces the question.
+func handlePurchaseConfirmation(ctx context.Context, store *dbengine.Store, username string, data string) string {
+	var id string
+	var confirmed bool
+	switch {
+	case strings.HasPrefix(data, confirmPurchasePrefix):
+		id = strings.TrimPrefix(data, confirmPurchasePrefix)
+		confirmed = true
+	case strings.HasPrefix(data, cancelPurchasePrefix):
+		id = strings.TrimPrefix(data, cancelPurchasePrefix)
+	default:
+		return ""
+	}
+
+	p, ok := pending.Take(id, username, time.Now())
+	if !ok {
+		return ""
+	}
+	if !confirmed {
+		logger.Infof("Purchase from %s with price %.2f cancelled by %s", p.shopName, p.price, username)
+		return fmt.Sprintf("Ostoa %s %.2f€ ei kirjattu, %s.", p.shopName, p.price, username)
+	}
+	if msg := storePurchase(ctx, store, p); msg != "" {
+		return msg
+	}
+	return fmt.Sprintf("Osto %s %.2f€ on jo kirjattu, %s.", p.shopName, p.price, username)
+}
+
+// handleSalaryInsert returns an empty text when the message was already handled
+func handleSalaryInsert(
+	ctx context.Context,
+	store *dbengine.Store,
+	key string,
+	username string,
+	lastElem string,
+	tokenized []string,
+) string {
 	salaryDate := utils.GetDate(tokenized, "01-2006")
 	if salaryDate.IsZero() {
 		logger.Info("No time given, using current time")
@@ -168,7 +579,15 @@ func handleSalaryInsert(ctx context.Context, username string, lastElem string, t
 		return "Virhe palkan parsinnassa. Palkan oltava viimeisenä ja muodossa x.xx tai x,xx"
 	}
 
-	pid, err := dbengine.AddSalary(ctx, username, salary, salaryDate)
+	pid, err := store.WithIdempotencyKey(key).AddSalary(ctx, username, salary, salaryDate)
+	if errors.Is(err, dbengine.ErrDuplicate) {
+		logger.Infof("Salary of message %s was already stored", key)
+		return ""
+	}
+	if errors.Is(err, dbengine.ErrQueued) {
+		return fmt.Sprintf("Tietokanta ei ole nyt tavoitettavissa. Palkka kirjataan, kun yhteys palaa, %s.",
+			username)
+	}
 	if err != nil {
 		logger.Errorf("couldn't insert salary: %v", err)
 		return "Virhe palkan lisäämisessä, kysy apua"
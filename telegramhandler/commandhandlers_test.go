@@ -0,0 +1,409 @@
+package telegramhandler
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"weezel/budget/blobstore"
+	"weezel/budget/confighandler"
+	"weezel/budget/dbengine"
+	"weezel/budget/dbengine/dbenginetest"
+	"weezel/budget/shortlivedpage"
+)
+
+func addTestData(t *testing.T, store *dbengine.Store) {
+	t.Helper()
+	ctx := context.Background()
+	march := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i, price := range []float64{9, 10, 11, 10, 10} {
+		if _, err := store.AddExpense(ctx, "alice", "Lidl", "food", march.AddDate(0, 0, i), price); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, username := range []string{"alice", "bob"} {
+		if _, err := store.AddSalary(ctx, username, 2000, march); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+var pageLink = regexp.MustCompile(`https://example.com/statistics\?page_hash=([\w-]+)`)
+
+func TestGetStatsTimeSpan(t *testing.T) {
+	tests := []struct {
+		name       string
+		tokenized  string
+		linkSecret string
+		dbErr      error
+		wantPrefix string
+		wantPIN    bool
+	}{
+		{
+			name:       "invalid month",
+			tokenized:  "tilastot maaliskuu huhtikuu",
+			wantPrefix: "Virhe päivämäärän parsinnassa",
+		},
+		{
+			name:       "long-lived links disabled",
+			tokenized:  "tilastot 03-2024 04-2024 7d",
+			wantPrefix: "Pitkäikäiset linkit eivät ole käytössä",
+		},
+		{
+			name:       "invalid duration",
+			tokenized:  "tilastot 03-2024 04-2024 ikuisesti",
+			linkSecret: "secret",
+			wantPrefix: "Virheellinen voimassaoloaika",
+		},
+		{
+			name:       "one-time long-lived link",
+			tokenized:  "tilastot 03-2024 04-2024 7d kerta",
+			linkSecret: "secret",
+			wantPrefix: "Kertakäyttöisyys ja PIN eivät ole käytössä",
+		},
+		{
+			name:       "database error",
+			tokenized:  "tilastot 03-2024 04-2024",
+			dbErr:      errors.New("connection refused"),
+			wantPrefix: "virhe, ei saatu tilastoja",
+		},
+		{
+			name:       "long-lived link",
+			tokenized:  "tilastot 03-2024 04-2024 7d",
+			linkSecret: "secret",
+			wantPrefix: "Tilastot saatavilla",
+		},
+		{
+			name:      "short-lived page",
+			tokenized: "tilastot 03-2024 04-2024",
+			wantPrefix: "Tilastot saatavilla 10min ajan täällä: " +
+				"https://example.com/statistics?page_hash=",
+		},
+		{
+			name:      "one-time page with PIN",
+			tokenized: "tilastot 03-2024 04-2024 KERTA pin",
+			wantPrefix: "Tilastot saatavilla 10min ajan, avattavissa kerran, " +
+				"PIN lähetetty yksityisviestinä täällä: https://example.com/statistics?page_hash=",
+			wantPIN: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store, q := dbenginetest.NewStore()
+			addTestData(t, store)
+			q.Err = tt.dbErr
+
+			tokenized := strings.Fields(tt.tokenized)
+			msg, pin := getStatsTimeSpan(ctx, store, "example.com", tt.linkSecret, -100, tokenized)
+			if !strings.HasPrefix(msg, tt.wantPrefix) {
+				t.Errorf("got message %q", msg)
+			}
+			if (pin != "") != tt.wantPIN {
+				t.Errorf("got PIN %q", pin)
+			}
+
+			m := pageLink.FindStringSubmatch(msg)
+			if m == nil {
+				return
+			}
+			page, err := shortlivedpage.Get(ctx, m[1])
+			if err != nil {
+				t.Fatalf("page not stored: %s", err)
+			}
+			if page.BurnAfterRead != tt.wantPIN || page.HasPIN() != tt.wantPIN {
+				t.Errorf("got one-time %t, PIN %t", page.BurnAfterRead, page.HasPIN())
+			}
+			if tt.wantPIN && !page.CheckPIN(pin) {
+				t.Errorf("PIN %q doesn't open the page", pin)
+			}
+		})
+	}
+}
+
+func TestHandleRemovePurchase(t *testing.T) {
+	ctx := context.Background()
+	store, _ := dbenginetest.NewStore()
+	addTestData(t, store)
+
+	tests := []struct {
+		name       string
+		username   string
+		tokenized  string
+		wantPrefix string
+	}{
+		{"other user's purchase", "bob", "poista osto 1", "Oston ID (1) poisto epäonnistui"},
+		{"own purchase", "alice", "poista osto 1", "Poistettu kulutapahtuma (ID 1) Lidl 9.00€"},
+		{"already removed", "alice", "poista osto 1", "Oston ID (1) poisto epäonnistui"},
+		{"invalid ID", "alice", "poista osto yksi", "Oston ID parsinta epäonnistui"},
+		{"salary", "bob", "poista palkka 7", "Poistettu palkkatapahtuma (ID 7)"},
+		{"unknown type", "alice", "poista lasku 1", "Vain 'osto' tai 'palkka'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := handleRemovePurchase(ctx, store, tt.username, strings.Fields(tt.tokenized))
+			if !strings.HasPrefix(msg, tt.wantPrefix) {
+				t.Errorf("got message %q", msg)
+			}
+		})
+	}
+}
+
+func TestHandleRestore(t *testing.T) {
+	ctx := context.Background()
+	store, _ := dbenginetest.NewStore()
+	addTestData(t, store)
+	if msg := handleRemovePurchase(ctx, store, "alice", strings.Fields("poista osto 1")); !strings.HasPrefix(
+		msg, "Poistettu") {
+		t.Fatalf("got message %q", msg)
+	}
+	if msg := handleRemovePurchase(ctx, store, "bob", strings.Fields("poista palkka 7")); !strings.HasPrefix(
+		msg, "Poistettu") {
+		t.Fatalf("got message %q", msg)
+	}
+
+	tests := []struct {
+		name       string
+		username   string
+		tokenized  string
+		wantPrefix string
+	}{
+		{"other user's purchase", "bob", "palauta osto 1", "Oston ID (1) palautus epäonnistui"},
+		{"own purchase", "alice", "palauta 1", "Palautettu kulutapahtuma (ID 1) Lidl 9.00€"},
+		{"not removed", "alice", "palauta osto 1", "Oston ID (1) palautus epäonnistui"},
+		{"invalid ID", "alice", "palauta yksi", "Oston ID parsinta epäonnistui"},
+		{"salary", "bob", "palauta palkka 7", "Palautettu palkkatapahtuma (ID 7)"},
+		{"unknown type", "alice", "palauta lasku 1", "Vain 'osto' tai 'palkka'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := handleRestore(ctx, store, tt.username, strings.Fields(tt.tokenized))
+			if !strings.HasPrefix(msg, tt.wantPrefix) {
+				t.Errorf("got message %q", msg)
+			}
+		})
+	}
+}
+
+func TestHandlePurchase(t *testing.T) {
+	ctx := context.Background()
+	store, _ := dbenginetest.NewStore()
+	addTestData(t, store)
+	anomalyConf := confighandler.Anomaly{MinSamples: 5}
+
+	msg, keyboard := handlePurchase(ctx, store, "telegram:1:1", "Lidl", "10.50",
+		"alice", strings.Fields("osto Lidl #food 10,50"), anomalyConf, nil)
+	if msg != "Ostosi on kirjattu, alice. Kiitos!" || keyboard != nil {
+		t.Fatalf("got message %q", msg)
+	}
+
+	msg, keyboard = handlePurchase(ctx, store, "telegram:1:2", "Lidl", "450",
+		"alice", strings.Fields("osto Lidl #food 15-03-2024 450"), anomalyConf, nil)
+	if !strings.HasPrefix(msg, "Oletko varma? Lidl 450.00€ poikkeaa tavallisesta") || keyboard == nil {
+		t.Fatalf("got message %q", msg)
+	}
+	confirm := *keyboard.InlineKeyboard[0][0].CallbackData
+	if msg = handlePurchaseConfirmation(ctx, store, "bob", confirm); msg != "" {
+		t.Errorf("other user confirmed the purchase: %q", msg)
+	}
+	if msg = handlePurchaseConfirmation(ctx, store, "alice", confirm); msg != "Ostosi on kirjattu, alice. Kiitos!" {
+		t.Errorf("got message %q", msg)
+	}
+
+	// Both purchases are stored after the five earlier ones
+	expenses, err := store.ListExpenses(ctx, dbengine.Filter{Category: "food", Sort: "-price"}, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expenses) != 7 || expenses[0].Price != 450 {
+		t.Fatalf("got %d expenses", len(expenses))
+	}
+	if want := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC); !expenses[0].ExpenseDate.Equal(want) {
+		t.Errorf("got date %s", expenses[0].ExpenseDate)
+	}
+}
+
+func TestHandlePurchaseDuplicate(t *testing.T) {
+	ctx := context.Background()
+	store, _ := dbenginetest.NewStore()
+	tokenized := strings.Fields("osto S-market #food 01-04-2024 12,30")
+	anomalyConf := confighandler.Anomaly{MinSamples: 5}
+
+	msg, keyboard := handlePurchase(ctx, store, "telegram:1:1", "S-market", "12.30", "alice",
+		tokenized, anomalyConf, nil)
+	if msg != "Ostosi on kirjattu, alice. Kiitos!" || keyboard != nil {
+		t.Fatalf("got message %q", msg)
+	}
+
+	// Re-delivered message is ignored
+	msg, keyboard = handlePurchase(ctx, store, "telegram:1:1", "S-market", "12.30", "alice",
+		tokenized, anomalyConf, nil)
+	if msg != "" || keyboard != nil {
+		t.Fatalf("replay got message %q", msg)
+	}
+
+	// The same purchase sent again is asked to be confirmed
+	msg, keyboard = handlePurchase(ctx, store, "telegram:1:2", "s-market", "12.30", "alice",
+		tokenized, anomalyConf, nil)
+	if !strings.HasPrefix(msg, "Oletko varma? s-market 12.30€ on jo kirjattu hetki sitten") || keyboard == nil {
+		t.Fatalf("got message %q", msg)
+	}
+	confirm := *keyboard.InlineKeyboard[0][0].CallbackData
+	if msg = handlePurchaseConfirmation(ctx, store, "alice", confirm); msg != "Ostosi on kirjattu, alice. Kiitos!" {
+		t.Errorf("got message %q", msg)
+	}
+
+	// Other users' purchases aren't duplicates
+	msg, _ = handlePurchase(ctx, store, "telegram:1:3", "S-market", "12.30", "bob",
+		tokenized, anomalyConf, nil)
+	if msg != "Ostosi on kirjattu, bob. Kiitos!" {
+		t.Errorf("got message %q", msg)
+	}
+
+	expenses, err := store.ListExpenses(ctx, dbengine.Filter{}, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expenses) != 3 {
+		t.Errorf("got %d expenses, expected 3", len(expenses))
+	}
+}
+
+func TestHandlePurchaseQueued(t *testing.T) {
+	ctx := context.Background()
+	store, fake := dbenginetest.NewStore()
+	queue, err := dbengine.OpenWriteQueue(filepath.Join(t.TempDir(), "pending_writes.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store = store.WithQueue(queue)
+	tokenized := strings.Fields("osto S-market #food 01-04-2024 12,30")
+
+	fake.Err = dbengine.ErrUnavailable
+	msg, keyboard := handlePurchase(ctx, store, "telegram:1:1", "S-market", "12.30", "alice",
+		tokenized, confighandler.Anomaly{MinSamples: 5}, nil)
+	want := "Tietokanta ei ole nyt tavoitettavissa. Ostosi kirjataan, kun yhteys palaa, alice."
+	if msg != want || keyboard != nil {
+		t.Errorf("got message %q", msg)
+	}
+	msg = handleSalaryInsert(ctx, store, "telegram:1:2", "alice", "2500", strings.Fields("palkka 2500"))
+	if msg != "Tietokanta ei ole nyt tavoitettavissa. Palkka kirjataan, kun yhteys palaa, alice." {
+		t.Errorf("got message %q", msg)
+	}
+
+	fake.Err = nil
+	replayed, err := store.ReplayQueue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed != 2 {
+		t.Errorf("replayed %d inserts, expected 2", replayed)
+	}
+	// Re-delivered message is ignored after the replay
+	msg, _ = handlePurchase(ctx, store, "telegram:1:1", "S-market", "12.30", "alice",
+		tokenized, confighandler.Anomaly{MinSamples: 5}, nil)
+	if msg != "" {
+		t.Errorf("replay got message %q", msg)
+	}
+}
+
+func TestHandlePurchaseReceipt(t *testing.T) {
+	ctx := context.Background()
+	store, _ := dbenginetest.NewStore()
+	blobs, err := blobstore.NewFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = saveReceipt(ctx, blobs, []byte("not a photo")); err == nil {
+		t.Error("text was accepted as a receipt")
+	}
+	photo := []byte("\x89PNG\r\n\x1a\nkuitti")
+	rcpt, err := saveReceipt(ctx, blobs, photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rcpt.contentType != "image/png" || rcpt.hash != blobstore.Hash(photo) {
+		t.Errorf("unexpected receipt %+v", rcpt)
+	}
+
+	msg, _ := handlePurchase(ctx, store, "telegram:1:1", "Lidl", "10.50", "alice",
+		strings.Fields("osto Lidl #food 10,50"), confighandler.Anomaly{MinSamples: 5}, rcpt)
+	if msg != "Ostosi ja kuitti on kirjattu, alice. Kiitos!" {
+		t.Errorf("got message %q", msg)
+	}
+	attachment, err := store.GetAttachmentByHash(ctx, rcpt.hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expense, err := store.GetExpenseByID(ctx, attachment.ExpenseID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expense.ShopName != "Lidl" || attachment.ContentType != "image/png" ||
+		attachment.SizeBytes != int64(len(photo)) {
+		t.Errorf("receipt attached to %+v as %+v", expense, attachment)
+	}
+}
+
+func TestHandleSalaryInsert(t *testing.T) {
+	ctx := context.Background()
+	store, _ := dbenginetest.NewStore()
+
+	msg := handleSalaryInsert(ctx, store, "telegram:1:1", "alice", "2500,5",
+		strings.Fields("palkka 05-2024 2500,5"))
+	if !strings.HasPrefix(msg, "Virhe palkan parsinnassa") {
+		t.Errorf("got message %q", msg)
+	}
+	tokenized := strings.Fields("palkka 05-2024 2500.5")
+	msg = handleSalaryInsert(ctx, store, "telegram:1:2", "alice", "2500.5", tokenized)
+	if msg != "Palkka kirjattu, alice. Kiitos!" {
+		t.Errorf("got message %q", msg)
+	}
+	// Re-delivered message is ignored
+	if msg = handleSalaryInsert(ctx, store, "telegram:1:2", "alice", "2500.5", tokenized); msg != "" {
+		t.Errorf("replay got message %q", msg)
+	}
+
+	salary, err := store.GetUserSalaryByMonth(ctx, "alice", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil || salary != 2500.5 {
+		t.Errorf("got salary %.2f, %v", salary, err)
+	}
+}
+
+func TestHandleRevokeLink(t *testing.T) {
+	ctx := context.Background()
+	store, q := dbenginetest.NewStore()
+
+	if msg := handleRevokeLink(ctx, store, "alice", "abc123"); msg != "Linkki abc123 mitätöity" {
+		t.Errorf("got message %q", msg)
+	}
+	if revoked, err := store.IsLinkRevoked(ctx, "abc123"); err != nil || !revoked {
+		t.Errorf("link not revoked: %v", err)
+	}
+
+	q.Err = errors.New("connection refused")
+	if msg := handleRevokeLink(ctx, store, "alice", "abc123"); msg != "Linkin mitätöinti epäonnistui" {
+		t.Errorf("got message %q", msg)
+	}
+}
+
+func TestHandleBalance(t *testing.T) {
+	ctx := context.Background()
+	store, q := dbenginetest.NewStore()
+	addTestData(t, store)
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	msg := handleBalance(ctx, store, confighandler.Budget{Monthly: 100}, now)
+	if !strings.HasPrefix(msg, "```\n") || !strings.Contains(msg, "alice") {
+		t.Errorf("got message %q", msg)
+	}
+
+	q.Err = errors.New("connection refused")
+	if msg = handleBalance(ctx, store, confighandler.Budget{}, now); !strings.HasPrefix(msg, "virhe") {
+		t.Errorf("got message %q", msg)
+	}
+}
@@ -0,0 +1,69 @@
+package telegramhandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// schedulerMaxSilence is how long the scheduler may go without a heartbeat,
+// it beats every minute
+const schedulerMaxSilence = 3 * time.Minute
+
+var (
+	updateLoopRunning atomic.Bool
+	// lastUpdate and lastSchedulerBeat are Unix nanoseconds, zero if never
+	lastUpdate        atomic.Int64
+	schedulerEnabled  atomic.Bool
+	lastSchedulerBeat atomic.Int64
+)
+
+func schedulerHeartbeat() {
+	lastSchedulerBeat.Store(time.Now().UnixNano())
+}
+
+func unixNanoTime(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// CheckUpdateLoop fails if the loop receiving Telegram updates has stopped.
+// Quiet channels have no updates for long times, so their age is only shown.
+func CheckUpdateLoop(context.Context) (string, error) {
+	return checkUpdateLoop(updateLoopRunning.Load(), unixNanoTime(lastUpdate.Load()), time.Now())
+}
+
+func checkUpdateLoop(running bool, last time.Time, now time.Time) (string, error) {
+	detail := "no updates received"
+	if !last.IsZero() {
+		detail = fmt.Sprintf("last update %s ago at %s",
+			now.Sub(last).Round(time.Second), last.UTC().Format(time.RFC3339))
+	}
+	if !running {
+		return detail, errors.New("update loop is not running")
+	}
+	return detail, nil
+}
+
+// CheckScheduler fails if the forecast alert scheduler has stopped beating
+func CheckScheduler(context.Context) (string, error) {
+	return checkScheduler(schedulerEnabled.Load(), unixNanoTime(lastSchedulerBeat.Load()), time.Now())
+}
+
+func checkScheduler(enabled bool, last time.Time, now time.Time) (string, error) {
+	if !enabled {
+		return "disabled, no budgets configured", nil
+	}
+	if last.IsZero() {
+		return "", errors.New("no heartbeat yet")
+	}
+	detail := fmt.Sprintf("last heartbeat %s ago", now.Sub(last).Round(time.Second))
+	if now.Sub(last) > schedulerMaxSilence {
+		return detail, errors.New("scheduler has stopped")
+	}
+	return detail, nil
+}
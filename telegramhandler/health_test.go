@@ -0,0 +1,70 @@
+package telegramhandler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckUpdateLoop(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		running    bool
+		last       time.Time
+		wantDetail string
+		wantErr    bool
+	}{
+		{
+			name:       "quiet channel",
+			running:    true,
+			wantDetail: "no updates received",
+		},
+		{
+			name:       "recent update",
+			running:    true,
+			last:       now.Add(-90 * time.Second),
+			wantDetail: "last update 1m30s ago at 2024-03-01T11:58:30Z",
+		},
+		{
+			name:       "stopped",
+			last:       now.Add(-time.Hour),
+			wantDetail: "last update 1h0m0s ago at 2024-03-01T11:00:00Z",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detail, err := checkUpdateLoop(tt.running, tt.last, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v", err)
+			}
+			if detail != tt.wantDetail {
+				t.Errorf("got detail %q", detail)
+			}
+		})
+	}
+}
+
+func TestCheckScheduler(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		enabled bool
+		last    time.Time
+		wantErr bool
+	}{
+		{name: "disabled"},
+		{name: "beating", enabled: true, last: now.Add(-time.Minute)},
+		{name: "no beat yet", enabled: true, wantErr: true},
+		{name: "stopped", enabled: true, last: now.Add(-10 * time.Minute), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := checkScheduler(tt.enabled, tt.last, now); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package telegramhandler
+
+import (
+	"strings"
+	"weezel/budget/metrics"
+)
+
+const (
+	outcomeOK      = "ok"
+	outcomeInvalid = "invalid"
+	outcomeError   = "error"
+	outcomeIgnored = "ignored"
+)
+
+var (
+	commandsProcessed = metrics.NewCounter(
+		"budget_telegram_commands_total",
+		"Telegram messages processed by command and outcome.",
+		"command", "outcome")
+	sendFailures = metrics.NewCounter(
+		"budget_telegram_send_failures_total",
+		"Messages which couldn't be sent to Telegram.")
+)
+
+// replyOutcome tells from the reply whether the command failed. Handlers
+// return the failures as Finnish error texts.
+func replyOutcome(reply string) string {
+	lower := strings.ToLower(reply)
+	if strings.HasPrefix(lower, "virhe") || strings.Contains(lower, "epäonnistui") {
+		return outcomeError
+	}
+	return outcomeOK
+}
@@ -0,0 +1,20 @@
+package telegramhandler
+
+import "testing"
+
+func TestReplyOutcome(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  string
+	}{
+		{reply: "Ostettu Kauppa 12.50€, ID=3", want: outcomeOK},
+		{reply: "virhe, ei saatu tilastoja", want: outcomeError},
+		{reply: "Virhe päivämäärän parsinnassa. Oltava muotoa kk-vvvv", want: outcomeError},
+		{reply: "Linkin mitätöinti epäonnistui", want: outcomeError},
+	}
+	for _, tt := range tests {
+		if got := replyOutcome(tt.reply); got != tt.want {
+			t.Errorf("replyOutcome(%q) = %s, expected %s", tt.reply, got, tt.want)
+		}
+	}
+}
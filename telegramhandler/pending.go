@@ -0,0 +1,110 @@
+package telegramhandler
+
+import (
+	"strconv"
+	"sync"
+	"time"
+	"weezel/budget/dbengine"
+)
+
+// pendingTTL is how long a purchase waits for the confirmation
+const pendingTTL = 10 * time.Minute
+
+// purchase holds a parsed, not yet stored, purchase
+type purchase struct {
+	// key is the idempotency key of the message
+	key          string
+	username     string
+	shopName     string
+	category     string
+	purchaseDate time.Time
+	price        float64
+	// items split the price by who pays them, nil for a shared purchase
+	items []dbengine.ExpenseItem
+	// receipt is attached to the expense when set
+	receipt *receipt
+}
+
+type pendingPurchase struct {
+	purchase
+	created time.Time
+	// messageID is the question sent to the chat, replies to it refer to the purchase
+	messageID int
+}
+
+// pendingPurchases holds purchases waiting for the user's confirmation
+type pendingPurchases struct {
+	lock      sync.Mutex
+	lastID    int64
+	purchases map[string]pendingPurchase
+}
+
+var pending = pendingPurchases{
+	purchases: map[string]pendingPurchase{},
+}
+
+// Add stores the purchase and returns an ID for it. Expired purchases are
+// dropped at the same time.
+func (p *pendingPurchases) Add(pur purchase, now time.Time) string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for id, pp := range p.purchases {
+		if now.Sub(pp.created) > pendingTTL {
+			delete(p.purchases, id)
+		}
+	}
+
+	p.lastID++
+	id := strconv.FormatInt(p.lastID, 10)
+	p.purchases[id] = pendingPurchase{
+		purchase: pur,
+		created:  now,
+	}
+	return id
+}
+
+// Take removes the purchase and returns it. False is returned if the purchase
+// doesn't exist, has already expired or belongs to someone else.
+func (p *pendingPurchases) Take(id string, username string, now time.Time) (purchase, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	pp, ok := p.purchases[id]
+	if !ok || pp.username != username {
+		return purchase{}, false
+	}
+	delete(p.purchases, id)
+	if now.Sub(pp.created) > pendingTTL {
+		return purchase{}, false
+	}
+	return pp.purchase, true
+}
+
+// SetMessage records the message asking about the purchase
+func (p *pendingPurchases) SetMessage(id string, messageID int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if pp, ok := p.purchases[id]; ok {
+		pp.messageID = messageID
+		p.purchases[id] = pp
+	}
+}
+
+// TakeByMessage is Take for the purchase asked about in the message
+func (p *pendingPurchases) TakeByMessage(messageID int, username string, now time.Time) (purchase, bool) {
+	p.lock.Lock()
+	id := ""
+	for pid, pp := range p.purchases {
+		if pp.messageID != 0 && pp.messageID == messageID {
+			id = pid
+			break
+		}
+	}
+	p.lock.Unlock()
+	if id == "" {
+		return purchase{}, false
+	}
+	return p.Take(id, username, now)
+}
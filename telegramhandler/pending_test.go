@@ -0,0 +1,58 @@
+package telegramhandler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPendingPurchases(t *testing.T) {
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	p := pendingPurchases{purchases: map[string]pendingPurchase{}}
+
+	id := p.Add(purchase{username: "alice", shopName: "lidl", price: 4500}, now)
+
+	if _, ok := p.Take(id, "tom", now); ok {
+		t.Errorf("Take() by other user succeeded")
+	}
+	got, ok := p.Take(id, "alice", now.Add(time.Minute))
+	if !ok || got.shopName != "lidl" || got.price != 4500 {
+		t.Errorf("Take() = %+v, %t", got, ok)
+	}
+	if _, ok = p.Take(id, "alice", now); ok {
+		t.Errorf("Take() succeeded twice")
+	}
+
+	id = p.Add(purchase{username: "alice"}, now)
+	if _, ok = p.Take(id, "alice", now.Add(pendingTTL+time.Second)); ok {
+		t.Errorf("Take() of expired purchase succeeded")
+	}
+
+	p.Add(purchase{username: "alice"}, now)
+	p.Add(purchase{username: "alice"}, now.Add(pendingTTL+time.Second))
+	if len(p.purchases) != 1 {
+		t.Errorf("Add() didn't drop expired purchases, %d left", len(p.purchases))
+	}
+}
+
+func TestPendingPurchasesByMessage(t *testing.T) {
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	p := pendingPurchases{purchases: map[string]pendingPurchase{}}
+
+	id := p.Add(purchase{username: "alice", shopName: "lidl"}, now)
+	p.Add(purchase{username: "alice", shopName: "alko"}, now)
+	if _, ok := p.TakeByMessage(42, "alice", now); ok {
+		t.Errorf("TakeByMessage() found a purchase without a message")
+	}
+	p.SetMessage(id, 42)
+
+	if _, ok := p.TakeByMessage(42, "bob", now); ok {
+		t.Errorf("TakeByMessage() by other user succeeded")
+	}
+	got, ok := p.TakeByMessage(42, "alice", now)
+	if !ok || got.shopName != "lidl" {
+		t.Errorf("TakeByMessage() = %+v, %t", got, ok)
+	}
+	if _, ok = p.Take(id, "alice", now); ok {
+		t.Errorf("purchase taken by message is still pending")
+	}
+}
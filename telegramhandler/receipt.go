@@ -0,0 +1,182 @@
+package telegramhandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"weezel/budget/blobstore"
+	"weezel/budget/confighandler"
+	"weezel/budget/dbengine"
+	"weezel/budget/logger"
+	"weezel/budget/ocr"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxReceiptBytes is the largest file bots can download from Telegram
+const maxReceiptBytes = 20 << 20
+
+// receipt is a photo of the receipt stored in the blob store. It's attached
+// to the purchase once the purchase is stored.
+type receipt struct {
+	hash        string
+	contentType string
+	size        int64
+}
+
+// receiptFileID returns the file of the receipt sent with the message, if any.
+// Photos come in several sizes, the largest one is last. Images sent as files
+// are accepted too.
+func receiptFileID(msg *tgbotapi.Message) string {
+	if len(msg.Photo) > 0 {
+		return msg.Photo[len(msg.Photo)-1].FileID
+	}
+	if msg.Document != nil && strings.HasPrefix(msg.Document.MimeType, "image/") {
+		return msg.Document.FileID
+	}
+	return ""
+}
+
+// downloadFile fetches the file through the Bot API
+func downloadFile(ctx context.Context, bot *tgbotapi.BotAPI, fileID string) ([]byte, error) {
+	link, err := bot.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := bot.Client.Do(req)
+	if err != nil {
+		// The URL contains the bot token, it's left out from the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("download %s: %w", fileID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download %s: status %d", fileID, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxReceiptBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("download %s: %w", fileID, err)
+	}
+	if len(data) > maxReceiptBytes {
+		return nil, fmt.Errorf("download %s: larger than %d bytes", fileID, maxReceiptBytes)
+	}
+	return data, nil
+}
+
+// fetchReceipt downloads the file and stores it in the blob store
+func fetchReceipt(ctx context.Context, bot *tgbotapi.BotAPI, blobs blobstore.Store, fileID string) (*receipt, error) {
+	data, err := downloadFile(ctx, bot, fileID)
+	if err != nil {
+		return nil, err
+	}
+	return saveReceipt(ctx, blobs, data)
+}
+
+// saveReceipt stores the file in the blob store. Only images are accepted,
+// since they're shown in the browser as is.
+func saveReceipt(ctx context.Context, blobs blobstore.Store, data []byte) (*receipt, error) {
+	contentType := http.DetectContentType(data)
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, fmt.Errorf("receipt is %s, not an image", contentType)
+	}
+	hash, err := blobs.Put(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	return &receipt{hash: hash, contentType: contentType, size: int64(len(data))}, nil
+}
+
+// prefillCommand returns the osto command for the receipt. Placeholders are
+// left for what couldn't be read, the date defaults to the current day.
+func prefillCommand(r ocr.Receipt) string {
+	shopName := receiptShopName(r)
+	if shopName == "" {
+		shopName = "kauppa"
+	}
+	command := "osto " + shopName
+	if !r.Date.IsZero() {
+		command += " " + r.Date.Format("02-01-2006")
+	}
+	if r.Total > 0 {
+		return command + fmt.Sprintf(" %.2f", r.Total)
+	}
+	return command + " x.xx"
+}
+
+// receiptShopName returns the first word of the merchant, the commands take
+// the shop as a single word, e.g. "K-Market"
+func receiptShopName(r ocr.Receipt) string {
+	if words := strings.Fields(r.Merchant); len(words) > 0 {
+		return words[0]
+	}
+	return ""
+}
+
+// handleReceiptScan stores the photo and reads it. The purchase found from
+// it is put on hold until it's confirmed with the returned keyboard, or
+// corrected by replying with an osto command to the returned text. The reply
+// warns about duplicates and unusual prices like the osto command. The ID of
+// the held purchase is returned too, it's empty when nothing was held. Empty
+// text is returned for messages which were already handled.
+func handleReceiptScan(
+	ctx context.Context,
+	store *dbengine.Store,
+	engine ocr.Engine,
+	blobs blobstore.Store,
+	key string,
+	username string,
+	image []byte,
+	anomalyConf confighandler.Anomaly,
+) (string, *tgbotapi.InlineKeyboardMarkup, string) {
+	rcpt, err := saveReceipt(ctx, blobs, image)
+	if err != nil {
+		logger.Errorf("couldn't store receipt of %s: %v", username, err)
+		return "Kuitin tallennus epäonnistui", nil, ""
+	}
+	r, err := ocr.Read(ctx, engine, image)
+	if err != nil {
+		// The receipt can still be attached by replying
+		logger.Errorf("couldn't read receipt %s: %v", rcpt.hash, err)
+	}
+	logger.Infof("Read receipt %s of %s: %+v", rcpt.hash, username, r)
+
+	p := purchase{
+		key:          key,
+		username:     username,
+		shopName:     receiptShopName(r),
+		purchaseDate: r.Date,
+		price:        r.Total,
+		receipt:      rcpt,
+	}
+	if p.purchaseDate.IsZero() {
+		p.purchaseDate = time.Now()
+	}
+
+	if !r.Complete() {
+		id := pending.Add(p, time.Now())
+		return fmt.Sprintf("Kuitista ei saatu luettua kaikkea. Vastaa tähän viestiin osto-komennolla, "+
+			"niin kuitti liitetään ostoon, %s:\n%s", username, prefillCommand(r)), nil, id
+	}
+	warning, stored := checkPurchase(ctx, store, p, anomalyConf)
+	if stored {
+		return "", nil, ""
+	}
+	if warning != "" {
+		warning += "\n"
+	}
+	id := pending.Add(p, time.Now())
+	return fmt.Sprintf("Kuitista luettiin:\n%s\n%sKirjaa se tai vastaa tähän viestiin korjatulla "+
+		"osto-komennolla, %s.", prefillCommand(r), warning, username), confirmKeyboard(id), id
+}
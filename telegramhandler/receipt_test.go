@@ -0,0 +1,162 @@
+package telegramhandler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"weezel/budget/blobstore"
+	"weezel/budget/confighandler"
+	"weezel/budget/dbengine/dbenginetest"
+	"weezel/budget/ocr"
+)
+
+// cannedOCR returns the same text for every image
+type cannedOCR struct {
+	text string
+	err  error
+}
+
+func (c cannedOCR) Text(context.Context, []byte) (string, error) {
+	return c.text, c.err
+}
+
+func TestPrefillCommand(t *testing.T) {
+	tests := []struct {
+		receipt ocr.Receipt
+		want    string
+	}{
+		{
+			ocr.Receipt{
+				Merchant: "K-Market Kalevanpuisto",
+				Date:     time.Date(2024, 2, 3, 0, 0, 0, 0, time.UTC),
+				Total:    5.3,
+			},
+			"osto K-Market 03-02-2024 5.30",
+		},
+		{ocr.Receipt{Merchant: "Lidl"}, "osto Lidl x.xx"},
+		{ocr.Receipt{Total: 12}, "osto kauppa 12.00"},
+	}
+	for _, tt := range tests {
+		if got := prefillCommand(tt.receipt); got != tt.want {
+			t.Errorf("prefillCommand(%+v) = %q, want %q", tt.receipt, got, tt.want)
+		}
+	}
+}
+
+func TestHandleReceiptScan(t *testing.T) {
+	ctx := context.Background()
+	store, _ := dbenginetest.NewStore()
+	blobs, err := blobstore.NewFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := cannedOCR{text: "K-Market Kalevanpuisto\n03.02.2024\nMAITO 1,19\nYHTEENSÄ 1,19\n"}
+	photo := []byte("\x89PNG\r\n\x1a\nkuitti")
+
+	anomalyConf := confighandler.Anomaly{MinSamples: 5}
+
+	msg, keyboard, _ := handleReceiptScan(ctx, store, engine, blobs, "telegram:1:1", "alice", []byte("teksti"),
+		anomalyConf)
+	if msg != "Kuitin tallennus epäonnistui" || keyboard != nil {
+		t.Errorf("text file: got message %q", msg)
+	}
+
+	msg, keyboard, id := handleReceiptScan(ctx, store, engine, blobs, "telegram:1:2", "alice", photo, anomalyConf)
+	if !strings.Contains(msg, "osto K-Market 03-02-2024 1.19") || strings.Contains(msg, "Oletko varma") ||
+		keyboard == nil || id == "" {
+		t.Fatalf("got message %q", msg)
+	}
+	confirm := *keyboard.InlineKeyboard[0][0].CallbackData
+	msg = handlePurchaseConfirmation(ctx, store, "alice", confirm)
+	if msg != "Ostosi ja kuitti on kirjattu, alice. Kiitos!" {
+		t.Errorf("confirm: got message %q", msg)
+	}
+	attachment, err := store.GetAttachmentByHash(ctx, blobstore.Hash(photo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expense, err := store.GetExpenseByID(ctx, attachment.ExpenseID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expense.ShopName != "K-Market" || expense.Price != 1.19 ||
+		expense.ExpenseDate.Format("02-01-2006") != "03-02-2024" {
+		t.Errorf("stored %+v", expense)
+	}
+
+	// Re-delivered photo is ignored
+	msg, keyboard, _ = handleReceiptScan(ctx, store, engine, blobs, "telegram:1:2", "alice", photo, anomalyConf)
+	if msg != "" || keyboard != nil {
+		t.Errorf("replay got message %q", msg)
+	}
+	// The same receipt sent again is asked to be confirmed
+	msg, keyboard, _ = handleReceiptScan(ctx, store, engine, blobs, "telegram:1:3", "alice", photo, anomalyConf)
+	if !strings.Contains(msg, "Oletko varma? K-Market 1.19€ on jo kirjattu hetki sitten") || keyboard == nil {
+		t.Errorf("duplicate receipt: got message %q", msg)
+	}
+}
+
+func TestHandleReceiptScanUnusualPrice(t *testing.T) {
+	ctx := context.Background()
+	store, _ := dbenginetest.NewStore()
+	addTestData(t, store)
+	blobs, err := blobstore.NewFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The decimal comma was lost
+	engine := cannedOCR{text: "Lidl\n03.03.2024\nYHTEENSÄ 1050,00\n"}
+	photo := []byte("\x89PNG\r\n\x1a\nlidl")
+
+	msg, keyboard, _ := handleReceiptScan(ctx, store, engine, blobs, "telegram:1:1", "alice", photo,
+		confighandler.Anomaly{MinSamples: 5})
+	if !strings.Contains(msg, "Oletko varma? Lidl 1050.00€ poikkeaa tavallisesta") || keyboard == nil {
+		t.Errorf("got message %q", msg)
+	}
+}
+
+func TestHandleReceiptScanCorrection(t *testing.T) {
+	ctx := context.Background()
+	store, _ := dbenginetest.NewStore()
+	blobs, err := blobstore.NewFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The reply is taken as the correction even when nothing could be read
+	engine := cannedOCR{err: errors.New("tesseract crashed")}
+	photo := []byte("\x89PNG\r\n\x1a\nsumea")
+
+	msg, keyboard, id := handleReceiptScan(ctx, store, engine, blobs, "telegram:1:1", "alice", photo,
+		confighandler.Anomaly{MinSamples: 5})
+	if !strings.HasPrefix(msg, "Kuitista ei saatu luettua kaikkea") ||
+		!strings.HasSuffix(msg, "osto kauppa x.xx") || keyboard != nil {
+		t.Fatalf("got message %q", msg)
+	}
+	pending.SetMessage(id, 100)
+
+	if _, ok := pending.TakeByMessage(100, "bob", time.Now()); ok {
+		t.Error("other user took the receipt")
+	}
+	held, ok := pending.TakeByMessage(100, "alice", time.Now())
+	if !ok || held.receipt == nil {
+		t.Fatalf("receipt wasn't held: %+v, %t", held, ok)
+	}
+	msg, _ = handlePurchase(ctx, store, "telegram:1:2", "Alepa", "7.20", "alice",
+		strings.Fields("osto Alepa #ruoka 7,20"), confighandler.Anomaly{MinSamples: 5}, held.receipt)
+	if msg != "Ostosi ja kuitti on kirjattu, alice. Kiitos!" {
+		t.Errorf("correction: got message %q", msg)
+	}
+	attachment, err := store.GetAttachmentByHash(ctx, blobstore.Hash(photo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expense, err := store.GetExpenseByID(ctx, attachment.ExpenseID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expense.ShopName != "Alepa" || expense.Price != 7.2 {
+		t.Errorf("stored %+v", expense)
+	}
+}
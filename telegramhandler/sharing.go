@@ -0,0 +1,84 @@
+package telegramhandler
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"weezel/budget/dbengine"
+	"weezel/budget/utils"
+)
+
+// owedPrefix marks the user owing the purchase, e.g. @bob
+const owedPrefix = "@"
+
+var (
+	errSharing     = errors.New("invalid sharing")
+	errUnknownUser = fmt.Errorf("%w: unknown user", errSharing)
+)
+
+// parseSharing splits the purchase into items by who pays them. #oma makes
+// the whole purchase personal and @user owed wholly by the user. Parts of the
+// price are given with #oma=x,xx and @user=x,xx, the rest of the price is
+// shared unless told otherwise. The tokens are the ones between the shop name
+// and the price. The @users must be in users, compared case-insensitively,
+// they're not checked when users is nil.
+func parseSharing(tokens []string, username string, users []string, price float64) ([]dbengine.ExpenseItem, error) {
+	var whole dbengine.Sharing
+	var items []dbengine.ExpenseItem
+	itemsSum := 0.0
+	for _, token := range tokens {
+		tag, rawPrice, isItem := strings.Cut(token, "=")
+		var sharing dbengine.Sharing
+		switch {
+		case strings.EqualFold(tag, utils.PersonalTag):
+			sharing = dbengine.Sharing{Mode: dbengine.SharingPersonal}
+		case strings.HasPrefix(tag, owedPrefix) && len(tag) > len(owedPrefix):
+			owedBy := strings.TrimPrefix(tag, owedPrefix)
+			if strings.EqualFold(owedBy, username) {
+				return nil, fmt.Errorf("%w: %s can't owe to themself", errSharing, username)
+			}
+			if users != nil {
+				i := slices.IndexFunc(users, func(u string) bool { return strings.EqualFold(u, owedBy) })
+				if i < 0 {
+					return nil, fmt.Errorf("%w %s", errUnknownUser, owedBy)
+				}
+				owedBy = users[i]
+			}
+			sharing = dbengine.Sharing{Mode: dbengine.SharingOwed, OwedBy: owedBy}
+		default:
+			continue
+		}
+
+		if !isItem {
+			if whole.Mode != "" && whole != sharing {
+				return nil, fmt.Errorf("%w: purchase is both %s and %s",
+					errSharing, whole.Mode, sharing.Mode)
+			}
+			whole = sharing
+			continue
+		}
+		itemPrice, err := strconv.ParseFloat(strings.ReplaceAll(rawPrice, ",", "."), 64)
+		if err != nil || itemPrice <= 0 {
+			return nil, fmt.Errorf("%w: price of %s", errSharing, token)
+		}
+		items = append(items, dbengine.ExpenseItem{Price: itemPrice, Sharing: sharing})
+		itemsSum += itemPrice
+	}
+	if len(items) == 0 {
+		return []dbengine.ExpenseItem{{Price: price, Sharing: whole}}, nil
+	}
+
+	// Cents are compared, the sums of floats are rarely exact
+	rest := math.Round((price-itemsSum)*100) / 100
+	if rest < 0 {
+		return nil, fmt.Errorf("%w: items sum up to %.2f, more than the price %.2f",
+			errSharing, itemsSum, price)
+	}
+	if rest > 0 {
+		items = append(items, dbengine.ExpenseItem{Price: rest, Sharing: whole})
+	}
+	return items, nil
+}
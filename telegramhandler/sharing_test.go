@@ -0,0 +1,206 @@
+package telegramhandler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"weezel/budget/confighandler"
+	"weezel/budget/dbengine"
+	"weezel/budget/dbengine/dbenginetest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseSharing(t *testing.T) {
+	personal := dbengine.Sharing{Mode: dbengine.SharingPersonal}
+	owedByBob := dbengine.Sharing{Mode: dbengine.SharingOwed, OwedBy: "bob"}
+	tests := []struct {
+		name    string
+		command string
+		want    []dbengine.ExpenseItem
+		wantErr bool
+	}{
+		{
+			name:    "shared",
+			command: "osto Lidl #ruoka 10,50",
+			want:    []dbengine.ExpenseItem{{Price: 10.5}},
+		},
+		{
+			name:    "personal",
+			command: "osto Lidl #oma 10,50",
+			want:    []dbengine.ExpenseItem{{Price: 10.5, Sharing: personal}},
+		},
+		{
+			name:    "owed by other user",
+			command: "osto Alko @bob 30",
+			want:    []dbengine.ExpenseItem{{Price: 30, Sharing: owedByBob}},
+		},
+		{
+			name:    "user in other case",
+			command: "osto Alko @Bob 30",
+			want:    []dbengine.ExpenseItem{{Price: 30, Sharing: owedByBob}},
+		},
+		{
+			name:    "items and shared rest",
+			command: "osto Lidl #ruoka #oma=2,50 @bob=3,10 20",
+			want: []dbengine.ExpenseItem{
+				{Price: 2.5, Sharing: personal},
+				{Price: 3.1, Sharing: owedByBob},
+				{Price: 14.4},
+			},
+		},
+		{
+			name:    "items and personal rest",
+			command: "osto Lidl #oma @bob=4 10",
+			want: []dbengine.ExpenseItem{
+				{Price: 4, Sharing: owedByBob},
+				{Price: 6, Sharing: personal},
+			},
+		},
+		{
+			name:    "items sum up to the price",
+			command: "osto Lidl @bob=4,20 #oma=5,80 10",
+			want: []dbengine.ExpenseItem{
+				{Price: 4.2, Sharing: owedByBob},
+				{Price: 5.8, Sharing: personal},
+			},
+		},
+		{name: "items over the price", command: "osto Lidl #oma=8 @bob=4 10", wantErr: true},
+		{name: "invalid item price", command: "osto Lidl #oma=kaksi 10", wantErr: true},
+		{name: "owed by self", command: "osto Lidl @alice 10", wantErr: true},
+		{name: "owed by self in other case", command: "osto Lidl @Alice 10", wantErr: true},
+		{name: "unknown user", command: "osto Lidl @bbo 10", wantErr: true},
+		{name: "unknown user item", command: "osto Lidl @bbo=2 10", wantErr: true},
+		{name: "personal and owed", command: "osto Lidl #oma @bob 10", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := strings.Fields(tt.command)
+			price, err := strconv.ParseFloat(strings.ReplaceAll(tokens[len(tokens)-1], ",", "."), 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseSharing(tokens[2:len(tokens)-1], "alice", []string{"alice", "bob"}, price)
+			if tt.wantErr {
+				if !errors.Is(err, errSharing) {
+					t.Errorf("parseSharing() returned %v, expected errSharing", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("parseSharing() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandlePurchaseItems(t *testing.T) {
+	ctx := context.Background()
+	store, _ := dbenginetest.NewStore()
+	anomalyConf := confighandler.Anomaly{MinSamples: 5}
+	for _, username := range []string{"alice", "bob"} {
+		if _, err := store.AddSalary(ctx, username, 2000, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msg, _ := handlePurchase(ctx, store, "telegram:1:1", "Lidl", "20", "alice",
+		strings.Fields("osto Lidl #ruoka #oma=2,50 @bob=3,10 20"), anomalyConf, nil)
+	if msg != "Ostosi on kirjattu, alice. Kiitos!" {
+		t.Fatalf("got message %q", msg)
+	}
+	msg, _ = handlePurchase(ctx, store, "telegram:1:2", "Lidl", "20", "alice",
+		strings.Fields("osto Lidl #oma=25 20"), anomalyConf, nil)
+	if !strings.HasPrefix(msg, "Virhe jaossa") {
+		t.Errorf("got message %q", msg)
+	}
+	msg, _ = handlePurchase(ctx, store, "telegram:1:3", "Lidl", "20", "alice",
+		strings.Fields("osto Lidl @bbo 20"), anomalyConf, nil)
+	if !strings.HasPrefix(msg, "Virhe jaossa, tuntematon käyttäjä") {
+		t.Errorf("unknown user got message %q", msg)
+	}
+
+	expenses, err := store.ListExpenses(ctx, dbengine.Filter{Sort: "price"}, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []dbengine.ExpenseItem
+	for _, e := range expenses {
+		if e.Category != "ruoka" || e.IdempotencyKey.String == "" {
+			t.Errorf("unexpected expense %+v", e)
+		}
+		got = append(got, dbengine.ExpenseItem{
+			Price:   e.Price,
+			Sharing: dbengine.Sharing{Mode: e.Sharing, OwedBy: e.OwedBy},
+		})
+	}
+	want := []dbengine.ExpenseItem{
+		{Price: 2.5, Sharing: dbengine.Sharing{Mode: dbengine.SharingPersonal}},
+		{Price: 3.1, Sharing: dbengine.Sharing{Mode: dbengine.SharingOwed, OwedBy: "bob"}},
+		{Price: 14.4, Sharing: dbengine.Sharing{Mode: dbengine.SharingShared}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("stored items mismatch (-want +got):\n%s", diff)
+	}
+
+	// Re-delivered message stores none of the items again
+	msg, _ = handlePurchase(ctx, store, "telegram:1:1", "Lidl", "20", "alice",
+		strings.Fields("osto Lidl #ruoka #oma=2,50 @bob=3,10 20"), anomalyConf, nil)
+	if msg != "" {
+		t.Errorf("replay got message %q", msg)
+	}
+
+}
+
+func TestHandlePurchaseItemsDuplicate(t *testing.T) {
+	ctx := context.Background()
+	store, _ := dbenginetest.NewStore()
+	anomalyConf := confighandler.Anomaly{MinSamples: 5}
+	if _, err := store.AddExpense(ctx, "alice", "Lidl", "ruoka", time.Now(), 5); err != nil {
+		t.Fatal(err)
+	}
+
+	// An item priced like an earlier purchase doesn't make it a duplicate
+	msg, kb := handlePurchase(ctx, store, "telegram:1:1", "Lidl", "20", "alice",
+		strings.Fields("osto Lidl #oma=5 20"), anomalyConf, nil)
+	if msg != "Ostosi on kirjattu, alice. Kiitos!" || kb != nil {
+		t.Errorf("got message %q", msg)
+	}
+
+	// The whole price is compared to the earlier purchases
+	if _, err := store.AddExpense(ctx, "alice", "Prisma", "ruoka", time.Now(), 30); err != nil {
+		t.Fatal(err)
+	}
+	msg, kb = handlePurchase(ctx, store, "telegram:1:2", "Prisma", "30", "alice",
+		strings.Fields("osto Prisma #oma=5 30"), anomalyConf, nil)
+	if !strings.HasPrefix(msg, "Oletko varma? Prisma 30.00€ on jo kirjattu") || kb == nil {
+		t.Errorf("near-duplicate got message %q", msg)
+	}
+}
+
+func TestHandlePurchaseShopNameWithAt(t *testing.T) {
+	ctx := context.Background()
+	store, _ := dbenginetest.NewStore()
+	if _, err := store.AddSalary(ctx, "alice", 2000, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, _ := handlePurchase(ctx, store, "telegram:1:1", "@Stockmann", "20", "alice",
+		strings.Fields("osto @Stockmann 20"), confighandler.Anomaly{MinSamples: 5}, nil)
+	if msg != "Ostosi on kirjattu, alice. Kiitos!" {
+		t.Fatalf("got message %q", msg)
+	}
+	expenses, err := store.ListExpenses(ctx, dbengine.Filter{}, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expenses) != 1 || expenses[0].Sharing != dbengine.SharingShared || expenses[0].OwedBy != "" {
+		t.Errorf("expected a shared purchase, got %+v", expenses)
+	}
+}
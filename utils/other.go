@@ -7,8 +7,14 @@ import (
 
 var categoryPattern = regexp.MustCompile(`^#[a-zA-Z1-9_-]+$`)
 
+// PersonalTag marks a purchase paid by the buyer alone, it's not a category
+const PersonalTag = "#oma"
+
 func GetCategory(tokens []string) string {
 	for _, token := range tokens {
+		if strings.EqualFold(token, PersonalTag) {
+			continue
+		}
 		if categoryPattern.MatchString(token) {
 			tmp := categoryPattern.FindString(token)
 			return strings.ReplaceAll(tmp, "#", "")
@@ -18,8 +18,13 @@ func TestGetCategory(t *testing.T) {
 		},
 		{
 			"Shopping with category",
-			args{[]string{"osto", "#oma", "lidl", "6.66"}},
-			"oma",
+			args{[]string{"osto", "#ruoka", "lidl", "6.66"}},
+			"ruoka",
+		},
+		{
+			"Personal shopping isn't a category",
+			args{[]string{"osto", "#oma", "lidl", "#ruoka", "6.66"}},
+			"ruoka",
 		},
 	}
 	for _, tt := range tests {
@@ -0,0 +1,605 @@
+package web
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"weezel/budget/db"
+	"weezel/budget/dbengine"
+	"weezel/budget/debtcontrol"
+	"weezel/budget/logger"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+	// topShopsCount limits how many shops are returned in the statistics
+	topShopsCount = 10
+	dateFormat    = "2006-01-02"
+	monthFormat   = "2006-01"
+)
+
+// OpenAPISpec describes the API. The client in apiclient is generated from it.
+//
+//go:embed openapi.json
+var OpenAPISpec []byte
+
+// Backend is the storage used by the API, same as the bot uses
+type Backend interface {
+	ListExpenses(ctx context.Context, filter dbengine.Filter, limit, offset int32) ([]*db.BudgetSchemaExpense, error)
+	GetExpenseByID(ctx context.Context, id int32) (*db.BudgetSchemaExpense, error)
+	AddExpense(
+		ctx context.Context,
+		username, shopName, category string,
+		expenseDate time.Time,
+		price float64,
+	) (int32, error)
+	UpdateExpenseByID(
+		ctx context.Context,
+		id int32,
+		username, shopName, category string,
+		expenseDate time.Time,
+		price float64,
+	) (*db.BudgetSchemaExpense, error)
+	DeleteExpenseByID(ctx context.Context, id int32, username string) (*db.BudgetSchemaExpense, error)
+
+	ListSalaries(ctx context.Context, filter dbengine.Filter, limit, offset int32) ([]*db.BudgetSchemaSalary, error)
+	GetSalaryByID(ctx context.Context, id int32) (*db.BudgetSchemaSalary, error)
+	AddSalary(ctx context.Context, username string, salary float64, storeDate time.Time) (int32, error)
+	UpdateSalaryByID(
+		ctx context.Context,
+		id int32,
+		username string,
+		salary float64,
+		storeDate time.Time,
+	) (*db.BudgetSchemaSalary, error)
+	DeleteSalaryByID(ctx context.Context, id int32, username string) (*db.BudgetSchemaSalary, error)
+
+	StatisticsByTimespan(ctx context.Context, startTime, endTime time.Time) ([]*db.StatisticsAggrByTimespanRow, error)
+	GetCategorySharesByTimespan(
+		ctx context.Context,
+		startTime, endTime time.Time,
+	) ([]*db.GetCategorySharesByTimespanRow, error)
+	GetTopShopsByTimespan(
+		ctx context.Context,
+		startTime, endTime time.Time,
+		shopLimit int32,
+	) ([]*db.GetTopShopsByTimespanRow, error)
+
+	ListAuditLog(ctx context.Context, limit, offset int32) ([]*db.BudgetSchemaAuditLog, error)
+
+	GetAttachmentByHash(ctx context.Context, hash string) (*db.BudgetSchemaAttachment, error)
+	ListAttachmentsByTimespan(
+		ctx context.Context,
+		startDate, endDate time.Time,
+	) ([]*db.ListAttachmentsByTimespanRow, error)
+}
+
+// *dbengine.Store is the Backend used outside the tests
+var _ Backend = (*dbengine.Store)(nil)
+
+// API is the versioned JSON API. Every request must carry a bearer token
+// and all the modifications are done in the name of the token's owner.
+type API struct {
+	backend Backend
+	// tokens maps usernames to their bearer tokens
+	tokens map[string]string
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Page is a paginated list. NextOffset is set only if there might be more items.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	Limit      int32  `json:"limit"`
+	Offset     int32  `json:"offset"`
+	NextOffset *int32 `json:"next_offset,omitempty"`
+}
+
+type ExpenseRequest struct {
+	ShopName    string  `json:"shop_name"`
+	Category    string  `json:"category"`
+	Price       float64 `json:"price"`
+	ExpenseDate string  `json:"expense_date"`
+}
+
+type SalaryRequest struct {
+	Salary    float64 `json:"salary"`
+	StoreDate string  `json:"store_date"`
+}
+
+type StatsResponse struct {
+	From           string                               `json:"from"`
+	To             string                               `json:"to"`
+	Statistics     []*db.StatisticsAggrByTimespanRow    `json:"statistics"`
+	CategoryShares []*db.GetCategorySharesByTimespanRow `json:"category_shares"`
+	TopShops       []*db.GetTopShopsByTimespanRow       `json:"top_shops"`
+}
+
+type Debt struct {
+	Username string  `json:"username"`
+	Month    string  `json:"month"`
+	Owes     float64 `json:"owes"`
+}
+
+func NewAPI(backend Backend, tokens map[string]string) *API {
+	return &API{
+		backend: backend,
+		tokens:  tokens,
+	}
+}
+
+type authenticatedHandler func(w http.ResponseWriter, r *http.Request, username string)
+
+type route struct {
+	pattern string
+	handler authenticatedHandler
+}
+
+// routes must match the paths in openapi.json
+func (a *API) routes() []route {
+	return []route{
+		{"GET /api/v1/expenses", a.listExpenses},
+		{"POST /api/v1/expenses", a.createExpense},
+		{"GET /api/v1/expenses/{id}", a.getExpense},
+		{"PUT /api/v1/expenses/{id}", a.updateExpense},
+		{"DELETE /api/v1/expenses/{id}", a.deleteExpense},
+
+		{"GET /api/v1/salaries", a.listSalaries},
+		{"POST /api/v1/salaries", a.createSalary},
+		{"GET /api/v1/salaries/{id}", a.getSalary},
+		{"PUT /api/v1/salaries/{id}", a.updateSalary},
+		{"DELETE /api/v1/salaries/{id}", a.deleteSalary},
+
+		{"GET /api/v1/stats", a.stats},
+		{"GET /api/v1/debts", a.debts},
+	}
+}
+
+// Register adds the API routes to the mux. The OpenAPI document is served
+// without authentication.
+func (a *API) Register(mux *http.ServeMux) {
+	for _, r := range a.routes() {
+		mux.HandleFunc(r.pattern, a.authenticate(r.handler))
+	}
+	mux.HandleFunc("GET /api/v1/openapi.json", serveOpenAPISpec)
+}
+
+// authenticate resolves the user from the bearer token. All the tokens are
+// compared in constant time so that timing doesn't reveal anything.
+func (a *API) authenticate(next authenticatedHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		username := ""
+		for user, userToken := range a.tokens {
+			if userToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(userToken)) == 1 {
+				username = user
+			}
+		}
+		if !found || username == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="budget"`)
+			writeError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+			return
+		}
+
+		next(w, r, username)
+	}
+}
+
+func serveOpenAPISpec(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(OpenAPISpec); err != nil {
+		logger.Errorf("couldn't write OpenAPI spec: %s", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Errorf("couldn't encode response: %s", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{Error: msg})
+}
+
+// writeBackendError hides the details of the database errors from the client
+func writeBackendError(w http.ResponseWriter, err error) {
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	logger.Error(err)
+	writeError(w, http.StatusInternalServerError, "internal error")
+}
+
+func parseID(r *http.Request) (int32, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 32)
+	if err != nil {
+		return 0, errors.New("id must be an integer")
+	}
+	return int32(id), nil
+}
+
+func parsePagination(r *http.Request) (int32, int32, error) {
+	limit := int64(defaultPageLimit)
+	offset := int64(0)
+	var err error
+
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		limit, err = strconv.ParseInt(raw, 10, 32)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return 0, 0, errors.New("limit must be between 1 and 500")
+		}
+	}
+	if raw := r.URL.Query().Get("offset"); raw != "" {
+		offset, err = strconv.ParseInt(raw, 10, 32)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must be a non-negative integer")
+		}
+	}
+
+	return int32(limit), int32(offset), nil
+}
+
+func parseFilter(r *http.Request) (dbengine.Filter, error) {
+	q := r.URL.Query()
+	filter := dbengine.Filter{
+		Username: q.Get("username"),
+		Category: q.Get("category"),
+	}
+
+	var err error
+	if raw := q.Get("from"); raw != "" {
+		if filter.StartDate, err = time.Parse(dateFormat, raw); err != nil {
+			return dbengine.Filter{}, errors.New("from must be in YYYY-MM-DD format")
+		}
+	}
+	if raw := q.Get("to"); raw != "" {
+		if filter.EndDate, err = time.Parse(dateFormat, raw); err != nil {
+			return dbengine.Filter{}, errors.New("to must be in YYYY-MM-DD format")
+		}
+	}
+
+	return filter, nil
+}
+
+// parseMonths parses the month range of the statistics, both ends are required
+func parseMonths(r *http.Request) (time.Time, time.Time, error) {
+	from, err := time.Parse(monthFormat, r.URL.Query().Get("from"))
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("from must be in YYYY-MM format")
+	}
+	to, err := time.Parse(monthFormat, r.URL.Query().Get("to"))
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("to must be in YYYY-MM format")
+	}
+	return from, to, nil
+}
+
+// parseDate parses an optional date, today is used if it's missing
+func parseDate(raw string) (time.Time, error) {
+	if raw == "" {
+		now := time.Now().UTC()
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC), nil
+	}
+	return time.Parse(dateFormat, raw)
+}
+
+func newPage[T any](items []T, limit, offset int32) Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	p := Page[T]{
+		Items:  items,
+		Limit:  limit,
+		Offset: offset,
+	}
+	if int32(len(items)) == limit {
+		next := offset + limit
+		p.NextOffset = &next
+	}
+	return p
+}
+
+func decodeExpense(r *http.Request) (ExpenseRequest, time.Time, error) {
+	var req ExpenseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return ExpenseRequest{}, time.Time{}, errors.New("malformed JSON body")
+	}
+	if strings.TrimSpace(req.ShopName) == "" {
+		return ExpenseRequest{}, time.Time{}, errors.New("shop_name is required")
+	}
+	if req.Price <= 0 {
+		return ExpenseRequest{}, time.Time{}, errors.New("price must be positive")
+	}
+	expenseDate, err := parseDate(req.ExpenseDate)
+	if err != nil {
+		return ExpenseRequest{}, time.Time{}, errors.New("expense_date must be in YYYY-MM-DD format")
+	}
+	return req, expenseDate, nil
+}
+
+func decodeSalary(r *http.Request) (SalaryRequest, time.Time, error) {
+	var req SalaryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return SalaryRequest{}, time.Time{}, errors.New("malformed JSON body")
+	}
+	if req.Salary <= 0 {
+		return SalaryRequest{}, time.Time{}, errors.New("salary must be positive")
+	}
+	storeDate, err := parseDate(req.StoreDate)
+	if err != nil {
+		return SalaryRequest{}, time.Time{}, errors.New("store_date must be in YYYY-MM-DD format")
+	}
+	return req, storeDate, nil
+}
+
+func (a *API) listExpenses(w http.ResponseWriter, r *http.Request, _ string) {
+	filter, err := parseFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	expenses, err := a.backend.ListExpenses(r.Context(), filter, limit, offset)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newPage(expenses, limit, offset))
+}
+
+func (a *API) getExpense(w http.ResponseWriter, r *http.Request, _ string) {
+	id, err := parseID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	expense, err := a.backend.GetExpenseByID(r.Context(), id)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, expense)
+}
+
+func (a *API) createExpense(w http.ResponseWriter, r *http.Request, username string) {
+	req, expenseDate, err := decodeExpense(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := a.backend.AddExpense(r.Context(), username, req.ShopName, req.Category, expenseDate, req.Price)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	logger.Infof("Purchased from %s [%s] with price %.2f by %s on %s via API, ID=%d",
+		req.ShopName, req.Category, req.Price, username, expenseDate.Format(dateFormat), id)
+
+	expense, err := a.backend.GetExpenseByID(r.Context(), id)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/api/v1/expenses/"+strconv.Itoa(int(id)))
+	writeJSON(w, http.StatusCreated, expense)
+}
+
+func (a *API) updateExpense(w http.ResponseWriter, r *http.Request, username string) {
+	id, err := parseID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	req, expenseDate, err := decodeExpense(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	expense, err := a.backend.UpdateExpenseByID(
+		r.Context(), id, username, req.ShopName, req.Category, expenseDate, req.Price)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	logger.Infof("Updated expense ID=%d by %s via API", id, username)
+	writeJSON(w, http.StatusOK, expense)
+}
+
+func (a *API) deleteExpense(w http.ResponseWriter, r *http.Request, username string) {
+	id, err := parseID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	expense, err := a.backend.DeleteExpenseByID(r.Context(), id, username)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	logger.Infof("Removed expense item ID=%d %s %.2f€ [%s] by %s via API",
+		expense.ID, expense.ShopName, expense.Price, expense.ExpenseDate, username)
+	writeJSON(w, http.StatusOK, expense)
+}
+
+func (a *API) listSalaries(w http.ResponseWriter, r *http.Request, _ string) {
+	filter, err := parseFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	salaries, err := a.backend.ListSalaries(r.Context(), filter, limit, offset)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newPage(salaries, limit, offset))
+}
+
+func (a *API) getSalary(w http.ResponseWriter, r *http.Request, _ string) {
+	id, err := parseID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	salary, err := a.backend.GetSalaryByID(r.Context(), id)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, salary)
+}
+
+func (a *API) createSalary(w http.ResponseWriter, r *http.Request, username string) {
+	req, storeDate, err := decodeSalary(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := a.backend.AddSalary(r.Context(), username, req.Salary, storeDate)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	logger.Infof("Inserted salary amount of %.2f by %s on %s via API, ID=%d",
+		req.Salary, username, storeDate.Format(dateFormat), id)
+
+	salary, err := a.backend.GetSalaryByID(r.Context(), id)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/api/v1/salaries/"+strconv.Itoa(int(id)))
+	writeJSON(w, http.StatusCreated, salary)
+}
+
+func (a *API) updateSalary(w http.ResponseWriter, r *http.Request, username string) {
+	id, err := parseID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	req, storeDate, err := decodeSalary(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	salary, err := a.backend.UpdateSalaryByID(r.Context(), id, username, req.Salary, storeDate)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	logger.Infof("Updated salary ID=%d by %s via API", id, username)
+	writeJSON(w, http.StatusOK, salary)
+}
+
+func (a *API) deleteSalary(w http.ResponseWriter, r *http.Request, username string) {
+	id, err := parseID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	salary, err := a.backend.DeleteSalaryByID(r.Context(), id, username)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	logger.Infof("Removed salary item ID=%d %s %.2f by %s via API",
+		salary.ID, salary.StoreDate, salary.Salary, username)
+	writeJSON(w, http.StatusOK, salary)
+}
+
+func (a *API) stats(w http.ResponseWriter, r *http.Request, _ string) {
+	from, to, err := parseMonths(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	stats, err := a.backend.StatisticsByTimespan(r.Context(), from, to)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	debtcontrol.FillDebts(stats)
+
+	shares, err := a.backend.GetCategorySharesByTimespan(r.Context(), from, to)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+
+	topShops, err := a.backend.GetTopShopsByTimespan(r.Context(), from, to, topShopsCount)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, StatsResponse{
+		From:           from.Format(monthFormat),
+		To:             to.Format(monthFormat),
+		Statistics:     stats,
+		CategoryShares: shares,
+		TopShops:       topShops,
+	})
+}
+
+func (a *API) debts(w http.ResponseWriter, r *http.Request, _ string) {
+	from, to, err := parseMonths(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	stats, err := a.backend.StatisticsByTimespan(r.Context(), from, to)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	debtcontrol.FillDebts(stats)
+
+	debts := []Debt{}
+	for _, s := range stats {
+		if s.Owes > 0 {
+			debts = append(debts, Debt{
+				Username: s.Username,
+				Month:    s.EventDate.Format(monthFormat),
+				Owes:     s.Owes,
+			})
+		}
+	}
+	writeJSON(w, http.StatusOK, debts)
+}
@@ -0,0 +1,501 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"weezel/budget/db"
+	"weezel/budget/dbengine"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jackc/pgx/v4"
+)
+
+type fakeBackend struct {
+	expenses []*db.BudgetSchemaExpense
+	salaries []*db.BudgetSchemaSalary
+	stats    []*db.StatisticsAggrByTimespanRow
+	audit    []*db.BudgetSchemaAuditLog
+	// attachments link to the expenses above
+	attachments []*db.BudgetSchemaAttachment
+	// lastFilter, lastLimit and lastOffset are from the latest list call
+	lastFilter dbengine.Filter
+	lastLimit  int32
+	lastOffset int32
+}
+
+func (f *fakeBackend) ListExpenses(
+	_ context.Context,
+	filter dbengine.Filter,
+	limit, offset int32,
+) ([]*db.BudgetSchemaExpense, error) {
+	f.lastFilter, f.lastLimit, f.lastOffset = filter, limit, offset
+	res := []*db.BudgetSchemaExpense{}
+	for _, e := range f.expenses {
+		if filter.Username != "" && e.Username != filter.Username {
+			continue
+		}
+		res = append(res, e)
+	}
+	if int(offset) >= len(res) {
+		return nil, nil
+	}
+	res = res[offset:]
+	if len(res) > int(limit) {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+func (f *fakeBackend) GetExpenseByID(_ context.Context, id int32) (*db.BudgetSchemaExpense, error) {
+	for _, e := range f.expenses {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (f *fakeBackend) AddExpense(
+	_ context.Context,
+	username, shopName, category string,
+	expenseDate time.Time,
+	price float64,
+) (int32, error) {
+	id := int32(len(f.expenses) + 1)
+	f.expenses = append(f.expenses, &db.BudgetSchemaExpense{
+		ID:          id,
+		Username:    username,
+		ShopName:    shopName,
+		Category:    category,
+		Price:       price,
+		ExpenseDate: expenseDate,
+	})
+	return id, nil
+}
+
+func (f *fakeBackend) UpdateExpenseByID(
+	_ context.Context,
+	id int32,
+	username, shopName, category string,
+	expenseDate time.Time,
+	price float64,
+) (*db.BudgetSchemaExpense, error) {
+	for _, e := range f.expenses {
+		if e.ID == id && e.Username == username {
+			e.ShopName, e.Category, e.ExpenseDate, e.Price = shopName, category, expenseDate, price
+			return e, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (f *fakeBackend) DeleteExpenseByID(_ context.Context, id int32, username string) (*db.BudgetSchemaExpense, error) {
+	for i, e := range f.expenses {
+		if e.ID == id && e.Username == username {
+			f.expenses = append(f.expenses[:i], f.expenses[i+1:]...)
+			return e, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (f *fakeBackend) ListSalaries(
+	_ context.Context,
+	filter dbengine.Filter,
+	limit, offset int32,
+) ([]*db.BudgetSchemaSalary, error) {
+	f.lastFilter, f.lastLimit, f.lastOffset = filter, limit, offset
+	return f.salaries, nil
+}
+
+func (f *fakeBackend) GetSalaryByID(_ context.Context, id int32) (*db.BudgetSchemaSalary, error) {
+	for _, s := range f.salaries {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (f *fakeBackend) AddSalary(_ context.Context, username string, salary float64, storeDate time.Time) (int32, error) {
+	id := int32(len(f.salaries) + 1)
+	f.salaries = append(f.salaries, &db.BudgetSchemaSalary{
+		ID:        id,
+		Username:  username,
+		Salary:    salary,
+		StoreDate: storeDate,
+	})
+	return id, nil
+}
+
+func (f *fakeBackend) UpdateSalaryByID(
+	_ context.Context,
+	id int32,
+	username string,
+	salary float64,
+	storeDate time.Time,
+) (*db.BudgetSchemaSalary, error) {
+	for _, s := range f.salaries {
+		if s.ID == id && s.Username == username {
+			s.Salary, s.StoreDate = salary, storeDate
+			return s, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (f *fakeBackend) DeleteSalaryByID(_ context.Context, id int32, username string) (*db.BudgetSchemaSalary, error) {
+	for i, s := range f.salaries {
+		if s.ID == id && s.Username == username {
+			f.salaries = append(f.salaries[:i], f.salaries[i+1:]...)
+			return s, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (f *fakeBackend) StatisticsByTimespan(_ context.Context, _, _ time.Time) ([]*db.StatisticsAggrByTimespanRow, error) {
+	return f.stats, nil
+}
+
+func (f *fakeBackend) GetCategorySharesByTimespan(
+	_ context.Context,
+	_, _ time.Time,
+) ([]*db.GetCategorySharesByTimespanRow, error) {
+	return nil, nil
+}
+
+func (f *fakeBackend) GetTopShopsByTimespan(
+	_ context.Context,
+	_, _ time.Time,
+	_ int32,
+) ([]*db.GetTopShopsByTimespanRow, error) {
+	return nil, nil
+}
+
+func (f *fakeBackend) ListAuditLog(_ context.Context, limit, offset int32) ([]*db.BudgetSchemaAuditLog, error) {
+	f.lastLimit, f.lastOffset = limit, offset
+	return f.audit, nil
+}
+
+func (f *fakeBackend) GetAttachmentByHash(_ context.Context, hash string) (*db.BudgetSchemaAttachment, error) {
+	for _, a := range f.attachments {
+		for _, e := range f.expenses {
+			if e.ID == a.ExpenseID && a.Hash == hash {
+				return a, nil
+			}
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (f *fakeBackend) ListAttachmentsByTimespan(
+	_ context.Context,
+	startDate, endDate time.Time,
+) ([]*db.ListAttachmentsByTimespanRow, error) {
+	rows := []*db.ListAttachmentsByTimespanRow{}
+	for _, a := range f.attachments {
+		for _, e := range f.expenses {
+			if e.ID == a.ExpenseID && !e.ExpenseDate.Before(startDate) && !e.ExpenseDate.After(endDate) {
+				rows = append(rows, &db.ListAttachmentsByTimespanRow{
+					ID:          a.ID,
+					ExpenseID:   a.ExpenseID,
+					Hash:        a.Hash,
+					ContentType: a.ContentType,
+					SizeBytes:   a.SizeBytes,
+				})
+			}
+		}
+	}
+	return rows, nil
+}
+
+func newTestServer(t *testing.T, backend Backend) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	NewAPI(backend, map[string]string{
+		"alice": "alicetoken",
+		"bob":   "bobtoken",
+	}).Register(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func doRequest(t *testing.T, method, url, token, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestAuthentication(t *testing.T) {
+	srv := newTestServer(t, &fakeBackend{})
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"No token", "", http.StatusUnauthorized},
+		{"Wrong token", "eve", http.StatusUnauthorized},
+		{"Valid token", "alicetoken", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(t, http.MethodGet, srv.URL+"/api/v1/expenses", tt.token, "")
+			if resp.StatusCode != tt.status {
+				t.Errorf("got status %d, expected %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestListExpensesPagination(t *testing.T) {
+	backend := &fakeBackend{}
+	for i := 0; i < 3; i++ {
+		_, _ = backend.AddExpense(context.Background(), "alice", "kauppa", "ruoka", time.Time{}, 10.0)
+	}
+	srv := newTestServer(t, backend)
+
+	tests := []struct {
+		name       string
+		query      string
+		status     int
+		items      int
+		nextOffset *int32
+	}{
+		{"Default limit", "", http.StatusOK, 3, nil},
+		{"Full page has next", "?limit=2", http.StatusOK, 2, ptr(int32(2))},
+		{"Last page", "?limit=2&offset=2", http.StatusOK, 1, nil},
+		{"Past the end", "?offset=10", http.StatusOK, 0, nil},
+		{"Too large limit", "?limit=501", http.StatusBadRequest, 0, nil},
+		{"Negative offset", "?offset=-1", http.StatusBadRequest, 0, nil},
+		{"Bad date", "?from=2023-13-01", http.StatusBadRequest, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(t, http.MethodGet, srv.URL+"/api/v1/expenses"+tt.query, "alicetoken", "")
+			if resp.StatusCode != tt.status {
+				t.Fatalf("got status %d, expected %d", resp.StatusCode, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var page Page[*db.BudgetSchemaExpense]
+			if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Items) != tt.items {
+				t.Errorf("got %d items, expected %d", len(page.Items), tt.items)
+			}
+			if diff := cmp.Diff(tt.nextOffset, page.NextOffset); diff != "" {
+				t.Errorf("next offset differs:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestListExpensesFilter(t *testing.T) {
+	backend := &fakeBackend{}
+	srv := newTestServer(t, backend)
+
+	resp := doRequest(t, http.MethodGet,
+		srv.URL+"/api/v1/expenses?username=bob&category=ruoka&from=2023-01-01&to=2023-01-31&limit=5&offset=10",
+		"alicetoken", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d", resp.StatusCode)
+	}
+
+	expected := dbengine.Filter{
+		Username:  "bob",
+		Category:  "ruoka",
+		StartDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2023, 1, 31, 0, 0, 0, 0, time.UTC),
+	}
+	if diff := cmp.Diff(expected, backend.lastFilter); diff != "" {
+		t.Errorf("filter differs:\n%s", diff)
+	}
+	if backend.lastLimit != 5 || backend.lastOffset != 10 {
+		t.Errorf("got limit %d and offset %d", backend.lastLimit, backend.lastOffset)
+	}
+}
+
+func TestExpenseLifecycle(t *testing.T) {
+	backend := &fakeBackend{}
+	srv := newTestServer(t, backend)
+
+	resp := doRequest(t, http.MethodPost, srv.URL+"/api/v1/expenses", "alicetoken",
+		`{"shop_name": "kauppa", "category": "ruoka", "price": 12.5, "expense_date": "2023-02-03"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create: got status %d", resp.StatusCode)
+	}
+	if loc := resp.Header.Get("Location"); loc != "/api/v1/expenses/1" {
+		t.Errorf("create: got location %q", loc)
+	}
+	var created db.BudgetSchemaExpense
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	expected := db.BudgetSchemaExpense{
+		ID:          1,
+		Username:    "alice",
+		ShopName:    "kauppa",
+		Category:    "ruoka",
+		Price:       12.5,
+		ExpenseDate: time.Date(2023, 2, 3, 0, 0, 0, 0, time.UTC),
+	}
+	if diff := cmp.Diff(expected, created); diff != "" {
+		t.Errorf("create: differs:\n%s", diff)
+	}
+
+	// Only the owner may modify the expense
+	resp = doRequest(t, http.MethodPut, srv.URL+"/api/v1/expenses/1", "bobtoken",
+		`{"shop_name": "kauppa", "price": 1}`)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("update by other user: got status %d", resp.StatusCode)
+	}
+
+	resp = doRequest(t, http.MethodPut, srv.URL+"/api/v1/expenses/1", "alicetoken",
+		`{"shop_name": "toinen kauppa", "category": "ruoka", "price": 13, "expense_date": "2023-02-04"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("update: got status %d", resp.StatusCode)
+	}
+	if backend.expenses[0].ShopName != "toinen kauppa" || backend.expenses[0].Price != 13 {
+		t.Errorf("update: not updated: %+v", backend.expenses[0])
+	}
+
+	resp = doRequest(t, http.MethodPut, srv.URL+"/api/v1/expenses/1", "alicetoken", `{"price": 13}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("update without shop: got status %d", resp.StatusCode)
+	}
+
+	resp = doRequest(t, http.MethodDelete, srv.URL+"/api/v1/expenses/1", "alicetoken", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("delete: got status %d", resp.StatusCode)
+	}
+
+	resp = doRequest(t, http.MethodGet, srv.URL+"/api/v1/expenses/1", "alicetoken", "")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("get deleted: got status %d", resp.StatusCode)
+	}
+	var errResp errorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+		t.Fatal(err)
+	}
+	if errResp.Error != "not found" {
+		t.Errorf("get deleted: got error %q", errResp.Error)
+	}
+
+	resp = doRequest(t, http.MethodGet, srv.URL+"/api/v1/expenses/abc", "alicetoken", "")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("get with bad id: got status %d", resp.StatusCode)
+	}
+}
+
+func TestExpenseValidation(t *testing.T) {
+	backend := &fakeBackend{}
+	srv := newTestServer(t, backend)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"Valid", http.MethodPost, "/api/v1/expenses", `{"shop_name": "kauppa", "price": 12.5}`,
+			http.StatusCreated},
+		{"Zero", http.MethodPost, "/api/v1/expenses", `{"shop_name": "kauppa", "price": 0}`,
+			http.StatusBadRequest},
+		{"Negative", http.MethodPost, "/api/v1/expenses", `{"shop_name": "kauppa", "price": -1}`,
+			http.StatusBadRequest},
+		{"Update to zero", http.MethodPut, "/api/v1/expenses/1", `{"shop_name": "kauppa", "price": 0}`,
+			http.StatusBadRequest},
+		{"Update to negative", http.MethodPut, "/api/v1/expenses/1", `{"shop_name": "kauppa", "price": -5}`,
+			http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(t, tt.method, srv.URL+tt.path, "alicetoken", tt.body)
+			if resp.StatusCode != tt.status {
+				t.Errorf("got status %d, expected %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+	if len(backend.expenses) != 1 || backend.expenses[0].Price != 12.5 {
+		t.Errorf("invalid prices were stored: %+v", backend.expenses)
+	}
+}
+
+func TestSalaryValidation(t *testing.T) {
+	srv := newTestServer(t, &fakeBackend{})
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"Valid", `{"salary": 3000, "store_date": "2023-01-15"}`, http.StatusCreated},
+		{"Negative", `{"salary": -1}`, http.StatusBadRequest},
+		{"Bad date", `{"salary": 3000, "store_date": "15-01-2023"}`, http.StatusBadRequest},
+		{"Malformed", `{"salary": `, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(t, http.MethodPost, srv.URL+"/api/v1/salaries", "bobtoken", tt.body)
+			if resp.StatusCode != tt.status {
+				t.Errorf("got status %d, expected %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestDebts(t *testing.T) {
+	month := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	backend := &fakeBackend{
+		stats: []*db.StatisticsAggrByTimespanRow{
+			{Username: "alice", EventDate: month, Salary: 1000, ExpensesSum: 400},
+			{Username: "bob", EventDate: month, Salary: 3000, ExpensesSum: 0},
+		},
+	}
+	srv := newTestServer(t, backend)
+
+	resp := doRequest(t, http.MethodGet, srv.URL+"/api/v1/debts?from=2023-01&to=2023-01", "alicetoken", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d", resp.StatusCode)
+	}
+	var debts []Debt
+	if err := json.NewDecoder(resp.Body).Decode(&debts); err != nil {
+		t.Fatal(err)
+	}
+	expected := []Debt{{Username: "bob", Month: "2023-01", Owes: 300}}
+	if diff := cmp.Diff(expected, debts); diff != "" {
+		t.Errorf("differs:\n%s", diff)
+	}
+
+	resp = doRequest(t, http.MethodGet, srv.URL+"/api/v1/debts?from=2023-01", "alicetoken", "")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("missing to: got status %d", resp.StatusCode)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,194 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// loginTokenTTL is how long a login link sent by the bot stays valid
+	loginTokenTTL = 10 * time.Minute
+	sessionTTL    = 12 * time.Hour
+	// telegramAuthMaxAge is how old Telegram Login Widget payloads are still accepted
+	telegramAuthMaxAge = 24 * time.Hour
+)
+
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		// Never happens on supported platforms, see crypto/rand
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+type loginToken struct {
+	username string
+	created  time.Time
+}
+
+// loginTokens holds the one-time login tokens issued through the bot
+type loginTokens struct {
+	lock   sync.Mutex
+	tokens map[string]loginToken
+}
+
+var issuedLoginTokens = loginTokens{
+	tokens: map[string]loginToken{},
+}
+
+// Issue returns a new token for the user. Expired tokens are dropped at the same time.
+func (l *loginTokens) Issue(username string, now time.Time) string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for token, lt := range l.tokens {
+		if now.Sub(lt.created) > loginTokenTTL {
+			delete(l.tokens, token)
+		}
+	}
+
+	token := randomToken()
+	l.tokens[token] = loginToken{
+		username: username,
+		created:  now,
+	}
+	return token
+}
+
+// Redeem removes the token and returns its user. False is returned if the token
+// doesn't exist or has already expired.
+func (l *loginTokens) Redeem(token string, now time.Time) (string, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	lt, ok := l.tokens[token]
+	if !ok {
+		return "", false
+	}
+	delete(l.tokens, token)
+	if now.Sub(lt.created) > loginTokenTTL {
+		return "", false
+	}
+	return lt.username, true
+}
+
+// IssueLoginToken returns a one-time token for signing in to the web UI
+func IssueLoginToken(username string) string {
+	return issuedLoginTokens.Issue(username, time.Now())
+}
+
+type session struct {
+	username string
+	// csrf must be posted with every form of the session
+	csrf    string
+	expires time.Time
+}
+
+type sessions struct {
+	lock     sync.Mutex
+	sessions map[string]session
+}
+
+func newSessions() *sessions {
+	return &sessions{
+		sessions: map[string]session{},
+	}
+}
+
+// Create starts a new session and returns its ID. Expired sessions are dropped at the same time.
+func (s *sessions) Create(username string, now time.Time) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for id, sess := range s.sessions {
+		if now.After(sess.expires) {
+			delete(s.sessions, id)
+		}
+	}
+
+	id := randomToken()
+	s.sessions[id] = session{
+		username: username,
+		csrf:     randomToken(),
+		expires:  now.Add(sessionTTL),
+	}
+	return id
+}
+
+func (s *sessions) Get(id string, now time.Time) (session, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok {
+		return session{}, false
+	}
+	if now.After(sess.expires) {
+		delete(s.sessions, id)
+		return session{}, false
+	}
+	return sess, true
+}
+
+func (s *sessions) Delete(id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.sessions, id)
+}
+
+// verifyTelegramLogin checks the payload signed by Telegram Login Widget and
+// returns the username in the same form as the bot sees it. The algorithm is
+// described in https://core.telegram.org/widgets/login#checking-authorization
+func verifyTelegramLogin(values url.Values, botToken string, now time.Time) (string, error) {
+	hash := values.Get("hash")
+	if hash == "" || botToken == "" {
+		return "", errors.New("missing hash")
+	}
+
+	fields := []string{}
+	for key := range values {
+		if key != "hash" {
+			fields = append(fields, key+"="+values.Get(key))
+		}
+	}
+	sort.Strings(fields)
+	dataCheckString := strings.Join(fields, "\n")
+
+	secret := sha256.Sum256([]byte(botToken))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write([]byte(dataCheckString))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(hash))) {
+		return "", errors.New("invalid hash")
+	}
+
+	authDate, err := strconv.ParseInt(values.Get("auth_date"), 10, 64)
+	if err != nil {
+		return "", errors.New("invalid auth_date")
+	}
+	if now.Sub(time.Unix(authDate, 0)) > telegramAuthMaxAge {
+		return "", errors.New("expired payload")
+	}
+
+	// Same as tgbotapi.User.String(), which the bot uses for usernames
+	if username := values.Get("username"); username != "" {
+		return username, nil
+	}
+	name := values.Get("first_name")
+	if lastName := values.Get("last_name"); lastName != "" {
+		name += " " + lastName
+	}
+	return name, nil
+}
@@ -0,0 +1,138 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginTokens(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	l := loginTokens{tokens: map[string]loginToken{}}
+
+	token := l.Issue("alice", now)
+	if username, ok := l.Redeem(token, now.Add(time.Minute)); !ok || username != "alice" {
+		t.Errorf("Redeem() = %q, %t", username, ok)
+	}
+	if _, ok := l.Redeem(token, now); ok {
+		t.Errorf("Redeem() succeeded twice")
+	}
+
+	token = l.Issue("alice", now)
+	if _, ok := l.Redeem(token, now.Add(loginTokenTTL+time.Second)); ok {
+		t.Errorf("Redeem() of expired token succeeded")
+	}
+
+	l.Issue("alice", now)
+	l.Issue("alice", now.Add(loginTokenTTL+time.Second))
+	if len(l.tokens) != 1 {
+		t.Errorf("Issue() didn't drop expired tokens, %d left", len(l.tokens))
+	}
+}
+
+func TestSessions(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	s := newSessions()
+
+	id := s.Create("alice", now)
+	sess, ok := s.Get(id, now.Add(time.Hour))
+	if !ok || sess.username != "alice" || sess.csrf == "" {
+		t.Errorf("Get() = %+v, %t", sess, ok)
+	}
+	if _, ok = s.Get(id, now.Add(sessionTTL+time.Second)); ok {
+		t.Errorf("Get() of expired session succeeded")
+	}
+
+	id = s.Create("alice", now)
+	s.Delete(id)
+	if _, ok = s.Get(id, now); ok {
+		t.Errorf("Get() of deleted session succeeded")
+	}
+}
+
+// signTelegramLogin signs the values like Telegram does
+func signTelegramLogin(values url.Values, botToken string) {
+	fields := []string{}
+	for key := range values {
+		fields = append(fields, key+"="+values.Get(key))
+	}
+	sort.Strings(fields)
+	secret := sha256.Sum256([]byte(botToken))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write([]byte(strings.Join(fields, "\n")))
+	values.Set("hash", hex.EncodeToString(mac.Sum(nil)))
+}
+
+func TestVerifyTelegramLogin(t *testing.T) {
+	const botToken = "123456:abcdef"
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	authDate := strconv.FormatInt(now.Add(-time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name     string
+		values   url.Values
+		sign     bool
+		tamper   bool
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "Username",
+			values:   url.Values{"id": {"42"}, "first_name": {"Alice"}, "username": {"alice"}, "auth_date": {authDate}},
+			sign:     true,
+			expected: "alice",
+		},
+		{
+			name:     "No username",
+			values:   url.Values{"id": {"42"}, "first_name": {"Alice"}, "last_name": {"Smith"}, "auth_date": {authDate}},
+			sign:     true,
+			expected: "Alice Smith",
+		},
+		{
+			name:    "Unsigned",
+			values:  url.Values{"id": {"42"}, "username": {"alice"}, "auth_date": {authDate}},
+			wantErr: true,
+		},
+		{
+			name:    "Tampered",
+			values:  url.Values{"id": {"42"}, "username": {"alice"}, "auth_date": {authDate}},
+			sign:    true,
+			tamper:  true,
+			wantErr: true,
+		},
+		{
+			name: "Expired",
+			values: url.Values{
+				"id":        {"42"},
+				"username":  {"alice"},
+				"auth_date": {strconv.FormatInt(now.Add(-telegramAuthMaxAge-time.Hour).Unix(), 10)},
+			},
+			sign:    true,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.sign {
+				signTelegramLogin(tt.values, botToken)
+			}
+			if tt.tamper {
+				tt.values.Set("username", "mallory")
+			}
+
+			got, err := verifyTelegramLogin(tt.values, botToken, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyTelegramLogin() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("got %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
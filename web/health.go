@@ -0,0 +1,137 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// checkTimeout limits a single check, so that a hung dependency fails the
+// check instead of the healthcheck of the container
+const checkTimeout = 3 * time.Second
+
+const (
+	statusOK   = "ok"
+	statusFail = "fail"
+)
+
+// Check returns an error when the component is unhealthy. The detail is
+// shown in the response either way.
+type Check func(ctx context.Context) (string, error)
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// CheckResult is the outcome of a single check
+type CheckResult struct {
+	Status     string `json:"status"`
+	Detail     string `json:"detail,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// HealthResponse is served by /healthz and /readyz. Checks are left out on
+// the public listener.
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Health serves /healthz for liveness and /readyz for readiness. Liveness
+// checks tell whether the process should be restarted, readiness checks also
+// cover the dependencies like the database.
+type Health struct {
+	liveness  []namedCheck
+	readiness []namedCheck
+}
+
+func NewHealth() *Health {
+	return &Health{}
+}
+
+// AddLiveness adds a check to both /healthz and /readyz
+func (h *Health) AddLiveness(name string, check Check) {
+	h.liveness = append(h.liveness, namedCheck{name: name, check: check})
+}
+
+// AddReadiness adds a check to /readyz
+func (h *Health) AddReadiness(name string, check Check) {
+	h.readiness = append(h.readiness, namedCheck{name: name, check: check})
+}
+
+// Register adds the routes with the results of each check to the mux
+func (h *Health) Register(mux *http.ServeMux) {
+	h.register(mux, false)
+}
+
+// RegisterSummary adds the routes answering only with the overall status to
+// the mux. The errors of the checks may reveal e.g. the database host, so
+// they're not served on the public listener.
+func (h *Health) RegisterSummary(mux *http.ServeMux) {
+	h.register(mux, true)
+}
+
+func (h *Health) register(mux *http.ServeMux, summary bool) {
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		h.serve(w, r, h.liveness, summary)
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		h.serve(w, r, append(append([]namedCheck{}, h.liveness...), h.readiness...), summary)
+	})
+}
+
+// run executes the checks concurrently
+func run(ctx context.Context, checks []namedCheck) HealthResponse {
+	resp := HealthResponse{
+		Status: statusOK,
+		Checks: map[string]CheckResult{},
+	}
+
+	lock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c namedCheck) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+			started := time.Now()
+			detail, err := c.check(checkCtx)
+			result := CheckResult{
+				Status:     statusOK,
+				Detail:     detail,
+				DurationMS: time.Since(started).Milliseconds(),
+			}
+			if err != nil {
+				result.Status = statusFail
+				result.Error = err.Error()
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+			resp.Checks[c.name] = result
+			if err != nil {
+				resp.Status = statusFail
+			}
+		}(c)
+	}
+	wg.Wait()
+	return resp
+}
+
+func (h *Health) serve(w http.ResponseWriter, r *http.Request, checks []namedCheck, summary bool) {
+	resp := run(r.Context(), checks)
+	status := http.StatusOK
+	if resp.Status != statusOK {
+		status = http.StatusServiceUnavailable
+	}
+	if summary {
+		resp.Checks = nil
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, resp)
+}
@@ -0,0 +1,144 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestHealth(t *testing.T) {
+	dbErr := errors.New("connection refused")
+	dbDown := false
+
+	health := NewHealth()
+	health.AddLiveness("telegram", func(context.Context) (string, error) {
+		return "last update 5s ago", nil
+	})
+	health.AddReadiness("database", func(context.Context) (string, error) {
+		if dbDown {
+			return "", dbErr
+		}
+		return "1/2 connections in use", nil
+	})
+	mux := http.NewServeMux()
+	health.Register(mux)
+
+	tests := []struct {
+		name       string
+		path       string
+		dbDown     bool
+		wantStatus int
+		want       HealthResponse
+	}{
+		{
+			name:       "alive",
+			path:       "/healthz",
+			wantStatus: http.StatusOK,
+			want: HealthResponse{
+				Status: statusOK,
+				Checks: map[string]CheckResult{
+					"telegram": {Status: statusOK, Detail: "last update 5s ago"},
+				},
+			},
+		},
+		{
+			name:       "ready",
+			path:       "/readyz",
+			wantStatus: http.StatusOK,
+			want: HealthResponse{
+				Status: statusOK,
+				Checks: map[string]CheckResult{
+					"telegram": {Status: statusOK, Detail: "last update 5s ago"},
+					"database": {Status: statusOK, Detail: "1/2 connections in use"},
+				},
+			},
+		},
+		{
+			name:       "database down doesn't affect liveness",
+			path:       "/healthz",
+			dbDown:     true,
+			wantStatus: http.StatusOK,
+			want: HealthResponse{
+				Status: statusOK,
+				Checks: map[string]CheckResult{
+					"telegram": {Status: statusOK, Detail: "last update 5s ago"},
+				},
+			},
+		},
+		{
+			name:       "not ready",
+			path:       "/readyz",
+			dbDown:     true,
+			wantStatus: http.StatusServiceUnavailable,
+			want: HealthResponse{
+				Status: statusFail,
+				Checks: map[string]CheckResult{
+					"telegram": {Status: statusOK, Detail: "last update 5s ago"},
+					"database": {Status: statusFail, Error: dbErr.Error()},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbDown = tt.dbDown
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d", w.Code)
+			}
+			got := HealthResponse{}
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got, cmpopts.IgnoreFields(CheckResult{}, "DurationMS")); diff != "" {
+				t.Errorf("response differs:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHealthCheckTimeout(t *testing.T) {
+	health := NewHealth()
+	health.AddReadiness("hung", func(ctx context.Context) (string, error) {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(time.Minute):
+			return "", nil
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	resp := run(ctx, health.readiness)
+	if resp.Status != statusFail {
+		t.Errorf("got status %s for a hung check", resp.Status)
+	}
+}
+
+func TestHealthSummary(t *testing.T) {
+	health := NewHealth()
+	health.AddReadiness("database", func(context.Context) (string, error) {
+		return "", errors.New("failed to connect to `host=db user=budget database=budget`")
+	})
+	mux := http.NewServeMux()
+	health.RegisterSummary(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d", w.Code)
+	}
+	if got := w.Body.String(); got != `{"status":"fail"}`+"\n" {
+		t.Errorf("got body %s", got)
+	}
+}
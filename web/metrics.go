@@ -0,0 +1,80 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"weezel/budget/metrics"
+)
+
+var requestDuration = metrics.NewHistogram(
+	"budget_http_request_duration_seconds",
+	"Duration of the HTTP requests.",
+	metrics.DefaultBuckets,
+	"method", "route", "code")
+
+// metricRoutes are the first path segments used as route labels. Others are
+// counted together, so that scanners can't grow the label values.
+var metricRoutes = map[string]bool{
+	"statistics": true,
+	"report":     true,
+	"ui":         true,
+	"api":        true,
+	"metrics":    true,
+	"healthz":    true,
+	"readyz":     true,
+}
+
+func routeLabel(path string) string {
+	segment, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if metricRoutes[segment] {
+		return "/" + segment
+	}
+	return "other"
+}
+
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "other"
+}
+
+// statusRecorder remembers the status code written by the handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// InstrumentHandler records the duration and status of every request
+func InstrumentHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		requestDuration.Observe(time.Since(started).Seconds(),
+			methodLabel(r.Method), routeLabel(r.URL.Path), strconv.Itoa(status))
+	})
+}
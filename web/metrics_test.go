@@ -0,0 +1,42 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouteLabel(t *testing.T) {
+	tests := map[string]string{
+		"/statistics":        "/statistics",
+		"/api/v1/expenses/3": "/api",
+		"/ui/":               "/ui",
+		"/":                  "other",
+		"/wp-login.php":      "other",
+	}
+	for path, want := range tests {
+		if got := routeLabel(path); got != want {
+			t.Errorf("routeLabel(%q) = %q, expected %q", path, got, want)
+		}
+	}
+}
+
+func TestInstrumentHandler(t *testing.T) {
+	handler := InstrumentHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/report" {
+			http.Error(w, "gone", http.StatusGone)
+		}
+	}))
+
+	before := requestDuration.Count(http.MethodGet, "/report", "410")
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/report", nil))
+	if got := requestDuration.Count(http.MethodGet, "/report", "410"); got != before+1 {
+		t.Errorf("got %d observations, expected %d", got, before+1)
+	}
+
+	before = requestDuration.Count(http.MethodGet, "/healthz", "200")
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if got := requestDuration.Count(http.MethodGet, "/healthz", "200"); got != before+1 {
+		t.Error("implicit 200 was not recorded")
+	}
+}
@@ -0,0 +1,176 @@
+package web
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxRequestBytes limits request bodies, forms and JSON are tiny
+	DefaultMaxRequestBytes int64 = 1 << 20
+	// hstsMaxAge is one year, as recommended by https://hstspreload.org
+	hstsMaxAge = "max-age=31536000; includeSubDomains"
+	// Pages are rendered on the server and styled inline. Telegram Login Widget
+	// needs its script and the iframe it opens.
+	contentSecurityPolicy = "default-src 'none'; " +
+		"style-src 'unsafe-inline'; " +
+		"img-src 'self' data:; " +
+		"script-src https://telegram.org; " +
+		"frame-src https://oauth.telegram.org; " +
+		"form-action 'self'; " +
+		"frame-ancestors 'none'; " +
+		"base-uri 'none'"
+
+	// Page lookups allowed per client: a burst and then one every few seconds.
+	// Enough for people, too little for guessing page tokens or PINs.
+	pageLookupBurst    = 10
+	pageLookupInterval = 6 * time.Second
+	// rateLimitIdle is how long an idle client is remembered
+	rateLimitIdle = 10 * time.Minute
+)
+
+// redactedHeaders carry credentials and must not end up in the logs
+var redactedHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"Proxy-Authorization",
+}
+
+// noStorePrefixes are paths whose responses contain the budget data
+var noStorePrefixes = []string{
+	"/statistics",
+	"/report",
+	"/ui/",
+	"/api/",
+}
+
+// SecureHandler adds the security headers to all responses and limits the
+// size of request bodies to maxRequestBytes
+func SecureHandler(next http.Handler, maxRequestBytes int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Security-Policy", contentSecurityPolicy)
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "no-referrer")
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			h.Set("Strict-Transport-Security", hstsMaxAge)
+		}
+		for _, prefix := range noStorePrefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				h.Set("Cache-Control", "private, no-store")
+				break
+			}
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redactHeaders returns a copy of the headers with credentials hidden
+func redactHeaders(header http.Header) http.Header {
+	redacted := header.Clone()
+	for _, name := range redactedHeaders {
+		if _, found := redacted[name]; found {
+			redacted[name] = []string{"[REDACTED]"}
+		}
+	}
+	return redacted
+}
+
+// clientIP returns the address of the client. Behind a reverse proxy the
+// proxy appends the client to X-Forwarded-For, so the last entry is the one
+// to trust. The other entries are set by the client.
+func clientIP(r *http.Request, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if last := strings.TrimSpace(hops[len(hops)-1]); last != "" {
+				return last
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is a token bucket per client
+type rateLimiter struct {
+	lock     sync.Mutex
+	burst    float64
+	interval time.Duration
+	buckets  map[string]*bucket
+}
+
+func newRateLimiter(burst int, interval time.Duration) *rateLimiter {
+	return &rateLimiter{
+		burst:    float64(burst),
+		interval: interval,
+		buckets:  map[string]*bucket{},
+	}
+}
+
+// Allow takes a token from the client's bucket. Idle clients are dropped at the same time.
+func (l *rateLimiter) Allow(client string, now time.Time) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > rateLimitIdle {
+			delete(l.buckets, key)
+		}
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+float64(now.Sub(b.last))/float64(l.interval))
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// PageHandler serves the short-lived pages, see LoadPage. Lookups are rate
+// limited per client to stop guessing the page tokens and PINs.
+type PageHandler struct {
+	limiter           *rateLimiter
+	trustForwardedFor bool
+}
+
+// NewPageHandler returns the handler. trustForwardedFor must be set only when
+// running behind a reverse proxy which sets X-Forwarded-For.
+func NewPageHandler(trustForwardedFor bool) *PageHandler {
+	return &PageHandler{
+		limiter:           newRateLimiter(pageLookupBurst, pageLookupInterval),
+		trustForwardedFor: trustForwardedFor,
+	}
+}
+
+func (p *PageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ip := clientIP(r, p.trustForwardedFor)
+	if !p.limiter.Allow(ip, time.Now()) {
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+	APIHandler(w, r)
+}
@@ -0,0 +1,193 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSecureHandlerHeaders(t *testing.T) {
+	handler := SecureHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), 100)
+
+	tests := []struct {
+		name        string
+		path        string
+		forwardedTo string
+		wantCache   string
+		wantHSTS    string
+	}{
+		{
+			name:      "statistics page",
+			path:      "/statistics?page_hash=abc",
+			wantCache: "private, no-store",
+		},
+		{
+			name:      "UI",
+			path:      "/ui/expenses",
+			wantCache: "private, no-store",
+		},
+		{
+			name:      "API",
+			path:      "/api/v1/openapi.json",
+			wantCache: "private, no-store",
+		},
+		{
+			name: "not a data page",
+			path: "/favicon.ico",
+		},
+		{
+			name:        "behind TLS proxy",
+			path:        "/report",
+			forwardedTo: "https",
+			wantCache:   "private, no-store",
+			wantHSTS:    hstsMaxAge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.forwardedTo != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.forwardedTo)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			h := w.Result().Header
+			if h.Get("Content-Security-Policy") != contentSecurityPolicy {
+				t.Errorf("got CSP %q", h.Get("Content-Security-Policy"))
+			}
+			if h.Get("X-Frame-Options") != "DENY" {
+				t.Errorf("got X-Frame-Options %q", h.Get("X-Frame-Options"))
+			}
+			if h.Get("Cache-Control") != tt.wantCache {
+				t.Errorf("got Cache-Control %q", h.Get("Cache-Control"))
+			}
+			if h.Get("Strict-Transport-Security") != tt.wantHSTS {
+				t.Errorf("got HSTS %q", h.Get("Strict-Transport-Security"))
+			}
+		})
+	}
+}
+
+func TestSecureHandlerLimitsBody(t *testing.T) {
+	var readErr error
+	handler := SecureHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = io.ReadAll(r.Body)
+	}), 10)
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("x", 11)))
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if readErr == nil {
+		t.Error("expected an error for too large body")
+	}
+}
+
+func TestRedactHeaders(t *testing.T) {
+	header := http.Header{
+		"Authorization": {"Bearer s3cr3t"},
+		"Cookie":        {"budget_session=abc"},
+		"Accept":        {"text/html"},
+	}
+	got := redactHeaders(header)
+
+	expected := http.Header{
+		"Authorization": {"[REDACTED]"},
+		"Cookie":        {"[REDACTED]"},
+		"Accept":        {"text/html"},
+	}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("headers differ:\n%s", diff)
+	}
+	if header.Get("Authorization") != "Bearer s3cr3t" {
+		t.Error("original headers were modified")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		forwarded string
+		trust     bool
+		want      string
+	}{
+		{
+			name: "remote address",
+			want: "192.0.2.1",
+		},
+		{
+			name:      "forwarded but not trusted",
+			forwarded: "198.51.100.7",
+			want:      "192.0.2.1",
+		},
+		{
+			name:      "trusted proxy",
+			forwarded: "203.0.113.9, 198.51.100.7",
+			trust:     true,
+			want:      "198.51.100.7",
+		},
+		{
+			name:  "trusted but missing",
+			trust: true,
+			want:  "192.0.2.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = "192.0.2.1:4321"
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := clientIP(r, tt.trust); got != tt.want {
+				t.Errorf("got %q, expected %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(2, time.Second)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if !limiter.Allow("a", now) {
+			t.Fatalf("request %d was limited", i)
+		}
+	}
+	if limiter.Allow("a", now) {
+		t.Error("burst was exceeded")
+	}
+	if !limiter.Allow("b", now) {
+		t.Error("other clients must not be limited")
+	}
+	if !limiter.Allow("a", now.Add(time.Second)) {
+		t.Error("bucket wasn't refilled")
+	}
+	if limiter.Allow("a", now.Add(time.Second)) {
+		t.Error("bucket was refilled too much")
+	}
+
+	limiter.Allow("c", now.Add(2*rateLimitIdle))
+	if len(limiter.buckets) != 1 {
+		t.Errorf("idle clients were not dropped: %d buckets", len(limiter.buckets))
+	}
+}
+
+func TestPageHandlerRateLimit(t *testing.T) {
+	handler := NewPageHandler(false)
+
+	var status int
+	for i := 0; i <= pageLookupBurst; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/statistics?page_hash=guess", nil))
+		status = w.Result().StatusCode
+	}
+	if status != http.StatusTooManyRequests {
+		t.Errorf("got %d after the burst", status)
+	}
+}
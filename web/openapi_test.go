@@ -0,0 +1,153 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"weezel/budget/db"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type specSchema struct {
+	Type       string                `json:"type"`
+	Format     string                `json:"format"`
+	Ref        string                `json:"$ref"`
+	Items      *specSchema           `json:"items"`
+	Properties map[string]specSchema `json:"properties"`
+}
+
+type spec struct {
+	Servers []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]specSchema `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadSpec(t *testing.T) spec {
+	t.Helper()
+	var s spec
+	if err := json.Unmarshal(OpenAPISpec, &s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSpecMatchesRoutes(t *testing.T) {
+	s := loadSpec(t)
+	basePath := s.Servers[0].URL
+
+	var documented []string
+	for path, ops := range s.Paths {
+		for method := range ops {
+			if method == "parameters" {
+				continue
+			}
+			documented = append(documented, strings.ToUpper(method)+" "+basePath+path)
+		}
+	}
+	sort.Strings(documented)
+
+	var registered []string
+	for _, r := range NewAPI(&fakeBackend{}, nil).routes() {
+		registered = append(registered, r.pattern)
+	}
+	sort.Strings(registered)
+
+	if diff := cmp.Diff(documented, registered); diff != "" {
+		t.Errorf("documented and registered routes differ:\n%s", diff)
+	}
+}
+
+// specKind tells what kind of schema the Go type should be described with
+func specKind(typ reflect.Type) string {
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ == reflect.TypeOf(time.Time{}) {
+		return "string"
+	}
+	switch typ.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Int32, reflect.Int64:
+		return "integer"
+	case reflect.Float64:
+		return "number"
+	case reflect.Slice:
+		return "array"
+	}
+	return typ.Kind().String()
+}
+
+func TestSpecMatchesModels(t *testing.T) {
+	s := loadSpec(t)
+
+	models := map[string]any{
+		"Error":          errorResponse{},
+		"Expense":        db.BudgetSchemaExpense{},
+		"ExpenseRequest": ExpenseRequest{},
+		"ExpensePage":    Page[*db.BudgetSchemaExpense]{},
+		"Salary":         db.BudgetSchemaSalary{},
+		"SalaryRequest":  SalaryRequest{},
+		"SalaryPage":     Page[*db.BudgetSchemaSalary]{},
+		"Statistics":     db.StatisticsAggrByTimespanRow{},
+		"CategoryShare":  db.GetCategorySharesByTimespanRow{},
+		"TopShop":        db.GetTopShopsByTimespanRow{},
+		"Stats":          StatsResponse{},
+		"Debt":           Debt{},
+	}
+	if len(models) != len(s.Components.Schemas) {
+		t.Errorf("got %d schemas, expected %d", len(s.Components.Schemas), len(models))
+	}
+
+	for name, model := range models {
+		t.Run(name, func(t *testing.T) {
+			schema, found := s.Components.Schemas[name]
+			if !found {
+				t.Fatalf("schema %s is missing", name)
+			}
+
+			expected := map[string]string{}
+			typ := reflect.TypeOf(model)
+			for i := 0; i < typ.NumField(); i++ {
+				field := typ.Field(i)
+				tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+				if tag == "-" {
+					// Not serialized, e.g. deleted_at of soft deleted rows
+					continue
+				}
+				expected[tag] = specKind(field.Type)
+			}
+
+			got := map[string]string{}
+			for prop, propSchema := range schema.Properties {
+				got[prop] = propSchema.Type
+			}
+
+			if diff := cmp.Diff(expected, got); diff != "" {
+				t.Errorf("properties differ:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestServeSpec(t *testing.T) {
+	srv := newTestServer(t, &fakeBackend{})
+
+	// The spec is public
+	resp := doRequest(t, http.MethodGet, srv.URL+"/api/v1/openapi.json", "", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("got content type %q", ct)
+	}
+}
@@ -0,0 +1,104 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+	"weezel/budget/logger"
+	"weezel/budget/outputs"
+	"weezel/budget/reportlink"
+)
+
+// reportTopShopsCount matches the amount of shops shown by the bot
+const reportTopShopsCount = 5
+
+// RevocationChecker tells whether a report link has been revoked
+type RevocationChecker func(ctx context.Context, linkID string) (bool, error)
+
+// ReportLinks serves the statistics behind signed links. The report is
+// rendered again on every request.
+type ReportLinks struct {
+	secret    []byte
+	household int64
+	loadStats StatsLoader
+	isRevoked RevocationChecker
+}
+
+func NewReportLinks(
+	secret string,
+	household int64,
+	loadStats StatsLoader,
+	isRevoked RevocationChecker,
+) *ReportLinks {
+	return &ReportLinks{
+		secret:    []byte(secret),
+		household: household,
+		loadStats: loadStats,
+		isRevoked: isRevoked,
+	}
+}
+
+// ReportURL returns the signed link to the report
+func ReportURL(hostname string, link reportlink.Link, secret string) string {
+	u := url.URL{
+		Scheme:   "https",
+		Host:     hostname,
+		Path:     "/report",
+		RawQuery: link.Query([]byte(secret)).Encode(),
+	}
+	return u.String()
+}
+
+func (rl *ReportLinks) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /report", rl.serveReport)
+}
+
+func (rl *ReportLinks) serveReport(w http.ResponseWriter, r *http.Request) {
+	link, err := reportlink.Parse(r.URL.Query(), rl.secret, rl.household, time.Now())
+	if err != nil {
+		logger.Warnf("Rejected report link from %s: %s", r.RemoteAddr, err)
+		if errors.Is(err, reportlink.ErrExpired) {
+			http.Error(w, "Linkki on vanhentunut", http.StatusGone)
+			return
+		}
+		http.Error(w, "Virheellinen linkki", http.StatusForbidden)
+		return
+	}
+
+	revoked, err := rl.isRevoked(r.Context(), link.ID)
+	if err != nil {
+		logger.Error(err)
+		http.Error(w, "Virhe tietokantahaussa", http.StatusInternalServerError)
+		return
+	}
+	if revoked {
+		logger.Infof("Revoked report link %s used from %s", link.ID, r.RemoteAddr)
+		http.Error(w, "Linkki on mitätöity", http.StatusGone)
+		return
+	}
+
+	statsVars, err := rl.loadStats(r.Context(), link.From, link.To, reportTopShopsCount)
+	if err != nil {
+		logger.Error(err)
+		http.Error(w, "Virhe, ei saatu tilastoja", http.StatusInternalServerError)
+		return
+	}
+	page, err := outputs.RenderStatsHTML(statsVars)
+	if err != nil {
+		logger.Error(err)
+		http.Error(w, "Virhe, HTML sivun muodostus epäonnistui", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// Set also by SecureHandler, but the signed link must never be cached or
+	// leak to other sites even if the handler is mounted without it
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	if _, err := fmt.Fprintf(w, "%s\n", page); err != nil {
+		logger.Errorf("couldn't write report %s: %s", link.ID, err)
+	}
+}
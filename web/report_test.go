@@ -0,0 +1,88 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"weezel/budget/outputs"
+	"weezel/budget/reportlink"
+)
+
+func TestServeReport(t *testing.T) {
+	const secret = "s3cr3t"
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	var loaded []time.Time
+	links := NewReportLinks(
+		secret,
+		-100,
+		func(_ context.Context, startMonth, endMonth time.Time, _ int32) (outputs.StatisticsVars, error) {
+			loaded = []time.Time{startMonth, endMonth}
+			return outputs.StatisticsVars{From: startMonth, To: endMonth}, nil
+		},
+		func(_ context.Context, linkID string) (bool, error) {
+			return linkID == "revoked", nil
+		})
+	mux := http.NewServeMux()
+	links.Register(mux)
+
+	valid := reportlink.New(from, to, -100, time.Hour, time.Now())
+	revoked := valid
+	revoked.ID = "revoked"
+	expired := reportlink.New(from, to, -100, time.Hour, time.Now().Add(-2*time.Hour))
+	tampered := valid.Query([]byte(secret))
+	tampered.Set("from", "2020-01")
+
+	tests := []struct {
+		name   string
+		query  url.Values
+		status int
+	}{
+		{"Valid", valid.Query([]byte(secret)), http.StatusOK},
+		{"Revoked", revoked.Query([]byte(secret)), http.StatusGone},
+		{"Expired", expired.Query([]byte(secret)), http.StatusGone},
+		{"Tampered", tampered, http.StatusForbidden},
+		{"Other secret", valid.Query([]byte("other")), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loaded = nil
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/report?"+tt.query.Encode(), nil))
+			if rec.Code != tt.status {
+				t.Fatalf("got status %d, expected %d", rec.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				if loaded != nil {
+					t.Errorf("report was loaded for a rejected link")
+				}
+				return
+			}
+			if len(loaded) != 2 || !loaded[0].Equal(from) || !loaded[1].Equal(to) {
+				t.Errorf("loaded months %v", loaded)
+			}
+			if !strings.Contains(rec.Body.String(), "01-2025 - 12-2025") {
+				t.Errorf("report is missing the months")
+			}
+		})
+	}
+}
+
+func TestReportURL(t *testing.T) {
+	link := reportlink.Link{
+		ID:        "abc",
+		From:      time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:        time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+		Household: -100,
+		Expires:   time.Unix(1700000000, 0),
+	}
+	got := ReportURL("example.com", link, "s3cr3t")
+	if !strings.HasPrefix(got, "https://example.com/report?exp=1700000000&from=2025-01&h=-100&id=abc&sig=") {
+		t.Errorf("got %s", got)
+	}
+}
@@ -1,49 +1,186 @@
 package web
 
 import (
+	"bytes"
 	"errors"
-	"fmt"
+	"html/template"
 	"net/http"
-	"reflect"
-	"text/template"
+	"sync"
+	"time"
 	"weezel/budget/logger"
 	"weezel/budget/shortlivedpage"
 )
 
+const (
+	// maxPINFailures is how many wrong PINs are accepted before the page is removed
+	maxPINFailures = 5
+	// pinFailureTTL is how long failures are remembered, longer than any page lives
+	pinFailureTTL = time.Hour
+)
+
+var unlockPage = template.Must(template.ParseFS(uiTemplateFS,
+	"templates/layout.gohtml", "templates/page_unlock.gohtml"))
+
+type unlockVars struct {
+	PageHash      string
+	PIN           bool
+	BurnAfterRead bool
+}
+
+type pinFailure struct {
+	count int
+	first time.Time
+}
+
+// pinFailures counts the wrong PINs entered per page
+type pinFailures struct {
+	lock     sync.Mutex
+	failures map[string]pinFailure
+}
+
+var pagePINFailures = pinFailures{
+	failures: map[string]pinFailure{},
+}
+
+// Record adds a failure and returns the failures of the page so far. Old
+// failures are dropped at the same time.
+func (p *pinFailures) Record(pageHash string, now time.Time) int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for hash, failure := range p.failures {
+		if now.Sub(failure.first) > pinFailureTTL {
+			delete(p.failures, hash)
+		}
+	}
+
+	failure, ok := p.failures[pageHash]
+	if !ok {
+		failure.first = now
+	}
+	failure.count++
+	p.failures[pageHash] = failure
+	return failure.count
+}
+
+func (p *pinFailures) Reset(pageHash string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	delete(p.failures, pageHash)
+}
+
+// pageID is logged instead of the page hash, which works as a password
+func pageID(pageHash string) string {
+	if len(pageHash) > 8 {
+		return pageHash[:8]
+	}
+	return pageHash
+}
+
+func renderUnlock(w http.ResponseWriter, status int, errMsg string, vars unlockVars) error {
+	buf := bytes.Buffer{}
+	err := unlockPage.ExecuteTemplate(&buf, "layout", pageVars{
+		Title: "Tilastot",
+		Error: errMsg,
+		Data:  vars,
+	})
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return err
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// LoadPage serves the short-lived page. Pages with a PIN or burn-after-read are
+// opened with a POST, so that link previews don't use them up.
 func LoadPage(w http.ResponseWriter, r *http.Request) error {
 	if err := r.ParseForm(); err != nil {
-		fmt.Fprintf(w, "Error parsing form\r\n")
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
 		return nil
 	}
-	logger.Infof("Received forms: %v", r.PostForm)
-	receivedPageHash := template.HTMLEscapeString(r.FormValue("page_hash"))
+	receivedPageHash := r.FormValue("page_hash")
 	if len(receivedPageHash) < 1 {
-		fmt.Fprintf(w, "Error, empty message\r\n")
+		http.Error(w, "Missing page_hash", http.StatusBadRequest)
+		return nil
+	}
+	id := pageID(receivedPageHash)
+
+	page, err := shortlivedpage.Get(r.Context(), receivedPageHash)
+	if errors.Is(err, shortlivedpage.ErrNotFound) {
+		logger.Infof("Page %s: not found, requested by %s", id, r.RemoteAddr)
+		http.Error(w, "No such page", http.StatusNotFound)
 		return nil
+	} else if err != nil {
+		http.Error(w, "Error loading page", http.StatusInternalServerError)
+		return err
 	}
 
-	page := shortlivedpage.Get(receivedPageHash)
-	if reflect.DeepEqual(page, shortlivedpage.ShortLivedPage{}) {
-		errMsg := fmt.Sprintf("No such hash %s\r\n", receivedPageHash)
-		fmt.Fprint(w, errMsg)
-		return errors.New(errMsg)
+	if page.HasPIN() || page.BurnAfterRead {
+		vars := unlockVars{
+			PageHash:      receivedPageHash,
+			PIN:           page.HasPIN(),
+			BurnAfterRead: page.BurnAfterRead,
+		}
+		if r.Method != http.MethodPost {
+			logger.Infof("Page %s: unlock form shown to %s", id, r.RemoteAddr)
+			return renderUnlock(w, http.StatusOK, "", vars)
+		}
+
+		if page.HasPIN() && !page.CheckPIN(r.PostFormValue("pin")) {
+			failures := pagePINFailures.Record(receivedPageHash, time.Now())
+			logger.Warnf("Page %s: wrong PIN from %s (%d/%d)",
+				id, r.RemoteAddr, failures, maxPINFailures)
+			if failures >= maxPINFailures {
+				pagePINFailures.Reset(receivedPageHash)
+				if err := shortlivedpage.Remove(r.Context(), receivedPageHash); err != nil {
+					return err
+				}
+				logger.Warnf("Page %s: removed after too many wrong PINs", id)
+				http.Error(w, "No such page", http.StatusNotFound)
+				return nil
+			}
+			return renderUnlock(w, http.StatusForbidden, "Väärä PIN", vars)
+		}
+
+		if page.BurnAfterRead {
+			page, err = shortlivedpage.Take(r.Context(), receivedPageHash)
+			if errors.Is(err, shortlivedpage.ErrNotFound) {
+				logger.Infof("Page %s: already opened, requested by %s", id, r.RemoteAddr)
+				http.Error(w, "No such page", http.StatusNotFound)
+				return nil
+			} else if err != nil {
+				http.Error(w, "Error loading page", http.StatusInternalServerError)
+				return err
+			}
+		}
+		pagePINFailures.Reset(receivedPageHash)
 	}
-	fmt.Fprintf(w, "%s\n", *page.HTMLPage)
-	return nil
+
+	logger.Infof("Page %s: opened by %s", id, r.RemoteAddr)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, err = w.Write(*page.HTMLPage)
+	return err
 }
 
 func APIHandler(w http.ResponseWriter, r *http.Request) {
-	logger.Infof("Incoming %s [%v] connection from %s with size %d bytes",
+	logger.Debugf("Incoming %s [%v] connection from %s with size %d bytes",
 		r.Method,
-		r.Header,
+		redactHeaders(r.Header),
 		r.RemoteAddr,
 		r.ContentLength)
 
 	switch r.Method {
-	case "GET":
+	case http.MethodGet, http.MethodPost:
 		if err := LoadPage(w, r); err != nil {
 			logger.Errorf("%s", err)
 			return
 		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
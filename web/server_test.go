@@ -0,0 +1,146 @@
+package web
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"weezel/budget/shortlivedpage"
+)
+
+func addTestPage(t *testing.T, burnAfterRead bool, pin string) string {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	shortlivedpage.Init(ctx, shortlivedpage.NewMemoryStore(shortlivedpage.DefaultMaxBytes))
+
+	html := []byte("<p>salaiset tilastot</p>")
+	page := shortlivedpage.ShortLivedPage{
+		StartTime:     time.Now(),
+		TTLSeconds:    600,
+		HTMLPage:      &html,
+		BurnAfterRead: burnAfterRead,
+	}
+	if pin != "" {
+		page.SetPIN(pin)
+	}
+	token := shortlivedpage.NewToken()
+	if _, err := shortlivedpage.Add(ctx, token, page); err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func requestPage(t *testing.T, method, token, pin string) (int, string) {
+	t.Helper()
+
+	var r *http.Request
+	if method == http.MethodPost {
+		form := url.Values{"page_hash": {token}, "pin": {pin}}
+		r = httptest.NewRequest(method, "/statistics", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		r = httptest.NewRequest(method, "/statistics?page_hash="+token, nil)
+	}
+	w := httptest.NewRecorder()
+	APIHandler(w, r)
+
+	body, err := io.ReadAll(w.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w.Result().StatusCode, string(body)
+}
+
+const secretContent = "salaiset tilastot"
+
+func TestLoadPagePlain(t *testing.T) {
+	token := addTestPage(t, false, "")
+
+	for i := 0; i < 2; i++ {
+		status, body := requestPage(t, http.MethodGet, token, "")
+		if status != http.StatusOK || !strings.Contains(body, secretContent) {
+			t.Errorf("got %d: %s", status, body)
+		}
+	}
+
+	status, _ := requestPage(t, http.MethodGet, shortlivedpage.NewToken(), "")
+	if status != http.StatusNotFound {
+		t.Errorf("got %d for unknown page", status)
+	}
+}
+
+func TestLoadPageBurnAfterRead(t *testing.T) {
+	token := addTestPage(t, true, "")
+
+	// Link previews only see the form
+	status, body := requestPage(t, http.MethodGet, token, "")
+	if status != http.StatusOK || strings.Contains(body, secretContent) {
+		t.Fatalf("got %d: %s", status, body)
+	}
+
+	status, body = requestPage(t, http.MethodPost, token, "")
+	if status != http.StatusOK || !strings.Contains(body, secretContent) {
+		t.Fatalf("got %d: %s", status, body)
+	}
+
+	status, _ = requestPage(t, http.MethodPost, token, "")
+	if status != http.StatusNotFound {
+		t.Errorf("got %d for the second read", status)
+	}
+}
+
+func TestLoadPagePIN(t *testing.T) {
+	token := addTestPage(t, false, "123456")
+
+	status, body := requestPage(t, http.MethodGet, token, "")
+	if status != http.StatusOK || strings.Contains(body, secretContent) || !strings.Contains(body, `name="pin"`) {
+		t.Fatalf("got %d: %s", status, body)
+	}
+
+	status, body = requestPage(t, http.MethodPost, token, "000000")
+	if status != http.StatusForbidden || strings.Contains(body, secretContent) {
+		t.Fatalf("got %d: %s", status, body)
+	}
+
+	status, body = requestPage(t, http.MethodPost, token, "123456")
+	if status != http.StatusOK || !strings.Contains(body, secretContent) {
+		t.Fatalf("got %d: %s", status, body)
+	}
+}
+
+func TestLoadPageRemovedAfterWrongPINs(t *testing.T) {
+	token := addTestPage(t, false, "123456")
+
+	for i := 1; i < maxPINFailures; i++ {
+		if status, _ := requestPage(t, http.MethodPost, token, "000000"); status != http.StatusForbidden {
+			t.Fatalf("attempt %d: got %d", i, status)
+		}
+	}
+	if status, _ := requestPage(t, http.MethodPost, token, "000000"); status != http.StatusNotFound {
+		t.Fatalf("last attempt: got %d", status)
+	}
+	// Correct PIN doesn't help anymore
+	if status, _ := requestPage(t, http.MethodPost, token, "123456"); status != http.StatusNotFound {
+		t.Errorf("got %d after the page was removed", status)
+	}
+}
+
+func TestPINFailuresExpire(t *testing.T) {
+	failures := pinFailures{failures: map[string]pinFailure{}}
+	now := time.Now()
+
+	failures.Record("a", now)
+	if got := failures.Record("a", now); got != 2 {
+		t.Errorf("got %d failures", got)
+	}
+	failures.Record("b", now.Add(2*pinFailureTTL))
+	if got := failures.Record("a", now.Add(2*pinFailureTTL)); got != 1 {
+		t.Errorf("got %d failures after expiry", got)
+	}
+}
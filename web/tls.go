@@ -0,0 +1,138 @@
+package web
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+	"weezel/budget/logger"
+)
+
+// CertReloader serves the certificate from files and reloads it when the
+// files change or when asked with Reload, e.g. on SIGHUP. Renewing a
+// certificate doesn't need a restart.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	lock    sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewCertReloader loads the certificate and fails if it can't be loaded
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	c := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// latestModTime returns the modification time of the newer file
+func (c *CertReloader) latestModTime() (time.Time, error) {
+	latest := time.Time{}
+	for _, file := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// Reload reads the certificate files. The old certificate stays in use if
+// they can't be read.
+func (c *CertReloader) Reload() error {
+	modTime, err := c.latestModTime()
+	if err != nil {
+		return fmt.Errorf("certificate: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("certificate: %w", err)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cert = &cert
+	c.modTime = modTime
+	return nil
+}
+
+// reloadIfChanged reloads the certificate if either of the files has changed
+func (c *CertReloader) reloadIfChanged() (bool, error) {
+	modTime, err := c.latestModTime()
+	if err != nil {
+		return false, fmt.Errorf("certificate: %w", err)
+	}
+
+	c.lock.RLock()
+	changed := !modTime.Equal(c.modTime)
+	c.lock.RUnlock()
+	if !changed {
+		return false, nil
+	}
+	return true, c.Reload()
+}
+
+// GetCertificate is meant for tls.Config
+func (c *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.cert, nil
+}
+
+// TLSConfig returns the server configuration using the reloaded certificate
+func (c *CertReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: c.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+}
+
+// Watch checks the files every interval and reloads on each value of reload.
+// Returns when ctx is done.
+func (c *CertReloader) Watch(ctx context.Context, interval time.Duration, reload <-chan os.Signal) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-reload:
+			if err := c.Reload(); err != nil {
+				logger.Errorf("Couldn't reload certificate on %s: %s", sig, err)
+				continue
+			}
+			logger.Infof("Certificate reloaded on %s", sig)
+		case <-ticker.C:
+			reloaded, err := c.reloadIfChanged()
+			if err != nil {
+				logger.Errorf("Couldn't reload changed certificate: %s", err)
+				continue
+			}
+			if reloaded {
+				logger.Infof("Certificate reloaded after the files changed")
+			}
+		}
+	}
+}
+
+// RedirectHandler redirects plain HTTP requests to the same path on HTTPS.
+// The target host is the configured one, Host header is not trusted.
+func RedirectHandler(hostname string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://"+hostname+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,200 @@
+package web
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate for localhost with the serial number
+func writeCert(t *testing.T, dir string, serial int64) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Modification times have coarse resolution on some file systems
+	modTime := time.Now().Add(time.Duration(serial) * time.Second)
+	for _, file := range []string{certFile, keyFile} {
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certFile, keyFile
+}
+
+func servedSerial(t *testing.T, c *CertReloader) int64 {
+	t.Helper()
+	cert, err := c.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.SerialNumber.Int64()
+}
+
+func TestCertReloaderReloadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, 1)
+
+	c, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := c.reloadIfChanged(); err != nil || reloaded {
+		t.Errorf("reloadIfChanged() = %v, %v for unchanged files", reloaded, err)
+	}
+
+	writeCert(t, dir, 2)
+	if reloaded, err := c.reloadIfChanged(); err != nil || !reloaded {
+		t.Fatalf("reloadIfChanged() = %v, %v for changed files", reloaded, err)
+	}
+	if serial := servedSerial(t, c); serial != 2 {
+		t.Errorf("got serial %d", serial)
+	}
+}
+
+func TestCertReloaderKeepsOldOnError(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, 1)
+
+	c, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, []byte("broken"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Reload(); err == nil {
+		t.Fatal("expected an error for a broken certificate")
+	}
+	if serial := servedSerial(t, c); serial != 1 {
+		t.Errorf("got serial %d", serial)
+	}
+}
+
+func TestCertReloaderWatchSignal(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, 1)
+
+	c, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reload := make(chan os.Signal)
+	// Polling is effectively off, only the signal reloads
+	go c.Watch(ctx, time.Hour, reload)
+
+	writeCert(t, dir, 3)
+	reload <- syscall.SIGHUP
+	// Second send returns once the first one has been handled
+	reload <- syscall.SIGHUP
+
+	if serial := servedSerial(t, c); serial != 3 {
+		t.Errorf("got serial %d", serial)
+	}
+}
+
+func TestCertReloaderServesTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, 1)
+
+	c, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// httptest.Server would add its own certificate
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", c.TLSConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{
+		Handler:           http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		ReadHeaderTimeout: time.Second,
+	}
+	go srv.Serve(listener) //nolint:errcheck // returns when closed
+	defer srv.Close()
+
+	for _, expected := range []int64{1, 4} {
+		if expected != 1 {
+			writeCert(t, dir, expected)
+			if err := c.Reload(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{
+			InsecureSkipVerify: true, //nolint:gosec // self-signed test certificate
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		serial := conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+		conn.Close()
+		if serial != expected {
+			t.Errorf("got serial %d, expected %d", serial, expected)
+		}
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/statistics?page_hash=abc", nil)
+	r.Host = "evil.example.com"
+	w := httptest.NewRecorder()
+	RedirectHandler("budget.example.com:8443").ServeHTTP(w, r)
+
+	if w.Code != http.StatusPermanentRedirect {
+		t.Errorf("got status %d", w.Code)
+	}
+	expected := "https://budget.example.com:8443/statistics?page_hash=abc"
+	if location := w.Header().Get("Location"); location != expected {
+		t.Errorf("got location %q", location)
+	}
+}
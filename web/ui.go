@@ -0,0 +1,753 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"weezel/budget/blobstore"
+	"weezel/budget/db"
+	"weezel/budget/dbengine"
+	"weezel/budget/logger"
+	"weezel/budget/outputs"
+
+	"github.com/jackc/pgx/v4"
+)
+
+//go:embed templates/*.gohtml
+var uiTemplateFS embed.FS
+
+const (
+	sessionCookie = "budget_session"
+	uiPageLimit   = 50
+	// uiTopShopsCount limits how many shops are shown in the statistics
+	uiTopShopsCount = 10
+)
+
+// StatsLoader loads the data of the statistics page, e.g. reports.Statistics
+type StatsLoader func(ctx context.Context, startMonth, endMonth time.Time, topShops int32) (outputs.StatisticsVars, error)
+
+// UI is the server rendered web UI. Users sign in either with Telegram Login
+// Widget or with a one-time link sent by the bot.
+type UI struct {
+	backend   Backend
+	loadStats StatsLoader
+	sessions  *sessions
+	pages     map[string]*template.Template
+	// botName and botToken are needed for Telegram Login Widget
+	botName  string
+	botToken string
+	users    []string
+	receipts blobstore.Store
+}
+
+// pageVars are available in every page, page specific data is in Data
+type pageVars struct {
+	Title    string
+	Username string
+	CSRF     string
+	Error    string
+	Data     any
+}
+
+type sortColumn struct {
+	Label  string
+	Align  string
+	URL    string
+	Active bool
+	Desc   bool
+}
+
+type expensesVars struct {
+	Filter   dbengine.Filter
+	From     string
+	To       string
+	Today    string
+	Columns  []sortColumn
+	Expenses []*db.BudgetSchemaExpense
+	// Receipts maps the IDs of the expenses to the hashes of their receipts
+	Receipts map[int32][]string
+	PrevURL  string
+	NextURL  string
+}
+
+type auditVars struct {
+	Entries []*db.BudgetSchemaAuditLog
+	PrevURL string
+	NextURL string
+}
+
+// auditActionNames are shown in place of the actions of the audit log
+var auditActionNames = map[string]string{
+	dbengine.ActionInsert:  "lisäys",
+	dbengine.ActionUpdate:  "muokkaus",
+	dbengine.ActionDelete:  "poisto",
+	dbengine.ActionRestore: "palautus",
+}
+
+// auditActionName returns a printable name for the action of the audit log
+func auditActionName(action string) string {
+	if name, found := auditActionNames[action]; found {
+		return name
+	}
+	return action
+}
+
+type salariesVars struct {
+	Month    string
+	Salaries []*db.BudgetSchemaSalary
+	PrevURL  string
+	NextURL  string
+}
+
+func NewUI(
+	backend Backend,
+	loadStats StatsLoader,
+	botName, botToken string,
+	users []string,
+	receipts blobstore.Store,
+) (*UI, error) {
+	pages := map[string]*template.Template{}
+	for _, page := range []string{
+		"login",
+		"login_link",
+		"expenses",
+		"expense_edit",
+		"salaries",
+		"salary_edit",
+		"stats",
+		"audit",
+		"error",
+	} {
+		tpl, err := template.New(page).Funcs(template.FuncMap{
+			"CategoryName":    outputs.CategoryName,
+			"AuditActionName": auditActionName,
+		}).ParseFS(uiTemplateFS, "templates/layout.gohtml", "templates/"+page+".gohtml")
+		if err != nil {
+			return nil, fmt.Errorf("parse template %s: %w", page, err)
+		}
+		pages[page] = tpl
+	}
+
+	return &UI{
+		backend:   backend,
+		loadStats: loadStats,
+		sessions:  newSessions(),
+		pages:     pages,
+		botName:   botName,
+		botToken:  botToken,
+		users:     users,
+		receipts:  receipts,
+	}, nil
+}
+
+// Register adds the UI routes to the mux
+func (u *UI) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /ui/{$}", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ui/expenses", http.StatusSeeOther)
+	})
+	mux.HandleFunc("GET /ui/login", u.loginPage)
+	mux.HandleFunc("POST /ui/login/link", u.loginWithLink)
+	mux.HandleFunc("GET /ui/login/telegram", u.loginWithTelegram)
+	mux.HandleFunc("POST /ui/logout", u.requireSession(u.logout))
+
+	mux.HandleFunc("GET /ui/expenses", u.requireSession(u.listExpenses))
+	mux.HandleFunc("POST /ui/expenses", u.requireSession(u.createExpense))
+	mux.HandleFunc("GET /ui/expenses/{id}/edit", u.requireSession(u.editExpense))
+	mux.HandleFunc("POST /ui/expenses/{id}", u.requireSession(u.updateExpense))
+	mux.HandleFunc("POST /ui/expenses/{id}/delete", u.requireSession(u.deleteExpense))
+
+	mux.HandleFunc("GET /ui/salaries", u.requireSession(u.listSalaries))
+	mux.HandleFunc("POST /ui/salaries", u.requireSession(u.createSalary))
+	mux.HandleFunc("GET /ui/salaries/{id}/edit", u.requireSession(u.editSalary))
+	mux.HandleFunc("POST /ui/salaries/{id}", u.requireSession(u.updateSalary))
+	mux.HandleFunc("POST /ui/salaries/{id}/delete", u.requireSession(u.deleteSalary))
+
+	mux.HandleFunc("GET /ui/stats", u.requireSession(u.stats))
+	mux.HandleFunc("GET /ui/audit", u.requireSession(u.listAuditLog))
+	mux.HandleFunc("GET /ui/receipts/{hash}", u.requireSession(u.showReceipt))
+}
+
+type sessionHandler func(w http.ResponseWriter, r *http.Request, sess session)
+
+// requireSession redirects to the login page when there's no valid session.
+// Posted forms must carry the CSRF token of the session.
+func (u *UI) requireSession(next sessionHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(sessionCookie)
+		if err != nil {
+			http.Redirect(w, r, "/ui/login", http.StatusSeeOther)
+			return
+		}
+		sess, ok := u.sessions.Get(cookie.Value, time.Now())
+		if !ok {
+			http.Redirect(w, r, "/ui/login", http.StatusSeeOther)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			if subtle.ConstantTimeCompare([]byte(r.PostFormValue("csrf")), []byte(sess.csrf)) != 1 {
+				logger.Warnf("CSRF token mismatch for %s from %s", sess.username, r.RemoteAddr)
+				http.Error(w, "invalid CSRF token", http.StatusForbidden)
+				return
+			}
+		}
+
+		next(w, r, sess)
+	}
+}
+
+func (u *UI) render(w http.ResponseWriter, status int, page string, vars pageVars) {
+	buf := bytes.Buffer{}
+	if err := u.pages[page].ExecuteTemplate(&buf, "layout", vars); err != nil {
+		logger.Errorf("couldn't render page %s: %s", page, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		logger.Errorf("couldn't write page %s: %s", page, err)
+	}
+}
+
+// renderError renders the error in place of the requested page
+func (u *UI) renderError(w http.ResponseWriter, status int, sess session, msg string) {
+	u.render(w, status, "error", pageVars{
+		Title:    "Virhe",
+		Username: sess.username,
+		CSRF:     sess.csrf,
+		Error:    msg,
+	})
+}
+
+func (u *UI) renderBackendError(w http.ResponseWriter, sess session, err error) {
+	if errors.Is(err, pgx.ErrNoRows) {
+		u.renderError(w, http.StatusNotFound, sess, "ei löytynyt")
+		return
+	}
+	logger.Error(err)
+	u.renderError(w, http.StatusInternalServerError, sess, "virhe tietokantahaussa")
+}
+
+func (u *UI) allowed(username string) bool {
+	return username != "" && slices.Contains(u.users, username)
+}
+
+func (u *UI) startSession(w http.ResponseWriter, r *http.Request, username string) {
+	id := u.sessions.Create(username, time.Now())
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     "/ui/",
+		MaxAge:   int(sessionTTL.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	logger.Infof("%s signed in to the web UI from %s", username, r.RemoteAddr)
+	http.Redirect(w, r, "/ui/expenses", http.StatusSeeOther)
+}
+
+func (u *UI) loginPage(w http.ResponseWriter, r *http.Request) {
+	// The token is redeemed only after posting the form, so that link
+	// previews don't burn it
+	if token := r.URL.Query().Get("token"); token != "" {
+		u.render(w, http.StatusOK, "login_link", pageVars{
+			Title: "Kirjaudu",
+			Data:  map[string]string{"Token": token},
+		})
+		return
+	}
+
+	u.render(w, http.StatusOK, "login", pageVars{
+		Title: "Kirjaudu",
+		Data:  map[string]string{"BotName": u.botName},
+	})
+}
+
+func (u *UI) loginWithLink(w http.ResponseWriter, r *http.Request) {
+	username, ok := issuedLoginTokens.Redeem(r.PostFormValue("token"), time.Now())
+	if !ok || !u.allowed(username) {
+		logger.Warnf("Invalid login link used from %s", r.RemoteAddr)
+		u.render(w, http.StatusUnauthorized, "login", pageVars{
+			Title: "Kirjaudu",
+			Error: "linkki on vanhentunut tai jo käytetty",
+			Data:  map[string]string{"BotName": u.botName},
+		})
+		return
+	}
+	u.startSession(w, r, username)
+}
+
+func (u *UI) loginWithTelegram(w http.ResponseWriter, r *http.Request) {
+	username, err := verifyTelegramLogin(r.URL.Query(), u.botToken, time.Now())
+	if err == nil && !u.allowed(username) {
+		err = fmt.Errorf("user %q is not allowed", username)
+	}
+	if err != nil {
+		logger.Warnf("Telegram login failed from %s: %s", r.RemoteAddr, err)
+		u.render(w, http.StatusUnauthorized, "login", pageVars{
+			Title: "Kirjaudu",
+			Error: "kirjautuminen epäonnistui",
+			Data:  map[string]string{"BotName": u.botName},
+		})
+		return
+	}
+	u.startSession(w, r, username)
+}
+
+func (u *UI) logout(w http.ResponseWriter, r *http.Request, sess session) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		u.sessions.Delete(cookie.Value)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:   sessionCookie,
+		Path:   "/ui/",
+		MaxAge: -1,
+	})
+	logger.Infof("%s signed out from the web UI", sess.username)
+	http.Redirect(w, r, "/ui/login", http.StatusSeeOther)
+}
+
+// parseAmount accepts both decimal comma and point like the bot does. Only
+// finite, positive amounts are accepted, NaN would break the statistics.
+func parseAmount(raw string) (float64, error) {
+	amount, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(raw), ",", "."), 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(amount) || math.IsInf(amount, 0) || amount <= 0 {
+		return 0, fmt.Errorf("invalid amount %q", raw)
+	}
+	return amount, nil
+}
+
+// pageURL returns the current URL with the given query parameter changed
+func pageURL(r *http.Request, key, value string) string {
+	q := r.URL.Query()
+	// Changing the filter or the order starts from the first page
+	q.Del("offset")
+	q.Set(key, value)
+	return r.URL.Path + "?" + q.Encode()
+}
+
+func pagination(r *http.Request, offset int32, items int) (string, string) {
+	prevURL, nextURL := "", ""
+	if offset > 0 {
+		prevURL = pageURL(r, "offset", strconv.Itoa(int(max(offset-uiPageLimit, 0))))
+	}
+	if items == uiPageLimit {
+		nextURL = pageURL(r, "offset", strconv.Itoa(int(offset+uiPageLimit)))
+	}
+	return prevURL, nextURL
+}
+
+func sortColumns(r *http.Request, current string) []sortColumn {
+	columns := []sortColumn{
+		{Label: "Päivämäärä", Align: "center"},
+		{Label: "Kauppa", Align: "left"},
+		{Label: "Kategoria", Align: "left"},
+		{Label: "Käyttäjä", Align: "left"},
+		{Label: "Hinta", Align: "right"},
+	}
+	for i, key := range dbengine.ExpenseSortKeys {
+		columns[i].Active = strings.TrimPrefix(current, "-") == key
+		columns[i].Desc = columns[i].Active && strings.HasPrefix(current, "-")
+		next := key
+		if columns[i].Active && !columns[i].Desc {
+			next = "-" + key
+		}
+		columns[i].URL = pageURL(r, "sort", next)
+	}
+	return columns
+}
+
+func (u *UI) listExpenses(w http.ResponseWriter, r *http.Request, sess session) {
+	filter, err := parseFilter(r)
+	if err != nil {
+		u.renderError(w, http.StatusBadRequest, sess, err.Error())
+		return
+	}
+	filter.Sort = r.URL.Query().Get("sort")
+	if filter.Sort != "" && !slices.Contains(dbengine.ExpenseSortKeys, strings.TrimPrefix(filter.Sort, "-")) {
+		u.renderError(w, http.StatusBadRequest, sess, "tuntematon järjestys")
+		return
+	}
+	offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 32)
+	offset = max(offset, 0)
+
+	expenses, err := u.backend.ListExpenses(r.Context(), filter, uiPageLimit, int32(offset))
+	if err != nil {
+		u.renderBackendError(w, sess, err)
+		return
+	}
+
+	receipts, err := u.listReceipts(r.Context(), expenses)
+	if err != nil {
+		u.renderBackendError(w, sess, err)
+		return
+	}
+
+	vars := expensesVars{
+		Filter:   filter,
+		From:     r.URL.Query().Get("from"),
+		To:       r.URL.Query().Get("to"),
+		Today:    time.Now().Format(dateFormat),
+		Columns:  sortColumns(r, filter.Sort),
+		Expenses: expenses,
+		Receipts: receipts,
+	}
+	vars.PrevURL, vars.NextURL = pagination(r, int32(offset), len(expenses))
+	u.render(w, http.StatusOK, "expenses", pageVars{
+		Title:    "Kulut",
+		Username: sess.username,
+		CSRF:     sess.csrf,
+		Data:     vars,
+	})
+}
+
+// listReceipts returns the receipts of the expenses shown on the page
+func (u *UI) listReceipts(ctx context.Context, expenses []*db.BudgetSchemaExpense) (map[int32][]string, error) {
+	if len(expenses) == 0 {
+		return nil, nil
+	}
+	first, last := expenses[0].ExpenseDate, expenses[0].ExpenseDate
+	for _, e := range expenses[1:] {
+		if e.ExpenseDate.Before(first) {
+			first = e.ExpenseDate
+		}
+		if e.ExpenseDate.After(last) {
+			last = e.ExpenseDate
+		}
+	}
+	attachments, err := u.backend.ListAttachmentsByTimespan(ctx, first, last)
+	if err != nil {
+		return nil, err
+	}
+	return outputs.ReceiptsByExpense(attachments), nil
+}
+
+// showReceipt serves the receipt photo. Only the files attached to expenses
+// are served, even if the blob store had others.
+func (u *UI) showReceipt(w http.ResponseWriter, r *http.Request, sess session) {
+	hash := r.PathValue("hash")
+	if !blobstore.ValidHash(hash) || u.receipts == nil {
+		u.renderError(w, http.StatusNotFound, sess, "ei löytynyt")
+		return
+	}
+	attachment, err := u.backend.GetAttachmentByHash(r.Context(), hash)
+	if err != nil {
+		u.renderBackendError(w, sess, err)
+		return
+	}
+	data, err := u.receipts.Get(r.Context(), hash)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		logger.Errorf("Receipt %s of expense %d is missing from the blob store", hash, attachment.ExpenseID)
+		u.renderError(w, http.StatusNotFound, sess, "ei löytynyt")
+		return
+	}
+	if err != nil {
+		logger.Error(err)
+		u.renderError(w, http.StatusInternalServerError, sess, "kuitin haku epäonnistui")
+		return
+	}
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	// The content of a hash never changes
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err = w.Write(data); err != nil {
+		logger.Errorf("couldn't write receipt %s: %s", hash, err)
+	}
+}
+
+func parseExpenseForm(r *http.Request) (ExpenseRequest, time.Time, error) {
+	req := ExpenseRequest{
+		ShopName: strings.TrimSpace(r.PostFormValue("shop_name")),
+		Category: strings.ToLower(strings.TrimPrefix(strings.TrimSpace(r.PostFormValue("category")), "#")),
+	}
+	if req.ShopName == "" {
+		return ExpenseRequest{}, time.Time{}, errors.New("kauppa puuttuu")
+	}
+	price, err := parseAmount(r.PostFormValue("price"))
+	if err != nil {
+		return ExpenseRequest{}, time.Time{}, errors.New("virheellinen hinta")
+	}
+	req.Price = price
+	expenseDate, err := time.Parse(dateFormat, r.PostFormValue("expense_date"))
+	if err != nil {
+		return ExpenseRequest{}, time.Time{}, errors.New("virheellinen päivämäärä")
+	}
+	return req, expenseDate, nil
+}
+
+func (u *UI) createExpense(w http.ResponseWriter, r *http.Request, sess session) {
+	req, expenseDate, err := parseExpenseForm(r)
+	if err != nil {
+		u.renderError(w, http.StatusBadRequest, sess, err.Error())
+		return
+	}
+
+	id, err := u.backend.AddExpense(r.Context(), sess.username, req.ShopName, req.Category, expenseDate, req.Price)
+	if err != nil {
+		u.renderBackendError(w, sess, err)
+		return
+	}
+	logger.Infof("Purchased from %s [%s] with price %.2f by %s on %s via web UI, ID=%d",
+		req.ShopName, req.Category, req.Price, sess.username, expenseDate.Format(dateFormat), id)
+	http.Redirect(w, r, "/ui/expenses", http.StatusSeeOther)
+}
+
+func (u *UI) editExpense(w http.ResponseWriter, r *http.Request, sess session) {
+	id, err := parseID(r)
+	if err != nil {
+		u.renderError(w, http.StatusBadRequest, sess, err.Error())
+		return
+	}
+
+	expense, err := u.backend.GetExpenseByID(r.Context(), id)
+	if err == nil && expense.Username != sess.username {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		u.renderBackendError(w, sess, err)
+		return
+	}
+	u.render(w, http.StatusOK, "expense_edit", pageVars{
+		Title:    "Muokkaa ostoa",
+		Username: sess.username,
+		CSRF:     sess.csrf,
+		Data:     expense,
+	})
+}
+
+func (u *UI) updateExpense(w http.ResponseWriter, r *http.Request, sess session) {
+	id, err := parseID(r)
+	if err != nil {
+		u.renderError(w, http.StatusBadRequest, sess, err.Error())
+		return
+	}
+	req, expenseDate, err := parseExpenseForm(r)
+	if err != nil {
+		u.renderError(w, http.StatusBadRequest, sess, err.Error())
+		return
+	}
+
+	if _, err = u.backend.UpdateExpenseByID(
+		r.Context(), id, sess.username, req.ShopName, req.Category, expenseDate, req.Price); err != nil {
+		u.renderBackendError(w, sess, err)
+		return
+	}
+	logger.Infof("Updated expense ID=%d by %s via web UI", id, sess.username)
+	http.Redirect(w, r, "/ui/expenses", http.StatusSeeOther)
+}
+
+func (u *UI) deleteExpense(w http.ResponseWriter, r *http.Request, sess session) {
+	id, err := parseID(r)
+	if err != nil {
+		u.renderError(w, http.StatusBadRequest, sess, err.Error())
+		return
+	}
+
+	expense, err := u.backend.DeleteExpenseByID(r.Context(), id, sess.username)
+	if err != nil {
+		u.renderBackendError(w, sess, err)
+		return
+	}
+	logger.Infof("Removed expense item ID=%d %s %.2f€ [%s] by %s via web UI",
+		expense.ID, expense.ShopName, expense.Price, expense.ExpenseDate, sess.username)
+	http.Redirect(w, r, "/ui/expenses", http.StatusSeeOther)
+}
+
+func (u *UI) listSalaries(w http.ResponseWriter, r *http.Request, sess session) {
+	offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 32)
+	offset = max(offset, 0)
+
+	salaries, err := u.backend.ListSalaries(r.Context(), dbengine.Filter{}, uiPageLimit, int32(offset))
+	if err != nil {
+		u.renderBackendError(w, sess, err)
+		return
+	}
+
+	vars := salariesVars{
+		Month:    time.Now().Format(monthFormat),
+		Salaries: salaries,
+	}
+	vars.PrevURL, vars.NextURL = pagination(r, int32(offset), len(salaries))
+	u.render(w, http.StatusOK, "salaries", pageVars{
+		Title:    "Palkat",
+		Username: sess.username,
+		CSRF:     sess.csrf,
+		Data:     vars,
+	})
+}
+
+// parseSalaryForm parses the salary and its month, which is stored as
+// the first day of the month like the bot does
+func parseSalaryForm(r *http.Request) (float64, time.Time, error) {
+	salary, err := parseAmount(r.PostFormValue("salary"))
+	if err != nil {
+		return 0, time.Time{}, errors.New("virheellinen palkka")
+	}
+	storeDate, err := time.Parse(monthFormat, r.PostFormValue("store_date"))
+	if err != nil {
+		return 0, time.Time{}, errors.New("virheellinen kuukausi")
+	}
+	return salary, storeDate, nil
+}
+
+func (u *UI) createSalary(w http.ResponseWriter, r *http.Request, sess session) {
+	salary, storeDate, err := parseSalaryForm(r)
+	if err != nil {
+		u.renderError(w, http.StatusBadRequest, sess, err.Error())
+		return
+	}
+
+	id, err := u.backend.AddSalary(r.Context(), sess.username, salary, storeDate)
+	if err != nil {
+		u.renderBackendError(w, sess, err)
+		return
+	}
+	logger.Infof("Inserted salary amount of %.2f by %s on %s via web UI, ID=%d",
+		salary, sess.username, storeDate.Format(monthFormat), id)
+	http.Redirect(w, r, "/ui/salaries", http.StatusSeeOther)
+}
+
+func (u *UI) editSalary(w http.ResponseWriter, r *http.Request, sess session) {
+	id, err := parseID(r)
+	if err != nil {
+		u.renderError(w, http.StatusBadRequest, sess, err.Error())
+		return
+	}
+
+	salary, err := u.backend.GetSalaryByID(r.Context(), id)
+	if err == nil && salary.Username != sess.username {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		u.renderBackendError(w, sess, err)
+		return
+	}
+	u.render(w, http.StatusOK, "salary_edit", pageVars{
+		Title:    "Muokkaa palkkaa",
+		Username: sess.username,
+		CSRF:     sess.csrf,
+		Data:     salary,
+	})
+}
+
+func (u *UI) updateSalary(w http.ResponseWriter, r *http.Request, sess session) {
+	id, err := parseID(r)
+	if err != nil {
+		u.renderError(w, http.StatusBadRequest, sess, err.Error())
+		return
+	}
+	salary, storeDate, err := parseSalaryForm(r)
+	if err != nil {
+		u.renderError(w, http.StatusBadRequest, sess, err.Error())
+		return
+	}
+
+	if _, err = u.backend.UpdateSalaryByID(r.Context(), id, sess.username, salary, storeDate); err != nil {
+		u.renderBackendError(w, sess, err)
+		return
+	}
+	logger.Infof("Updated salary ID=%d by %s via web UI", id, sess.username)
+	http.Redirect(w, r, "/ui/salaries", http.StatusSeeOther)
+}
+
+func (u *UI) deleteSalary(w http.ResponseWriter, r *http.Request, sess session) {
+	id, err := parseID(r)
+	if err != nil {
+		u.renderError(w, http.StatusBadRequest, sess, err.Error())
+		return
+	}
+
+	salary, err := u.backend.DeleteSalaryByID(r.Context(), id, sess.username)
+	if err != nil {
+		u.renderBackendError(w, sess, err)
+		return
+	}
+	logger.Infof("Removed salary item ID=%d %s %.2f by %s via web UI",
+		salary.ID, salary.StoreDate, salary.Salary, sess.username)
+	http.Redirect(w, r, "/ui/salaries", http.StatusSeeOther)
+}
+
+// stats shows the month selection, or the statistics page once months are selected
+func (u *UI) stats(w http.ResponseWriter, r *http.Request, sess session) {
+	q := r.URL.Query()
+	if q.Get("from") == "" || q.Get("to") == "" {
+		now := time.Now()
+		u.render(w, http.StatusOK, "stats", pageVars{
+			Title:    "Tilastot",
+			Username: sess.username,
+			CSRF:     sess.csrf,
+			Data: map[string]string{
+				"From": now.AddDate(0, -2, 0).Format(monthFormat),
+				"To":   now.Format(monthFormat),
+			},
+		})
+		return
+	}
+
+	from, to, err := parseMonths(r)
+	if err != nil {
+		u.renderError(w, http.StatusBadRequest, sess, err.Error())
+		return
+	}
+	statsVars, err := u.loadStats(r.Context(), from, to, uiTopShopsCount)
+	if err != nil {
+		logger.Error(err)
+		u.renderError(w, http.StatusInternalServerError, sess, "virhe, ei saatu tilastoja")
+		return
+	}
+	page, err := outputs.RenderStatsHTML(statsVars)
+	if err != nil {
+		logger.Error(err)
+		u.renderError(w, http.StatusInternalServerError, sess, "virhe, HTML sivun muodostus epäonnistui")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := w.Write(page); err != nil {
+		logger.Errorf("couldn't write stats page: %s", err)
+	}
+}
+
+// LoginURL returns the one-time login link of the web UI
+func LoginURL(hostname, token string) string {
+	return fmt.Sprintf("https://%s/ui/login?token=%s", hostname, url.QueryEscape(token))
+}
+
+// listAuditLog shows the changes of expenses and salaries, newest first
+func (u *UI) listAuditLog(w http.ResponseWriter, r *http.Request, sess session) {
+	offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 32)
+	offset = max(offset, 0)
+
+	entries, err := u.backend.ListAuditLog(r.Context(), uiPageLimit, int32(offset))
+	if err != nil {
+		u.renderBackendError(w, sess, err)
+		return
+	}
+
+	vars := auditVars{Entries: entries}
+	vars.PrevURL, vars.NextURL = pagination(r, int32(offset), len(entries))
+	u.render(w, http.StatusOK, "audit", pageVars{
+		Title:    "Muutokset",
+		Username: sess.username,
+		CSRF:     sess.csrf,
+		Data:     vars,
+	})
+}
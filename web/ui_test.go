@@ -0,0 +1,403 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"weezel/budget/blobstore"
+	"weezel/budget/db"
+	"weezel/budget/dbengine"
+	"weezel/budget/outputs"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type uiTest struct {
+	ui       *UI
+	mux      *http.ServeMux
+	backend  *fakeBackend
+	receipts *blobstore.FS
+}
+
+func newUITest(t *testing.T, loadStats StatsLoader) uiTest {
+	t.Helper()
+	backend := &fakeBackend{}
+	receipts, err := blobstore.NewFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ui, err := NewUI(backend, loadStats, "budgetbot", "123456:abcdef", []string{"alice", "bob"}, receipts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	ui.Register(mux)
+	return uiTest{ui: ui, mux: mux, backend: backend, receipts: receipts}
+}
+
+func (u uiTest) do(method, target string, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+	var req *http.Request
+	if form != nil {
+		req = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(method, target, nil)
+	}
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	u.mux.ServeHTTP(rec, req)
+	return rec
+}
+
+// login signs in with a one-time link and returns the session cookie and CSRF token
+func (u uiTest) login(t *testing.T, username string) (*http.Cookie, string) {
+	t.Helper()
+	token := issuedLoginTokens.Issue(username, time.Now())
+	rec := u.do(http.MethodPost, "/ui/login/link", url.Values{"token": {token}}, nil)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("login: got status %d", rec.Code)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookie || !cookies[0].HttpOnly {
+		t.Fatalf("login: got cookies %v", cookies)
+	}
+	sess, ok := u.ui.sessions.Get(cookies[0].Value, time.Now())
+	if !ok || sess.username != username {
+		t.Fatalf("login: session = %+v, %t", sess, ok)
+	}
+	return cookies[0], sess.csrf
+}
+
+func TestUILogin(t *testing.T) {
+	ut := newUITest(t, nil)
+
+	rec := ut.do(http.MethodGet, "/ui/expenses", nil, nil)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/ui/login" {
+		t.Errorf("without session: got status %d to %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	// Viewing the link must not redeem the token
+	token := issuedLoginTokens.Issue("alice", time.Now())
+	rec = ut.do(http.MethodGet, "/ui/login?token="+token, nil, nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), token) {
+		t.Errorf("login link: got status %d", rec.Code)
+	}
+	rec = ut.do(http.MethodPost, "/ui/login/link", url.Values{"token": {token}}, nil)
+	if rec.Code != http.StatusSeeOther {
+		t.Errorf("redeem: got status %d", rec.Code)
+	}
+	rec = ut.do(http.MethodPost, "/ui/login/link", url.Values{"token": {token}}, nil)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("redeem twice: got status %d", rec.Code)
+	}
+
+	token = issuedLoginTokens.Issue("mallory", time.Now())
+	rec = ut.do(http.MethodPost, "/ui/login/link", url.Values{"token": {token}}, nil)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("unknown user: got status %d", rec.Code)
+	}
+}
+
+func TestUILoginWithTelegram(t *testing.T) {
+	ut := newUITest(t, nil)
+
+	tests := []struct {
+		name     string
+		username string
+		status   int
+	}{
+		{"Allowed user", "bob", http.StatusSeeOther},
+		{"Unknown user", "mallory", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := url.Values{
+				"id":        {"42"},
+				"username":  {tt.username},
+				"auth_date": {strconv.FormatInt(time.Now().Unix(), 10)},
+			}
+			signTelegramLogin(values, "123456:abcdef")
+			rec := ut.do(http.MethodGet, "/ui/login/telegram?"+values.Encode(), nil, nil)
+			if rec.Code != tt.status {
+				t.Errorf("got status %d, expected %d", rec.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestUIExpenses(t *testing.T) {
+	ut := newUITest(t, nil)
+	cookie, csrf := ut.login(t, "alice")
+
+	form := url.Values{
+		"shop_name":    {"Kauppa"},
+		"category":     {"#Ruoka"},
+		"expense_date": {"2023-02-03"},
+		"price":        {"12,50"},
+	}
+	rec := ut.do(http.MethodPost, "/ui/expenses", form, cookie)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("without CSRF token: got status %d", rec.Code)
+	}
+
+	form.Set("csrf", csrf)
+	rec = ut.do(http.MethodPost, "/ui/expenses", form, cookie)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("create: got status %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(ut.backend.expenses) != 1 {
+		t.Fatalf("create: got %d expenses", len(ut.backend.expenses))
+	}
+	got := ut.backend.expenses[0]
+	if got.Username != "alice" || got.Category != "ruoka" || got.Price != 12.5 {
+		t.Errorf("create: got %+v", got)
+	}
+
+	rec = ut.do(http.MethodGet, "/ui/expenses?sort=-price", nil, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list: got status %d", rec.Code)
+	}
+	if ut.backend.lastFilter.Sort != "-price" {
+		t.Errorf("list: got sort %q", ut.backend.lastFilter.Sort)
+	}
+	for _, expected := range []string{"Kauppa", "12.50", "/ui/expenses/1/edit"} {
+		if !strings.Contains(rec.Body.String(), expected) {
+			t.Errorf("list: %q is missing", expected)
+		}
+	}
+
+	rec = ut.do(http.MethodGet, "/ui/expenses?sort=password", nil, cookie)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("list with unknown sort: got status %d", rec.Code)
+	}
+
+	// Other users can see but not edit
+	bobCookie, bobCSRF := ut.login(t, "bob")
+	rec = ut.do(http.MethodGet, "/ui/expenses", nil, bobCookie)
+	if strings.Contains(rec.Body.String(), "/ui/expenses/1/edit") {
+		t.Errorf("list: edit link shown to other user")
+	}
+	rec = ut.do(http.MethodGet, "/ui/expenses/1/edit", nil, bobCookie)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("edit by other user: got status %d", rec.Code)
+	}
+	rec = ut.do(http.MethodPost, "/ui/expenses/1/delete", url.Values{"csrf": {bobCSRF}}, bobCookie)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("delete by other user: got status %d", rec.Code)
+	}
+
+	for _, price := range []string{"0", "-5", "NaN", "Inf"} {
+		form.Set("price", price)
+		rec = ut.do(http.MethodPost, "/ui/expenses", form, cookie)
+		if rec.Code != http.StatusBadRequest || len(ut.backend.expenses) != 1 {
+			t.Errorf("create with price %s: got status %d", price, rec.Code)
+		}
+		rec = ut.do(http.MethodPost, "/ui/expenses/1", form, cookie)
+		if rec.Code != http.StatusBadRequest || got.Price != 12.5 {
+			t.Errorf("update with price %s: got status %d", price, rec.Code)
+		}
+	}
+
+	form.Set("price", "13")
+	rec = ut.do(http.MethodPost, "/ui/expenses/1", form, cookie)
+	if rec.Code != http.StatusSeeOther || got.Price != 13 {
+		t.Errorf("update: got status %d and price %.2f", rec.Code, got.Price)
+	}
+
+	rec = ut.do(http.MethodPost, "/ui/expenses/1/delete", url.Values{"csrf": {csrf}}, cookie)
+	if rec.Code != http.StatusSeeOther || len(ut.backend.expenses) != 0 {
+		t.Errorf("delete: got status %d", rec.Code)
+	}
+
+	rec = ut.do(http.MethodPost, "/ui/logout", url.Values{"csrf": {csrf}}, cookie)
+	if rec.Code != http.StatusSeeOther {
+		t.Errorf("logout: got status %d", rec.Code)
+	}
+	rec = ut.do(http.MethodGet, "/ui/expenses", nil, cookie)
+	if rec.Code != http.StatusSeeOther {
+		t.Errorf("after logout: got status %d", rec.Code)
+	}
+}
+
+func TestUISalaries(t *testing.T) {
+	ut := newUITest(t, nil)
+	cookie, csrf := ut.login(t, "bob")
+
+	rec := ut.do(http.MethodPost, "/ui/salaries", url.Values{
+		"csrf":       {csrf},
+		"store_date": {"2023-01"},
+		"salary":     {"3000"},
+	}, cookie)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("create: got status %d", rec.Code)
+	}
+	expected := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	if got := ut.backend.salaries[0]; got.Salary != 3000 || !got.StoreDate.Equal(expected) {
+		t.Errorf("create: got %+v", got)
+	}
+
+	for _, salary := range []string{"-1", "NaN", "+Inf"} {
+		rec = ut.do(http.MethodPost, "/ui/salaries", url.Values{
+			"csrf":       {csrf},
+			"store_date": {"2023-01"},
+			"salary":     {salary},
+		}, cookie)
+		if rec.Code != http.StatusBadRequest || len(ut.backend.salaries) != 1 {
+			t.Errorf("salary %s: got status %d", salary, rec.Code)
+		}
+	}
+
+	rec = ut.do(http.MethodGet, "/ui/salaries", nil, cookie)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "3000.00") {
+		t.Errorf("list: got status %d", rec.Code)
+	}
+}
+
+func TestUIAuditLog(t *testing.T) {
+	ut := newUITest(t, nil)
+	cookie, _ := ut.login(t, "alice")
+	ut.backend.audit = []*db.BudgetSchemaAuditLog{{
+		ID:        1,
+		ChangedAt: time.Date(2023, 1, 2, 15, 4, 0, 0, time.UTC),
+		Actor:     "alice",
+		Source:    dbengine.SourceBot,
+		Action:    dbengine.ActionDelete,
+		TableName: dbengine.TableExpense,
+		RowID:     7,
+		BeforeRow: []byte(`{"id":7,"shop_name":"Lidl"}`),
+		AfterRow:  []byte("null"),
+	}}
+
+	rec := ut.do(http.MethodGet, "/ui/audit?offset=50", nil, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"02-01-2023 15:04", "poisto", "expense", "Lidl", "Edelliset"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("%q is missing from the page", want)
+		}
+	}
+	if ut.backend.lastLimit != uiPageLimit || ut.backend.lastOffset != 50 {
+		t.Errorf("got limit %d, offset %d", ut.backend.lastLimit, ut.backend.lastOffset)
+	}
+}
+
+func TestUIReceipts(t *testing.T) {
+	ctx := context.Background()
+	ut := newUITest(t, nil)
+	cookie, csrf := ut.login(t, "alice")
+	photo := []byte("\x89PNG\r\n\x1a\nkuitti")
+	hash, err := ut.receipts.Put(ctx, photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Stored but not attached to any expense
+	unattached, err := ut.receipts.Put(ctx, []byte("\x89PNG\r\n\x1a\nmuu"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ut.backend.expenses = []*db.BudgetSchemaExpense{{
+		ID:          3,
+		Username:    "alice",
+		ShopName:    "Lidl",
+		ExpenseDate: time.Date(2023, 2, 3, 0, 0, 0, 0, time.UTC),
+		Price:       10.5,
+	}}
+	ut.backend.attachments = []*db.BudgetSchemaAttachment{{
+		ID:          1,
+		ExpenseID:   3,
+		Hash:        hash,
+		ContentType: "image/png",
+		SizeBytes:   int64(len(photo)),
+	}}
+
+	rec := ut.do(http.MethodGet, "/ui/expenses", nil, cookie)
+	if !strings.Contains(rec.Body.String(), "/ui/receipts/"+hash) {
+		t.Errorf("link to the receipt is missing from the list")
+	}
+
+	rec = ut.do(http.MethodGet, "/ui/receipts/"+hash, nil, nil)
+	if rec.Code != http.StatusSeeOther {
+		t.Errorf("without session: got status %d", rec.Code)
+	}
+	rec = ut.do(http.MethodGet, "/ui/receipts/"+hash, nil, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d", rec.Code)
+	}
+	if rec.Header().Get("Content-Type") != "image/png" || rec.Body.String() != string(photo) {
+		t.Errorf("got %q: %q", rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+
+	for _, target := range []string{"/ui/receipts/" + unattached, "/ui/receipts/..%2Fsecret"} {
+		rec = ut.do(http.MethodGet, target, nil, cookie)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: got status %d", target, rec.Code)
+		}
+	}
+
+	// Receipt of a deleted expense isn't shown
+	rec = ut.do(http.MethodPost, "/ui/expenses/3/delete", url.Values{"csrf": {csrf}}, cookie)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("delete: got status %d", rec.Code)
+	}
+	rec = ut.do(http.MethodGet, "/ui/receipts/"+hash, nil, cookie)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("deleted expense: got status %d", rec.Code)
+	}
+}
+
+func TestUIStats(t *testing.T) {
+	var gotFrom, gotTo time.Time
+	ut := newUITest(t, func(_ context.Context, from, to time.Time, _ int32) (outputs.StatisticsVars, error) {
+		gotFrom, gotTo = from, to
+		return outputs.StatisticsVars{From: from, To: to}, nil
+	})
+	cookie, _ := ut.login(t, "alice")
+
+	rec := ut.do(http.MethodGet, "/ui/stats", nil, cookie)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `type="month"`) {
+		t.Errorf("form: got status %d", rec.Code)
+	}
+
+	rec = ut.do(http.MethodGet, "/ui/stats?from=2023-01&to=2023-03", nil, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("stats: got status %d", rec.Code)
+	}
+	if diff := cmp.Diff(
+		[]time.Time{time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)},
+		[]time.Time{gotFrom, gotTo},
+	); diff != "" {
+		t.Errorf("stats: months differ:\n%s", diff)
+	}
+}
+
+func TestSortColumns(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/ui/expenses?sort=price&offset=50&category=ruoka", nil)
+	columns := sortColumns(req, "price")
+
+	got := []string{}
+	for _, c := range columns {
+		got = append(got, c.URL)
+	}
+	expected := []string{
+		"/ui/expenses?category=ruoka&sort=date",
+		"/ui/expenses?category=ruoka&sort=shop",
+		"/ui/expenses?category=ruoka&sort=category",
+		"/ui/expenses?category=ruoka&sort=username",
+		"/ui/expenses?category=ruoka&sort=-price",
+	}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("differs:\n%s", diff)
+	}
+	if !columns[4].Active || columns[4].Desc {
+		t.Errorf("price column: %+v", columns[4])
+	}
+}